@@ -0,0 +1,55 @@
+// Package broker connects goroom nodes so that users on different instances
+// can be matched with and message each other.
+package broker
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrClosed is returned when using a broker after Close
+var ErrClosed = errors.New("broker closed")
+
+// Broker provides cross-node pub/sub, shared queues, hashes and locks
+type Broker interface {
+	// Publish sends a payload to every current subscriber of the channel
+	Publish(ctx context.Context, channel string, payload []byte) error
+
+	// Subscribe delivers payloads published to the channel until ctx is done
+	Subscribe(ctx context.Context, channel string) (<-chan []byte, error)
+
+	// Push appends a member to the tail of a queue
+	Push(ctx context.Context, queue, member string) error
+
+	// Pop removes and returns the member at the head of a queue, ok is false if it is empty
+	Pop(ctx context.Context, queue string) (member string, ok bool, err error)
+
+	// Remove deletes every occurrence of a member from a queue
+	Remove(ctx context.Context, queue, member string) error
+
+	// Members returns the members of a queue from head to tail
+	Members(ctx context.Context, queue string) ([]string, error)
+
+	// Head returns up to n members from the head of a queue
+	Head(ctx context.Context, queue string, n int) ([]string, error)
+
+	// SetField sets a field of a hash
+	SetField(ctx context.Context, hash, field, value string) error
+
+	// Field returns the value of a hash field, ok is false if it isn't set
+	Field(ctx context.Context, hash, field string) (value string, ok bool, err error)
+
+	// DeleteField removes a field from a hash
+	DeleteField(ctx context.Context, hash, field string) error
+
+	// Fields returns every field of a hash
+	Fields(ctx context.Context, hash string) (map[string]string, error)
+
+	// Lock acquires a named lock that expires after ttl, waiting until ctx is done.
+	// The returned function releases it.
+	Lock(ctx context.Context, name string, ttl time.Duration) (func(), error)
+
+	// Close releases the broker's resources
+	Close() error
+}
@@ -0,0 +1,193 @@
+package broker
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+)
+
+// subscriberBuffer is how many payloads a slow subscriber may lag behind
+const subscriberBuffer = 256
+
+// MemoryBroker is an in-process broker for single-node deployments
+type MemoryBroker struct {
+	subscribers map[string][]chan []byte
+	queues      map[string][]string
+	hashes      map[string]map[string]string
+	locks       map[string]chan struct{}
+	closed      bool
+	mu          sync.Mutex
+}
+
+// NewMemoryBroker creates a new in-process broker
+func NewMemoryBroker() *MemoryBroker {
+	return &MemoryBroker{
+		subscribers: make(map[string][]chan []byte),
+		queues:      make(map[string][]string),
+		hashes:      make(map[string]map[string]string),
+		locks:       make(map[string]chan struct{}),
+		mu:          sync.Mutex{},
+	}
+}
+
+// Publish sends a payload to every current subscriber of the channel
+func (b *MemoryBroker) Publish(ctx context.Context, channel string, payload []byte) error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return ErrClosed
+	}
+	subscribers := slices.Clone(b.subscribers[channel])
+	b.mu.Unlock()
+
+	for _, subscriber := range subscribers {
+		select {
+		case subscriber <- payload:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// Subscribe delivers payloads published to the channel until ctx is done
+func (b *MemoryBroker) Subscribe(ctx context.Context, channel string) (<-chan []byte, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return nil, ErrClosed
+	}
+
+	subscriber := make(chan []byte, subscriberBuffer)
+	b.subscribers[channel] = append(b.subscribers[channel], subscriber)
+
+	go func() {
+		<-ctx.Done()
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		b.subscribers[channel] = slices.DeleteFunc(b.subscribers[channel], func(c chan []byte) bool {
+			return c == subscriber
+		})
+	}()
+	return subscriber, nil
+}
+
+// Push appends a member to the tail of a queue
+func (b *MemoryBroker) Push(ctx context.Context, queue, member string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.queues[queue] = append(b.queues[queue], member)
+	return nil
+}
+
+// Pop removes and returns the member at the head of a queue
+func (b *MemoryBroker) Pop(ctx context.Context, queue string) (string, bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	members := b.queues[queue]
+	if len(members) == 0 {
+		return "", false, nil
+	}
+	b.queues[queue] = members[1:]
+	return members[0], true, nil
+}
+
+// Remove deletes every occurrence of a member from a queue
+func (b *MemoryBroker) Remove(ctx context.Context, queue, member string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.queues[queue] = slices.DeleteFunc(b.queues[queue], func(m string) bool {
+		return m == member
+	})
+	return nil
+}
+
+// Members returns the members of a queue from head to tail
+func (b *MemoryBroker) Members(ctx context.Context, queue string) ([]string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return slices.Clone(b.queues[queue]), nil
+}
+
+// Head returns up to n members from the head of a queue
+func (b *MemoryBroker) Head(ctx context.Context, queue string, n int) ([]string, error) {
+	if n <= 0 {
+		return nil, nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	members := b.queues[queue]
+	return slices.Clone(members[:min(n, len(members))]), nil
+}
+
+// SetField sets a field of a hash
+func (b *MemoryBroker) SetField(ctx context.Context, hash, field, value string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	fields, ok := b.hashes[hash]
+	if !ok {
+		fields = make(map[string]string)
+		b.hashes[hash] = fields
+	}
+	fields[field] = value
+	return nil
+}
+
+// Field returns the value of a hash field
+func (b *MemoryBroker) Field(ctx context.Context, hash, field string) (string, bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	value, ok := b.hashes[hash][field]
+	return value, ok, nil
+}
+
+// DeleteField removes a field from a hash
+func (b *MemoryBroker) DeleteField(ctx context.Context, hash, field string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.hashes[hash], field)
+	// Empty hashes disappear, as in Redis
+	if len(b.hashes[hash]) == 0 {
+		delete(b.hashes, hash)
+	}
+	return nil
+}
+
+// Fields returns every field of a hash
+func (b *MemoryBroker) Fields(ctx context.Context, hash string) (map[string]string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return maps.Clone(b.hashes[hash]), nil
+}
+
+// Lock acquires a named lock. In a single process there is no holder that
+// could crash, so the ttl is not needed.
+func (b *MemoryBroker) Lock(ctx context.Context, name string, ttl time.Duration) (func(), error) {
+	b.mu.Lock()
+	lock, ok := b.locks[name]
+	if !ok {
+		lock = make(chan struct{}, 1)
+		b.locks[name] = lock
+	}
+	b.mu.Unlock()
+
+	select {
+	case lock <- struct{}{}:
+		return func() { <-lock }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Close stops accepting publications and subscriptions
+func (b *MemoryBroker) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	return nil
+}
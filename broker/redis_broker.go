@@ -0,0 +1,404 @@
+package broker
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"realTimeService/broker/internal/resp"
+	"realTimeService/logging"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// dialTimeout bounds connecting to the Redis server
+	dialTimeout = 5 * time.Second
+	// lockRetryInterval is how long Lock waits between attempts
+	lockRetryInterval = 10 * time.Millisecond
+	// resubscribeDelay is how long a dropped subscription waits before reconnecting
+	resubscribeDelay = time.Second
+	// maxIdleConns is how many command connections are kept open between commands
+	maxIdleConns = 8
+)
+
+// unlockScript deletes a lock only if it still holds the caller's token, so a lock
+// that expired and was taken over is left alone. Running it server-side makes the
+// check and the delete a single atomic step.
+const unlockScript = `if redis.call("GET", KEYS[1]) == ARGV[1] then return redis.call("DEL", KEYS[1]) else return 0 end`
+
+// RedisBroker is a broker backed by any server speaking the Redis protocol.
+// Commands run concurrently on a pool of connections, each subscription gets its own.
+type RedisBroker struct {
+	addr     string
+	password string
+	idle     []*redisConn // command connections not in use, dialled lazily
+	closed   bool
+	cancel   context.CancelFunc
+	ctx      context.Context
+	mu       sync.Mutex // guards idle and closed, never held during I/O
+}
+
+// redisConn is a single connection to the server
+type redisConn struct {
+	net.Conn
+	reader *bufio.Reader
+	writer *bufio.Writer
+}
+
+// NewRedisBroker creates a broker for the Redis server at addr. No connection
+// is made until the broker is first used.
+func NewRedisBroker(addr, password string) *RedisBroker {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &RedisBroker{
+		addr:     addr,
+		password: password,
+		ctx:      ctx,
+		cancel:   cancel,
+		mu:       sync.Mutex{},
+	}
+}
+
+// Ping checks that the server is reachable
+func (b *RedisBroker) Ping(ctx context.Context) error {
+	_, err := b.do(ctx, "PING")
+	return err
+}
+
+// Publish sends a payload to every current subscriber of the channel
+func (b *RedisBroker) Publish(ctx context.Context, channel string, payload []byte) error {
+	_, err := b.do(ctx, "PUBLISH", channel, string(payload))
+	return err
+}
+
+// Subscribe delivers payloads published to the channel until ctx is done.
+// A dropped subscription is re-established in the background.
+func (b *RedisBroker) Subscribe(ctx context.Context, channel string) (<-chan []byte, error) {
+	// The subscription ends with the subscriber or the broker, whichever is done first
+	ctx, cancel := context.WithCancel(ctx)
+	stopCancel := context.AfterFunc(b.ctx, cancel)
+
+	conn, err := b.subscribe(ctx, channel)
+	if err != nil {
+		stopCancel()
+		cancel()
+		return nil, err
+	}
+
+	out := make(chan []byte, subscriberBuffer)
+	go func() {
+		defer close(out)
+		defer cancel()
+		defer stopCancel()
+		for {
+			// Unblock the reader once the subscription ends, for this connection only
+			stopClose := context.AfterFunc(ctx, func() { conn.Close() })
+			b.readSubscription(ctx, conn, out)
+			stopClose()
+			conn.Close()
+
+			// Reconnect until the subscriber or the broker is done
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(resubscribeDelay):
+				}
+				if conn, err = b.subscribe(ctx, channel); err == nil {
+					break
+				}
+				slog.Warn("Redis resubscribe failed", "channel", channel, logging.Err(err))
+			}
+		}
+	}()
+	return out, nil
+}
+
+// Push appends a member to the tail of a queue
+func (b *RedisBroker) Push(ctx context.Context, queue, member string) error {
+	_, err := b.do(ctx, "RPUSH", queue, member)
+	return err
+}
+
+// Pop removes and returns the member at the head of a queue
+func (b *RedisBroker) Pop(ctx context.Context, queue string) (string, bool, error) {
+	reply, err := b.do(ctx, "LPOP", queue)
+	if err != nil {
+		return "", false, err
+	}
+	member, ok := reply.([]byte)
+	if !ok || member == nil {
+		return "", false, nil
+	}
+	return string(member), true, nil
+}
+
+// Remove deletes every occurrence of a member from a queue
+func (b *RedisBroker) Remove(ctx context.Context, queue, member string) error {
+	_, err := b.do(ctx, "LREM", queue, "0", member)
+	return err
+}
+
+// Members returns the members of a queue from head to tail
+func (b *RedisBroker) Members(ctx context.Context, queue string) ([]string, error) {
+	return b.lrange(ctx, queue, -1)
+}
+
+// Head returns up to n members from the head of a queue
+func (b *RedisBroker) Head(ctx context.Context, queue string, n int) ([]string, error) {
+	if n <= 0 {
+		return nil, nil
+	}
+	return b.lrange(ctx, queue, n-1)
+}
+
+// lrange returns the members of a queue from the head up to index stop, -1 being the tail
+func (b *RedisBroker) lrange(ctx context.Context, queue string, stop int) ([]string, error) {
+	reply, err := b.do(ctx, "LRANGE", queue, "0", strconv.Itoa(stop))
+	if err != nil {
+		return nil, err
+	}
+	items, _ := reply.([]any)
+	members := make([]string, len(items))
+	for i, item := range items {
+		members[i] = string(asBytes(item))
+	}
+	return members, nil
+}
+
+// SetField sets a field of a hash
+func (b *RedisBroker) SetField(ctx context.Context, hash, field, value string) error {
+	_, err := b.do(ctx, "HSET", hash, field, value)
+	return err
+}
+
+// Field returns the value of a hash field
+func (b *RedisBroker) Field(ctx context.Context, hash, field string) (string, bool, error) {
+	reply, err := b.do(ctx, "HGET", hash, field)
+	if err != nil {
+		return "", false, err
+	}
+	value, ok := reply.([]byte)
+	if !ok || value == nil {
+		return "", false, nil
+	}
+	return string(value), true, nil
+}
+
+// DeleteField removes a field from a hash
+func (b *RedisBroker) DeleteField(ctx context.Context, hash, field string) error {
+	_, err := b.do(ctx, "HDEL", hash, field)
+	return err
+}
+
+// Fields returns every field of a hash
+func (b *RedisBroker) Fields(ctx context.Context, hash string) (map[string]string, error) {
+	reply, err := b.do(ctx, "HGETALL", hash)
+	if err != nil {
+		return nil, err
+	}
+
+	// The reply alternates field names and values
+	items, _ := reply.([]any)
+	fields := make(map[string]string, len(items)/2)
+	for i := 0; i+1 < len(items); i += 2 {
+		fields[string(asBytes(items[i]))] = string(asBytes(items[i+1]))
+	}
+	return fields, nil
+}
+
+// Lock acquires a named lock that expires after ttl, so a crashed holder cannot block others forever
+func (b *RedisBroker) Lock(ctx context.Context, name string, ttl time.Duration) (func(), error) {
+	tokenBytes := make([]byte, 16)
+	if _, err := rand.Read(tokenBytes); err != nil {
+		return nil, err
+	}
+	token := hex.EncodeToString(tokenBytes)
+	ttlMillis := strconv.FormatInt(ttl.Milliseconds(), 10)
+
+	for {
+		reply, err := b.do(ctx, "SET", name, token, "NX", "PX", ttlMillis)
+		if err != nil {
+			return nil, err
+		}
+		if reply == "OK" {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(lockRetryInterval):
+		}
+	}
+
+	return func() {
+		// Only release the lock if it wasn't taken over after expiring
+		unlockCtx, cancel := context.WithTimeout(context.Background(), dialTimeout)
+		defer cancel()
+		if _, err := b.do(unlockCtx, "EVAL", unlockScript, "1", name, token); err != nil {
+			slog.Warn("Redis unlock failed, the lock expires on its own", "lock", name, logging.Err(err))
+		}
+	}, nil
+}
+
+// Close closes every connection of the broker
+func (b *RedisBroker) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+	b.cancel()
+	var err error
+	for _, conn := range b.idle {
+		err = errors.Join(err, conn.Close())
+	}
+	b.idle = nil
+	return err
+}
+
+// do runs a command on a pooled connection, so slow commands don't hold up others
+func (b *RedisBroker) do(ctx context.Context, args ...string) (any, error) {
+	conn, err := b.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	} else {
+		conn.SetDeadline(time.Time{})
+	}
+
+	reply, err := conn.roundTrip(args...)
+	if err != nil {
+		// The connection state is unknown, it is not reused
+		conn.Close()
+		return nil, fmt.Errorf("redis %s: %w", args[0], err)
+	}
+	b.release(conn)
+	if replyErr, ok := reply.(resp.Error); ok {
+		return nil, fmt.Errorf("redis %s: %w", args[0], replyErr)
+	}
+	return reply, nil
+}
+
+// acquire takes an idle command connection or dials a new one
+func (b *RedisBroker) acquire(ctx context.Context) (*redisConn, error) {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return nil, ErrClosed
+	}
+	if n := len(b.idle); n > 0 {
+		conn := b.idle[n-1]
+		b.idle = b.idle[:n-1]
+		b.mu.Unlock()
+		return conn, nil
+	}
+	b.mu.Unlock()
+	return b.dial(ctx)
+}
+
+// release returns a healthy connection to the pool, closing it if the pool is full
+func (b *RedisBroker) release(conn *redisConn) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed || len(b.idle) >= maxIdleConns {
+		conn.Close()
+		return
+	}
+	b.idle = append(b.idle, conn)
+}
+
+// dial opens and authenticates a new connection
+func (b *RedisBroker) dial(ctx context.Context) (*redisConn, error) {
+	dialer := net.Dialer{Timeout: dialTimeout}
+	netConn, err := dialer.DialContext(ctx, "tcp", b.addr)
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to redis at %s: %w", b.addr, err)
+	}
+
+	conn := &redisConn{
+		Conn:   netConn,
+		reader: bufio.NewReader(netConn),
+		writer: bufio.NewWriter(netConn),
+	}
+	if b.password != "" {
+		reply, err := conn.roundTrip("AUTH", b.password)
+		if err == nil {
+			if replyErr, ok := reply.(resp.Error); ok {
+				err = replyErr
+			}
+		}
+		if err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("redis auth failed: %w", err)
+		}
+	}
+	return conn, nil
+}
+
+// subscribe opens a dedicated connection subscribed to a channel
+func (b *RedisBroker) subscribe(ctx context.Context, channel string) (*redisConn, error) {
+	conn, err := b.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// The first reply confirms the subscription
+	if _, err := conn.roundTrip("SUBSCRIBE", channel); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("redis subscribe to %s: %w", channel, err)
+	}
+	return conn, nil
+}
+
+// readSubscription forwards published payloads until the connection fails
+func (b *RedisBroker) readSubscription(ctx context.Context, conn *redisConn, out chan<- []byte) {
+	for {
+		reply, err := resp.ReadValue(conn.reader)
+		if err != nil {
+			if ctx.Err() == nil {
+				slog.Warn("Redis subscription read error", logging.Err(err))
+			}
+			return
+		}
+
+		// Published messages arrive as ["message", channel, payload]
+		parts, ok := reply.([]any)
+		if !ok || len(parts) != 3 || string(asBytes(parts[0])) != "message" {
+			continue
+		}
+		select {
+		case out <- asBytes(parts[2]):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// roundTrip writes a command and reads its reply
+func (c *redisConn) roundTrip(args ...string) (any, error) {
+	if err := resp.WriteCommand(c.writer, args...); err != nil {
+		return nil, err
+	}
+	return resp.ReadValue(c.reader)
+}
+
+// asBytes converts a bulk or simple string reply to bytes
+func asBytes(reply any) []byte {
+	switch v := reply.(type) {
+	case []byte:
+		return v
+	case string:
+		return []byte(v)
+	default:
+		return nil
+	}
+}
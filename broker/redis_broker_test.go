@@ -0,0 +1,247 @@
+package broker_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"realTimeService/broker"
+	"realTimeService/broker/redistest"
+	"realTimeService/models"
+	"realTimeService/services"
+
+	"github.com/google/uuid"
+)
+
+// scores is a reputation source with fixed scores, 0 for anyone else
+type scores map[uuid.UUID]float64
+
+func (s scores) Score(userId uuid.UUID) float64 {
+	return s[userId]
+}
+
+// newRedisBroker starts a redistest server and a broker connected to it
+func newRedisBroker(t *testing.T) (*broker.RedisBroker, *redistest.Server) {
+	t.Helper()
+	server, err := redistest.NewServer()
+	if err != nil {
+		t.Fatalf("starting redistest server: %v", err)
+	}
+	b := broker.NewRedisBroker(server.Addr(), "")
+	t.Cleanup(func() {
+		b.Close()
+		server.Close()
+	})
+	return b, server
+}
+
+// receive waits for the next payload of a subscription
+func receive(t *testing.T, sub <-chan []byte) string {
+	t.Helper()
+	select {
+	case payload, ok := <-sub:
+		if !ok {
+			t.Fatal("subscription closed")
+		}
+		return string(payload)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a payload")
+		return ""
+	}
+}
+
+func TestRedisBrokerPublishSubscribe(t *testing.T) {
+	b, _ := newRedisBroker(t)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	sub, err := b.Subscribe(ctx, "events")
+	if err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+	if err := b.Publish(ctx, "events", []byte("hello")); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	if got := receive(t, sub); got != "hello" {
+		t.Fatalf("got %q, want %q", got, "hello")
+	}
+
+	// Ending the subscriber closes the channel
+	cancel()
+	select {
+	case _, ok := <-sub:
+		if ok {
+			t.Fatal("got a payload after cancelling")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("subscription not closed after cancelling")
+	}
+}
+
+func TestRedisBrokerResubscribe(t *testing.T) {
+	b, server := newRedisBroker(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sub, err := b.Subscribe(ctx, "events")
+	if err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+	server.Disconnect()
+
+	// Publishing reaches nobody until the subscription is re-established
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if err := b.Publish(ctx, "events", []byte("again")); err != nil {
+			t.Fatalf("Publish: %v", err)
+		}
+		select {
+		case payload := <-sub:
+			if string(payload) != "again" {
+				t.Fatalf("got %q, want %q", payload, "again")
+			}
+			return
+		case <-time.After(100 * time.Millisecond):
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("subscription not re-established")
+		}
+	}
+}
+
+func TestRedisBrokerLock(t *testing.T) {
+	b, _ := newRedisBroker(t)
+	ctx := context.Background()
+
+	unlock, err := b.Lock(ctx, "lock", time.Minute)
+	if err != nil {
+		t.Fatalf("Lock: %v", err)
+	}
+
+	// A held lock can't be taken
+	waitCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	if _, err := b.Lock(waitCtx, "lock", time.Minute); err == nil {
+		t.Fatal("took a held lock")
+	}
+
+	unlock()
+	unlock, err = b.Lock(ctx, "lock", time.Minute)
+	if err != nil {
+		t.Fatalf("Lock after unlock: %v", err)
+	}
+	unlock()
+}
+
+func TestRedisBrokerLockExpired(t *testing.T) {
+	b, _ := newRedisBroker(t)
+	ctx := context.Background()
+
+	expired, err := b.Lock(ctx, "lock", 20*time.Millisecond)
+	if err != nil {
+		t.Fatalf("Lock: %v", err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	unlock, err := b.Lock(ctx, "lock", time.Minute)
+	if err != nil {
+		t.Fatalf("Lock after expiry: %v", err)
+	}
+	defer unlock()
+
+	// The former holder must not release a lock that was taken over
+	expired()
+	waitCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	if _, err := b.Lock(waitCtx, "lock", time.Minute); err == nil {
+		t.Fatal("expired holder released the new holder's lock")
+	}
+}
+
+func TestRedisBrokerConcurrentCommands(t *testing.T) {
+	b, _ := newRedisBroker(t)
+	ctx := context.Background()
+
+	errs := make(chan error, 50)
+	for range cap(errs) {
+		go func() { errs <- b.Push(ctx, "queue", "member") }()
+	}
+	for range cap(errs) {
+		if err := <-errs; err != nil {
+			t.Fatalf("Push: %v", err)
+		}
+	}
+	members, err := b.Members(ctx, "queue")
+	if err != nil {
+		t.Fatalf("Members: %v", err)
+	}
+	if len(members) != cap(errs) {
+		t.Fatalf("got %d members, want %d", len(members), cap(errs))
+	}
+}
+
+func TestRedisBrokerClosed(t *testing.T) {
+	b, _ := newRedisBroker(t)
+	b.Close()
+	if err := b.Publish(context.Background(), "events", nil); err != broker.ErrClosed {
+		t.Fatalf("got %v, want ErrClosed", err)
+	}
+}
+
+func TestRedisBrokerSharedQueue(t *testing.T) {
+	_, server := newRedisBroker(t)
+	node1 := broker.NewRedisBroker(server.Addr(), "")
+	node2 := broker.NewRedisBroker(server.Addr(), "")
+	defer node1.Close()
+	defer node2.Close()
+	queue1 := services.NewSharedQueue(node1, "node1", scores{})
+	queue2 := services.NewSharedQueue(node2, "node2", scores{})
+
+	waiting := models.NewClient(uuid.New(), nil, nil)
+	if stranger, err := queue1.Match(waiting); err != nil || stranger != nil {
+		t.Fatalf("first Match = %v, %v, want to wait", stranger, err)
+	}
+
+	// A user on another node is matched with the waiting one as a remote client
+	stranger, err := queue2.Match(models.NewClient(uuid.New(), nil, nil))
+	if err != nil {
+		t.Fatalf("Match: %v", err)
+	}
+	if stranger == nil || stranger.UserId != waiting.UserId || stranger.NodeId != "node1" {
+		t.Fatalf("got %+v, want the user waiting on node1", stranger)
+	}
+	if client := queue1.Claim(waiting.UserId); client != waiting {
+		t.Fatal("waiting user not claimable on their node")
+	}
+	if size := queue1.Len() + queue2.Len(); size != 0 {
+		t.Fatalf("%d users still waiting", size)
+	}
+}
+
+func TestRedisBrokerSharedQueueReputation(t *testing.T) {
+	b, _ := newRedisBroker(t)
+	ctx := context.Background()
+	client := models.NewClient(uuid.New(), nil, nil)
+	queue := services.NewSharedQueue(b, "node1", scores{client.UserId: 1.5})
+
+	// Users waiting on other nodes carry the scores they queued with
+	disliked, liked := uuid.New(), uuid.New()
+	for _, entry := range []string{"node2|" + disliked.String() + "|-3", "node3|" + liked.String() + "|2"} {
+		if err := b.Push(ctx, "goroom:queue", entry); err != nil {
+			t.Fatalf("Push: %v", err)
+		}
+	}
+
+	stranger, err := queue.Match(client)
+	if err != nil {
+		t.Fatalf("Match: %v", err)
+	}
+	if stranger == nil || stranger.UserId != liked {
+		t.Fatalf("got %+v, want the user with the closest score", stranger)
+	}
+	members, err := b.Members(ctx, "goroom:queue")
+	if err != nil {
+		t.Fatalf("Members: %v", err)
+	}
+	if len(members) != 1 || members[0] != "node2|"+disliked.String()+"|-3" {
+		t.Fatalf("queue is %v, want only the other user", members)
+	}
+}
@@ -0,0 +1,423 @@
+// Package redistest provides a small in-process server speaking the Redis
+// protocol, so the Redis broker can be exercised without a real Redis.
+// It implements only the commands the broker uses, and EVAL only for the
+// broker's compare-and-delete unlock script.
+package redistest
+
+import (
+	"bufio"
+	"maps"
+	"net"
+	"realTimeService/broker/internal/resp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// unlockScript is the script the broker releases locks with, the only one EVAL runs
+const unlockScript = `if redis.call("GET", KEYS[1]) == ARGV[1] then return redis.call("DEL", KEYS[1]) else return 0 end`
+
+// Server is a local Redis stand-in listening on a loopback port
+type Server struct {
+	listener    net.Listener
+	password    string
+	strings     map[string]entry
+	lists       map[string][]string
+	hashes      map[string]map[string]string
+	subscribers map[string][]*session
+	sessions    map[*session]struct{}
+	mu          sync.Mutex
+}
+
+// entry is a string value with an optional expiry
+type entry struct {
+	value     string
+	expiresAt time.Time
+}
+
+// session is one client connection
+type session struct {
+	conn   net.Conn
+	writer *bufio.Writer
+	authed bool
+	mu     sync.Mutex // serializes writes from the session and from publishers
+}
+
+// NewServer starts a server on a random loopback port
+func NewServer() (*Server, error) {
+	return NewServerWithPassword("")
+}
+
+// NewServerWithPassword starts a server that requires AUTH with the given password
+func NewServerWithPassword(password string) (*Server, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{
+		listener:    listener,
+		password:    password,
+		strings:     make(map[string]entry),
+		lists:       make(map[string][]string),
+		hashes:      make(map[string]map[string]string),
+		subscribers: make(map[string][]*session),
+		sessions:    make(map[*session]struct{}),
+		mu:          sync.Mutex{},
+	}
+	go s.serve()
+	return s, nil
+}
+
+// Addr returns the host:port the server listens on
+func (s *Server) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// Close stops the server and drops every connection
+func (s *Server) Close() error {
+	err := s.listener.Close()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for sess := range s.sessions {
+		sess.conn.Close()
+	}
+	return err
+}
+
+// Disconnect drops every client connection while the server keeps listening,
+// as if Redis had restarted
+func (s *Server) Disconnect() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for sess := range s.sessions {
+		sess.conn.Close()
+	}
+}
+
+// serve accepts connections until the listener is closed
+func (s *Server) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		sess := &session{conn: conn, writer: bufio.NewWriter(conn), authed: s.password == ""}
+		s.mu.Lock()
+		s.sessions[sess] = struct{}{}
+		s.mu.Unlock()
+
+		go s.handle(sess)
+	}
+}
+
+// handle runs the commands of one connection
+func (s *Server) handle(sess *session) {
+	defer s.drop(sess)
+
+	reader := bufio.NewReader(sess.conn)
+	for {
+		value, err := resp.ReadValue(reader)
+		if err != nil {
+			return
+		}
+
+		parts, ok := value.([]any)
+		if !ok || len(parts) == 0 {
+			sess.reply(func(w *bufio.Writer) { resp.WriteError(w, "ERR invalid command") })
+			continue
+		}
+		args := make([]string, len(parts))
+		for i, part := range parts {
+			b, _ := part.([]byte)
+			args[i] = string(b)
+		}
+		s.exec(sess, strings.ToUpper(args[0]), args[1:])
+	}
+}
+
+// drop forgets a closed connection and its subscriptions
+func (s *Server) drop(sess *session) {
+	sess.conn.Close()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.sessions, sess)
+	for channel, subscribers := range s.subscribers {
+		s.subscribers[channel] = slices.DeleteFunc(subscribers, func(other *session) bool {
+			return other == sess
+		})
+	}
+}
+
+// exec runs a single command and writes its reply
+func (s *Server) exec(sess *session, cmd string, args []string) {
+	if !sess.authed && cmd != "AUTH" {
+		sess.reply(func(w *bufio.Writer) { resp.WriteError(w, "NOAUTH Authentication required.") })
+		return
+	}
+
+	switch {
+	case cmd == "PING":
+		sess.reply(func(w *bufio.Writer) { resp.WriteSimple(w, "PONG") })
+	case cmd == "AUTH" && len(args) == 1:
+		if args[0] != s.password {
+			sess.reply(func(w *bufio.Writer) { resp.WriteError(w, "WRONGPASS invalid password") })
+			return
+		}
+		sess.authed = true
+		sess.reply(func(w *bufio.Writer) { resp.WriteSimple(w, "OK") })
+	case cmd == "PUBLISH" && len(args) == 2:
+		count := s.publish(args[0], []byte(args[1]))
+		sess.reply(func(w *bufio.Writer) { resp.WriteInt(w, int64(count)) })
+	case cmd == "SUBSCRIBE" && len(args) >= 1:
+		s.subscribe(sess, args)
+	case cmd == "RPUSH" && len(args) >= 2:
+		s.mu.Lock()
+		s.lists[args[0]] = append(s.lists[args[0]], args[1:]...)
+		length := len(s.lists[args[0]])
+		s.mu.Unlock()
+		sess.reply(func(w *bufio.Writer) { resp.WriteInt(w, int64(length)) })
+	case cmd == "LPOP" && len(args) == 1:
+		var member []byte
+		s.mu.Lock()
+		if list := s.lists[args[0]]; len(list) > 0 {
+			member = []byte(list[0])
+			s.lists[args[0]] = list[1:]
+		}
+		s.mu.Unlock()
+		sess.reply(func(w *bufio.Writer) { resp.WriteBulk(w, member) })
+	case cmd == "LREM" && len(args) == 3:
+		s.mu.Lock()
+		before := len(s.lists[args[0]])
+		s.lists[args[0]] = slices.DeleteFunc(s.lists[args[0]], func(m string) bool { return m == args[2] })
+		removed := before - len(s.lists[args[0]])
+		s.mu.Unlock()
+		sess.reply(func(w *bufio.Writer) { resp.WriteInt(w, int64(removed)) })
+	case cmd == "LLEN" && len(args) == 1:
+		s.mu.Lock()
+		length := len(s.lists[args[0]])
+		s.mu.Unlock()
+		sess.reply(func(w *bufio.Writer) { resp.WriteInt(w, int64(length)) })
+	case cmd == "LRANGE" && len(args) == 3:
+		s.lrange(sess, args)
+	case cmd == "HSET" && len(args) >= 3 && len(args)%2 == 1:
+		added := 0
+		s.mu.Lock()
+		fields, ok := s.hashes[args[0]]
+		if !ok {
+			fields = make(map[string]string)
+			s.hashes[args[0]] = fields
+		}
+		for i := 1; i < len(args); i += 2 {
+			if _, exists := fields[args[i]]; !exists {
+				added++
+			}
+			fields[args[i]] = args[i+1]
+		}
+		s.mu.Unlock()
+		sess.reply(func(w *bufio.Writer) { resp.WriteInt(w, int64(added)) })
+	case cmd == "HGET" && len(args) == 2:
+		var value []byte
+		s.mu.Lock()
+		if v, ok := s.hashes[args[0]][args[1]]; ok {
+			value = []byte(v)
+		}
+		s.mu.Unlock()
+		sess.reply(func(w *bufio.Writer) { resp.WriteBulk(w, value) })
+	case cmd == "HDEL" && len(args) >= 2:
+		removed := 0
+		s.mu.Lock()
+		for _, field := range args[1:] {
+			if _, exists := s.hashes[args[0]][field]; exists {
+				delete(s.hashes[args[0]], field)
+				removed++
+			}
+		}
+		s.mu.Unlock()
+		sess.reply(func(w *bufio.Writer) { resp.WriteInt(w, int64(removed)) })
+	case cmd == "HGETALL" && len(args) == 1:
+		s.mu.Lock()
+		fields := maps.Clone(s.hashes[args[0]])
+		s.mu.Unlock()
+		sess.reply(func(w *bufio.Writer) {
+			resp.WriteArrayHeader(w, len(fields)*2)
+			for field, value := range fields {
+				resp.WriteBulk(w, []byte(field))
+				resp.WriteBulk(w, []byte(value))
+			}
+		})
+	case cmd == "SET" && len(args) >= 2:
+		s.set(sess, args)
+	case cmd == "GET" && len(args) == 1:
+		var value []byte
+		s.mu.Lock()
+		if e, ok := s.get(args[0]); ok {
+			value = []byte(e.value)
+		}
+		s.mu.Unlock()
+		sess.reply(func(w *bufio.Writer) { resp.WriteBulk(w, value) })
+	case cmd == "DEL" && len(args) >= 1:
+		removed := 0
+		s.mu.Lock()
+		for _, key := range args {
+			if _, ok := s.get(key); ok {
+				delete(s.strings, key)
+				removed++
+			}
+		}
+		s.mu.Unlock()
+		sess.reply(func(w *bufio.Writer) { resp.WriteInt(w, int64(removed)) })
+	case cmd == "EVAL" && len(args) == 4 && args[0] == unlockScript && args[1] == "1":
+		removed := 0
+		s.mu.Lock()
+		if e, ok := s.get(args[2]); ok && e.value == args[3] {
+			delete(s.strings, args[2])
+			removed = 1
+		}
+		s.mu.Unlock()
+		sess.reply(func(w *bufio.Writer) { resp.WriteInt(w, int64(removed)) })
+	default:
+		sess.reply(func(w *bufio.Writer) {
+			resp.WriteError(w, "ERR unknown command or wrong number of arguments for '"+cmd+"'")
+		})
+	}
+}
+
+// lrange implements LRANGE key start stop, negative indexes counting from the end
+func (s *Server) lrange(sess *session, args []string) {
+	start, err1 := strconv.Atoi(args[1])
+	stop, err2 := strconv.Atoi(args[2])
+	if err1 != nil || err2 != nil {
+		sess.reply(func(w *bufio.Writer) { resp.WriteError(w, "ERR value is not an integer or out of range") })
+		return
+	}
+
+	s.mu.Lock()
+	list := slices.Clone(s.lists[args[0]])
+	s.mu.Unlock()
+
+	if start < 0 {
+		start = max(len(list)+start, 0)
+	}
+	if stop < 0 {
+		stop = len(list) + stop
+	}
+	stop = min(stop, len(list)-1)
+	if start > stop {
+		list = nil
+	} else {
+		list = list[start : stop+1]
+	}
+
+	sess.reply(func(w *bufio.Writer) {
+		resp.WriteArrayHeader(w, len(list))
+		for _, member := range list {
+			resp.WriteBulk(w, []byte(member))
+		}
+	})
+}
+
+// set implements SET key value [NX] [PX milliseconds]
+func (s *Server) set(sess *session, args []string) {
+	key, value := args[0], args[1]
+	onlyIfMissing := false
+	var ttl time.Duration
+
+	for i := 2; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "NX":
+			onlyIfMissing = true
+		case "PX":
+			if i+1 == len(args) {
+				sess.reply(func(w *bufio.Writer) { resp.WriteError(w, "ERR syntax error") })
+				return
+			}
+			millis, err := strconv.ParseInt(args[i+1], 10, 64)
+			if err != nil || millis <= 0 {
+				sess.reply(func(w *bufio.Writer) { resp.WriteError(w, "ERR invalid expire time in 'set' command") })
+				return
+			}
+			ttl = time.Duration(millis) * time.Millisecond
+			i++
+		default:
+			sess.reply(func(w *bufio.Writer) { resp.WriteError(w, "ERR syntax error") })
+			return
+		}
+	}
+
+	s.mu.Lock()
+	if _, exists := s.get(key); exists && onlyIfMissing {
+		s.mu.Unlock()
+		sess.reply(func(w *bufio.Writer) { resp.WriteBulk(w, nil) })
+		return
+	}
+	e := entry{value: value}
+	if ttl > 0 {
+		e.expiresAt = time.Now().Add(ttl)
+	}
+	s.strings[key] = e
+	s.mu.Unlock()
+
+	sess.reply(func(w *bufio.Writer) { resp.WriteSimple(w, "OK") })
+}
+
+// get returns a string value that hasn't expired, the caller must hold the lock
+func (s *Server) get(key string) (entry, bool) {
+	e, ok := s.strings[key]
+	if !ok {
+		return entry{}, false
+	}
+	if !e.expiresAt.IsZero() && time.Now().After(e.expiresAt) {
+		delete(s.strings, key)
+		return entry{}, false
+	}
+	return e, true
+}
+
+// subscribe adds the session to channels and confirms each one
+func (s *Server) subscribe(sess *session, channels []string) {
+	s.mu.Lock()
+	for _, channel := range channels {
+		s.subscribers[channel] = append(s.subscribers[channel], sess)
+	}
+	s.mu.Unlock()
+
+	for i, channel := range channels {
+		sess.reply(func(w *bufio.Writer) {
+			resp.WriteArrayHeader(w, 3)
+			resp.WriteBulk(w, []byte("subscribe"))
+			resp.WriteBulk(w, []byte(channel))
+			resp.WriteInt(w, int64(i+1))
+		})
+	}
+}
+
+// publish pushes a payload to every subscriber and returns how many received it
+func (s *Server) publish(channel string, payload []byte) int {
+	s.mu.Lock()
+	subscribers := slices.Clone(s.subscribers[channel])
+	s.mu.Unlock()
+
+	for _, sub := range subscribers {
+		sub.reply(func(w *bufio.Writer) {
+			resp.WriteArrayHeader(w, 3)
+			resp.WriteBulk(w, []byte("message"))
+			resp.WriteBulk(w, []byte(channel))
+			resp.WriteBulk(w, payload)
+		})
+	}
+	return len(subscribers)
+}
+
+// reply writes and flushes a reply on the session
+func (sess *session) reply(write func(w *bufio.Writer)) {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	write(sess.writer)
+	sess.writer.Flush()
+}
@@ -0,0 +1,627 @@
+// Package client is a Go client for the goroom WebSocket protocol. It connects
+// with a session of its own, looks for strangers and chats with them, and
+// delivers what the server sends on typed channels. A dropped connection is
+// opened again with the same session.
+//
+//	c, err := client.Dial(ctx, "ws://localhost:8080/ws", nil)
+//	if err != nil {
+//		return err
+//	}
+//	defer c.Close()
+//
+//	if err := c.FindMatch(ctx); err != nil {
+//		return err
+//	}
+//	for {
+//		select {
+//		case <-c.StrangerJoined():
+//			c.Send(ctx, "hi")
+//		case msg := <-c.Messages():
+//			fmt.Println("Stranger:", msg.Text)
+//		case <-c.StrangerLeft():
+//			c.FindMatch(ctx)
+//		case <-c.Searching():
+//		case err := <-c.Errors():
+//			log.Print(err)
+//		case <-c.Done():
+//			return c.Err()
+//		}
+//	}
+//
+// Every event channel must be received from: while one of them is full the
+// client stops reading from the server. The channels are closed once the
+// client stops.
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"realTimeService/models"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// DefaultMaxBackoff caps the wait between reconnection attempts
+	DefaultMaxBackoff = 30 * time.Second
+	// DefaultBuffer is the capacity of each event channel
+	DefaultBuffer = 64
+	// minBackoff is the wait before the first reconnection attempt
+	minBackoff = 250 * time.Millisecond
+	// writeTimeout bounds writing a message when the context has no deadline
+	writeTimeout = 10 * time.Second
+	// closeTimeout bounds sending the close frame
+	closeTimeout = time.Second
+	// resumeHeader carries the resume token of the session when reconnecting
+	resumeHeader = "X-Resume-Token"
+)
+
+var (
+	// ErrClosed is returned once the client is closed
+	ErrClosed = errors.New("client closed")
+	// ErrNotChatting is returned by Send when there is no stranger to send to
+	ErrNotChatting = errors.New("not in a chat")
+	// ErrChatEnded is returned by Send when the chat ended before the message was acknowledged
+	ErrChatEnded = errors.New("chat ended")
+)
+
+// Options configures a client. The zero value is ready to use.
+type Options struct {
+	// ResumeToken resumes the session of an earlier client, from its ResumeToken.
+	// The server starts a new session if empty. Reconnections keep the session.
+	ResumeToken string
+	// Header is sent with every connection request, for example an Origin
+	Header http.Header
+	// Dialer opens the connections, websocket.DefaultDialer if nil
+	Dialer *websocket.Dialer
+	// Capabilities are requested in the handshake, such as models.CapabilityTyping
+	Capabilities []models.Capability
+	// NoReconnect stops the client when its connection drops instead of opening another
+	NoReconnect bool
+	// MaxBackoff caps the wait between reconnection attempts, DefaultMaxBackoff if zero
+	MaxBackoff time.Duration
+	// Buffer is the capacity of each event channel, DefaultBuffer if zero
+	Buffer int
+}
+
+// DialError is returned when the server refuses a connection
+type DialError struct {
+	StatusCode int
+	Reason     string // Why, if the server said, such as the reason of a ban
+}
+
+func (e *DialError) Error() string {
+	if e.Reason == "" {
+		return fmt.Sprintf("connection refused: HTTP %d", e.StatusCode)
+	}
+	return fmt.Sprintf("connection refused: HTTP %d: %s", e.StatusCode, e.Reason)
+}
+
+// permanent reports whether trying again won't help, such as when the session is banned
+func (e *DialError) permanent() bool {
+	return e.StatusCode >= 400 && e.StatusCode < 500 &&
+		e.StatusCode != http.StatusRequestTimeout && e.StatusCode != http.StatusTooManyRequests
+}
+
+// state is what the client is doing
+type state int
+
+const (
+	idle state = iota
+	searching
+	chatting
+)
+
+// pendingSend is a sent chat message waiting for its ack
+type pendingSend struct {
+	clientId string
+	result   chan sendResult
+}
+
+// sendResult is the outcome of sending a chat message
+type sendResult struct {
+	message *Message
+	err     error
+}
+
+// Client is a connection to a goroom server that reconnects when it drops.
+// Its methods may be called from any goroutine.
+type Client struct {
+	url          string
+	sessionId    uuid.UUID // Set by the welcome reply
+	resumeToken  string    // Set by the welcome reply
+	header       http.Header
+	dialer       *websocket.Dialer
+	capabilities []models.Capability
+	reconnect    bool
+	maxBackoff   time.Duration
+
+	joined    chan StrangerJoined
+	left      chan StrangerLeft
+	searching chan Searching
+	messages  chan Message
+	errors    chan *ServerError
+
+	conn     *websocket.Conn // nil while reconnecting
+	ready    chan struct{}   // Closed once conn is set
+	state    state
+	pairId   uuid.UUID      // Current or last pair
+	pending  []*pendingSend // Oldest first
+	sequence int
+	err      error // Why the client stopped
+	mu       sync.Mutex
+
+	// writeMu serializes writes, which the connection doesn't allow concurrently
+	writeMu   sync.Mutex
+	ctx       context.Context // Canceled by Close
+	cancel    context.CancelFunc
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// Dial connects to the WebSocket endpoint of a server, such as ws://localhost:8080/ws.
+// ctx bounds the first connection only.
+func Dial(ctx context.Context, url string, opts *Options) (*Client, error) {
+	if opts == nil {
+		opts = &Options{}
+	}
+	buffer := opts.Buffer
+	if buffer <= 0 {
+		buffer = DefaultBuffer
+	}
+	c := &Client{
+		url:          url,
+		resumeToken:  opts.ResumeToken,
+		header:       opts.Header.Clone(),
+		dialer:       opts.Dialer,
+		capabilities: opts.Capabilities,
+		reconnect:    !opts.NoReconnect,
+		maxBackoff:   opts.MaxBackoff,
+		joined:       make(chan StrangerJoined, buffer),
+		left:         make(chan StrangerLeft, buffer),
+		searching:    make(chan Searching, buffer),
+		messages:     make(chan Message, buffer),
+		errors:       make(chan *ServerError, buffer),
+		ready:        make(chan struct{}),
+		done:         make(chan struct{}),
+		mu:           sync.Mutex{},
+	}
+	if c.header == nil {
+		c.header = http.Header{}
+	}
+	if c.dialer == nil {
+		c.dialer = websocket.DefaultDialer
+	}
+	if c.maxBackoff <= 0 {
+		c.maxBackoff = DefaultMaxBackoff
+	}
+
+	conn, err := c.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+	c.conn = conn
+	close(c.ready)
+	go c.run(conn)
+	return c, nil
+}
+
+// SessionID returns the session the client connects with
+func (c *Client) SessionID() uuid.UUID {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.sessionId
+}
+
+// ResumeToken returns the token resuming the session, for Options.ResumeToken.
+// Unlike the session ID it must be kept secret.
+func (c *Client) ResumeToken() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.resumeToken
+}
+
+// StrangerJoined returns the channel of matches
+func (c *Client) StrangerJoined() <-chan StrangerJoined {
+	return c.joined
+}
+
+// StrangerLeft returns the channel of chats ended by the stranger or by a dropped connection
+func (c *Client) StrangerLeft() <-chan StrangerLeft {
+	return c.left
+}
+
+// Searching returns the channel telling that the client waits for a stranger
+func (c *Client) Searching() <-chan Searching {
+	return c.searching
+}
+
+// Messages returns the channel of chat messages of the stranger
+func (c *Client) Messages() <-chan Message {
+	return c.messages
+}
+
+// Errors returns the channel of requests the server rejected, except messages
+// passed to Send, whose rejection Send returns
+func (c *Client) Errors() <-chan *ServerError {
+	return c.errors
+}
+
+// Done returns a channel closed once the client stopped
+func (c *Client) Done() <-chan struct{} {
+	return c.done
+}
+
+// Err returns why the client stopped: ErrClosed after Close, the error of the
+// connection if it couldn't reconnect, nil while it runs
+func (c *Client) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+// FindMatch starts looking for a random stranger. StrangerJoined follows once one
+// is found, after Searching if nobody is waiting yet.
+func (c *Client) FindMatch(ctx context.Context) error {
+	return c.request(ctx, models.FindMatch, searching)
+}
+
+// Next leaves the current stranger, if any, and looks for another one
+func (c *Client) Next(ctx context.Context) error {
+	return c.request(ctx, models.NextStranger, searching)
+}
+
+// Stop leaves the current stranger or stops looking for one
+func (c *Client) Stop(ctx context.Context) error {
+	return c.request(ctx, models.StopChat, idle)
+}
+
+// Send sends a chat message to the stranger and waits until the server acknowledges
+// it, returning the message with the ID the server assigned
+func (c *Client) Send(ctx context.Context, text string) (*Message, error) {
+	conn, err := c.connection(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Pending messages are queued in the order they are written, so a rejection
+	// can be matched to the oldest one
+	c.writeMu.Lock()
+	c.mu.Lock()
+	if c.state != chatting {
+		c.mu.Unlock()
+		c.writeMu.Unlock()
+		return nil, ErrNotChatting
+	}
+	c.sequence++
+	pending := &pendingSend{clientId: strconv.Itoa(c.sequence), result: make(chan sendResult, 1)}
+	c.pending = append(c.pending, pending)
+	c.mu.Unlock()
+	err = writeJSON(ctx, conn, models.IncomingMessage{Type: models.SendMessage, Text: text, ClientId: pending.clientId})
+	c.writeMu.Unlock()
+	if err != nil {
+		c.forget(pending)
+		return nil, err
+	}
+
+	select {
+	case result := <-pending.result:
+		return result.message, result.err
+	case <-ctx.Done():
+		c.forget(pending)
+		return nil, ctx.Err()
+	}
+}
+
+// Close closes the connection and stops reconnecting
+func (c *Client) Close() error {
+	c.closeOnce.Do(func() {
+		c.cancel()
+		c.mu.Lock()
+		conn := c.conn
+		c.mu.Unlock()
+		if conn != nil {
+			conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(closeTimeout))
+			conn.Close()
+		}
+	})
+	<-c.done
+	return nil
+}
+
+// request sends a request without a payload, moving the client to the state it leads to
+func (c *Client) request(ctx context.Context, msgType models.MessageType, next state) error {
+	conn, err := c.connection(ctx)
+	if err != nil {
+		return err
+	}
+	c.setState(next, ErrChatEnded)
+	return c.write(ctx, conn, models.IncomingMessage{Type: msgType})
+}
+
+// connection returns the open connection, waiting while the client reconnects
+func (c *Client) connection(ctx context.Context) (*websocket.Conn, error) {
+	for {
+		c.mu.Lock()
+		conn, ready, err := c.conn, c.ready, c.err
+		c.mu.Unlock()
+		if err != nil {
+			return nil, err
+		}
+		if conn != nil {
+			return conn, nil
+		}
+		select {
+		case <-ready:
+		case <-c.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// connect opens a connection, says hello and waits for the welcome reply
+func (c *Client) connect(ctx context.Context) (*websocket.Conn, error) {
+	header := c.header.Clone()
+	c.mu.Lock()
+	if c.resumeToken != "" {
+		header.Set(resumeHeader, c.resumeToken)
+	}
+	c.mu.Unlock()
+	conn, resp, err := c.dialer.DialContext(ctx, c.url, header)
+	if err != nil {
+		if resp != nil {
+			return nil, refused(resp)
+		}
+		return nil, err
+	}
+
+	hello := models.IncomingMessage{Type: models.Hello, Version: models.ProtocolVersion, Capabilities: c.capabilities}
+	if err := writeJSON(ctx, conn, hello); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if err := c.welcome(ctx, conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// welcome reads the reply to hello, keeping the session it names
+func (c *Client) welcome(ctx context.Context, conn *websocket.Conn) error {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(writeTimeout)
+	}
+	conn.SetReadDeadline(deadline)
+	defer conn.SetReadDeadline(time.Time{})
+
+	var ev event
+	if err := conn.ReadJSON(&ev); err != nil {
+		return err
+	}
+	switch models.MessageType(ev.Type) {
+	case models.Welcome:
+		sessionId, err := uuid.Parse(ev.Session.UserId)
+		if err != nil {
+			return fmt.Errorf("invalid session in welcome: %w", err)
+		}
+		c.mu.Lock()
+		c.sessionId, c.resumeToken = sessionId, ev.Session.ResumeToken
+		c.mu.Unlock()
+		return nil
+	case models.Error:
+		return &ServerError{RequestType: ev.RequestType, Message: ev.Error}
+	default:
+		return fmt.Errorf("expected welcome, got %q", ev.Type)
+	}
+}
+
+// refused describes the response of a server that refused a connection
+func refused(resp *http.Response) *DialError {
+	var body struct {
+		Error  string `json:"error"`
+		Reason string `json:"reason"`
+	}
+	json.NewDecoder(resp.Body).Decode(&body)
+	reason := body.Error
+	if body.Reason != "" {
+		reason = body.Error + ": " + body.Reason
+	}
+	return &DialError{StatusCode: resp.StatusCode, Reason: reason}
+}
+
+// run reads from the connection, reconnecting whenever it drops, until the client stops
+func (c *Client) run(conn *websocket.Conn) {
+	for {
+		err := c.read(conn)
+		conn.Close()
+		if c.ctx.Err() != nil {
+			c.stop(ErrClosed)
+			return
+		}
+		if !c.reconnect {
+			c.stop(err)
+			return
+		}
+
+		c.disconnected()
+		if conn, err = c.redial(); err != nil {
+			c.stop(err)
+			return
+		}
+		c.resume(conn)
+	}
+}
+
+// read handles the events of a connection until it fails
+func (c *Client) read(conn *websocket.Conn) error {
+	for {
+		var ev event
+		if err := conn.ReadJSON(&ev); err != nil {
+			return err
+		}
+		c.handle(&ev)
+	}
+}
+
+// disconnected ends the chat the dropped connection was in. The server ended
+// it already; a search is started again once the client reconnects.
+func (c *Client) disconnected() {
+	c.mu.Lock()
+	c.conn = nil
+	c.ready = make(chan struct{})
+	c.mu.Unlock()
+
+	if pairId, ended := c.endChat(ErrChatEnded); ended {
+		deliver(c, c.left, StrangerLeft{PairId: pairId, Disconnected: true})
+	}
+}
+
+// redial connects again, waiting longer after each failure, until it succeeds,
+// the server refuses the session or the client is closed
+func (c *Client) redial() (*websocket.Conn, error) {
+	backoff := minBackoff
+	for {
+		// Jitter keeps clients dropped together from reconnecting together
+		wait := backoff/2 + rand.N(backoff/2+1)
+		select {
+		case <-time.After(wait):
+		case <-c.ctx.Done():
+			return nil, ErrClosed
+		}
+
+		conn, err := c.connect(c.ctx)
+		if err == nil {
+			return conn, nil
+		}
+		if c.ctx.Err() != nil {
+			return nil, ErrClosed
+		}
+		var dialErr *DialError
+		if errors.As(err, &dialErr) && dialErr.permanent() {
+			return nil, err
+		}
+		backoff = min(2*backoff, c.maxBackoff)
+	}
+}
+
+// resume starts using a new connection, looking for a stranger again if the
+// client was searching when the previous one dropped
+func (c *Client) resume(conn *websocket.Conn) {
+	c.mu.Lock()
+	// Close may have run while the connection was opened
+	if c.ctx.Err() != nil {
+		c.mu.Unlock()
+		conn.Close()
+		return
+	}
+	c.conn = conn
+	close(c.ready)
+	search := c.state == searching
+	c.mu.Unlock()
+
+	if search {
+		// A failure drops the connection, which the next read notices
+		c.write(c.ctx, conn, models.IncomingMessage{Type: models.FindMatch})
+	}
+}
+
+// stop ends the client, failing whatever still waits for it
+func (c *Client) stop(err error) {
+	c.mu.Lock()
+	c.err = err
+	c.conn = nil
+	pending := c.pending
+	c.pending = nil
+	c.mu.Unlock()
+
+	for _, p := range pending {
+		p.result <- sendResult{err: err}
+	}
+	close(c.joined)
+	close(c.left)
+	close(c.searching)
+	close(c.messages)
+	close(c.errors)
+	close(c.done)
+}
+
+// write sends a message over the connection
+func (c *Client) write(ctx context.Context, conn *websocket.Conn, v any) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	return writeJSON(ctx, conn, v)
+}
+
+// writeJSON writes a message by the deadline of ctx, or within writeTimeout if it has none
+func writeJSON(ctx context.Context, conn *websocket.Conn, v any) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(writeTimeout)
+	}
+	conn.SetWriteDeadline(deadline)
+	return conn.WriteJSON(v)
+}
+
+// setState moves the client to a new state, failing the pending messages with
+// err if that leaves a chat
+func (c *Client) setState(next state, err error) {
+	c.endChat(err)
+	c.mu.Lock()
+	c.state = next
+	c.mu.Unlock()
+}
+
+// endChat leaves the current chat, if any, failing its pending messages with err.
+// Returns the pair and whether there was a chat.
+func (c *Client) endChat(err error) (uuid.UUID, bool) {
+	c.mu.Lock()
+	if c.state != chatting {
+		c.mu.Unlock()
+		return uuid.Nil, false
+	}
+	c.state = idle
+	pairId, pending := c.pairId, c.pending
+	c.pending = nil
+	c.mu.Unlock()
+
+	for _, p := range pending {
+		p.result <- sendResult{err: err}
+	}
+	return pairId, true
+}
+
+// forget stops waiting for the ack of a message
+func (c *Client) forget(pending *pendingSend) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, p := range c.pending {
+		if p == pending {
+			c.pending = append(c.pending[:i], c.pending[i+1:]...)
+			return
+		}
+	}
+}
+
+// deliver passes an event to its channel unless the client is closed first
+func deliver[T any](c *Client, ch chan<- T, v T) {
+	select {
+	case ch <- v:
+	case <-c.ctx.Done():
+	}
+}
@@ -0,0 +1,132 @@
+package client
+
+import (
+	"fmt"
+	"realTimeService/models"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// StrangerJoined tells that a stranger was found and the chat started
+type StrangerJoined struct {
+	PairId uuid.UUID
+}
+
+// StrangerLeft tells that the chat ended
+type StrangerLeft struct {
+	PairId uuid.UUID
+	// Disconnected is set when the chat ended because the connection dropped
+	// rather than because the stranger left
+	Disconnected bool
+}
+
+// Searching tells that nobody was waiting, so the client waits for a stranger
+type Searching struct{}
+
+// Message is a chat message, received from the stranger or acknowledged by the server
+type Message struct {
+	ID        uuid.UUID
+	PairId    uuid.UUID
+	UserId    uuid.UUID // Session of the sender
+	Text      string
+	ReplyTo   uuid.UUID // Message this one replies to, if any
+	Timestamp time.Time
+}
+
+// ServerError is a request the server rejected
+type ServerError struct {
+	RequestType models.MessageType
+	Message     string
+}
+
+func (e *ServerError) Error() string {
+	return fmt.Sprintf("%s rejected: %s", e.RequestType, e.Message)
+}
+
+// event holds the fields of the server events the client understands
+type event struct {
+	models.Message
+	RequestType models.MessageType    `json:"requestType"`
+	Error       string                `json:"error"`
+	Session     models.WelcomeSession `json:"session"` // welcome only
+}
+
+// message returns the chat message an event carries
+func (ev *event) message() *Message {
+	return &Message{
+		ID:        ev.ID,
+		PairId:    ev.PairId,
+		UserId:    ev.UserId,
+		Text:      ev.Text,
+		ReplyTo:   ev.ReplyTo,
+		Timestamp: ev.Timestamp,
+	}
+}
+
+// handle updates the client with an event of the server and passes it on.
+// Events the client doesn't understand are ignored.
+func (c *Client) handle(ev *event) {
+	switch models.MessageType(ev.Type) {
+	case models.StrangerJoined:
+		c.endChat(ErrChatEnded)
+		c.mu.Lock()
+		c.state = chatting
+		c.pairId = ev.PairId
+		c.mu.Unlock()
+		deliver(c, c.joined, StrangerJoined{PairId: ev.PairId})
+	case models.StrangerLeft:
+		// The server doesn't say which pair ended, it can only be the current one
+		if pairId, ended := c.endChat(ErrChatEnded); ended {
+			deliver(c, c.left, StrangerLeft{PairId: pairId})
+		}
+	case models.Searching:
+		deliver(c, c.searching, Searching{})
+	case "message":
+		deliver(c, c.messages, *ev.message())
+	case models.MessageAck:
+		if pending := c.acknowledged(ev.ClientId); pending != nil {
+			pending.result <- sendResult{message: ev.message()}
+		}
+	case models.Error:
+		c.rejected(&ServerError{RequestType: ev.RequestType, Message: ev.Error})
+	}
+}
+
+// acknowledged removes the pending message with a client ID, nil if there is none
+func (c *Client) acknowledged(clientId string) *pendingSend {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, p := range c.pending {
+		if p.clientId == clientId {
+			c.pending = append(c.pending[:i], c.pending[i+1:]...)
+			return p
+		}
+	}
+	return nil
+}
+
+// rejected passes on a rejection. Rejected chat messages fail the oldest pending
+// Send, since the server answers in order; a rejected search leaves the client idle.
+func (c *Client) rejected(serverErr *ServerError) {
+	c.mu.Lock()
+	var pending *pendingSend
+	switch serverErr.RequestType {
+	case models.SendMessage:
+		if len(c.pending) > 0 {
+			pending = c.pending[0]
+			c.pending = c.pending[1:]
+		}
+	case models.FindMatch, models.NextStranger:
+		if c.state == searching {
+			c.state = idle
+		}
+	}
+	c.mu.Unlock()
+
+	if pending != nil {
+		pending.result <- sendResult{err: serverErr}
+		return
+	}
+	deliver(c, c.errors, serverErr)
+}
@@ -0,0 +1,144 @@
+// Command goroom-loadtest simulates many strangers chatting on a running server:
+// each one connects over WebSocket, looks for a match, chats at the given rate
+// and then moves on with nextStranger, stops or disconnects and comes back.
+// At the end it reports match and message latency percentiles, error events
+// and the connections the server refused or dropped, and exits with status 1
+// if there were any.
+//
+//	go run ./cmd/goroom-loadtest -clients 5000 -duration 2m -rate 1
+//
+// Every stranger holds a connection, so the open file limit of both the
+// load tester and the server must allow for them (ulimit -n).
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// handshakeTimeout bounds opening a connection
+const handshakeTimeout = 10 * time.Second
+
+func main() {
+	target := flag.String("url", "ws://localhost:8080/ws", "WebSocket endpoint of the server")
+	clients := flag.Int("clients", 100, "number of concurrent strangers")
+	duration := flag.Duration("duration", time.Minute, "how long to run")
+	ramp := flag.Duration("ramp", 10*time.Second, "time over which the strangers connect")
+	rate := flag.Float64("rate", 0.5, "messages per second a stranger sends while chatting")
+	messages := flag.Int("messages", 10, "mean number of messages a stranger sends per chat")
+	size := flag.Int("size", 64, "size of chat messages in bytes")
+	next := flag.Float64("next", 0.5, "share of chats left with nextStranger")
+	disconnect := flag.Float64("disconnect", 0.1, "share of chats left by disconnecting, the rest use stopChat")
+	think := flag.Duration("think", 2*time.Second, "longest pause before looking for the next stranger")
+	interval := flag.Duration("interval", 5*time.Second, "how often to print progress, 0 for never")
+	jsonOutput := flag.Bool("json", false, "print the report as JSON")
+	flag.Parse()
+
+	u, err := url.Parse(*target)
+	switch {
+	case err != nil || (u.Scheme != "ws" && u.Scheme != "wss") || u.Host == "":
+		log.Fatalf("url must be a ws:// or wss:// URL, got %q", *target)
+	case *clients <= 0:
+		log.Fatal("clients must be positive")
+	case *rate <= 0:
+		log.Fatal("rate must be positive")
+	case *messages <= 0:
+		log.Fatal("messages must be positive")
+	case *next < 0 || *disconnect < 0 || *next+*disconnect > 1:
+		log.Fatal("next and disconnect must be shares adding up to at most 1")
+	}
+
+	behavior := &behavior{
+		rate:       *rate,
+		messages:   *messages,
+		size:       *size,
+		next:       *next,
+		disconnect: *disconnect,
+		think:      *think,
+	}
+	dialer := &websocket.Dialer{Proxy: http.ProxyFromEnvironment, HandshakeTimeout: handshakeTimeout}
+	st := &stats{}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	start := time.Now()
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		// Spread the connections over the ramp rather than opening them all at once
+		gap := *ramp / time.Duration(*clients)
+		for range *clients {
+			s := &stranger{url: *target, dialer: dialer, behavior: behavior, stats: st}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				s.run(ctx)
+			}()
+			select {
+			case <-time.After(gap):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	if *interval > 0 {
+		go progress(ctx, st, *interval)
+	}
+
+	time.Sleep(*duration)
+	elapsed := time.Since(start)
+	searching := st.searching.Load()
+	cancel()
+	wg.Wait()
+
+	result := st.report(*target, *clients, elapsed, searching)
+	if *jsonOutput {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(result); err != nil {
+			log.Fatal(err)
+		}
+	} else {
+		result.print(os.Stdout)
+	}
+	if result.failures() > 0 {
+		os.Exit(1)
+	}
+}
+
+// progress logs what the strangers are doing every interval until ctx is done
+func progress(ctx context.Context, st *stats, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var lastSent, lastMatches int64
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+		sent, matches := st.sent.Load(), st.matches.Load()
+		log.Printf("connected %d, searching %d, chatting %d, %s matches/s, %s messages/s, %d errors, %d dropped",
+			st.connected.Load(), st.searching.Load(), st.chatting.Load(),
+			perSecond(matches-lastMatches, interval), perSecond(sent-lastSent, interval),
+			st.serverErrors.total(), st.dialFailures.total()+st.dropped.total())
+		lastSent, lastMatches = sent, matches
+	}
+}
+
+// perSecond formats a count over an interval as a rate
+func perSecond(n int64, interval time.Duration) string {
+	return fmt.Sprintf("%.1f", float64(n)/interval.Seconds())
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"text/tabwriter"
+	"time"
+)
+
+// latencies collects the samples of one measurement
+type latencies struct {
+	samples []time.Duration
+	mu      sync.Mutex
+}
+
+// add records a sample
+func (l *latencies) add(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.samples = append(l.samples, d)
+}
+
+// summary is the distribution of a measurement
+type summary struct {
+	Count int           `json:"count"`
+	P50   time.Duration `json:"p50"`
+	P90   time.Duration `json:"p90"`
+	P99   time.Duration `json:"p99"`
+	Max   time.Duration `json:"max"`
+}
+
+// summarize computes the percentiles of the samples so far
+func (l *latencies) summarize() summary {
+	l.mu.Lock()
+	samples := slices.Clone(l.samples)
+	l.mu.Unlock()
+
+	if len(samples) == 0 {
+		return summary{}
+	}
+	slices.Sort(samples)
+	percentile := func(p float64) time.Duration {
+		return samples[min(len(samples)-1, int(p*float64(len(samples))))]
+	}
+	return summary{
+		Count: len(samples),
+		P50:   percentile(0.50),
+		P90:   percentile(0.90),
+		P99:   percentile(0.99),
+		Max:   samples[len(samples)-1],
+	}
+}
+
+// counts tallies occurrences by description, such as server errors by message
+type counts struct {
+	byKey map[string]int64
+	mu    sync.Mutex
+}
+
+// add counts one occurrence
+func (c *counts) add(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.byKey == nil {
+		c.byKey = make(map[string]int64)
+	}
+	c.byKey[key]++
+}
+
+// snapshot returns the tallies so far
+func (c *counts) snapshot() map[string]int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return maps.Clone(c.byKey)
+}
+
+// total returns the number of occurrences of every key
+func (c *counts) total() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var total int64
+	for _, n := range c.byKey {
+		total += n
+	}
+	return total
+}
+
+// stats is everything the strangers measure, shared by all of them
+type stats struct {
+	// Gauges of what the strangers are doing right now
+	connected atomic.Int64
+	searching atomic.Int64
+	chatting  atomic.Int64
+
+	connections  atomic.Int64 // Connections opened
+	disconnects  atomic.Int64 // Connections the strangers closed on purpose
+	matches      atomic.Int64
+	sent         atomic.Int64 // Chat messages sent
+	delivered    atomic.Int64 // Chat messages received from partners
+	acked        atomic.Int64 // Acks received for sent messages
+	partnersLeft atomic.Int64
+
+	matchLatency    latencies // findMatch or nextStranger until strangerJoined
+	deliveryLatency latencies // sendMessage until the partner receives it
+	ackLatency      latencies // sendMessage until its messageAck
+
+	dialFailures counts // Connections that couldn't be opened, by reason
+	dropped      counts // Connections the server or the network closed, by reason
+	serverErrors counts // error events, by request type and message
+}
+
+// report is the outcome of a run, as printed with -json
+type report struct {
+	URL         string        `json:"url"`
+	Clients     int           `json:"clients"`
+	Duration    time.Duration `json:"duration"`
+	Connections int64         `json:"connections"`
+	Disconnects int64         `json:"disconnects"`
+	Matches     int64         `json:"matches"`
+	// Searching is how many strangers were still waiting for a match at the end
+	Searching    int64              `json:"searching"`
+	Sent         int64              `json:"sent"`
+	Delivered    int64              `json:"delivered"`
+	Acked        int64              `json:"acked"`
+	PartnersLeft int64              `json:"partnersLeft"`
+	Latency      map[string]summary `json:"latency"`
+	DialFailures map[string]int64   `json:"dialFailures,omitempty"`
+	Dropped      map[string]int64   `json:"dropped,omitempty"`
+	ServerErrors map[string]int64   `json:"serverErrors,omitempty"`
+}
+
+// report summarizes the run, given how many strangers were searching when it ended
+func (s *stats) report(url string, clients int, elapsed time.Duration, searching int64) *report {
+	return &report{
+		URL:          url,
+		Clients:      clients,
+		Duration:     elapsed.Round(time.Millisecond),
+		Connections:  s.connections.Load(),
+		Disconnects:  s.disconnects.Load(),
+		Matches:      s.matches.Load(),
+		Searching:    searching,
+		Sent:         s.sent.Load(),
+		Delivered:    s.delivered.Load(),
+		Acked:        s.acked.Load(),
+		PartnersLeft: s.partnersLeft.Load(),
+		Latency: map[string]summary{
+			"match":    s.matchLatency.summarize(),
+			"delivery": s.deliveryLatency.summarize(),
+			"ack":      s.ackLatency.summarize(),
+		},
+		DialFailures: s.dialFailures.snapshot(),
+		Dropped:      s.dropped.snapshot(),
+		ServerErrors: s.serverErrors.snapshot(),
+	}
+}
+
+// failures counts what went wrong on the server's side: connections it refused or dropped
+func (r *report) failures() int64 {
+	var total int64
+	for _, n := range r.DialFailures {
+		total += n
+	}
+	for _, n := range r.Dropped {
+		total += n
+	}
+	return total
+}
+
+// print writes the report as tables
+func (r *report) print(out io.Writer) {
+	seconds := r.Duration.Seconds()
+	fmt.Fprintf(out, "%d clients against %s for %s\n\n", r.Clients, r.URL, r.Duration)
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(w, "\tcount\tper second\t\n")
+	for _, row := range []struct {
+		name  string
+		count int64
+	}{
+		{"connections", r.Connections},
+		{"disconnects", r.Disconnects},
+		{"matches", r.Matches},
+		{"partners left", r.PartnersLeft},
+		{"messages sent", r.Sent},
+		{"delivered", r.Delivered},
+		{"acked", r.Acked},
+	} {
+		fmt.Fprintf(w, "%s\t%d\t%.1f\t\n", row.name, row.count, float64(row.count)/seconds)
+	}
+	fmt.Fprintf(w, "still searching\t%d\t\t\n", r.Searching)
+	w.Flush()
+
+	fmt.Fprintln(out)
+	w = tabwriter.NewWriter(out, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(w, "latency\tcount\tp50\tp90\tp99\tmax\t\n")
+	for _, name := range []string{"match", "delivery", "ack"} {
+		l := r.Latency[name]
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\t%s\t\n", name, l.Count,
+			round(l.P50), round(l.P90), round(l.P99), round(l.Max))
+	}
+	w.Flush()
+
+	printCounts(out, "Dial failures", r.DialFailures)
+	printCounts(out, "Connections dropped", r.Dropped)
+	printCounts(out, "Server errors", r.ServerErrors)
+}
+
+// printCounts writes tallies under a heading, most frequent first, nothing if there are none
+func printCounts(out io.Writer, heading string, byKey map[string]int64) {
+	if len(byKey) == 0 {
+		return
+	}
+	keys := slices.Collect(maps.Keys(byKey))
+	sort.Slice(keys, func(i, j int) bool {
+		if byKey[keys[i]] != byKey[keys[j]] {
+			return byKey[keys[i]] > byKey[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+
+	fmt.Fprintf(out, "\n%s\n", heading)
+	for _, key := range keys {
+		fmt.Fprintf(out, "%8d  %s\n", byKey[key], key)
+	}
+}
+
+// round shortens a latency for display
+func round(d time.Duration) time.Duration {
+	switch {
+	case d >= time.Second:
+		return d.Round(time.Millisecond)
+	case d >= time.Millisecond:
+		return d.Round(10 * time.Microsecond)
+	default:
+		return d.Round(time.Microsecond)
+	}
+}
@@ -0,0 +1,312 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// latencyPrefix starts the text of chat messages, followed by when they were sent
+// in Unix nanoseconds, so the receiving stranger can tell how long delivery took
+const latencyPrefix = "lt:"
+
+// behavior is how the strangers act
+type behavior struct {
+	rate       float64       // Messages per second while chatting
+	messages   int           // Mean number of messages per chat
+	size       int           // Bytes of a chat message
+	next       float64       // Share of chats left with nextStranger
+	disconnect float64       // Share of chats left by disconnecting
+	think      time.Duration // Longest pause before looking for the next stranger
+}
+
+// state is what a stranger is doing
+type state int
+
+const (
+	idle state = iota
+	searching
+	chatting
+)
+
+// incoming holds the fields of server events the strangers look at
+type incoming struct {
+	Type        string `json:"type"`
+	Text        string `json:"text"`
+	ClientId    string `json:"clientId"`
+	RequestType string `json:"requestType"`
+	Error       string `json:"error"`
+}
+
+// stranger is a simulated user: it looks for strangers, chats for a while, and then
+// moves on to the next one, stops or disconnects, until the run is over
+type stranger struct {
+	url      string
+	dialer   *websocket.Dialer
+	behavior *behavior
+	stats    *stats
+
+	conn        *websocket.Conn
+	state       state
+	searchStart time.Time
+	remaining   int                  // Messages left to send in the current chat
+	pending     map[string]time.Time // clientId -> when the message was sent, until acked
+	sequence    int
+}
+
+// run connects again and again until ctx is done
+func (s *stranger) run(ctx context.Context) {
+	for ctx.Err() == nil {
+		s.session(ctx)
+		s.pause(ctx)
+	}
+}
+
+// session runs one connection, until the stranger disconnects, the connection
+// drops or ctx is done
+func (s *stranger) session(ctx context.Context) {
+	conn, resp, err := s.dialer.DialContext(ctx, s.url, nil)
+	if err != nil {
+		if ctx.Err() == nil {
+			s.stats.dialFailures.add(dialFailure(resp, err))
+		}
+		return
+	}
+	s.conn = conn
+	s.stats.connections.Add(1)
+	s.stats.connected.Add(1)
+	defer func() {
+		s.setState(idle)
+		s.stats.connected.Add(-1)
+		conn.Close()
+	}()
+
+	events := make(chan incoming, 64)
+	readErr := make(chan error, 1)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			var event incoming
+			if err := conn.ReadJSON(&event); err != nil {
+				readErr <- err
+				return
+			}
+			select {
+			case events <- event:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	s.pending = make(map[string]time.Time)
+	if !s.send(map[string]any{"type": "hello", "version": 2}) || !s.search("findMatch") {
+		return
+	}
+
+	var timer <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+			return
+		case err := <-readErr:
+			s.stats.dropped.add(dropReason(err))
+			return
+		case event := <-events:
+			timer = s.handle(event, timer)
+		case <-timer:
+			timer = nil
+			var ok bool
+			if timer, ok = s.act(); !ok {
+				return
+			}
+		}
+	}
+}
+
+// handle reacts to an event of the server, returning the timer of the next action
+func (s *stranger) handle(event incoming, timer <-chan time.Time) <-chan time.Time {
+	switch event.Type {
+	case "strangerJoined":
+		if s.state == searching {
+			s.stats.matchLatency.add(time.Since(s.searchStart))
+		}
+		s.stats.matches.Add(1)
+		s.setState(chatting)
+		clear(s.pending)
+		s.remaining = max(1, int(rand.ExpFloat64()*float64(s.behavior.messages)+0.5))
+		return time.After(s.messageGap())
+	case "strangerLeft":
+		if s.state != chatting {
+			break
+		}
+		s.stats.partnersLeft.Add(1)
+		s.setState(idle)
+		return time.After(s.thinkTime())
+	case "message":
+		s.stats.delivered.Add(1)
+		if sent, ok := sentAt(event.Text); ok {
+			s.stats.deliveryLatency.add(time.Since(sent))
+		}
+	case "messageAck":
+		if sent, ok := s.pending[event.ClientId]; ok {
+			delete(s.pending, event.ClientId)
+			s.stats.acked.Add(1)
+			s.stats.ackLatency.add(time.Since(sent))
+		}
+	case "error":
+		s.stats.serverErrors.add(event.RequestType + ": " + event.Error)
+	}
+	return timer
+}
+
+// act does what the stranger planned next, returning the timer of the action after
+// and false if the connection is over
+func (s *stranger) act() (<-chan time.Time, bool) {
+	switch s.state {
+	case idle:
+		return nil, s.search("findMatch")
+	case chatting:
+		if s.remaining > 0 {
+			s.remaining--
+			return time.After(s.messageGap()), s.sendChat()
+		}
+
+		// Done with this chat
+		choice := rand.Float64()
+		switch {
+		case choice < s.behavior.next:
+			return nil, s.search("nextStranger")
+		case choice < s.behavior.next+s.behavior.disconnect:
+			s.stats.disconnects.Add(1)
+			s.conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+			return nil, false
+		default:
+			s.setState(idle)
+			return time.After(s.thinkTime()), s.send(map[string]any{"type": "stopChat"})
+		}
+	}
+	return nil, true
+}
+
+// search asks for a stranger with findMatch or nextStranger
+func (s *stranger) search(messageType string) bool {
+	s.setState(searching)
+	s.searchStart = time.Now()
+	return s.send(map[string]any{"type": messageType})
+}
+
+// sendChat sends a chat message carrying when it was sent
+func (s *stranger) sendChat() bool {
+	now := time.Now()
+	text := latencyPrefix + strconv.FormatInt(now.UnixNano(), 10) + ":"
+	if padding := s.behavior.size - len(text); padding > 0 {
+		text += strings.Repeat("x", padding)
+	}
+
+	s.sequence++
+	clientId := strconv.Itoa(s.sequence)
+	s.pending[clientId] = now
+	s.stats.sent.Add(1)
+	return s.send(map[string]any{"type": "sendMessage", "text": text, "clientId": clientId})
+}
+
+// send writes a message, counting the connection as dropped if that fails
+func (s *stranger) send(message map[string]any) bool {
+	if err := s.conn.WriteJSON(message); err != nil {
+		s.stats.dropped.add(dropReason(err))
+		return false
+	}
+	return true
+}
+
+// setState moves the stranger to a new state, keeping the gauges up to date
+func (s *stranger) setState(next state) {
+	s.count(s.state, -1)
+	s.count(next, 1)
+	s.state = next
+}
+
+// count adds delta to the gauge of strangers in the state
+func (s *stranger) count(st state, delta int64) {
+	switch st {
+	case searching:
+		s.stats.searching.Add(delta)
+	case chatting:
+		s.stats.chatting.Add(delta)
+	}
+}
+
+// pause waits for up to the think time, or until ctx is done
+func (s *stranger) pause(ctx context.Context) {
+	select {
+	case <-time.After(s.thinkTime()):
+	case <-ctx.Done():
+	}
+}
+
+// messageGap returns a random time until the next message, exponentially distributed around the rate
+func (s *stranger) messageGap() time.Duration {
+	return time.Duration(rand.ExpFloat64() / s.behavior.rate * float64(time.Second))
+}
+
+// thinkTime returns a random pause of up to the think time
+func (s *stranger) thinkTime() time.Duration {
+	if s.behavior.think <= 0 {
+		return 0
+	}
+	return rand.N(s.behavior.think)
+}
+
+// sentAt reads when a chat message of another stranger was sent
+func sentAt(text string) (time.Time, bool) {
+	rest, ok := strings.CutPrefix(text, latencyPrefix)
+	if !ok {
+		return time.Time{}, false
+	}
+	digits, _, _ := strings.Cut(rest, ":")
+	nanos, err := strconv.ParseInt(digits, 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(0, nanos), true
+}
+
+// dialFailure describes why a connection couldn't be opened, without the addresses
+// that would make every failure unique
+func dialFailure(resp *http.Response, err error) string {
+	if resp != nil {
+		return fmt.Sprintf("HTTP %d", resp.StatusCode)
+	}
+	return describe(err)
+}
+
+// dropReason describes why an open connection failed
+func dropReason(err error) string {
+	var closeErr *websocket.CloseError
+	if errors.As(err, &closeErr) {
+		return fmt.Sprintf("closed by server: %d %s", closeErr.Code, closeErr.Text)
+	}
+	return describe(err)
+}
+
+// describe returns an error without the addresses of network errors
+func describe(err error) string {
+	var opErr *net.OpError
+	if errors.As(err, &opErr) {
+		return opErr.Op + ": " + opErr.Err.Error()
+	}
+	return err.Error()
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// settings of the tool, from the config file and the environment
+type settings struct {
+	Server string `json:"server"`
+	Token  string `json:"token"`
+	Output string `json:"output"`
+}
+
+// defaultConfigFile returns the path of the config file used without -config
+func defaultConfigFile() string {
+	if path := os.Getenv("GOROOMCTL_CONFIG"); path != "" {
+		return path
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "goroomctl", "config.json")
+}
+
+// loadSettings reads the config file if it exists, then the environment
+func loadSettings(path string) (*settings, error) {
+	s := &settings{Server: "http://localhost:8080", Output: "table"}
+	if path != "" {
+		data, err := os.ReadFile(path)
+		switch {
+		case err == nil:
+			if err := json.Unmarshal(data, s); err != nil {
+				return nil, fmt.Errorf("%s: %w", path, err)
+			}
+		case !errors.Is(err, os.ErrNotExist):
+			return nil, err
+		}
+	}
+
+	for name, value := range map[string]*string{
+		"GOROOM_SERVER": &s.Server,
+		"GOROOM_TOKEN":  &s.Token,
+		"GOROOM_OUTPUT": &s.Output,
+	} {
+		if env := os.Getenv(name); env != "" {
+			*value = env
+		}
+	}
+	return s, nil
+}
+
+// apiClient calls the admin API
+type apiClient struct {
+	server string
+	token  string
+	http   *http.Client
+}
+
+// newAPIClient creates a client of the admin API at the server URL
+func newAPIClient(server, token string) *apiClient {
+	return &apiClient{
+		server: strings.TrimSuffix(server, "/"),
+		token:  token,
+		http:   &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// do sends a request with an optional JSON body and returns the response body.
+// Error responses are returned as errors carrying the server's message.
+func (c *apiClient) do(method, path string, body any) ([]byte, error) {
+	if c.token == "" {
+		return nil, errors.New("no admin token, set GOROOM_TOKEN or token in the config file")
+	}
+
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, c.server+"/admin"+path, reader)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode >= 300 {
+		var apiErr struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(data, &apiErr) == nil && apiErr.Error != "" {
+			return nil, fmt.Errorf("%s: %s", resp.Status, apiErr.Error)
+		}
+		if resp.StatusCode == http.StatusNotFound {
+			return nil, fmt.Errorf("%s: the server has no admin token configured or serves the admin API on another port", resp.Status)
+		}
+		return nil, fmt.Errorf("%s", resp.Status)
+	}
+	return data, nil
+}
+
+// get decodes the response of a GET into v
+func (c *apiClient) get(path string, v any) ([]byte, error) {
+	data, err := c.do(http.MethodGet, path, nil)
+	if err != nil {
+		return nil, err
+	}
+	return data, json.Unmarshal(data, v)
+}
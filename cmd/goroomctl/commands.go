@@ -0,0 +1,333 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"realTimeService/dtos"
+	"realTimeService/models"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// run dispatches a command line such as "pairs end <pairId>"
+func (c *cli) run(args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+	command, args := args[0], args[1:]
+	sub := ""
+	if len(args) > 0 {
+		sub = args[0]
+	}
+
+	switch {
+	case command == "stats":
+		return c.stats()
+	case command == "clients" && sub == "ls":
+		return c.clientsList()
+	case command == "clients" && sub == "kick":
+		return c.clientsKick(args[1:])
+	case command == "pairs" && sub == "ls":
+		return c.pairsList()
+	case command == "pairs" && sub == "end":
+		return c.pairsEnd(args[1:])
+	case command == "queue":
+		return c.queue()
+	case command == "matching" && (sub == "on" || sub == "off"):
+		return c.matching(sub == "on")
+	case command == "ban" && sub == "ls":
+		return c.banList()
+	case command == "ban" && sub == "add":
+		return c.banAdd(args[1:])
+	case command == "ban" && sub == "rm":
+		return c.banRemove(args[1:])
+	case command == "reports" && sub == "ls":
+		return c.reportsList(args[1:])
+	case command == "reports" && sub == "resolve":
+		return c.reportsResolve(args[1:])
+	case command == "announce":
+		return c.announce(args)
+	default:
+		return errUsage
+	}
+}
+
+// parseArgs parses the flags of a subcommand, which may come before or after
+// its arguments, and returns the arguments
+func parseArgs(set *flag.FlagSet, args []string) ([]string, error) {
+	set.SetOutput(io.Discard)
+	var positional []string
+	for {
+		if err := set.Parse(args); err != nil {
+			return nil, fmt.Errorf("%s: %w", set.Name(), err)
+		}
+		if set.NArg() == 0 {
+			return positional, nil
+		}
+		positional = append(positional, set.Arg(0))
+		args = set.Args()[1:]
+	}
+}
+
+// oneId parses the single ID argument of a command
+func oneId(name string, args []string) (uuid.UUID, error) {
+	if len(args) != 1 {
+		return uuid.Nil, errUsage
+	}
+	id, err := uuid.Parse(args[0])
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("invalid %s %q", name, args[0])
+	}
+	return id, nil
+}
+
+func (c *cli) stats() error {
+	var stats dtos.StatsDto
+	data, err := c.api.get("/stats", &stats)
+	if err != nil {
+		return err
+	}
+	return c.print(data, func(w io.Writer) {
+		row(w, "NODE", stats.NodeId)
+		row(w, "CLUSTER", strings.Join(stats.Nodes, ", "))
+		row(w, "CLIENTS", stats.Clients)
+		row(w, "PAIRS", stats.Pairs)
+		row(w, "WAITING", stats.Waiting)
+		row(w, "MATCHING", onOff(stats.MatchingEnabled))
+		row(w, "BANS", stats.Bans)
+		row(w, "OPEN REPORTS", stats.OpenReports)
+	})
+}
+
+func (c *cli) clientsList() error {
+	var clients []dtos.ClientDto
+	data, err := c.api.get("/clients", &clients)
+	if err != nil {
+		return err
+	}
+	return c.print(data, func(w io.Writer) {
+		row(w, "USER", "ADDRESS", "TRANSPORT", "PROTOCOL", "CONNECTED", "PAIR")
+		for _, client := range clients {
+			pair := "-"
+			if client.PairId != uuid.Nil {
+				pair = client.PairId.String()
+			}
+			row(w, client.UserId, client.RemoteAddr, client.Transport, client.ProtocolVersion, age(client.ConnectedAt), pair)
+		}
+	})
+}
+
+func (c *cli) clientsKick(args []string) error {
+	set := flag.NewFlagSet("clients kick", flag.ContinueOnError)
+	reason := set.String("reason", "", "reason shown to the client")
+	args, err := parseArgs(set, args)
+	if err != nil {
+		return err
+	}
+	userId, err := oneId("user id", args)
+	if err != nil {
+		return err
+	}
+	if _, err := c.api.do(http.MethodPost, "/clients/"+userId.String()+"/kick", map[string]string{"reason": *reason}); err != nil {
+		return err
+	}
+	return c.done("Client %s kicked", userId)
+}
+
+func (c *cli) pairsList() error {
+	var pairs []dtos.PairDto
+	data, err := c.api.get("/pairs", &pairs)
+	if err != nil {
+		return err
+	}
+	return c.print(data, func(w io.Writer) {
+		row(w, "PAIR", "USER 1", "USER 2", "AGE", "OWNER")
+		for _, pair := range pairs {
+			row(w, pair.ID, pair.Users[0].UserId, pair.Users[1].UserId, age(pair.CreatedAt), orDash(pair.NodeId))
+		}
+	})
+}
+
+func (c *cli) pairsEnd(args []string) error {
+	pairId, err := oneId("pair id", args)
+	if err != nil {
+		return err
+	}
+	if _, err := c.api.do(http.MethodDelete, "/pairs/"+pairId.String(), nil); err != nil {
+		return err
+	}
+	return c.done("Pair %s ended", pairId)
+}
+
+func (c *cli) queue() error {
+	var queue dtos.QueueDto
+	data, err := c.api.get("/queue", &queue)
+	if err != nil {
+		return err
+	}
+	return c.print(data, func(w io.Writer) {
+		fmt.Fprintf(w, "Matching %s, %d waiting\n", onOff(queue.MatchingEnabled), len(queue.Waiting))
+		for _, userId := range queue.Waiting {
+			row(w, userId)
+		}
+	})
+}
+
+func (c *cli) matching(enabled bool) error {
+	data, err := c.api.do(http.MethodPut, "/matching", map[string]bool{"enabled": enabled})
+	if err != nil {
+		return err
+	}
+	if c.json {
+		return c.printJSON(data)
+	}
+	return c.done("Matching turned %s", onOff(enabled))
+}
+
+func (c *cli) banList() error {
+	var bans []models.Ban
+	data, err := c.api.get("/bans", &bans)
+	if err != nil {
+		return err
+	}
+	return c.print(data, func(w io.Writer) {
+		row(w, "BAN", "USER", "IP", "REASON", "CREATED", "EXPIRES")
+		for _, ban := range bans {
+			user, expires := "-", "never"
+			if ban.UserId != uuid.Nil {
+				user = ban.UserId.String()
+			}
+			if ban.ExpiresAt != nil {
+				expires = formatTime(*ban.ExpiresAt)
+			}
+			row(w, ban.ID, user, orDash(ban.IP), orDash(ban.Reason), formatTime(ban.CreatedAt), expires)
+		}
+	})
+}
+
+func (c *cli) banAdd(args []string) error {
+	set := flag.NewFlagSet("ban add", flag.ContinueOnError)
+	user := set.String("user", "", "session to ban")
+	ip := set.String("ip", "", "IP address to ban")
+	reason := set.String("reason", "", "reason shown to the banned user")
+	duration := set.String("duration", "", "ban duration such as 24h, permanent if empty")
+	args, err := parseArgs(set, args)
+	if err != nil {
+		return err
+	}
+	if len(args) > 0 || (*user == "" && *ip == "") {
+		return errUsage
+	}
+
+	request := map[string]string{"ip": *ip, "reason": *reason, "duration": *duration}
+	if *user != "" {
+		userId, err := uuid.Parse(*user)
+		if err != nil {
+			return fmt.Errorf("invalid user id %q", *user)
+		}
+		request["userId"] = userId.String()
+	}
+	data, err := c.api.do(http.MethodPost, "/bans", request)
+	if err != nil {
+		return err
+	}
+	if c.json {
+		return c.printJSON(data)
+	}
+	return c.done("Ban added and matching clients disconnected")
+}
+
+func (c *cli) banRemove(args []string) error {
+	banId, err := oneId("ban id", args)
+	if err != nil {
+		return err
+	}
+	if _, err := c.api.do(http.MethodDelete, "/bans/"+banId.String(), nil); err != nil {
+		return err
+	}
+	return c.done("Ban %s lifted", banId)
+}
+
+func (c *cli) reportsList(args []string) error {
+	set := flag.NewFlagSet("reports ls", flag.ContinueOnError)
+	all := set.Bool("all", false, "include resolved reports")
+	args, err := parseArgs(set, args)
+	if err != nil {
+		return err
+	}
+	if len(args) > 0 {
+		return errUsage
+	}
+	query := url.Values{"status": {"open"}}
+	if *all {
+		query.Set("status", "all")
+	}
+
+	var reports []models.Report
+	data, err := c.api.get("/reports?"+query.Encode(), &reports)
+	if err != nil {
+		return err
+	}
+	return c.print(data, func(w io.Writer) {
+		row(w, "REPORT", "REPORTED", "IP", "REASON", "CREATED", "STATUS", "DETAILS")
+		for _, report := range reports {
+			status := "open"
+			if !report.Open() {
+				status = "resolved"
+			}
+			row(w, report.ID, report.ReportedId, orDash(report.ReportedIP), report.Reason,
+				formatTime(report.CreatedAt), status, orDash(strings.Join(strings.Fields(report.Details), " ")))
+		}
+	})
+}
+
+func (c *cli) reportsResolve(args []string) error {
+	set := flag.NewFlagSet("reports resolve", flag.ContinueOnError)
+	note := set.String("note", "", "how the report was resolved")
+	ban := set.Bool("ban", false, "ban the reported session and its address")
+	duration := set.String("duration", "", "ban duration such as 24h, permanent if empty")
+	args, err := parseArgs(set, args)
+	if err != nil {
+		return err
+	}
+	reportId, err := oneId("report id", args)
+	if err != nil {
+		return err
+	}
+
+	request := map[string]any{"note": *note, "ban": *ban, "duration": *duration}
+	data, err := c.api.do(http.MethodPost, "/reports/"+reportId.String()+"/resolve", request)
+	if err != nil {
+		return err
+	}
+	if c.json {
+		return c.printJSON(data)
+	}
+	if *ban {
+		return c.done("Report %s resolved, reported user banned", reportId)
+	}
+	return c.done("Report %s resolved", reportId)
+}
+
+func (c *cli) announce(args []string) error {
+	text := strings.TrimSpace(strings.Join(args, " "))
+	if text == "" {
+		return errUsage
+	}
+	if _, err := c.api.do(http.MethodPost, "/announcements", map[string]string{"text": text}); err != nil {
+		return err
+	}
+	return c.done("Announcement sent")
+}
+
+// onOff names a switch state
+func onOff(enabled bool) string {
+	if enabled {
+		return "on"
+	}
+	return "off"
+}
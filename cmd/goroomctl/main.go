@@ -0,0 +1,94 @@
+// Command goroomctl operates a running server through its admin API.
+//
+//	goroomctl stats
+//	goroomctl clients ls
+//	goroomctl pairs end <pairId>
+//	goroomctl ban add -ip 203.0.113.7 -reason spam -duration 24h
+//	goroomctl -o json reports ls
+//
+// The admin token is read from GOROOM_TOKEN or the config file, never from the
+// command line, which every user of the machine can see. See usage for the rest.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+)
+
+const usage = `Usage: goroomctl [flags] <command> [arguments]
+
+Commands:
+  stats                              node counters
+  clients ls                         connected clients
+  clients kick [-reason r] <userId>  disconnect a session
+  pairs ls                           active pairs
+  pairs end <pairId>                 end a pair
+  queue                              users waiting for a match
+  matching on|off                    turn matching on or off
+  ban ls                             bans in effect
+  ban add [-user id] [-ip addr] [-reason r] [-duration d]
+                                     ban a session, an address or both
+  ban rm <banId>                     lift a ban
+  reports ls [-all]                  open reports, or every report
+  reports resolve [-note n] [-ban] [-duration d] <reportId>
+                                     resolve a report, optionally banning the reported user
+  announce <text>                    send an announcement to every client
+
+Settings come from the config file, then the environment, then flags:
+  {"server": "http://localhost:8080", "token": "...", "output": "table"}
+  GOROOM_SERVER, GOROOM_TOKEN, GOROOM_OUTPUT
+
+Flags:
+`
+
+// errUsage reports a command line that doesn't name a valid command
+var errUsage = errors.New("invalid usage")
+
+func main() {
+	global := flag.NewFlagSet("goroomctl", flag.ContinueOnError)
+	global.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+		global.PrintDefaults()
+	}
+	configFile := global.String("config", defaultConfigFile(), "config file")
+	server := global.String("server", "", "server admin API URL (default http://localhost:8080)")
+	output := global.String("o", "", "output format: table or json (default table)")
+	if err := global.Parse(os.Args[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return
+		}
+		os.Exit(2)
+	}
+
+	settings, err := loadSettings(*configFile)
+	if err != nil {
+		fatal(err)
+	}
+	if *server != "" {
+		settings.Server = *server
+	}
+	if *output != "" {
+		settings.Output = *output
+	}
+	if settings.Output != "table" && settings.Output != "json" {
+		fatal(fmt.Errorf("output must be table or json, got %q", settings.Output))
+	}
+
+	cli := &cli{api: newAPIClient(settings.Server, settings.Token), json: settings.Output == "json", out: os.Stdout}
+	err = cli.run(global.Args())
+	if errors.Is(err, errUsage) {
+		global.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		fatal(err)
+	}
+}
+
+// fatal prints the error and exits
+func fatal(err error) {
+	fmt.Fprintf(os.Stderr, "goroomctl: %v\n", err)
+	os.Exit(1)
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// cli runs commands against the admin API, printing tables or the API's JSON
+type cli struct {
+	api  *apiClient
+	json bool
+	out  io.Writer
+}
+
+// print writes the JSON response as is, or the table the function writes
+func (c *cli) print(data []byte, table func(w io.Writer)) error {
+	if c.json {
+		return c.printJSON(data)
+	}
+	w := tabwriter.NewWriter(c.out, 0, 0, 2, ' ', 0)
+	table(w)
+	return w.Flush()
+}
+
+// printJSON writes a JSON response indented
+func (c *cli) printJSON(data []byte) error {
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, data, "", "  "); err != nil {
+		return err
+	}
+	indented.WriteByte('\n')
+	_, err := indented.WriteTo(c.out)
+	return err
+}
+
+// done confirms an action without a response body, in table mode only
+func (c *cli) done(format string, args ...any) error {
+	if !c.json {
+		fmt.Fprintf(c.out, format+"\n", args...)
+	}
+	return nil
+}
+
+// row writes the cells of a table row
+func row(w io.Writer, cells ...any) {
+	text := make([]string, len(cells))
+	for i, cell := range cells {
+		text[i] = fmt.Sprint(cell)
+	}
+	fmt.Fprintln(w, strings.Join(text, "\t"))
+}
+
+// formatTime formats a time for tables, "-" if it is zero
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Local().Format("2006-01-02 15:04:05")
+}
+
+// age returns how long ago a time was, to the second
+func age(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return time.Since(t).Round(time.Second).String()
+}
+
+// orDash returns the value, "-" if it is empty
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,120 @@
+package codec
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"realTimeService/models"
+)
+
+// versionField is the envelope field holding the protocol version. Frames
+// without one are version 1.
+const versionField = "v"
+
+// ProtocolVersion is the newest version a frame may carry
+const ProtocolVersion = models.ProtocolVersion
+
+// ErrUnsupportedVersion is returned when decoding a frame of a newer protocol version
+var ErrUnsupportedVersion = errors.New("unsupported protocol version")
+
+// Codec encodes outgoing events and decodes incoming messages for the wire.
+// Every codec carries the same envelope: a version, a message type and the
+// message fields under their JSON names, so a client can switch encodings
+// without any other change.
+type Codec interface {
+	// Name is the WebSocket subprotocol selecting the codec
+	Name() string
+	// Binary reports whether frames are binary rather than text
+	Binary() bool
+	// Encode encodes an outgoing event for a peer of the protocol version.
+	// Version 1 frames carry no version, as version 1 clients don't know the field.
+	Encode(v any, version int) ([]byte, error)
+	// Decode decodes an incoming frame into v
+	Decode(data []byte, v any) error
+}
+
+var (
+	// JSON is the default codec, used when the client asks for none
+	JSON Codec = jsonCodec{}
+	// MessagePack encodes the envelope as a MessagePack map
+	MessagePack Codec = newMsgpackCodec()
+	// Protobuf encodes the envelope as the Envelope message in envelope.proto
+	Protobuf Codec = protobufCodec{}
+)
+
+// codecs lists the supported codecs in order of server preference
+var codecs = []Codec{Protobuf, MessagePack, JSON}
+
+// Names returns the subprotocols of the supported codecs, most preferred first
+func Names() []string {
+	names := make([]string, len(codecs))
+	for i, c := range codecs {
+		names[i] = c.Name()
+	}
+	return names
+}
+
+// ByName returns the codec selected by a subprotocol, JSON if the name is empty
+func ByName(name string) (Codec, error) {
+	if name == "" {
+		return JSON, nil
+	}
+	for _, c := range codecs {
+		if c.Name() == name {
+			return c, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown codec %q", name)
+}
+
+// toFields converts an outgoing event to the generic field map of the envelope,
+// going through its JSON encoding so every codec sees the same names and values
+func toFields(v any) (map[string]any, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]any
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, fmt.Errorf("event is not an object: %w", err)
+	}
+	return fields, nil
+}
+
+// stamped reports whether frames of the protocol version carry it
+func stamped(version int) bool {
+	return version > 1
+}
+
+// fromFields fills v from the field map of an incoming envelope
+func fromFields(fields map[string]any, v any) error {
+	if err := checkVersion(fields[versionField]); err != nil {
+		return err
+	}
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// checkVersion rejects versions newer than ProtocolVersion, a missing version is accepted
+func checkVersion(version any) error {
+	var number float64
+	switch n := version.(type) {
+	case nil:
+		return nil
+	case float64:
+		number = n
+	case int64:
+		number = float64(n)
+	case uint64:
+		number = float64(n)
+	default:
+		return fmt.Errorf("invalid protocol version %v", version)
+	}
+	if number > ProtocolVersion {
+		return fmt.Errorf("%w %v", ErrUnsupportedVersion, version)
+	}
+	return nil
+}
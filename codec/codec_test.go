@@ -0,0 +1,115 @@
+package codec
+
+import (
+	"errors"
+	"fmt"
+	"realTimeService/models"
+	"slices"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestCodecsRoundTrip(t *testing.T) {
+	want := models.IncomingMessage{
+		Type:      models.MessageType("sendMessage"),
+		Text:      "hello",
+		Enabled:   true,
+		MessageId: uuid.New(),
+		Tags:      []string{"spam", "rude"},
+	}
+	for _, c := range codecs {
+		for _, version := range []int{1, ProtocolVersion} {
+			data, err := c.Encode(want, version)
+			if err != nil {
+				t.Fatalf("%s: Encode v%d: %v", c.Name(), version, err)
+			}
+			var got models.IncomingMessage
+			if err := c.Decode(data, &got); err != nil {
+				t.Fatalf("%s: Decode v%d: %v", c.Name(), version, err)
+			}
+			if got.Type != want.Type || got.Text != want.Text || got.Enabled != want.Enabled ||
+				got.MessageId != want.MessageId || !slices.Equal(got.Tags, want.Tags) {
+				t.Errorf("%s: v%d round trip = %+v, want %+v", c.Name(), version, got, want)
+			}
+		}
+	}
+}
+
+func TestCodecsStampVersion(t *testing.T) {
+	event := models.NewErrorMessage("typing", "not supported")
+	for _, c := range codecs {
+		for _, tc := range []struct {
+			version int
+			want    string // Decoded "v" field, empty if the frame has none
+		}{
+			{version: 1, want: ""},
+			{version: 2, want: "2"},
+		} {
+			data, err := c.Encode(event, tc.version)
+			if err != nil {
+				t.Fatalf("%s: Encode v%d: %v", c.Name(), tc.version, err)
+			}
+			var fields map[string]any
+			if err := c.Decode(data, &fields); err != nil {
+				t.Fatalf("%s: Decode v%d: %v", c.Name(), tc.version, err)
+			}
+			got := ""
+			if v, ok := fields[versionField]; ok {
+				got = fmt.Sprint(v)
+			}
+			if got != tc.want {
+				t.Errorf("%s: v%d frame has version %q, want %q", c.Name(), tc.version, got, tc.want)
+			}
+			if fields["type"] != "error" || fields["requestType"] != "typing" {
+				t.Errorf("%s: v%d frame fields = %v", c.Name(), tc.version, fields)
+			}
+		}
+	}
+}
+
+func TestCodecsRejectUnsupportedVersion(t *testing.T) {
+	for _, c := range codecs {
+		data, err := c.Encode(models.IncomingMessage{Type: "hello"}, ProtocolVersion+1)
+		if err != nil {
+			t.Fatalf("%s: Encode: %v", c.Name(), err)
+		}
+		var msg models.IncomingMessage
+		if err := c.Decode(data, &msg); !errors.Is(err, ErrUnsupportedVersion) {
+			t.Errorf("%s: Decode of a v%d frame = %v, want ErrUnsupportedVersion", c.Name(), ProtocolVersion+1, err)
+		}
+	}
+}
+
+func TestCodecsRejectMalformedFrames(t *testing.T) {
+	for _, tc := range []struct {
+		codec Codec
+		data  []byte
+	}{
+		{codec: JSON, data: []byte(`{"type":`)},
+		{codec: JSON, data: []byte(`{"v":"two","type":"hello"}`)},
+		{codec: MessagePack, data: []byte{0xc1}},
+		{codec: Protobuf, data: []byte{0xff}},
+		{codec: Protobuf, data: []byte{}}, // No type
+	} {
+		var msg models.IncomingMessage
+		if err := tc.codec.Decode(tc.data, &msg); err == nil {
+			t.Errorf("%s: Decode(%x) succeeded", tc.codec.Name(), tc.data)
+		}
+	}
+}
+
+func TestByName(t *testing.T) {
+	for _, name := range Names() {
+		c, err := ByName(name)
+		if err != nil || c.Name() != name {
+			t.Errorf("ByName(%q) = %v, %v", name, c, err)
+		}
+	}
+	if c, err := ByName(""); err != nil || c != JSON {
+		t.Errorf(`ByName("") = %v, %v, want JSON`, c, err)
+	}
+	if _, err := ByName("goroom.v1.xml"); err == nil {
+		t.Error("ByName of an unknown codec succeeded")
+	}
+}
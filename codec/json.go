@@ -0,0 +1,49 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+)
+
+// jsonCodec sends the envelope as a JSON object in text frames
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string { return "goroom.v1.json" }
+
+func (jsonCodec) Binary() bool { return false }
+
+// Encode marshals the event and adds the version to the object
+func (jsonCodec) Encode(v any, version int) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	data = bytes.TrimSpace(data)
+	if !stamped(version) || len(data) < 2 || data[0] != '{' {
+		return data, nil // Not an object, nothing to add the version to
+	}
+
+	field := `"` + versionField + `":` + strconv.Itoa(version)
+	out := make([]byte, 0, len(data)+len(field)+1)
+	out = append(out, '{')
+	out = append(out, field...)
+	if len(bytes.TrimSpace(data[1:len(data)-1])) > 0 {
+		out = append(out, ',')
+	}
+	return append(out, data[1:]...), nil
+}
+
+// Decode unmarshals a JSON object after checking its version
+func (jsonCodec) Decode(data []byte, v any) error {
+	var envelope struct {
+		Version any `json:"v"`
+	}
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return err
+	}
+	if err := checkVersion(envelope.Version); err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
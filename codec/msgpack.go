@@ -0,0 +1,50 @@
+package codec
+
+import (
+	"reflect"
+
+	ugorji "github.com/ugorji/go/codec"
+)
+
+// msgpackCodec sends the envelope as a MessagePack map in binary frames
+type msgpackCodec struct {
+	handle *ugorji.MsgpackHandle
+}
+
+// newMsgpackCodec creates a MessagePack codec decoding maps with string keys
+func newMsgpackCodec() msgpackCodec {
+	handle := &ugorji.MsgpackHandle{WriteExt: true}
+	handle.RawToString = true
+	handle.MapType = reflect.TypeOf(map[string]any(nil))
+	return msgpackCodec{handle: handle}
+}
+
+func (msgpackCodec) Name() string { return "goroom.v1.msgpack" }
+
+func (msgpackCodec) Binary() bool { return true }
+
+// Encode encodes the event's fields and the version as a map
+func (c msgpackCodec) Encode(v any, version int) ([]byte, error) {
+	fields, err := toFields(v)
+	if err != nil {
+		return nil, err
+	}
+	if stamped(version) {
+		fields[versionField] = version
+	}
+
+	var data []byte
+	if err := ugorji.NewEncoderBytes(&data, c.handle).Encode(fields); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// Decode decodes a map into v
+func (c msgpackCodec) Decode(data []byte, v any) error {
+	var fields map[string]any
+	if err := ugorji.NewDecoderBytes(data, c.handle).Decode(&fields); err != nil {
+		return err
+	}
+	return fromFields(fields, v)
+}
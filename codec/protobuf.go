@@ -0,0 +1,102 @@
+package codec
+
+import (
+	"errors"
+	"fmt"
+
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// Field numbers of the Envelope message in envelope.proto
+const (
+	envelopeVersionField protowire.Number = 1
+	envelopeTypeField    protowire.Number = 2
+	envelopeFieldsField  protowire.Number = 3
+)
+
+// protobufCodec sends the envelope as an Envelope protobuf message in binary frames.
+// The type has its own field, the other fields go in a google.protobuf.Struct.
+type protobufCodec struct{}
+
+func (protobufCodec) Name() string { return "goroom.v1.protobuf" }
+
+func (protobufCodec) Binary() bool { return true }
+
+// Encode encodes the event as an Envelope
+func (protobufCodec) Encode(v any, version int) ([]byte, error) {
+	fields, err := toFields(v)
+	if err != nil {
+		return nil, err
+	}
+	msgType, _ := fields["type"].(string)
+	delete(fields, "type")
+
+	payload, err := structpb.NewStruct(fields)
+	if err != nil {
+		return nil, err
+	}
+	payloadBytes, err := proto.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	var data []byte
+	if stamped(version) {
+		data = protowire.AppendTag(data, envelopeVersionField, protowire.VarintType)
+		data = protowire.AppendVarint(data, uint64(version))
+	}
+	data = protowire.AppendTag(data, envelopeTypeField, protowire.BytesType)
+	data = protowire.AppendString(data, msgType)
+	data = protowire.AppendTag(data, envelopeFieldsField, protowire.BytesType)
+	data = protowire.AppendBytes(data, payloadBytes)
+	return data, nil
+}
+
+// Decode decodes an Envelope into v, skipping unknown fields
+func (protobufCodec) Decode(data []byte, v any) error {
+	var (
+		version uint64
+		msgType string
+		payload structpb.Struct
+	)
+	for len(data) > 0 {
+		number, wireType, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+
+		switch {
+		case number == envelopeVersionField && wireType == protowire.VarintType:
+			version, n = protowire.ConsumeVarint(data)
+		case number == envelopeTypeField && wireType == protowire.BytesType:
+			msgType, n = protowire.ConsumeString(data)
+		case number == envelopeFieldsField && wireType == protowire.BytesType:
+			var payloadBytes []byte
+			payloadBytes, n = protowire.ConsumeBytes(data)
+			if n >= 0 {
+				if err := proto.Unmarshal(payloadBytes, &payload); err != nil {
+					return fmt.Errorf("invalid envelope fields: %w", err)
+				}
+			}
+		default:
+			n = protowire.ConsumeFieldValue(number, wireType, data)
+		}
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+	}
+	if msgType == "" {
+		return errors.New("envelope without a type")
+	}
+
+	fields := payload.AsMap()
+	fields["type"] = msgType
+	if version != 0 {
+		fields[versionField] = version
+	}
+	return fromFields(fields, v)
+}
@@ -1,39 +1,187 @@
 package configuration
 
 import (
-	"encoding/json"
-	"os"
+	"compress/flate"
+	"time"
 )
 
+// Config holds every setting of the server. It is built from layers applied in
+// order: defaults, the config file, environment variables and command line flags.
+//
+// Fields tagged env are read from that environment variable and fields tagged flag
+// from that command line flag. Secrets have no flag, since command lines are
+// visible to every user of the machine.
 type Config struct {
-	HttpPort string `json:"httpPort"`
-}
-
-func LoadConfig(path string) (*Config, error) {
-	var config Config
-
-	// Попробовать загрузить из файла
-	data, err := os.ReadFile(path)
-	if err != nil {
-		// Если файла нет (например, на Render) - использовать ENV переменные
-		port := os.Getenv("PORT")
-		if port == "" {
-			port = "8080"
-		}
-		config.HttpPort = ":" + port
-		return &config, nil
-	}
+	HttpPort string `json:"httpPort" env:"PORT" flag:"http-port"`
+	// AdminPort serves the admin API on its own port instead of on HttpPort
+	AdminPort string `json:"adminPort" env:"ADMIN_PORT" flag:"admin-port"`
 
-	// Если файл есть - парсим его
-	err = json.Unmarshal(data, &config)
-	if err != nil {
-		return nil, err
-	}
+	// Broker connecting nodes: "memory" for a single node, "redis" to share
+	// matching and message delivery with other nodes through Redis
+	Broker        string `json:"broker" env:"BROKER" flag:"broker"`
+	RedisAddr     string `json:"redisAddr" env:"REDIS_ADDR" flag:"redis-addr"`
+	RedisPassword string `json:"redisPassword" env:"REDIS_PASSWORD"`
+	// NodeId identifies this instance to other nodes, generated if empty
+	NodeId string `json:"nodeId" env:"NODE_ID" flag:"node-id"`
 
-	// Переопределить порт из ENV если задан (приоритет ENV)
-	if envPort := os.Getenv("PORT"); envPort != "" {
-		config.HttpPort = ":" + envPort
-	}
+	// EventLoop runs every hub state change on a single goroutine
+	EventLoop bool `json:"eventLoop" env:"EVENT_LOOP" flag:"event-loop"`
+
+	// Http3Port enables an HTTP/3 listener with WebTransport on this UDP port,
+	// serving TLS with the certificate and key files
+	Http3Port   string `json:"http3Port" env:"HTTP3_PORT" flag:"http3-port"`
+	TLSCertFile string `json:"tlsCertFile" env:"TLS_CERT_FILE" flag:"tls-cert-file"`
+	TLSKeyFile  string `json:"tlsKeyFile" env:"TLS_KEY_FILE" flag:"tls-key-file"`
+
+	// Compression negotiates permessage-deflate with WebSocket clients offering it.
+	// CompressionLevel is a compress/flate level, 0 being no compression rather than a default;
+	// payloads under CompressionThreshold bytes are sent uncompressed, 0 for the default.
+	Compression          bool `json:"compression" env:"WS_COMPRESSION" flag:"compression"`
+	CompressionLevel     int  `json:"compressionLevel" env:"WS_COMPRESSION_LEVEL" flag:"compression-level"`
+	CompressionThreshold int  `json:"compressionThreshold" env:"WS_COMPRESSION_THRESHOLD" flag:"compression-threshold"`
+
+	// DebugAddr serves /debug/vars on a separate listener, such as "localhost:6060",
+	// disabled if empty. It must not be reachable from the public network.
+	DebugAddr string `json:"debugAddr" env:"DEBUG_ADDR" flag:"debug-addr"`
+
+	Timeouts   Timeouts   `json:"timeouts"`
+	Limits     Limits     `json:"limits"`
+	Matching   Matching   `json:"matching"`
+	Moderation Moderation `json:"moderation"`
+	Auth       Auth       `json:"auth"`
+	Transports Transports `json:"transports"`
+	Logging    Logging    `json:"logging"`
+	Tracing    Tracing    `json:"tracing"`
+	Events     Events     `json:"events"`
+	Store      Store      `json:"store"`
+}
 
-	return &config, nil
+// Timeouts of the HTTP listener. Upgraded connections and event streams aren't
+// bound by them once established.
+type Timeouts struct {
+	// ReadHeader bounds reading the headers of a request
+	ReadHeader Duration `json:"readHeader" env:"READ_HEADER_TIMEOUT" flag:"read-header-timeout"`
+	// Idle is how long a keep-alive connection may wait for its next request
+	Idle Duration `json:"idle" env:"IDLE_TIMEOUT" flag:"idle-timeout"`
+}
+
+// Limits on what chats keep and for how long
+type Limits struct {
+	MessageHistorySize    int      `json:"messageHistorySize" env:"MESSAGE_HISTORY_SIZE" flag:"message-history-size"`
+	EditWindow            Duration `json:"editWindow" env:"EDIT_WINDOW" flag:"edit-window"`
+	TranscriptMaxMessages int      `json:"transcriptMaxMessages" env:"TRANSCRIPT_MAX_MESSAGES" flag:"transcript-max-messages"`
+	TranscriptRetention   Duration `json:"transcriptRetention" env:"TRANSCRIPT_RETENTION" flag:"transcript-retention"`
+	ChannelTTL            Duration `json:"channelTTL" env:"CHANNEL_TTL" flag:"channel-ttl"`
+}
+
+// Matching settings
+type Matching struct {
+	// Enabled lets users look for strangers, turned off for maintenance
+	Enabled bool `json:"enabled" env:"MATCHING_ENABLED" flag:"matching"`
+}
+
+// Moderation settings of the rating system
+type Moderation struct {
+	ReputationHalfLife Duration `json:"reputationHalfLife" env:"REPUTATION_HALF_LIFE" flag:"reputation-half-life"`
+	RatingWindow       Duration `json:"ratingWindow" env:"RATING_WINDOW" flag:"rating-window"`
+	// AuditSize is how many of the latest entries the audit trail keeps. Every
+	// entry is kept if 0, as operators may need the full history.
+	AuditSize int `json:"auditSize" env:"AUDIT_SIZE" flag:"audit-size"`
+}
+
+// Auth settings of operator endpoints
+type Auth struct {
+	// AdminToken is the bearer token operator endpoints require, which are disabled without one
+	AdminToken string `json:"adminToken" env:"ADMIN_TOKEN"`
+	// Moderators lists the accounts of the moderation dashboard as "name:role:token",
+	// the role being viewer, moderator or admin
+	Moderators []string `json:"moderators" env:"MODERATORS"`
+	// SessionSecret signs the tokens clients resume their session with. Nodes
+	// sharing a broker need the same one. A random one is used if empty, so
+	// sessions can't be resumed on another node or after a restart.
+	SessionSecret string `json:"sessionSecret" env:"SESSION_SECRET"`
+}
+
+// Transports settings shared by the WebSocket, SSE and WebTransport endpoints
+type Transports struct {
+	// SSE serves the Server-Sent Events fallback
+	SSE bool `json:"sse" env:"SSE_ENABLED" flag:"sse"`
+	// AllowedOrigins lists the origins browsers may connect from, any if empty
+	AllowedOrigins []string `json:"allowedOrigins" env:"ALLOWED_ORIGINS" flag:"allowed-origins"`
+	// TrustedProxies lists the proxies whose X-Forwarded-For header gives the client
+	// address, such as for IP bans. No proxy is trusted if empty.
+	TrustedProxies []string `json:"trustedProxies" env:"TRUSTED_PROXIES" flag:"trusted-proxies"`
+}
+
+// Logging settings of the server log
+type Logging struct {
+	// Level is the least severe level logged: debug, info, warn or error
+	Level string `json:"level" env:"LOG_LEVEL" flag:"log-level"`
+	// Format is text or json
+	Format string `json:"format" env:"LOG_FORMAT" flag:"log-format"`
+	// Content logs the text users send, which is redacted otherwise
+	Content bool `json:"content" env:"LOG_CONTENT" flag:"log-content"`
+}
+
+// Tracing settings of the OpenTelemetry spans covering the message path
+type Tracing struct {
+	// Exporter is none, stdout or otlp
+	Exporter string `json:"exporter" env:"TRACING_EXPORTER" flag:"tracing-exporter"`
+	// Endpoint is the host:port of the OTLP/HTTP collector, localhost:4318 if empty
+	Endpoint string `json:"endpoint" env:"TRACING_ENDPOINT" flag:"tracing-endpoint"`
+	// Insecure sends spans to the collector over plain HTTP
+	Insecure bool `json:"insecure" env:"TRACING_INSECURE" flag:"tracing-insecure"`
+	// SampleRatio is the share of traces recorded, from 0 to 1
+	SampleRatio float64 `json:"sampleRatio" env:"TRACING_SAMPLE_RATIO" flag:"tracing-sample-ratio"`
+}
+
+// Events settings of the domain events sent to other services
+type Events struct {
+	// AuditFile appends every event to this file as JSON lines, none if empty
+	AuditFile string `json:"auditFile" env:"EVENTS_AUDIT_FILE" flag:"events-audit-file"`
+	// Webhooks lists the URLs events are posted to
+	Webhooks []string `json:"webhooks" env:"EVENTS_WEBHOOKS" flag:"events-webhooks"`
+	// WebhookSecret signs webhook requests
+	WebhookSecret string `json:"webhookSecret" env:"EVENTS_WEBHOOK_SECRET"`
+	// WebhookEvents lists the event types webhooks get, every type if empty
+	WebhookEvents []string `json:"webhookEvents" env:"EVENTS_WEBHOOK_EVENTS" flag:"events-webhook-events"`
+}
+
+// Store settings of the data kept across chats: bans, reports, reputation,
+// the audit trail and transcripts
+type Store struct {
+	// Driver is sqlite for a database file surviving restarts, broker to keep it in
+	// the broker, shared with the other nodes, or memory for this process only
+	Driver string `json:"driver" env:"STORE_DRIVER" flag:"store"`
+	// Path is the SQLite database file
+	Path string `json:"path" env:"STORE_PATH" flag:"store-path"`
+}
+
+// Default returns the configuration used for settings no layer sets
+func Default() *Config {
+	return &Config{
+		HttpPort:             ":8080",
+		CompressionLevel:     flate.BestSpeed,
+		CompressionThreshold: 256,
+		Timeouts: Timeouts{
+			ReadHeader: Duration(10 * time.Second),
+			Idle:       Duration(2 * time.Minute),
+		},
+		Limits: Limits{
+			MessageHistorySize:    200,
+			EditWindow:            Duration(5 * time.Minute),
+			TranscriptMaxMessages: 500,
+			TranscriptRetention:   Duration(15 * time.Minute),
+			ChannelTTL:            Duration(7 * 24 * time.Hour),
+		},
+		Matching: Matching{Enabled: true},
+		Moderation: Moderation{
+			ReputationHalfLife: Duration(30 * time.Minute),
+			RatingWindow:       Duration(10 * time.Minute),
+		},
+		Transports: Transports{SSE: true},
+		Logging:    Logging{Level: "info", Format: "text"},
+		Tracing:    Tracing{Exporter: "none", SampleRatio: 1},
+		Store:      Store{Driver: "sqlite", Path: "goroom.db"},
+	}
 }
@@ -0,0 +1,289 @@
+package configuration
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// clearEnv blanks every variable a setting is read from, which the environment
+// layer ignores, so the tests don't depend on the environment they run in
+func clearEnv(t *testing.T) {
+	t.Helper()
+	t.Setenv("CONFIG_FILE", "")
+	for _, s := range settings(Default()) {
+		if name := s.field.Tag.Get("env"); name != "" {
+			t.Setenv(name, "")
+		}
+	}
+}
+
+// writeConfig writes a config file named name to a temporary directory
+func writeConfig(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	return path
+}
+
+func TestLoadAppliesLayersInOrder(t *testing.T) {
+	const file = `{"httpPort": "9000", "logging": {"level": "debug"}, "limits": {"editWindow": "1m"}}`
+	tests := []struct {
+		name       string
+		file       string
+		env        map[string]string
+		args       []string
+		wantPort   string
+		wantLevel  string
+		wantWindow time.Duration
+	}{
+		{name: "defaults", wantPort: ":8080", wantLevel: "info", wantWindow: 5 * time.Minute},
+		{name: "file over defaults", file: file,
+			wantPort: ":9000", wantLevel: "debug", wantWindow: time.Minute},
+		{name: "environment over file", file: file, env: map[string]string{"PORT": "9100"},
+			wantPort: ":9100", wantLevel: "debug", wantWindow: time.Minute},
+		{name: "empty variable ignored", file: file, env: map[string]string{"LOG_LEVEL": ""},
+			wantPort: ":9000", wantLevel: "debug", wantWindow: time.Minute},
+		{name: "flags over environment", file: file,
+			env:      map[string]string{"PORT": "9100", "LOG_LEVEL": "warn"},
+			args:     []string{"-http-port", "9200", "-edit-window", "30s"},
+			wantPort: ":9200", wantLevel: "warn", wantWindow: 30 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clearEnv(t)
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+			args := tt.args
+			if tt.file != "" {
+				args = append([]string{"-config", writeConfig(t, "config.json", tt.file)}, args...)
+			}
+
+			m, err := NewManager(args)
+			if err != nil {
+				t.Fatalf("NewManager: %v", err)
+			}
+			cfg := m.Current()
+			if cfg.HttpPort != tt.wantPort || cfg.Logging.Level != tt.wantLevel || cfg.Limits.EditWindow.Std() != tt.wantWindow {
+				t.Errorf("httpPort, logging.level, limits.editWindow = %q, %q, %v, want %q, %q, %v",
+					cfg.HttpPort, cfg.Logging.Level, cfg.Limits.EditWindow, tt.wantPort, tt.wantLevel, tt.wantWindow)
+			}
+		})
+	}
+}
+
+func TestLoadReadsEveryFileFormat(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr []string // Substrings of the error, none if the file is valid
+	}{
+		{name: "config.json",
+			content: `{"httpPort": "9000", "limits": {"messageHistorySize": 50}, "auth": {"moderators": ["ann:viewer:0123456789abcdef"]}}`},
+		{name: "config.yaml",
+			content: "httpPort: \"9000\"\nlimits:\n  messageHistorySize: 50\nauth:\n  moderators: [\"ann:viewer:0123456789abcdef\"]\n"},
+		{name: "config.toml",
+			content: "httpPort = \"9000\"\n[limits]\nmessageHistorySize = 50\n[auth]\nmoderators = [\"ann:viewer:0123456789abcdef\"]\n"},
+		{name: "unknown.json",
+			content: `{"httpPort": "9000", "limits": {"messageHistory": 50}, "cache": {"size": 1}}`,
+			wantErr: []string{"limits.messageHistory: unknown setting", "cache: unknown setting"}},
+		{name: "unknown.yaml",
+			content: "httpPort: \"9000\"\nlimits:\n  messageHistory: 50\ncache:\n  size: 1\n",
+			wantErr: []string{"limits.messageHistory: unknown setting", "cache: unknown setting"}},
+		{name: "unknown.toml",
+			content: "httpPort = \"9000\"\n[limits]\nmessageHistory = 50\n[cache]\nsize = 1\n",
+			wantErr: []string{"limits.messageHistory: unknown setting", "cache: unknown setting"}},
+		{name: "setting as section.json", content: `{"httpPort": {"port": 9000}}`,
+			wantErr: []string{"httpPort: must be a string"}},
+		{name: "config.ini", content: "httpPort = 9000\n",
+			wantErr: []string{`unsupported config format ".ini"`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clearEnv(t)
+			m, err := NewManager([]string{"-config", writeConfig(t, tt.name, tt.content)})
+			if len(tt.wantErr) == 0 {
+				if err != nil {
+					t.Fatalf("NewManager: %v", err)
+				}
+				cfg := m.Current()
+				if cfg.HttpPort != ":9000" || cfg.Limits.MessageHistorySize != 50 || len(cfg.Auth.Moderators) != 1 {
+					t.Errorf("loaded %q, %d, %v", cfg.HttpPort, cfg.Limits.MessageHistorySize, cfg.Auth.Moderators)
+				}
+				return
+			}
+			for _, want := range tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), want) {
+					t.Errorf("error = %v, want it to contain %q", err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadRejectsInvalidValues(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		env     map[string]string
+		args    []string
+		wantErr string
+	}{
+		{name: "wrong type", file: `{"matching": {"enabled": "yes"}}`,
+			wantErr: `matching.enabled: must be true or false, got "yes"`},
+		{name: "bad duration", file: `{"limits": {"editWindow": "5 minutes"}}`,
+			wantErr: `limits.editWindow: must be a duration such as "5m", got "5 minutes"`},
+		{name: "not a list", file: `{"transports": {"allowedOrigins": "https://example.com"}}`,
+			wantErr: "transports.allowedOrigins: must be a list"},
+		{name: "compression level", file: `{"compressionLevel": 10}`,
+			wantErr: "compressionLevel must be between -2 and 9, got 10"},
+		{name: "non-positive limit", file: `{"limits": {"messageHistorySize": 0}}`,
+			wantErr: "limits.messageHistorySize must be positive"},
+		{name: "redis without address", file: `{"broker": "redis"}`,
+			wantErr: "broker: redis requires redisAddr"},
+		{name: "unknown broker", file: `{"broker": "kafka"}`,
+			wantErr: `broker: must be memory or redis, got "kafka"`},
+		{name: "negative audit size", file: `{"moderation": {"auditSize": -1}}`,
+			wantErr: "moderation.auditSize must not be negative"},
+		{name: "http3 without TLS", file: `{"http3Port": "4433"}`,
+			wantErr: "http3Port requires tlsCertFile and tlsKeyFile"},
+		{name: "origin with path", file: `{"transports": {"allowedOrigins": ["https://example.com/chat"]}}`,
+			wantErr: `transports.allowedOrigins: "https://example.com/chat" must be a scheme and host`},
+		{name: "proxy hostname", file: `{"transports": {"trustedProxies": ["proxy.internal"]}}`,
+			wantErr: `transports.trustedProxies: "proxy.internal" must be an IP address or a CIDR range`},
+		{name: "moderator role", file: `{"auth": {"moderators": ["ann:owner:0123456789abcdef"]}}`,
+			wantErr: `auth.moderators: item 0: ann: role must be viewer, moderator or admin, got "owner"`},
+		{name: "moderator token", file: `{"auth": {"moderators": ["ann:viewer:short"]}}`,
+			wantErr: "auth.moderators: ann: token must be at least 16 characters"},
+		{name: "admin token", env: map[string]string{"ADMIN_TOKEN": "admin"},
+			wantErr: "auth.adminToken must be at least 16 characters"},
+		{name: "log level", file: `{"logging": {"level": "verbose"}}`,
+			wantErr: `logging.level must be debug, info, warn or error, got "verbose"`},
+		{name: "sample ratio", file: `{"tracing": {"sampleRatio": 2}}`,
+			wantErr: "tracing.sampleRatio must be between 0 and 1, got 2"},
+		{name: "unsigned webhooks", file: `{"events": {"webhooks": ["https://example.com/hook"]}}`,
+			wantErr: "events.webhookSecret must be at least 16 characters long"},
+		{name: "sqlite without path", file: `{"store": {"driver": "sqlite", "path": ""}}`,
+			wantErr: "store.path is required by the sqlite driver"},
+		{name: "shared admin port", file: `{"httpPort": "9000", "adminPort": "9000"}`,
+			wantErr: "adminPort must differ from httpPort"},
+		{name: "environment", env: map[string]string{"EDIT_WINDOW": "soon"},
+			wantErr: `environment: EDIT_WINDOW: must be a duration such as "5m", got "soon"`},
+		{name: "flag", args: []string{"-message-history-size", "many"},
+			wantErr: "flags: -message-history-size: must be an integer, got many"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clearEnv(t)
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+			args := tt.args
+			if tt.file != "" {
+				args = append([]string{"-config", writeConfig(t, "config.json", tt.file)}, args...)
+			}
+			if _, err := NewManager(args); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadReportsEveryProblem(t *testing.T) {
+	clearEnv(t)
+	path := writeConfig(t, "config.json", `{"compressionLevel": 10, "logging": {"level": "verbose"}}`)
+	_, err := NewManager([]string{"-config", path})
+	for _, want := range []string{"compressionLevel", "logging.level"} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("error = %v, want it to mention %s", err, want)
+		}
+	}
+}
+
+func TestKeepRestartOnly(t *testing.T) {
+	tests := []struct {
+		name        string
+		change      func(cfg *Config)
+		wantChanged []string
+		check       func(cfg *Config) bool // Whether next ended up as expected
+	}{
+		{name: "reloadable setting",
+			change: func(cfg *Config) { cfg.Logging.Level = "debug" },
+			check:  func(cfg *Config) bool { return cfg.Logging.Level == "debug" }},
+		{name: "port",
+			change:      func(cfg *Config) { cfg.HttpPort = ":9000" },
+			wantChanged: []string{"httpPort"},
+			check:       func(cfg *Config) bool { return cfg.HttpPort == ":8080" }},
+		{name: "debug listener",
+			change:      func(cfg *Config) { cfg.DebugAddr = "0.0.0.0:6060" },
+			wantChanged: []string{"debugAddr"},
+			check:       func(cfg *Config) bool { return cfg.DebugAddr == "" }},
+		{name: "section",
+			change:      func(cfg *Config) { cfg.Store.Path = "other.db" },
+			wantChanged: []string{"store"},
+			check:       func(cfg *Config) bool { return cfg.Store.Path == "goroom.db" }},
+		{name: "list",
+			change:      func(cfg *Config) { cfg.Transports.TrustedProxies = []string{"10.0.0.0/8"} },
+			wantChanged: []string{"transports.trustedProxies"},
+			check:       func(cfg *Config) bool { return cfg.Transports.TrustedProxies == nil }},
+		{name: "mixed",
+			change: func(cfg *Config) {
+				cfg.EventLoop, cfg.Auth.SessionSecret, cfg.Limits.ChannelTTL = true, "secret", Duration(time.Hour)
+			},
+			wantChanged: []string{"auth.sessionSecret", "eventLoop"},
+			check: func(cfg *Config) bool {
+				return !cfg.EventLoop && cfg.Auth.SessionSecret == "" && cfg.Limits.ChannelTTL == Duration(time.Hour)
+			}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next := Default()
+			tt.change(next)
+			if changed := keepRestartOnly(next, Default()); !slices.Equal(changed, tt.wantChanged) {
+				t.Errorf("changed = %v, want %v", changed, tt.wantChanged)
+			}
+			if !tt.check(next) {
+				t.Errorf("next = %+v", next)
+			}
+		})
+	}
+}
+
+func TestReloadKeepsRestartOnlySettings(t *testing.T) {
+	clearEnv(t)
+	path := writeConfig(t, "config.json", `{"httpPort": "9000", "logging": {"level": "info"}}`)
+	m, err := NewManager([]string{"-config", path})
+	if err != nil {
+		t.Fatalf("NewManager: %v", err)
+	}
+	var reloaded *Config
+	m.OnReload(func(cfg *Config) { reloaded = cfg })
+
+	if err := os.WriteFile(path, []byte(`{"httpPort": "9100", "logging": {"level": "debug"}}`), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if err := m.Reload(); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	if cfg := m.Current(); cfg != reloaded || cfg.HttpPort != ":9000" || cfg.Logging.Level != "debug" {
+		t.Errorf("after reload httpPort, logging.level = %q, %q, want the old port and the new level",
+			cfg.HttpPort, cfg.Logging.Level)
+	}
+
+	// An invalid file leaves the current configuration in effect
+	if err := os.WriteFile(path, []byte(`{"logging": {"level": "verbose"}}`), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if err := m.Reload(); err == nil {
+		t.Fatal("Reload of an invalid file succeeded")
+	}
+	if cfg := m.Current(); cfg.Logging.Level != "debug" {
+		t.Errorf("after a failed reload logging.level = %q, want debug", cfg.Logging.Level)
+	}
+}
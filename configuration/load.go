@@ -0,0 +1,164 @@
+package configuration
+
+import (
+	"compress/flate"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+)
+
+// minWebhookSecretLength is the shortest secret webhooks are signed with
+const minWebhookSecretLength = 16
+
+// load builds the configuration from its layers and validates it
+func load(f *flags) (*Config, error) {
+	cfg := Default()
+
+	path, required := f.configFile, true
+	if path == "" {
+		path, required = DefaultConfigFile, false
+	}
+	tree, err := readFile(path)
+	switch {
+	case err == nil:
+		if err := applyFile(cfg, tree); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	case errors.Is(err, os.ErrNotExist) && !required:
+		// Deployments such as Render configure everything through the environment
+	default:
+		return nil, err
+	}
+
+	if err := applyEnv(cfg); err != nil {
+		return nil, fmt.Errorf("environment: %w", err)
+	}
+	if err := applyFlags(cfg, f); err != nil {
+		return nil, fmt.Errorf("flags: %w", err)
+	}
+
+	normalize(cfg)
+	if err := validate(cfg); err != nil {
+		return nil, fmt.Errorf("invalid configuration:\n%w", err)
+	}
+	return cfg, nil
+}
+
+// normalize fills in settings derived from others
+func normalize(cfg *Config) {
+	// A bare port such as PORT=8080 listens on every interface
+	if cfg.HttpPort != "" && !strings.Contains(cfg.HttpPort, ":") {
+		cfg.HttpPort = ":" + cfg.HttpPort
+	}
+	if cfg.Http3Port != "" && !strings.Contains(cfg.Http3Port, ":") {
+		cfg.Http3Port = ":" + cfg.Http3Port
+	}
+	if cfg.AdminPort != "" && !strings.Contains(cfg.AdminPort, ":") {
+		cfg.AdminPort = ":" + cfg.AdminPort
+	}
+
+	// Setting a Redis address without choosing a broker selects Redis
+	if cfg.Broker == "" {
+		cfg.Broker = "memory"
+		if cfg.RedisAddr != "" {
+			cfg.Broker = "redis"
+		}
+	}
+}
+
+// validate checks every setting, reporting all problems at once
+func validate(cfg *Config) error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(cfg.HttpPort != "", "httpPort is required")
+	switch cfg.Broker {
+	case "memory":
+	case "redis":
+		check(cfg.RedisAddr != "", "broker: redis requires redisAddr")
+	default:
+		check(false, "broker: must be memory or redis, got %q", cfg.Broker)
+	}
+
+	if cfg.Http3Port != "" {
+		// HTTP/3 always runs over TLS
+		check(cfg.TLSCertFile != "" && cfg.TLSKeyFile != "", "http3Port requires tlsCertFile and tlsKeyFile")
+		for _, file := range []string{cfg.TLSCertFile, cfg.TLSKeyFile} {
+			if file != "" {
+				_, err := os.Stat(file)
+				check(err == nil, "%v", err)
+			}
+		}
+	}
+
+	check(cfg.CompressionLevel >= flate.HuffmanOnly && cfg.CompressionLevel <= flate.BestCompression,
+		"compressionLevel must be between -2 and 9, got %d", cfg.CompressionLevel)
+	check(cfg.CompressionThreshold >= 0, "compressionThreshold must not be negative")
+
+	check(cfg.Timeouts.ReadHeader >= 0, "timeouts.readHeader must not be negative")
+	check(cfg.Timeouts.Idle >= 0, "timeouts.idle must not be negative")
+
+	check(cfg.Limits.MessageHistorySize > 0, "limits.messageHistorySize must be positive")
+	check(cfg.Limits.EditWindow > 0, "limits.editWindow must be positive")
+	check(cfg.Limits.TranscriptMaxMessages > 0, "limits.transcriptMaxMessages must be positive")
+	check(cfg.Limits.TranscriptRetention > 0, "limits.transcriptRetention must be positive")
+	check(cfg.Limits.ChannelTTL > 0, "limits.channelTTL must be positive")
+
+	check(cfg.Moderation.ReputationHalfLife > 0, "moderation.reputationHalfLife must be positive")
+	check(cfg.Moderation.RatingWindow > 0, "moderation.ratingWindow must be positive")
+	check(cfg.Moderation.AuditSize >= 0, "moderation.auditSize must not be negative")
+
+	for _, origin := range cfg.Transports.AllowedOrigins {
+		if origin == "*" {
+			continue
+		}
+		u, err := url.Parse(origin)
+		check(err == nil && u.Scheme != "" && u.Host != "" && u.Path == "",
+			"transports.allowedOrigins: %q must be a scheme and host such as https://example.com", origin)
+	}
+	for _, proxy := range cfg.Transports.TrustedProxies {
+		_, _, cidrErr := net.ParseCIDR(proxy)
+		check(cidrErr == nil || net.ParseIP(proxy) != nil,
+			"transports.trustedProxies: %q must be an IP address or a CIDR range", proxy)
+	}
+	errs = append(errs, validateModerators(&cfg.Auth)...)
+
+	check(slices.Contains([]string{"debug", "info", "warn", "error"}, strings.ToLower(cfg.Logging.Level)),
+		"logging.level must be debug, info, warn or error, got %q", cfg.Logging.Level)
+	check(cfg.Logging.Format == "text" || cfg.Logging.Format == "json",
+		"logging.format must be text or json, got %q", cfg.Logging.Format)
+
+	switch cfg.Tracing.Exporter {
+	case "none", "stdout", "otlp":
+	default:
+		check(false, "tracing.exporter must be none, stdout or otlp, got %q", cfg.Tracing.Exporter)
+	}
+	check(cfg.Tracing.SampleRatio >= 0 && cfg.Tracing.SampleRatio <= 1,
+		"tracing.sampleRatio must be between 0 and 1, got %g", cfg.Tracing.SampleRatio)
+
+	for _, webhook := range cfg.Events.Webhooks {
+		u, err := url.Parse(webhook)
+		check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "",
+			"events.webhooks: %q must be an http or https URL", webhook)
+	}
+	check(len(cfg.Events.Webhooks) == 0 || len(cfg.Events.WebhookSecret) >= minWebhookSecretLength,
+		"events.webhookSecret must be at least %d characters long to sign webhooks", minWebhookSecretLength)
+
+	switch cfg.Store.Driver {
+	case "broker", "memory":
+	case "sqlite":
+		check(cfg.Store.Path != "", "store.path is required by the sqlite driver")
+	default:
+		check(false, "store.driver must be broker, memory or sqlite, got %q", cfg.Store.Driver)
+	}
+	check(cfg.AdminPort == "" || cfg.AdminPort != cfg.HttpPort, "adminPort must differ from httpPort")
+	return errors.Join(errs...)
+}
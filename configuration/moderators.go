@@ -0,0 +1,90 @@
+package configuration
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+const (
+	// AdminName is the moderator name of requests made with the admin token
+	AdminName = "admin"
+	// minModeratorTokenLength keeps moderator and admin tokens from being guessed
+	minModeratorTokenLength = 16
+)
+
+// moderatorRoles lists the roles of auth.moderators
+var moderatorRoles = []string{"viewer", "moderator", "admin"}
+
+// ModeratorAccount is a parsed entry of auth.moderators
+type ModeratorAccount struct {
+	Name string
+	// Role is viewer, moderator or admin
+	Role  string
+	token string
+}
+
+// parseModerator parses a "name:role:token" entry of auth.moderators.
+// The token comes last, so it may contain colons.
+func parseModerator(entry string) (*ModeratorAccount, error) {
+	parts := strings.SplitN(entry, ":", 3)
+	if len(parts) != 3 || parts[0] == "" || parts[2] == "" {
+		return nil, fmt.Errorf("must be name:role:token")
+	}
+	if !slices.Contains(moderatorRoles, parts[1]) {
+		return nil, fmt.Errorf("%s: role must be viewer, moderator or admin, got %q", parts[0], parts[1])
+	}
+	return &ModeratorAccount{Name: parts[0], Role: parts[1], token: parts[2]}, nil
+}
+
+// Moderator returns the account a token belongs to. The admin token signs in as
+// the admin role. Every account is compared, in constant time.
+func (a *Auth) Moderator(token string) (*ModeratorAccount, bool) {
+	if token == "" {
+		return nil, false
+	}
+
+	var found *ModeratorAccount
+	if a.AdminToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(a.AdminToken)) == 1 {
+		found = &ModeratorAccount{Name: AdminName, Role: "admin"}
+	}
+	for _, entry := range a.Moderators {
+		account, err := parseModerator(entry)
+		if err != nil {
+			continue
+		}
+		if subtle.ConstantTimeCompare([]byte(token), []byte(account.token)) == 1 && found == nil {
+			found = account
+		}
+	}
+	return found, found != nil
+}
+
+// validateModerators checks the admin token and the entries of auth.moderators
+func validateModerators(auth *Auth) []error {
+	var errs []error
+	if auth.AdminToken != "" && len(auth.AdminToken) < minModeratorTokenLength {
+		errs = append(errs, fmt.Errorf("auth.adminToken must be at least %d characters", minModeratorTokenLength))
+	}
+	names, tokens := map[string]bool{AdminName: true}, map[string]bool{auth.AdminToken: true}
+	for i, entry := range auth.Moderators {
+		account, err := parseModerator(entry)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("auth.moderators: item %d: %w", i, err))
+			continue
+		}
+		if names[account.Name] {
+			errs = append(errs, fmt.Errorf("auth.moderators: name %q is taken", account.Name))
+		}
+		if tokens[account.token] {
+			errs = append(errs, fmt.Errorf("auth.moderators: %s: token is used by another account", account.Name))
+		}
+		if len(account.token) < minModeratorTokenLength {
+			errs = append(errs, fmt.Errorf("auth.moderators: %s: token must be at least %d characters",
+				account.Name, minModeratorTokenLength))
+		}
+		names[account.Name], tokens[account.token] = true, true
+	}
+	return errs
+}
@@ -0,0 +1,165 @@
+package configuration
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"os/signal"
+	"reflect"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// watchInterval is how often the config file is checked for changes
+const watchInterval = 2 * time.Second
+
+// Manager holds the current configuration and reloads it on SIGHUP or when the
+// config file changes. Settings read once at startup, such as ports and the
+// broker, keep their startup values until the server restarts.
+type Manager struct {
+	flags    *flags
+	current  atomic.Pointer[Config]
+	onReload []func(cfg *Config)
+	mu       sync.Mutex
+}
+
+// NewManager loads the configuration from the defaults, the config file, the
+// environment and the command line arguments
+func NewManager(args []string) (*Manager, error) {
+	f, err := parseFlags(args)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := load(f)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Manager{flags: f, mu: sync.Mutex{}}
+	m.current.Store(cfg)
+	return m, nil
+}
+
+// Current returns the configuration in effect. It must not be modified.
+func (m *Manager) Current() *Config {
+	return m.current.Load()
+}
+
+// OnReload registers fn to be called with the new configuration after each reload
+func (m *Manager) OnReload(fn func(cfg *Config)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.onReload = append(m.onReload, fn)
+}
+
+// Reload loads the configuration again. If it is invalid the current one stays in effect.
+func (m *Manager) Reload() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	next, err := load(m.flags)
+	if err != nil {
+		return err
+	}
+	running := m.current.Load()
+	for _, path := range keepRestartOnly(next, running) {
+		slog.Warn("Config setting changed, restart the server to apply it", "setting", path)
+	}
+
+	m.current.Store(next)
+	for _, fn := range m.onReload {
+		fn(next)
+	}
+	slog.Info("Configuration reloaded")
+	return nil
+}
+
+// Watch reloads the configuration on SIGHUP and when the config file is
+// modified, until ctx is done
+func (m *Manager) Watch(ctx context.Context) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+
+	go func() {
+		defer signal.Stop(hangup)
+		ticker := time.NewTicker(watchInterval)
+		defer ticker.Stop()
+
+		modified := m.fileModTime()
+		for {
+			select {
+			case <-hangup:
+				m.reloadAndLog()
+			case <-ticker.C:
+				if t := m.fileModTime(); !t.Equal(modified) {
+					modified = t
+					m.reloadAndLog()
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+func (m *Manager) reloadAndLog() {
+	if err := m.Reload(); err != nil {
+		slog.Error("Error reloading configuration, keeping the current one", slog.Any("error", err))
+	}
+}
+
+// fileModTime returns when the config file was last modified, zero if there is none
+func (m *Manager) fileModTime() time.Time {
+	path := m.flags.configFile
+	if path == "" {
+		path = DefaultConfigFile
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+// keepRestartOnly copies the settings that only take effect at startup from the
+// running configuration into next, returning the paths of those that differed
+func keepRestartOnly(next, running *Config) []string {
+	restartOnly := func(cfg *Config) map[string]any {
+		return map[string]any{
+			"httpPort":                  &cfg.HttpPort,
+			"adminPort":                 &cfg.AdminPort,
+			"broker":                    &cfg.Broker,
+			"redisAddr":                 &cfg.RedisAddr,
+			"redisPassword":             &cfg.RedisPassword,
+			"nodeId":                    &cfg.NodeId,
+			"debugAddr":                 &cfg.DebugAddr,
+			"eventLoop":                 &cfg.EventLoop,
+			"http3Port":                 &cfg.Http3Port,
+			"tlsCertFile":               &cfg.TLSCertFile,
+			"tlsKeyFile":                &cfg.TLSKeyFile,
+			"timeouts":                  &cfg.Timeouts,
+			"auth.sessionSecret":        &cfg.Auth.SessionSecret,
+			"transports.sse":            &cfg.Transports.SSE,
+			"transports.trustedProxies": &cfg.Transports.TrustedProxies,
+			"logging.format":            &cfg.Logging.Format,
+			"tracing":                   &cfg.Tracing,
+			"events":                    &cfg.Events,
+			"store":                     &cfg.Store,
+		}
+	}
+
+	nextFields, runningFields := restartOnly(next), restartOnly(running)
+	var changed []string
+	for path, field := range nextFields {
+		target, source := reflect.ValueOf(field).Elem(), reflect.ValueOf(runningFields[path]).Elem()
+		if !reflect.DeepEqual(target.Interface(), source.Interface()) {
+			changed = append(changed, path)
+			target.Set(source)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
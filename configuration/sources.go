@@ -0,0 +1,323 @@
+package configuration
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultConfigFile is read when no config file is given and it exists
+const DefaultConfigFile = "config.json"
+
+var durationType = reflect.TypeFor[Duration]()
+
+// setting is a field of Config together with its path in config files
+type setting struct {
+	path  string // e.g. "limits.editWindow"
+	field reflect.StructField
+	value reflect.Value
+}
+
+// settings lists the leaf fields of cfg in declaration order
+func settings(cfg *Config) []setting {
+	var list []setting
+	var walk func(v reflect.Value, prefix string)
+	walk = func(v reflect.Value, prefix string) {
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			path := prefix + jsonName(field)
+			if field.Type.Kind() == reflect.Struct && field.Type != durationType {
+				walk(v.Field(i), path+".")
+				continue
+			}
+			list = append(list, setting{path: path, field: field, value: v.Field(i)})
+		}
+	}
+	walk(reflect.ValueOf(cfg).Elem(), "")
+	return list
+}
+
+// jsonName returns the key of a field in config files
+func jsonName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "" {
+		return field.Name
+	}
+	return name
+}
+
+// readFile decodes a JSON, YAML or TOML config file, chosen by its extension,
+// into a tree of generic values
+func readFile(path string) (map[string]any, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	tree := map[string]any{}
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".json":
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+		err = decoder.Decode(&tree)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &tree)
+	case ".toml":
+		err = toml.Unmarshal(data, &tree)
+	default:
+		return nil, fmt.Errorf("%s: unsupported config format %q, use .json, .yaml or .toml", path, ext)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return tree, nil
+}
+
+// applyFile sets the settings present in a decoded config file. Unknown keys are
+// errors, so a typo can't silently leave a setting at its default.
+func applyFile(cfg *Config, tree map[string]any) error {
+	known := map[string]setting{}
+	for _, s := range settings(cfg) {
+		known[s.path] = s
+	}
+
+	var errs []error
+	var walk func(node map[string]any, prefix string)
+	walk = func(node map[string]any, prefix string) {
+		for _, key := range slices.Sorted(maps.Keys(node)) {
+			path, value := prefix+key, node[key]
+			if s, ok := known[path]; ok {
+				if err := setValue(s.value, value); err != nil {
+					errs = append(errs, fmt.Errorf("%s: %w", path, err))
+				}
+				continue
+			}
+			if section, ok := value.(map[string]any); ok && isSection(known, path) {
+				walk(section, path+".")
+				continue
+			}
+			errs = append(errs, fmt.Errorf("%s: unknown setting", path))
+		}
+	}
+	walk(tree, "")
+	return errors.Join(errs...)
+}
+
+// isSection reports whether path names a group of settings such as "limits"
+func isSection(known map[string]setting, path string) bool {
+	for p := range known {
+		if strings.HasPrefix(p, path+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// applyEnv sets the settings whose environment variable is set
+func applyEnv(cfg *Config) error {
+	var errs []error
+	for _, s := range settings(cfg) {
+		name := s.field.Tag.Get("env")
+		if name == "" {
+			continue
+		}
+		if raw, ok := os.LookupEnv(name); ok && raw != "" {
+			if err := setString(s.value, raw); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// flags are the command line arguments, parsed once at startup and applied
+// again on every reload
+type flags struct {
+	configFile string
+	values     map[string]string // flag name -> raw value
+}
+
+// parseFlags parses the command line. Every setting with a flag tag gets a flag,
+// plus -config naming the config file.
+func parseFlags(args []string) (*flags, error) {
+	parsed := &flags{values: map[string]string{}}
+	set := flag.NewFlagSet("goroom", flag.ContinueOnError)
+	set.StringVar(&parsed.configFile, "config", "",
+		"config file (.json, .yaml or .toml), "+DefaultConfigFile+" if it exists")
+
+	for _, s := range settings(Default()) {
+		name := s.field.Tag.Get("flag")
+		if name == "" {
+			continue
+		}
+		usage := "sets " + s.path
+		if s.value.Kind() == reflect.Bool {
+			set.BoolFunc(name, usage, func(raw string) error {
+				parsed.values[name] = raw
+				return nil
+			})
+			continue
+		}
+		set.Func(name, usage, func(raw string) error {
+			parsed.values[name] = raw
+			return nil
+		})
+	}
+
+	if err := set.Parse(args); err != nil {
+		return nil, err
+	}
+	if set.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected argument %q", set.Arg(0))
+	}
+	if parsed.configFile == "" {
+		parsed.configFile = os.Getenv("CONFIG_FILE")
+	}
+	return parsed, nil
+}
+
+// applyFlags sets the settings given on the command line
+func applyFlags(cfg *Config, f *flags) error {
+	var errs []error
+	for _, s := range settings(cfg) {
+		name := s.field.Tag.Get("flag")
+		if raw, ok := f.values[name]; ok && name != "" {
+			if err := setString(s.value, raw); err != nil {
+				errs = append(errs, fmt.Errorf("-%s: %w", name, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// setString sets a setting from an environment variable or flag.
+// Lists are comma separated.
+func setString(v reflect.Value, raw string) error {
+	if v.Kind() == reflect.Slice {
+		var items []any
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		return setValue(v, items)
+	}
+	return setValue(v, raw)
+}
+
+// setValue sets a setting from a value decoded from a config file, or from a
+// string given in the environment or on the command line
+func setValue(v reflect.Value, value any) error {
+	if v.Type() == durationType {
+		s, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("must be a duration such as \"5m\", got %v", value)
+		}
+		return v.Addr().Interface().(*Duration).UnmarshalText([]byte(s))
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		s, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("must be a string, got %v", value)
+		}
+		v.SetString(s)
+	case reflect.Bool:
+		switch b := value.(type) {
+		case bool:
+			v.SetBool(b)
+		case string:
+			parsed, err := strconv.ParseBool(b)
+			if err != nil {
+				return fmt.Errorf("must be true or false, got %q", b)
+			}
+			v.SetBool(parsed)
+		default:
+			return fmt.Errorf("must be true or false, got %v", value)
+		}
+	case reflect.Int:
+		n, err := toInt(value)
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Float64:
+		f, err := toFloat(value)
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	case reflect.Slice:
+		items, ok := value.([]any)
+		if !ok {
+			return fmt.Errorf("must be a list, got %v", value)
+		}
+		list := reflect.MakeSlice(v.Type(), len(items), len(items))
+		for i, item := range items {
+			if err := setValue(list.Index(i), item); err != nil {
+				return fmt.Errorf("item %d: %w", i, err)
+			}
+		}
+		v.Set(list)
+	default:
+		return fmt.Errorf("unsupported setting type %s", v.Type())
+	}
+	return nil
+}
+
+// toInt converts the integer types the file decoders produce
+func toInt(value any) (int64, error) {
+	switch n := value.(type) {
+	case int:
+		return int64(n), nil
+	case int64:
+		return n, nil
+	case uint64:
+		return int64(n), nil
+	case json.Number:
+		if i, err := n.Int64(); err == nil {
+			return i, nil
+		}
+	case string:
+		if i, err := strconv.ParseInt(n, 10, 64); err == nil {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("must be an integer, got %v", value)
+}
+
+// toFloat converts the number types the file decoders produce
+func toFloat(value any) (float64, error) {
+	switch n := value.(type) {
+	case float64:
+		return n, nil
+	case int:
+		return float64(n), nil
+	case int64:
+		return float64(n), nil
+	case uint64:
+		return float64(n), nil
+	case json.Number:
+		if f, err := n.Float64(); err == nil {
+			return f, nil
+		}
+	case string:
+		if f, err := strconv.ParseFloat(n, 64); err == nil {
+			return f, nil
+		}
+	}
+	return 0, fmt.Errorf("must be a number, got %v", value)
+}
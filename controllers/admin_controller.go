@@ -0,0 +1,420 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"realTimeService/dtos"
+	"realTimeService/hubs"
+	"realTimeService/interfaces"
+	"realTimeService/logging"
+	"realTimeService/middlewares"
+	"realTimeService/models"
+	"realTimeService/services"
+	"realTimeService/transport"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// defaultKickReason is sent to clients an operator disconnects without giving a reason
+const defaultKickReason = "disconnected by an operator"
+
+// AdminController serves the operator API. Lists cover this node; actions on
+// sessions, bans and announcements apply to the whole cluster.
+type AdminController struct {
+	container interfaces.Container
+}
+
+// NewAdminController creates a new admin controller
+func NewAdminController(container interfaces.Container) *AdminController {
+	return &AdminController{container: container}
+}
+
+// kickRequest is the body of a kick
+type kickRequest struct {
+	Reason string `json:"reason"`
+}
+
+// banRequest is the body of a new ban, which needs a session, an IP address or both
+type banRequest struct {
+	UserId   uuid.UUID `json:"userId"`
+	IP       string    `json:"ip"`
+	Reason   string    `json:"reason"`
+	Duration string    `json:"duration"` // e.g. "24h", empty for a permanent ban
+}
+
+// announcementRequest is the body of an announcement
+type announcementRequest struct {
+	Text string `json:"text"`
+}
+
+// resolveReportRequest is the body of a report resolution, optionally banning the reported user
+type resolveReportRequest struct {
+	Note     string `json:"note"`
+	Ban      bool   `json:"ban"`      // Bans the reported session and its address, if known
+	Duration string `json:"duration"` // Ban duration, empty for a permanent ban
+}
+
+// matchingRequest is the body of a matching toggle
+type matchingRequest struct {
+	Enabled *bool `json:"enabled"`
+}
+
+// Stats returns counters of this node
+func (c *AdminController) Stats(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, nodeStats(c.container.GetHub()))
+}
+
+// nodeStats counts the clients, pairs and waiting users of the node, and the bans
+// and open reports of the cluster
+func nodeStats(hub *hubs.MainHub) *dtos.StatsDto {
+	stats := &dtos.StatsDto{
+		NodeId:          hub.NodeId,
+		Nodes:           []string{hub.NodeId},
+		Clients:         len(hub.ListClients()),
+		Pairs:           hub.MatchingService.GetActivePairsCount(),
+		Waiting:         hub.MatchingService.GetQueueSize(),
+		MatchingEnabled: hub.MatchingService.Enabled(),
+	}
+	if nodes, err := hub.ClusterService.Nodes(); err == nil {
+		for nodeId := range nodes {
+			if nodeId != hub.NodeId {
+				stats.Nodes = append(stats.Nodes, nodeId)
+			}
+		}
+		slices.Sort(stats.Nodes[1:])
+	}
+	if bans, err := hub.BanService.List(); err == nil {
+		stats.Bans = len(bans)
+	}
+	if reports, err := hub.ReportService.List(true); err == nil {
+		stats.OpenReports = len(reports)
+	}
+	return stats
+}
+
+// Clients lists the clients connected to this node, longest connected first
+func (c *AdminController) Clients(ctx *gin.Context) {
+	hub := c.container.GetHub()
+	clients := hub.ListClients()
+	slices.SortFunc(clients, func(a, b *models.Client) int { return a.ConnectedAt.Compare(b.ConnectedAt) })
+
+	result := make([]dtos.ClientDto, 0, len(clients))
+	for _, client := range clients {
+		client := dtos.ClientDto{
+			UserId:          client.UserId,
+			RemoteAddr:      client.Conn.RemoteAddr(),
+			Transport:       transportName(client.Conn),
+			ProtocolVersion: client.Session.Version(),
+			Capabilities:    client.Session.Capabilities(),
+			ConnectedAt:     client.ConnectedAt,
+		}
+		if pair, err := hub.MatchingService.GetPair(client.UserId); err == nil {
+			client.PairId = pair.ID
+		}
+		result = append(result, client)
+	}
+	ctx.JSON(http.StatusOK, result)
+}
+
+// Kick disconnects a session, on whichever node holds it
+func (c *AdminController) Kick(ctx *gin.Context) {
+	userId, err := uuid.Parse(ctx.Param("userId"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id"})
+		return
+	}
+	var request kickRequest
+	if ctx.Request.ContentLength != 0 {
+		if err := ctx.ShouldBindJSON(&request); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if request.Reason == "" {
+		request.Reason = defaultKickReason
+	}
+
+	hub := c.container.GetHub()
+	err = hub.Kick(userId, request.Reason)
+	if errors.Is(err, hubs.ErrClientNotFound) {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	audit(ctx, hub, models.AuditKick, userId.String(), request.Reason)
+	ctx.Status(http.StatusNoContent)
+}
+
+// Pairs lists the active pairs of this node, oldest first
+func (c *AdminController) Pairs(ctx *gin.Context) {
+	pairs := c.container.GetHub().MatchingService.GetPairs()
+	slices.SortFunc(pairs, func(a, b *models.ChatPair) int { return a.CreatedAt.Compare(b.CreatedAt) })
+
+	result := make([]*dtos.PairDto, 0, len(pairs))
+	for _, pair := range pairs {
+		result = append(result, dtos.NewPairDto(pair))
+	}
+	ctx.JSON(http.StatusOK, result)
+}
+
+// EndPair ends a pair, telling both users the stranger left
+func (c *AdminController) EndPair(ctx *gin.Context) {
+	pairId, err := uuid.Parse(ctx.Param("pairId"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid pair id"})
+		return
+	}
+
+	hub := c.container.GetHub()
+	hub.Do(func() {
+		var pair *models.ChatPair
+		pair, err = hub.MatchingService.GetPairById(pairId)
+		if err == nil {
+			err = hub.TerminatePair(pair)
+		}
+	})
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	audit(ctx, hub, models.AuditEndPair, pairId.String(), "")
+	ctx.Status(http.StatusNoContent)
+}
+
+// Queue returns the users waiting for a match on this node, longest waiting first
+func (c *AdminController) Queue(ctx *gin.Context) {
+	matching := c.container.GetHub().MatchingService
+	ctx.JSON(http.StatusOK, dtos.QueueDto{
+		MatchingEnabled: matching.Enabled(),
+		Shared:          matching.QueueShared(),
+		Waiting:         matching.GetWaitingUsers(),
+	})
+}
+
+// SetMatching turns matching on or off on this node. Existing chats continue.
+func (c *AdminController) SetMatching(ctx *gin.Context) {
+	var request matchingRequest
+	if err := ctx.ShouldBindJSON(&request); err != nil || request.Enabled == nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "enabled is required"})
+		return
+	}
+	hub := c.container.GetHub()
+	hub.MatchingService.SetEnabled(*request.Enabled)
+	audit(ctx, hub, models.AuditSetMatching, hub.NodeId, onOff(*request.Enabled))
+	ctx.JSON(http.StatusOK, gin.H{"matchingEnabled": *request.Enabled})
+}
+
+// Bans lists the bans in effect
+func (c *AdminController) Bans(ctx *gin.Context) {
+	bans, err := c.container.GetHub().BanService.List()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, bans)
+}
+
+// AddBan bans a session, an IP address or both, and disconnects them
+func (c *AdminController) AddBan(ctx *gin.Context) {
+	var request banRequest
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	duration, err := parseBanDuration(request.Duration)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	hub := c.container.GetHub()
+	ban, err := hub.Ban(request.UserId, strings.TrimSpace(request.IP), request.Reason, duration)
+	if ban == nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	audit(ctx, hub, models.AuditAddBan, ban.ID.String(), describeBan(ban))
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusCreated, ban)
+}
+
+// RemoveBan lifts a ban
+func (c *AdminController) RemoveBan(ctx *gin.Context) {
+	banId, err := uuid.Parse(ctx.Param("banId"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid ban id"})
+		return
+	}
+	hub := c.container.GetHub()
+	if err := hub.BanService.Remove(banId); err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	audit(ctx, hub, models.AuditRemoveBan, banId.String(), "")
+	ctx.Status(http.StatusNoContent)
+}
+
+// Reports lists the open reports, or every report with ?status=all, oldest first
+func (c *AdminController) Reports(ctx *gin.Context) {
+	status := ctx.DefaultQuery("status", "open")
+	if status != "open" && status != "all" {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "status must be open or all"})
+		return
+	}
+	reports, err := c.container.GetHub().ReportService.List(status == "open")
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, reports)
+}
+
+// ResolveReport closes a report, banning and disconnecting the reported user if asked to
+func (c *AdminController) ResolveReport(ctx *gin.Context) {
+	reportId, err := uuid.Parse(ctx.Param("reportId"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid report id"})
+		return
+	}
+	var request resolveReportRequest
+	if ctx.Request.ContentLength != 0 {
+		if err := ctx.ShouldBindJSON(&request); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	duration, err := parseBanDuration(request.Duration)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	hub := c.container.GetHub()
+	report, err := hub.ResolveReport(reportId, request.Note, request.Ban, duration)
+	switch {
+	case errors.Is(err, services.ErrReportNotFound):
+		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrReportResolved):
+		ctx.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case err != nil:
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	default:
+		audit(ctx, hub, models.AuditResolveReport, reportId.String(), describeResolution(report))
+		ctx.JSON(http.StatusOK, report)
+	}
+}
+
+// Announce sends a system announcement to every connected client
+func (c *AdminController) Announce(ctx *gin.Context) {
+	var request announcementRequest
+	if err := ctx.ShouldBindJSON(&request); err != nil || strings.TrimSpace(request.Text) == "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "text is required"})
+		return
+	}
+	hub := c.container.GetHub()
+	if err := hub.Announce(request.Text); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	audit(ctx, hub, models.AuditAnnounce, "", request.Text)
+	ctx.Status(http.StatusNoContent)
+}
+
+// Audit lists the latest operator actions, newest first, up to ?limit=100
+func (c *AdminController) Audit(ctx *gin.Context) {
+	limit, err := strconv.Atoi(ctx.DefaultQuery("limit", "100"))
+	if err != nil || limit <= 0 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a positive number"})
+		return
+	}
+	entries, err := c.container.GetHub().AuditService.List(limit)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, entries)
+}
+
+// audit records an action of the signed in moderator. A failure is logged
+// rather than failing an action that already took place.
+func audit(ctx *gin.Context, hub *hubs.MainHub, action models.AuditAction, target, details string) {
+	moderator := ctx.MustGet(middlewares.ModeratorKey).(*models.Moderator)
+	if err := hub.AuditService.Record(moderator.Name, action, target, details); err != nil {
+		logging.FromContext(ctx.Request.Context()).Error("Error recording audit entry", logging.Err(err))
+	}
+}
+
+// describeBan summarizes a ban for the audit trail
+func describeBan(ban *models.Ban) string {
+	var parts []string
+	if ban.UserId != uuid.Nil {
+		parts = append(parts, "session "+ban.UserId.String())
+	}
+	if ban.IP != "" {
+		parts = append(parts, "ip "+ban.IP)
+	}
+	if ban.ExpiresAt != nil {
+		parts = append(parts, "until "+ban.ExpiresAt.Format(time.RFC3339))
+	}
+	if ban.Reason != "" {
+		parts = append(parts, "reason: "+ban.Reason)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// describeResolution summarizes a report resolution for the audit trail
+func describeResolution(report *models.Report) string {
+	description := report.Resolution
+	if report.BanId != uuid.Nil {
+		description = strings.TrimPrefix(description+", banned with "+report.BanId.String(), ", ")
+	}
+	return description
+}
+
+// onOff names a switch state
+func onOff(enabled bool) string {
+	if enabled {
+		return "on"
+	}
+	return "off"
+}
+
+// parseBanDuration parses a ban duration such as "24h", zero for a permanent ban if empty
+func parseBanDuration(raw string) (time.Duration, error) {
+	if raw == "" {
+		return 0, nil
+	}
+	duration, err := time.ParseDuration(raw)
+	if err != nil {
+		return 0, fmt.Errorf("duration must be such as \"24h\"")
+	}
+	return duration, nil
+}
+
+// transportName names the transport of a connection
+func transportName(conn models.Connection) string {
+	switch conn := conn.(type) {
+	case *transport.QueuedConnection:
+		return transportName(conn.Connection)
+	case *transport.WebSocketConnection:
+		return "websocket"
+	case *transport.SSEConnection:
+		return "sse"
+	case *transport.WebTransportConnection:
+		return "webtransport"
+	default:
+		return "other"
+	}
+}
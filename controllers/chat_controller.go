@@ -1,20 +1,30 @@
 package controllers
 
 import (
+	"net"
 	"net/http"
+	"realTimeService/configuration"
 
 	"github.com/gin-gonic/gin"
 )
 
 // ChatController handles the chat page
-type ChatController struct{}
+type ChatController struct {
+	webTransportPort string // Empty unless the HTTP/3 listener is enabled
+}
 
 // NewChatController creates a new chat controller
-func NewChatController() *ChatController {
-	return &ChatController{}
+func NewChatController(cfg *configuration.Config) *ChatController {
+	controller := &ChatController{}
+	if cfg.Http3Port != "" {
+		if _, port, err := net.SplitHostPort(cfg.Http3Port); err == nil {
+			controller.webTransportPort = port
+		}
+	}
+	return controller
 }
 
 // Index renders the chat page
 func (c *ChatController) Index(ctx *gin.Context) {
-	ctx.HTML(http.StatusOK, "chat.html", nil)
+	ctx.HTML(http.StatusOK, "chat.html", gin.H{"WebTransportPort": c.webTransportPort})
 }
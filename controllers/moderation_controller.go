@@ -0,0 +1,273 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"realTimeService/configuration"
+	"realTimeService/dtos"
+	"realTimeService/interfaces"
+	"realTimeService/logging"
+	"realTimeService/middlewares"
+	"realTimeService/models"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	// moderationPath is where the dashboard is served
+	moderationPath = "/mod"
+	// ModerationSignInPath is the dashboard's sign in page
+	ModerationSignInPath = moderationPath + "/login"
+	// moderationFeedInterval is how often the live feed checks for changes
+	moderationFeedInterval = 2 * time.Second
+	// moderationKeepAlive is how often an unchanged feed gets a comment, so proxies don't time it out
+	moderationKeepAlive = 15 * time.Second
+	// moderationSession is how long a dashboard sign in lasts
+	moderationSession = 12 * time.Hour
+	// moderationAuditSize is how many of the latest operator actions the dashboard shows
+	moderationAuditSize = 50
+)
+
+// ModerationController serves the moderation dashboard: the report queue, live
+// counters, bans and the audit trail. Moderators act through forms, and the page
+// follows changes made by others over a Server-Sent Events feed.
+type ModerationController struct {
+	container interfaces.Container
+	config    *configuration.Manager
+}
+
+// NewModerationController creates a new moderation controller
+func NewModerationController(container interfaces.Container, config *configuration.Manager) *ModerationController {
+	return &ModerationController{container: container, config: config}
+}
+
+// SignInPage renders the sign in form
+func (c *ModerationController) SignInPage(ctx *gin.Context) {
+	auth := c.config.Current().Auth
+	if auth.AdminToken == "" && len(auth.Moderators) == 0 {
+		ctx.Status(http.StatusNotFound)
+		return
+	}
+	ctx.HTML(http.StatusOK, "moderation_login.html", gin.H{"Title": "Moderation sign in"})
+}
+
+// SignIn checks a token and keeps it in the dashboard cookie
+func (c *ModerationController) SignIn(ctx *gin.Context) {
+	moderator, ok := c.config.Current().Auth.Moderator(ctx.PostForm("token"))
+	if !ok {
+		ctx.HTML(http.StatusUnauthorized, "moderation_login.html", gin.H{
+			"Title": "Moderation sign in",
+			"Error": "Invalid token",
+		})
+		return
+	}
+
+	// Strict same-site cookies aren't sent with forms posted from other sites
+	ctx.SetSameSite(http.SameSiteStrictMode)
+	ctx.SetCookie(middlewares.ModeratorCookie, ctx.PostForm("token"), int(moderationSession.Seconds()),
+		moderationPath, "", ctx.Request.TLS != nil, true)
+
+	hub := c.container.GetHub()
+	if err := hub.AuditService.Record(moderator.Name, models.AuditSignIn, "", moderator.Role); err != nil {
+		logging.FromContext(ctx.Request.Context()).Error("Error recording audit entry", logging.Err(err))
+	}
+	ctx.Redirect(http.StatusSeeOther, moderationPath)
+}
+
+// SignOut clears the dashboard cookie
+func (c *ModerationController) SignOut(ctx *gin.Context) {
+	ctx.SetSameSite(http.SameSiteStrictMode)
+	ctx.SetCookie(middlewares.ModeratorCookie, "", -1, moderationPath, "", ctx.Request.TLS != nil, true)
+	ctx.Redirect(http.StatusSeeOther, ModerationSignInPath)
+}
+
+// Dashboard renders the dashboard
+func (c *ModerationController) Dashboard(ctx *gin.Context) {
+	moderator := ctx.MustGet(middlewares.ModeratorKey).(*models.Moderator)
+	ctx.HTML(http.StatusOK, "moderation.html", gin.H{
+		"Title":       "Moderation",
+		"Moderator":   moderator,
+		"CanModerate": moderator.Role.Allows(models.RoleModerator),
+		"IsAdmin":     moderator.Role.Allows(models.RoleAdmin),
+		"State":       c.state(),
+		"Notice":      ctx.Query("notice"),
+		"Error":       ctx.Query("error"),
+	})
+}
+
+// Events streams the dashboard state as "state" events whenever it changes
+func (c *ModerationController) Events(ctx *gin.Context) {
+	ctx.Header("Content-Type", "text/event-stream")
+	ctx.Header("Cache-Control", "no-cache")
+	ctx.Header("X-Accel-Buffering", "no")
+	ctx.Status(http.StatusOK)
+
+	ticker := time.NewTicker(moderationFeedInterval)
+	defer ticker.Stop()
+
+	var last []byte
+	lastWrite := time.Now()
+	for {
+		state, err := json.Marshal(c.state())
+		if err != nil {
+			logging.FromContext(ctx.Request.Context()).Error("Error encoding moderation state", logging.Err(err))
+			return
+		}
+
+		if !bytes.Equal(state, last) {
+			_, err = fmt.Fprintf(ctx.Writer, "event: state\ndata: %s\n\n", state)
+			last, lastWrite = state, time.Now()
+		} else if time.Since(lastWrite) >= moderationKeepAlive {
+			_, err = fmt.Fprint(ctx.Writer, ": keep-alive\n\n")
+			lastWrite = time.Now()
+		}
+		if err != nil {
+			return
+		}
+		ctx.Writer.Flush()
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Request.Context().Done():
+			return
+		}
+	}
+}
+
+// ResolveReport closes a report, banning the reported user if the form asks to
+func (c *ModerationController) ResolveReport(ctx *gin.Context) {
+	reportId, err := uuid.Parse(ctx.Param("reportId"))
+	if err != nil {
+		c.back(ctx, "", errors.New("invalid report id"))
+		return
+	}
+	duration, err := parseBanDuration(strings.TrimSpace(ctx.PostForm("duration")))
+	if err != nil {
+		c.back(ctx, "", err)
+		return
+	}
+
+	hub := c.container.GetHub()
+	ban := ctx.PostForm("ban") != ""
+	report, err := hub.ResolveReport(reportId, strings.TrimSpace(ctx.PostForm("note")), ban, duration)
+	if err != nil {
+		c.back(ctx, "", err)
+		return
+	}
+	audit(ctx, hub, models.AuditResolveReport, reportId.String(), describeResolution(report))
+	if ban {
+		c.back(ctx, "Report resolved and reported user banned", nil)
+		return
+	}
+	c.back(ctx, "Report resolved", nil)
+}
+
+// AddBan bans a session, an address or both from the form
+func (c *ModerationController) AddBan(ctx *gin.Context) {
+	var userId uuid.UUID
+	if raw := strings.TrimSpace(ctx.PostForm("userId")); raw != "" {
+		var err error
+		if userId, err = uuid.Parse(raw); err != nil {
+			c.back(ctx, "", errors.New("invalid session id"))
+			return
+		}
+	}
+	duration, err := parseBanDuration(strings.TrimSpace(ctx.PostForm("duration")))
+	if err != nil {
+		c.back(ctx, "", err)
+		return
+	}
+
+	hub := c.container.GetHub()
+	ban, err := hub.Ban(userId, strings.TrimSpace(ctx.PostForm("ip")), strings.TrimSpace(ctx.PostForm("reason")), duration)
+	if ban == nil {
+		c.back(ctx, "", err)
+		return
+	}
+	audit(ctx, hub, models.AuditAddBan, ban.ID.String(), describeBan(ban))
+	c.back(ctx, "Ban added", err)
+}
+
+// RemoveBan lifts a ban
+func (c *ModerationController) RemoveBan(ctx *gin.Context) {
+	banId, err := uuid.Parse(ctx.Param("banId"))
+	if err != nil {
+		c.back(ctx, "", errors.New("invalid ban id"))
+		return
+	}
+	hub := c.container.GetHub()
+	if err := hub.BanService.Remove(banId); err != nil {
+		c.back(ctx, "", err)
+		return
+	}
+	audit(ctx, hub, models.AuditRemoveBan, banId.String(), "")
+	c.back(ctx, "Ban lifted", nil)
+}
+
+// Announce sends an announcement to every client
+func (c *ModerationController) Announce(ctx *gin.Context) {
+	text := strings.TrimSpace(ctx.PostForm("text"))
+	if text == "" {
+		c.back(ctx, "", errors.New("announcement text is required"))
+		return
+	}
+	hub := c.container.GetHub()
+	if err := hub.Announce(text); err != nil {
+		c.back(ctx, "", err)
+		return
+	}
+	audit(ctx, hub, models.AuditAnnounce, "", text)
+	c.back(ctx, "Announcement sent", nil)
+}
+
+// SetMatching turns matching on or off on this node
+func (c *ModerationController) SetMatching(ctx *gin.Context) {
+	enabled := ctx.PostForm("enabled") == "true"
+	hub := c.container.GetHub()
+	hub.MatchingService.SetEnabled(enabled)
+	audit(ctx, hub, models.AuditSetMatching, hub.NodeId, onOff(enabled))
+	c.back(ctx, "Matching turned "+onOff(enabled), nil)
+}
+
+// state gathers what the dashboard shows. Parts the store fails to return are left empty.
+func (c *ModerationController) state() *dtos.ModerationDto {
+	hub := c.container.GetHub()
+	reports, err := hub.ReportService.List(true)
+	logModerationError(err)
+	bans, err := hub.BanService.List()
+	logModerationError(err)
+	entries, err := hub.AuditService.List(moderationAuditSize)
+	logModerationError(err)
+	return dtos.NewModerationDto(nodeStats(hub), reports, bans, entries)
+}
+
+// back redirects to the dashboard, showing the outcome of an action
+func (c *ModerationController) back(ctx *gin.Context, notice string, err error) {
+	query := url.Values{}
+	if notice != "" {
+		query.Set("notice", notice)
+	}
+	if err != nil {
+		query.Set("error", err.Error())
+	}
+	target := moderationPath
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	ctx.Redirect(http.StatusSeeOther, target)
+}
+
+// logModerationError logs an error reading the dashboard state
+func logModerationError(err error) {
+	if err != nil {
+		slog.Error("Error reading moderation state", logging.Err(err))
+	}
+}
@@ -0,0 +1,116 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"realTimeService/dtos"
+	"realTimeService/interfaces"
+	"realTimeService/models"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// TranscriptTokenHeader carries the download token so it never ends up in access logs
+const TranscriptTokenHeader = "X-Transcript-Token"
+
+// TranscriptController serves opt-in chat transcripts
+type TranscriptController struct {
+	container interfaces.Container
+}
+
+// transcriptLine is a single message as shown in text and HTML transcripts
+type transcriptLine struct {
+	Author string
+	Text   string
+	Time   string
+	Edited bool
+}
+
+// NewTranscriptController creates a new transcript controller
+func NewTranscriptController(container interfaces.Container) *TranscriptController {
+	return &TranscriptController{container: container}
+}
+
+// Download returns a transcript as plain text, JSON or HTML depending on the format query parameter
+func (c *TranscriptController) Download(ctx *gin.Context) {
+	pairId, err := uuid.Parse(ctx.Param("pairId"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid pair id"})
+		return
+	}
+
+	transcript, userId, err := c.container.GetHub().TranscriptService.Get(pairId, ctx.GetHeader(TranscriptTokenHeader))
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "transcript not found or expired"})
+		return
+	}
+
+	format := ctx.DefaultQuery("format", "txt")
+	filename := fmt.Sprintf("chat-%s.%s", transcript.CreatedAt.Format("2006-01-02-150405"), format)
+
+	switch format {
+	case "txt":
+		ctx.Header("Content-Disposition", "attachment; filename="+filename)
+		ctx.String(http.StatusOK, renderTranscriptText(transcript, userId))
+	case "json":
+		ctx.Header("Content-Disposition", "attachment; filename="+filename)
+		ctx.JSON(http.StatusOK, transcriptDtos(transcript))
+	case "html":
+		ctx.Header("Content-Disposition", "attachment; filename="+filename)
+		ctx.HTML(http.StatusOK, "transcript.html", gin.H{
+			"Title":     "Chat transcript",
+			"StartedAt": transcript.CreatedAt.Format(time.RFC1123),
+			"Lines":     transcriptLines(transcript, userId),
+		})
+	default:
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "format must be txt, json or html"})
+	}
+}
+
+// transcriptLines converts messages to lines from the point of view of the downloading user
+func transcriptLines(transcript *models.Transcript, userId uuid.UUID) []transcriptLine {
+	lines := make([]transcriptLine, 0, len(transcript.Messages))
+	for _, message := range transcript.Messages {
+		author := "Stranger"
+		if message.UserId == userId {
+			author = "You"
+		}
+		lines = append(lines, transcriptLine{
+			Author: author,
+			Text:   message.Text,
+			Time:   message.Timestamp.Format("15:04:05"),
+			Edited: message.EditedAt != nil,
+		})
+	}
+	return lines
+}
+
+// renderTranscriptText renders a transcript as plain text
+func renderTranscriptText(transcript *models.Transcript, userId uuid.UUID) string {
+	var sb strings.Builder
+	sb.WriteString("Anonymous Chat transcript - " + transcript.CreatedAt.Format(time.RFC1123) + "\n\n")
+	for _, line := range transcriptLines(transcript, userId) {
+		edited := ""
+		if line.Edited {
+			edited = " (edited)"
+		}
+		sb.WriteString(fmt.Sprintf("[%s] %s: %s%s\n", line.Time, line.Author, line.Text, edited))
+	}
+	return sb.String()
+}
+
+// transcriptDtos converts a transcript to message DTOs
+func transcriptDtos(transcript *models.Transcript) []*dtos.MessageDto {
+	result := make([]*dtos.MessageDto, 0, len(transcript.Messages))
+	for _, message := range transcript.Messages {
+		result = append(result, dtos.NewMessageDto(
+			message.ID, message.UserId, transcript.PairId,
+			message.Text,
+			message.Timestamp, message.Timestamp,
+			dtos.Delivered))
+	}
+	return result
+}
@@ -0,0 +1,66 @@
+package dtos
+
+import (
+	"realTimeService/models"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// StatsDto summarizes the state of a node for operators
+type StatsDto struct {
+	NodeId          string   `json:"nodeId"`
+	Nodes           []string `json:"nodes"` // Nodes in the cluster, including this one
+	Clients         int      `json:"clients"`
+	Pairs           int      `json:"pairs"`
+	Waiting         int      `json:"waiting"`
+	MatchingEnabled bool     `json:"matchingEnabled"`
+	Bans            int      `json:"bans"`
+	OpenReports     int      `json:"openReports"`
+}
+
+// ClientDto describes a connected client
+type ClientDto struct {
+	UserId          uuid.UUID           `json:"userId"`
+	RemoteAddr      string              `json:"remoteAddr"`
+	Transport       string              `json:"transport"`
+	ProtocolVersion int                 `json:"protocolVersion"`
+	Capabilities    []models.Capability `json:"capabilities"`
+	ConnectedAt     time.Time           `json:"connectedAt"`
+	PairId          uuid.UUID           `json:"pairId,omitzero"` // Current pair, zero if not chatting
+}
+
+// PairDto describes an active pair
+type PairDto struct {
+	ID        uuid.UUID     `json:"id"`
+	Users     []PairUserDto `json:"users"`
+	CreatedAt time.Time     `json:"createdAt"`
+	NodeId    string        `json:"nodeId,omitempty"` // Node owning the pair, empty for this node
+}
+
+// PairUserDto is one of the users of a pair
+type PairUserDto struct {
+	UserId uuid.UUID `json:"userId"`
+	NodeId string    `json:"nodeId,omitempty"` // Node the user is connected to, empty for this node
+}
+
+// QueueDto describes the users waiting for a match on a node
+type QueueDto struct {
+	MatchingEnabled bool        `json:"matchingEnabled"`
+	Shared          bool        `json:"shared"` // Whether the queue is shared by every node
+	Waiting         []uuid.UUID `json:"waiting"`
+}
+
+// NewPairDto converts a pair
+func NewPairDto(pair *models.ChatPair) *PairDto {
+	users := pair.Users()
+	return &PairDto{
+		ID: pair.ID,
+		Users: []PairUserDto{
+			{UserId: users[0].UserId, NodeId: users[0].NodeId},
+			{UserId: users[1].UserId, NodeId: users[1].NodeId},
+		},
+		CreatedAt: pair.CreatedAt,
+		NodeId:    pair.NodeId,
+	}
+}
@@ -0,0 +1,129 @@
+package dtos
+
+import (
+	"realTimeService/models"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// moderationTimeFormat is how the dashboard shows times
+const moderationTimeFormat = "2006-01-02 15:04:05"
+
+// ModerationDto is the state shown on the moderation dashboard, formatted for display
+// so the page and its live updates show the same text
+type ModerationDto struct {
+	Stats   *StatsDto      `json:"stats"`
+	Reports []ReportRowDto `json:"reports"`
+	Bans    []BanRowDto    `json:"bans"`
+	Audit   []AuditRowDto  `json:"audit"`
+}
+
+// ReportRowDto is an open report
+type ReportRowDto struct {
+	ID       string           `json:"id"`
+	Reported string           `json:"reported"`
+	IP       string           `json:"ip"`
+	Reason   string           `json:"reason"`
+	Details  string           `json:"details"`
+	Created  string           `json:"created"`
+	Snippet  []SnippetLineDto `json:"snippet"`
+}
+
+// SnippetLineDto is a message of a reported chat
+type SnippetLineDto struct {
+	Author string `json:"author"` // "Reported" or "Reporter"
+	Text   string `json:"text"`
+	Time   string `json:"time"`
+}
+
+// BanRowDto is a ban in effect
+type BanRowDto struct {
+	ID      string `json:"id"`
+	User    string `json:"user"`
+	IP      string `json:"ip"`
+	Reason  string `json:"reason"`
+	Created string `json:"created"`
+	Expires string `json:"expires"`
+}
+
+// AuditRowDto is an operator action
+type AuditRowDto struct {
+	Time    string `json:"time"`
+	Actor   string `json:"actor"`
+	Action  string `json:"action"`
+	Target  string `json:"target"`
+	Details string `json:"details"`
+}
+
+// NewModerationDto formats the dashboard state
+func NewModerationDto(stats *StatsDto, reports []*models.Report, bans []*models.Ban,
+	audit []*models.AuditEntry) *ModerationDto {
+	dto := &ModerationDto{
+		Stats:   stats,
+		Reports: make([]ReportRowDto, 0, len(reports)),
+		Bans:    make([]BanRowDto, 0, len(bans)),
+		Audit:   make([]AuditRowDto, 0, len(audit)),
+	}
+
+	for _, report := range reports {
+		row := ReportRowDto{
+			ID:       report.ID.String(),
+			Reported: report.ReportedId.String(),
+			IP:       orDash(report.ReportedIP),
+			Reason:   report.Reason,
+			Details:  report.Details,
+			Created:  report.CreatedAt.Format(moderationTimeFormat),
+			Snippet:  make([]SnippetLineDto, 0, len(report.Snippet)),
+		}
+		for _, line := range report.Snippet {
+			author := "Reporter"
+			if line.Reported {
+				author = "Reported"
+			}
+			row.Snippet = append(row.Snippet, SnippetLineDto{
+				Author: author,
+				Text:   line.Text,
+				Time:   line.SentAt.Format(time.TimeOnly),
+			})
+		}
+		dto.Reports = append(dto.Reports, row)
+	}
+
+	for _, ban := range bans {
+		row := BanRowDto{
+			ID:      ban.ID.String(),
+			User:    "-",
+			IP:      orDash(ban.IP),
+			Reason:  orDash(ban.Reason),
+			Created: ban.CreatedAt.Format(moderationTimeFormat),
+			Expires: "never",
+		}
+		if ban.UserId != uuid.Nil {
+			row.User = ban.UserId.String()
+		}
+		if ban.ExpiresAt != nil {
+			row.Expires = ban.ExpiresAt.Format(moderationTimeFormat)
+		}
+		dto.Bans = append(dto.Bans, row)
+	}
+
+	for _, entry := range audit {
+		dto.Audit = append(dto.Audit, AuditRowDto{
+			Time:    entry.CreatedAt.Format(moderationTimeFormat),
+			Actor:   entry.Actor,
+			Action:  string(entry.Action),
+			Target:  entry.Target,
+			Details: entry.Details,
+		})
+	}
+	return dto
+}
+
+// orDash returns the value, "-" if it is empty
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,42 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"realTimeService/logging"
+)
+
+// AuditFile appends every event to a file as a line of JSON. The file is only
+// ever appended to, so it can be shipped or rotated by external tools.
+type AuditFile struct {
+	file *os.File
+}
+
+// OpenAuditFile opens the file at path for appending, creating it if needed
+func OpenAuditFile(path string) (*AuditFile, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("error opening audit file: %w", err)
+	}
+	return &AuditFile{file: file}, nil
+}
+
+// Handle implements Subscriber
+func (a *AuditFile) Handle(envelope *Envelope) {
+	line, err := json.Marshal(envelope)
+	if err != nil {
+		slog.Error("Error encoding event", "event", envelope.ID.String(), logging.Err(err))
+		return
+	}
+	// A single write per line, so lines of concurrent writers never interleave
+	if _, err := a.file.Write(append(line, '\n')); err != nil {
+		slog.Error("Error writing audit file", "event", envelope.ID.String(), logging.Err(err))
+	}
+}
+
+// Close implements Subscriber
+func (a *AuditFile) Close() error {
+	return a.file.Close()
+}
@@ -0,0 +1,129 @@
+package events
+
+import (
+	"context"
+	"log/slog"
+	"realTimeService/logging"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// DefaultBuffer is how many events a subscriber may fall behind by before
+	// further events are dropped for it
+	DefaultBuffer = 1024
+	// closeTimeout bounds waiting for subscribers to handle the events left on close
+	closeTimeout = 5 * time.Second
+)
+
+// Subscriber handles the events of the bus
+type Subscriber interface {
+	// Handle processes an event. Calls are sequential, in publishing order.
+	Handle(envelope *Envelope)
+	// Close releases the subscriber once the bus is closed
+	Close() error
+}
+
+// subscription is a subscriber and the events it has yet to handle
+type subscription struct {
+	name       string
+	subscriber Subscriber
+	events     chan *Envelope
+	done       chan struct{}
+}
+
+// Bus delivers the events of a node to its subscribers. Each subscriber runs on
+// its own goroutine, so publishing never waits for a slow subscriber such as a
+// webhook that is down: once a subscriber's buffer is full its events are dropped.
+// A nil bus drops every event.
+type Bus struct {
+	nodeId        string
+	subscriptions []*subscription
+	closed        bool
+	mu            sync.RWMutex
+}
+
+// NewBus creates a bus for the events of a node
+func NewBus(nodeId string) *Bus {
+	return &Bus{nodeId: nodeId, mu: sync.RWMutex{}}
+}
+
+// Subscribe starts handing events published from now on to subscriber, which
+// may fall behind by buffer events
+func (b *Bus) Subscribe(name string, buffer int, subscriber Subscriber) {
+	s := &subscription{
+		name:       name,
+		subscriber: subscriber,
+		events:     make(chan *Envelope, buffer),
+		done:       make(chan struct{}),
+	}
+	go func() {
+		defer close(s.done)
+		for envelope := range s.events {
+			subscriber.Handle(envelope)
+		}
+	}()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subscriptions = append(b.subscriptions, s)
+}
+
+// Publish hands an event to every subscriber without waiting for them
+func (b *Bus) Publish(event Event) {
+	if b == nil {
+		return
+	}
+	envelope := &Envelope{
+		ID:   uuid.New(),
+		Type: event.Type(),
+		Node: b.nodeId,
+		Time: time.Now(),
+		Data: event,
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if b.closed {
+		return
+	}
+	for _, s := range b.subscriptions {
+		select {
+		case s.events <- envelope:
+		default:
+			slog.Warn("Subscriber is falling behind, dropping event",
+				"subscriber", s.name, "type", envelope.Type, "event", envelope.ID.String())
+		}
+	}
+}
+
+// Close stops accepting events, gives the subscribers a few seconds to handle
+// the ones left and closes them
+func (b *Bus) Close() {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return
+	}
+	b.closed = true
+	subscriptions := b.subscriptions
+	b.mu.Unlock()
+
+	for _, s := range subscriptions {
+		close(s.events)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), closeTimeout)
+	defer cancel()
+	for _, s := range subscriptions {
+		select {
+		case <-s.done:
+		case <-ctx.Done():
+		}
+		// Closing a subscriber still busy makes it give up, such as a webhook retrying
+		if err := s.subscriber.Close(); err != nil {
+			slog.Error("Error closing event subscriber", "subscriber", s.name, logging.Err(err))
+		}
+	}
+}
@@ -0,0 +1,121 @@
+// Package events carries the domain events of the hub and the matcher, such as
+// users connecting, getting matched and being banned, to subscribers outside
+// the chat: an append-only audit file and webhooks of other services.
+package events
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Type names an event on the wire
+type Type string
+
+const (
+	TypeClientConnected    Type = "clientConnected"
+	TypeClientDisconnected Type = "clientDisconnected"
+	TypeQueued             Type = "queued"
+	TypeMatched            Type = "matched"
+	TypePairEnded          Type = "pairEnded"
+	TypeReportFiled        Type = "reportFiled"
+	TypeBanApplied         Type = "banApplied"
+)
+
+// Types lists every event type
+var Types = []Type{
+	TypeClientConnected,
+	TypeClientDisconnected,
+	TypeQueued,
+	TypeMatched,
+	TypePairEnded,
+	TypeReportFiled,
+	TypeBanApplied,
+}
+
+// Event is a domain event, encoded as the data of its envelope
+type Event interface {
+	Type() Type
+}
+
+// Envelope is an event as subscribers get it
+type Envelope struct {
+	// ID identifies the event, the same across webhook retries
+	ID   uuid.UUID `json:"id"`
+	Type Type      `json:"type"`
+	// Node is the node the event happened on
+	Node string    `json:"node"`
+	Time time.Time `json:"time"`
+	Data Event     `json:"data"`
+}
+
+// EndReason tells why a pair ended
+type EndReason string
+
+const (
+	ReasonStop       EndReason = "stop"       // A user stopped the chat
+	ReasonNext       EndReason = "next"       // A user moved on to the next stranger
+	ReasonDisconnect EndReason = "disconnect" // A user disconnected
+	ReasonOperator   EndReason = "operator"   // An operator ended the pair
+	ReasonNodeDown   EndReason = "nodeDown"   // The node of a user went down
+	ReasonUnknown    EndReason = "unknown"    // Another node ended the pair without telling why
+)
+
+// ClientConnected is published when a client connects to this node
+type ClientConnected struct {
+	UserId uuid.UUID `json:"userId"`
+	IP     string    `json:"ip"`
+}
+
+// ClientDisconnected is published when a client of this node disconnects
+type ClientDisconnected struct {
+	UserId     uuid.UUID `json:"userId"`
+	DurationMs int64     `json:"durationMs"` // How long the client was connected
+}
+
+// Queued is published when a user starts waiting for a stranger
+type Queued struct {
+	UserId uuid.UUID `json:"userId"`
+}
+
+// Matched is published by the node owning a new pair
+type Matched struct {
+	PairId  uuid.UUID    `json:"pairId"`
+	UserIds [2]uuid.UUID `json:"userIds"`
+	// PrivateChannel is set when the users met again through a private channel
+	PrivateChannel bool `json:"privateChannel,omitempty"`
+}
+
+// PairEnded is published by the node owning a pair when it ends
+type PairEnded struct {
+	PairId     uuid.UUID    `json:"pairId"`
+	UserIds    [2]uuid.UUID `json:"userIds"`
+	Reason     EndReason    `json:"reason"`
+	DurationMs int64        `json:"durationMs"` // How long the chat lasted
+}
+
+// ReportFiled is published when a user reports a stranger
+type ReportFiled struct {
+	ReportId   uuid.UUID `json:"reportId"`
+	PairId     uuid.UUID `json:"pairId"`
+	ReporterId uuid.UUID `json:"reporterId"`
+	ReportedId uuid.UUID `json:"reportedId"`
+	Reason     string    `json:"reason"`
+}
+
+// BanApplied is published when an operator bans a session, an address or both
+type BanApplied struct {
+	BanId     uuid.UUID  `json:"banId"`
+	UserId    uuid.UUID  `json:"userId,omitzero"`
+	IP        string     `json:"ip,omitempty"`
+	Reason    string     `json:"reason,omitempty"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"` // nil for permanent bans
+}
+
+func (ClientConnected) Type() Type    { return TypeClientConnected }
+func (ClientDisconnected) Type() Type { return TypeClientDisconnected }
+func (Queued) Type() Type             { return TypeQueued }
+func (Matched) Type() Type            { return TypeMatched }
+func (PairEnded) Type() Type          { return TypePairEnded }
+func (ReportFiled) Type() Type        { return TypeReportFiled }
+func (BanApplied) Type() Type         { return TypeBanApplied }
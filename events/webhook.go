@@ -0,0 +1,167 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"realTimeService/logging"
+	"strconv"
+	"time"
+)
+
+// Headers of webhook requests
+const (
+	// EventHeader carries the type of the event
+	EventHeader = "X-Goroom-Event"
+	// DeliveryHeader carries the ID of the event, the same across retries
+	DeliveryHeader = "X-Goroom-Delivery"
+	// TimestampHeader carries the Unix time the request was signed at
+	TimestampHeader = "X-Goroom-Timestamp"
+	// SignatureHeader carries the signature of the timestamp and the body
+	SignatureHeader = "X-Goroom-Signature"
+)
+
+const (
+	// webhookTimeout bounds a single delivery attempt
+	webhookTimeout = 10 * time.Second
+	// webhookAttempts is how many times an event is sent before giving up on it
+	webhookAttempts = 6
+	// webhookBaseDelay is the wait before the first retry, doubled for each further one
+	webhookBaseDelay = time.Second
+	// webhookMaxDelay caps the wait between retries
+	webhookMaxDelay = time.Minute
+)
+
+// Webhook posts events to an HTTP endpoint of another service, signed with a
+// secret shared with it. Failed deliveries are retried with exponential backoff.
+// Events are sent one at a time in order, so a webhook that is down falls behind
+// and, once its buffer on the bus is full, misses events.
+type Webhook struct {
+	url    string
+	secret []byte
+	types  map[Type]bool // nil for every type
+	client *http.Client
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// NewWebhook creates a webhook posting to url the events of the given types, every
+// event if there are none
+func NewWebhook(url, secret string, types []Type) *Webhook {
+	w := &Webhook{
+		url:    url,
+		secret: []byte(secret),
+		client: &http.Client{Timeout: webhookTimeout},
+	}
+	if len(types) > 0 {
+		w.types = make(map[Type]bool, len(types))
+		for _, t := range types {
+			w.types[t] = true
+		}
+	}
+	w.ctx, w.cancel = context.WithCancel(context.Background())
+	return w
+}
+
+// Handle implements Subscriber
+func (w *Webhook) Handle(envelope *Envelope) {
+	if w.types != nil && !w.types[envelope.Type] {
+		return
+	}
+	body, err := json.Marshal(envelope)
+	if err != nil {
+		slog.Error("Error encoding event", "event", envelope.ID.String(), logging.Err(err))
+		return
+	}
+
+	for attempt := 1; ; attempt++ {
+		retry, err := w.deliver(envelope, body)
+		if err == nil {
+			return
+		}
+		if !retry || attempt == webhookAttempts {
+			slog.Error("Giving up on webhook delivery", "url", w.url, "type", envelope.Type,
+				"event", envelope.ID.String(), "attempts", attempt, logging.Err(err))
+			return
+		}
+
+		delay := backoff(attempt)
+		slog.Warn("Webhook delivery failed, retrying", "url", w.url, "type", envelope.Type,
+			"event", envelope.ID.String(), "attempt", attempt, "retryIn", delay, logging.Err(err))
+		select {
+		case <-time.After(delay):
+		case <-w.ctx.Done():
+			slog.Warn("Webhook closed, dropping event", "url", w.url, "event", envelope.ID.String())
+			return
+		}
+	}
+}
+
+// deliver posts an event once, reporting whether a failure is worth retrying
+func (w *Webhook) deliver(envelope *Envelope, body []byte) (bool, error) {
+	request, err := http.NewRequestWithContext(w.ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("User-Agent", "goroom-webhook")
+	request.Header.Set(EventHeader, string(envelope.Type))
+	request.Header.Set(DeliveryHeader, envelope.ID.String())
+	request.Header.Set(TimestampHeader, timestamp)
+	request.Header.Set(SignatureHeader, Sign(w.secret, timestamp, body))
+
+	response, err := w.client.Do(request)
+	if err != nil {
+		return true, err
+	}
+	defer response.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(response.Body, 64<<10))
+
+	switch {
+	case response.StatusCode < 300:
+		return false, nil
+	case response.StatusCode >= 500 || response.StatusCode == http.StatusTooManyRequests ||
+		response.StatusCode == http.StatusRequestTimeout:
+		return true, fmt.Errorf("webhook answered %s", response.Status)
+	default:
+		// The endpoint refused the event, sending it again won't change that
+		return false, fmt.Errorf("webhook answered %s", response.Status)
+	}
+}
+
+// Close implements Subscriber. Deliveries in progress and retries are abandoned.
+func (w *Webhook) Close() error {
+	w.cancel()
+	return nil
+}
+
+// Sign returns the signature of a webhook request: the hex-encoded HMAC-SHA256
+// of the timestamp, a dot and the body, keyed with the secret and prefixed with
+// "sha256=". Receivers compute it the same way to check the request came from
+// the server, and should reject old timestamps to prevent replays.
+func Sign(secret []byte, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// backoff returns the wait before retrying after the given attempt, doubling
+// from webhookBaseDelay up to webhookMaxDelay with up to a quarter of jitter
+func backoff(attempt int) time.Duration {
+	delay := webhookBaseDelay << (attempt - 1)
+	if delay > webhookMaxDelay || delay <= 0 {
+		delay = webhookMaxDelay
+	}
+	return delay - time.Duration(rand.Int64N(int64(delay/4)+1))
+}
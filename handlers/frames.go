@@ -0,0 +1,23 @@
+package handlers
+
+import (
+	"errors"
+	"realTimeService/codec"
+	"realTimeService/hubs"
+	"realTimeService/logging"
+	"realTimeService/models"
+)
+
+// rejectFrame tells a client that a frame it sent could not be decoded and was
+// dropped. The error event has no request type, as the frame's type is unknown.
+func rejectFrame(hub *hubs.MainHub, client *models.Client, err error) {
+	reason := "invalid message"
+	if errors.Is(err, codec.ErrUnsupportedVersion) {
+		reason = "unsupported protocol version"
+	}
+	hub.Do(func() {
+		if err := hub.SendToClient(client, models.NewErrorMessage("", reason)); err != nil {
+			client.Log.Warn("Error sending rejection", logging.Err(err))
+		}
+	})
+}
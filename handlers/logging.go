@@ -0,0 +1,17 @@
+package handlers
+
+import (
+	"log/slog"
+	"realTimeService/logging"
+	"realTimeService/models"
+)
+
+// logMessage logs a message received from a client at debug level. Its text is
+// redacted unless content logging is turned on.
+func logMessage(client *models.Client, msg models.IncomingMessage) {
+	args := []any{slog.String("type", string(msg.Type))}
+	if msg.Text != "" {
+		args = append(args, logging.Content("text", msg.Text))
+	}
+	client.Log.Debug("Message received", args...)
+}
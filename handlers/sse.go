@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"realTimeService/codec"
+	"realTimeService/handlers/wsrouter"
+	"realTimeService/interfaces"
+	"realTimeService/logging"
+	"realTimeService/models"
+	"realTimeService/transport"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// streamTokenHeader carries the token identifying the stream a POSTed message belongs to
+const streamTokenHeader = "X-Stream-Token"
+
+// sseStream is an open event stream and the client it belongs to
+type sseStream struct {
+	client    *models.Client
+	conn      *transport.SSEConnection
+	authToken string
+}
+
+// SSEHandler serves the fallback transport for networks that break WebSockets:
+// events go out over Server-Sent Events and messages come in as POST requests,
+// dispatched through the same router as WebSocket messages
+type SSEHandler struct {
+	container interfaces.Container
+	streams   map[string]*sseStream // stream token -> stream
+	mu        sync.RWMutex
+}
+
+// NewSSEHandler creates a new SSE transport handler
+func NewSSEHandler(container interfaces.Container) *SSEHandler {
+	return &SSEHandler{
+		container: container,
+		streams:   make(map[string]*sseStream),
+		mu:        sync.RWMutex{},
+	}
+}
+
+// Stream opens the event stream of a new client. The first event, "session",
+// carries the token the client sends its messages with.
+func (h *SSEHandler) Stream(ctx *gin.Context) {
+	userId := ctx.GetString("user_sub")
+
+	streamToken, err := newStreamToken()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "error creating stream"})
+		return
+	}
+
+	conn := transport.NewSSEConnection(ctx.Request.Context(), ctx.ClientIP())
+	stream := &sseStream{
+		client:    models.NewClient(uuid.MustParse(userId), nil, conn),
+		conn:      conn,
+		authToken: ctx.GetString("auth_token"),
+	}
+	conn.SetSession(stream.client.Session)
+	stream.client.Log = logging.FromContext(ctx.Request.Context()).With(logging.Session(stream.client.UserId), slog.String("transport", "sse"))
+
+	h.mu.Lock()
+	h.streams[streamToken] = stream
+	h.mu.Unlock()
+
+	hub := h.container.GetHub()
+	hub.Do(func() { hub.AddClient(stream.client) })
+	defer func() {
+		h.mu.Lock()
+		delete(h.streams, streamToken)
+		h.mu.Unlock()
+		conn.Close("")
+		hub.Do(func() { hub.RemoveClient(stream.client) })
+	}()
+
+	if err := conn.Serve(ctx.Writer, "session", gin.H{"token": streamToken}); err != nil {
+		stream.client.Log.Info("SSE stream closed", logging.Err(err))
+	}
+}
+
+// Send handles a message POSTed by the client of an open stream
+func (h *SSEHandler) Send(ctx *gin.Context) {
+	h.mu.RLock()
+	stream, ok := h.streams[ctx.GetHeader(streamTokenHeader)]
+	h.mu.RUnlock()
+	if !ok {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "stream not found"})
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(ctx.Writer, ctx.Request.Body, transport.MaxSSEMessage))
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		ctx.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "message too large"})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid message"})
+		return
+	}
+	var msg models.IncomingMessage
+	if err := codec.JSON.Decode(body, &msg); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	logMessage(stream.client, msg)
+	hub := h.container.GetHub()
+	msgCtx, result := wsrouter.WithResult(ctx.Request.Context())
+	hub.Do(func() {
+		err = h.container.GetRouter().Handle(msgCtx, stream.client, msg, stream.authToken)
+	})
+	if err != nil {
+		// Same as on a WebSocket, a failed message ends the connection
+		stream.client.Log.Warn("SSE router handle error", logging.Err(err))
+		stream.conn.Close(err.Error())
+		if result.Status == 0 {
+			result.Status, result.Error = http.StatusBadRequest, err.Error()
+		}
+	}
+	if result.Status != 0 {
+		ctx.JSON(result.Status, gin.H{"error": result.Error})
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
+
+// newStreamToken returns a random token that is only known to the stream's client.
+// The user ID can't serve this purpose since partners see it.
+func newStreamToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"log/slog"
+	"net/http"
+	"realTimeService/codec"
+	"realTimeService/interfaces"
+	"realTimeService/logging"
+	"realTimeService/models"
+	"realTimeService/transport"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/quic-go/webtransport-go"
+)
+
+// WebTransportHandler serves chat sessions over WebTransport on the HTTP/3 listener,
+// with the same messages and events as the WebSocket endpoint
+type WebTransportHandler struct {
+	container interfaces.Container
+	server    *webtransport.Server
+}
+
+// NewWebTransportHandler creates a handler upgrading requests with the given server
+func NewWebTransportHandler(container interfaces.Container, server *webtransport.Server) *WebTransportHandler {
+	return &WebTransportHandler{container: container, server: server}
+}
+
+// Handle upgrades an extended CONNECT request to a WebTransport session and
+// runs its messages through the router until the session ends
+func (h *WebTransportHandler) Handle(ctx *gin.Context) {
+	userId := ctx.GetString("user_sub")
+	token := ctx.GetString("auth_token")
+
+	// The upgrade needs the HTTP/3 response writer underneath gin's
+	writer, ok := ctx.Writer.(interface{ Unwrap() http.ResponseWriter })
+	if !ok {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "webtransport not supported"})
+		return
+	}
+	session, err := h.server.Upgrade(writer.Unwrap(), ctx.Request)
+	if err != nil {
+		logging.FromContext(ctx.Request.Context()).Warn("WebTransport upgrade error", logging.Err(err))
+		ctx.Status(http.StatusBadRequest)
+		return
+	}
+
+	// Same address as on the other transports, so bans by IP apply to every one
+	conn, err := transport.AcceptWebTransportConnection(session.Context(), session, ctx.ClientIP())
+	if err != nil {
+		logging.FromContext(ctx.Request.Context()).Warn("WebTransport stream error", logging.Err(err))
+		session.CloseWithError(0, "no message stream")
+		return
+	}
+	defer conn.Close("")
+
+	client := models.NewClient(uuid.MustParse(userId), nil, conn)
+	conn.SetSession(client.Session)
+	client.Log = logging.FromContext(ctx.Request.Context()).With(logging.Session(client.UserId), slog.String("transport", "webtransport"))
+	hub := h.container.GetHub()
+	hub.Do(func() { hub.AddClient(client) })
+	defer hub.Do(func() { hub.RemoveClient(client) })
+
+	for {
+		msgBytes, err := conn.ReadMessage()
+		if err != nil {
+			client.Log.Info("WebTransport session closed", logging.Err(err))
+			break
+		}
+		var msg models.IncomingMessage
+		if err := codec.JSON.Decode(msgBytes, &msg); err != nil {
+			client.Log.Warn("WebTransport invalid message", logging.Err(err))
+			rejectFrame(hub, client, err)
+			continue
+		}
+		logMessage(client, msg)
+		hub.Do(func() {
+			err = h.container.GetRouter().Handle(ctx.Request.Context(), client, msg, token)
+		})
+		if err != nil {
+			client.Log.Warn("WebTransport router handle error", logging.Err(err))
+			break
+		}
+	}
+}
@@ -1,61 +1,84 @@
 package handlers
 
 import (
-	"log"
-	"net/http"
+	"log/slog"
+	"realTimeService/logging"
 	"realTimeService/models"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
-	"github.com/gorilla/websocket"
 	"realTimeService/interfaces"
-	"encoding/json"
+	"realTimeService/configuration"
+	"realTimeService/tracing"
+	"realTimeService/transport"
+	"go.opentelemetry.io/otel/trace"
 )
 
-var upgrader = websocket.Upgrader{
-	CheckOrigin: func(r *http.Request) bool { return true },
-}
-
 type WsHandler struct {
 	container interfaces.Container
+	// config provides the origins and compression settings in effect for new connections
+	config *configuration.Manager
 }
 
-func NewWsHandler(container interfaces.Container) *WsHandler {
-	log.Println("Creating new WsHandler")
-	return &WsHandler{container: container}
+func NewWsHandler(container interfaces.Container, config *configuration.Manager) *WsHandler {
+	return &WsHandler{container: container, config: config}
 }
 
 func (h *WsHandler) Handle(ctx *gin.Context) {
-	log.Println("WsHandler called.")
-
 	userId := ctx.GetString("user_sub")
 	token := ctx.GetString("auth_token")
 
-	conn, err := upgrader.Upgrade(ctx.Writer, ctx.Request, nil)
+	// Messages of the connection are traced with links to its upgrade
+	upgradeCtx, span := tracing.Tracer().Start(ctx.Request.Context(), "websocket.upgrade",
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(tracing.Session(uuid.MustParse(userId)), tracing.IP(ctx.ClientIP())))
+	cfg := h.config.Current()
+	wsConn, err := transport.UpgradeWebSocket(ctx.Writer, ctx.Request, transport.WebSocketOptions{
+		// Same address as on the other transports, so bans by IP apply to every one
+		RemoteAddr:     ctx.ClientIP(),
+		AllowedOrigins: cfg.Transports.AllowedOrigins,
+		Compression: transport.Compression{
+			Enabled:   cfg.Compression,
+			Level:     cfg.CompressionLevel,
+			Threshold: cfg.CompressionThreshold,
+		},
+	})
+	tracing.End(span, err)
 	if err != nil {
-		log.Println("WebSocket upgrade error:", err)
+		logging.FromContext(ctx.Request.Context()).Warn("WebSocket upgrade error", logging.Err(err))
 		return
 	}
-	defer conn.Close()
+	ctx.Request = ctx.Request.WithContext(upgradeCtx)
+	defer wsConn.Close("")
 
-	client := models.NewClient(uuid.MustParse(userId), nil, conn)
+	client := models.NewClient(uuid.MustParse(userId), nil, wsConn)
+	wsConn.SetSession(client.Session)
+	client.Log = logging.FromContext(ctx.Request.Context()).With(logging.Session(client.UserId), slog.String("transport", "websocket"))
 	ctx.Set("ws_user_id", userId)
 	ctx.Set("ws_auth_token", token)
 	ctx.Set("ws_client", client)
 
-	h.container.GetHub().AddClient(client)
+	hub := h.container.GetHub()
+	hub.Do(func() { hub.AddClient(client) })
+	defer hub.Do(func() { hub.RemoveClient(client) })
 
 	for {
-		_, msgBytes, err := conn.ReadMessage()
+		msgBytes, err := wsConn.ReadMessage()
 		if err != nil {
-			log.Println("WebSocket read error:", err)
+			client.Log.Info("WebSocket closed", logging.Err(err))
 			break
 		}
-		log.Println("Message received:", string(msgBytes))
 		var msg models.IncomingMessage
-		err = json.Unmarshal(msgBytes, &msg)
-		err = h.container.GetRouter().Handle(ctx, client, msg, token)
+		if err := wsConn.Codec().Decode(msgBytes, &msg); err != nil {
+			client.Log.Warn("WebSocket decode error", logging.Err(err))
+			rejectFrame(hub, client, err)
+			continue
+		}
+		logMessage(client, msg)
+		hub.Do(func() {
+			err = h.container.GetRouter().Handle(ctx.Request.Context(), client, msg, token)
+		})
 		if err != nil {
-			log.Println("WebSocket router handle error:", err)
+			client.Log.Warn("WebSocket router handle error", logging.Err(err))
 			break
 		}
 	}
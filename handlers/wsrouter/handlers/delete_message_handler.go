@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"context"
+	"realTimeService/handlers/wsrouter"
+	"realTimeService/interfaces"
+	"realTimeService/logging"
+	"realTimeService/models"
+)
+
+// DeleteMessageHandler handles users deleting a message they sent
+type DeleteMessageHandler struct {
+	container interfaces.Container
+}
+
+// NewDeleteMessageHandler creates a new DeleteMessageHandler
+func NewDeleteMessageHandler(container interfaces.Container) *DeleteMessageHandler {
+	return &DeleteMessageHandler{
+		container: container,
+	}
+}
+
+// Handle processes the delete message request
+func (h *DeleteMessageHandler) Handle(ctx context.Context, client *models.Client,
+	msg models.IncomingMessage, token string) error {
+
+	hub := h.container.GetHub()
+
+	pair, err := hub.MatchingService.GetPair(client.UserId)
+	if err != nil || !pair.IsActive() {
+		wsrouter.Fail(ctx, 400, "you are not in an active chat")
+		return nil
+	}
+
+	// Only the sender may delete, and only within the edit window
+	deleted, err := hub.MessageService.Delete(pair.ID, msg.MessageId, client.UserId)
+	if err != nil {
+		wsrouter.Fail(ctx, 400, err.Error())
+		return nil
+	}
+	hub.TranscriptService.Remove(pair.ID, deleted.ID)
+
+	// The text is not repeated in the notification
+	notification := models.NewSystemMessage(string(models.MessageDeleted), pair.ID)
+	notification.ID = deleted.ID
+	notification.UserId = deleted.UserId
+	// Failing to reach the partner is no reason to drop the sender's connection
+	if err := hub.SendEventToPair(pair.ID, notification, client.UserId); err != nil {
+		client.Log.Warn("Error notifying partner of deletion", logging.Pair(pair.ID), logging.Err(err))
+	}
+	return hub.SendToClient(client, notification)
+}
@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"context"
+	"realTimeService/handlers/wsrouter"
+	"realTimeService/interfaces"
+	"realTimeService/logging"
+	"realTimeService/models"
+)
+
+// EditMessageHandler handles users editing a message they sent
+type EditMessageHandler struct {
+	container interfaces.Container
+}
+
+// NewEditMessageHandler creates a new EditMessageHandler
+func NewEditMessageHandler(container interfaces.Container) *EditMessageHandler {
+	return &EditMessageHandler{
+		container: container,
+	}
+}
+
+// Handle processes the edit message request
+func (h *EditMessageHandler) Handle(ctx context.Context, client *models.Client,
+	msg models.IncomingMessage, token string) error {
+
+	if msg.Text == "" {
+		wsrouter.Fail(ctx, 400, "message text is required")
+		return nil
+	}
+
+	hub := h.container.GetHub()
+
+	pair, err := hub.MatchingService.GetPair(client.UserId)
+	if err != nil || !pair.IsActive() {
+		wsrouter.Fail(ctx, 400, "you are not in an active chat")
+		return nil
+	}
+
+	// Only the sender may edit, and only within the edit window
+	edited, err := hub.MessageService.Edit(pair.ID, msg.MessageId, client.UserId, msg.Text)
+	if err != nil {
+		wsrouter.Fail(ctx, 400, err.Error())
+		return nil
+	}
+	hub.TranscriptService.Update(pair.ID, edited)
+
+	// Both users see the new text. Failing to reach the partner is no reason
+	// to drop the sender's connection.
+	notification := edited.WithType(models.MessageEdited)
+	if err := hub.SendEventToPair(pair.ID, notification, client.UserId); err != nil {
+		client.Log.Warn("Error notifying partner of edit", logging.Pair(pair.ID), logging.Err(err))
+	}
+	return hub.SendToClient(client, notification)
+}
@@ -1,12 +1,12 @@
 package handlers
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
+	"realTimeService/handlers/wsrouter"
 	"realTimeService/interfaces"
 	"realTimeService/models"
-
-	"github.com/gin-gonic/gin"
-	"github.com/gorilla/websocket"
+	"realTimeService/services"
 )
 
 // FindMatchHandler handles users looking for a random stranger to chat with
@@ -22,23 +22,30 @@ func NewFindMatchHandler(container interfaces.Container) *FindMatchHandler {
 }
 
 // Handle processes the find match request
-func (h *FindMatchHandler) Handle(ctx *gin.Context, client *models.Client,
+func (h *FindMatchHandler) Handle(ctx context.Context, client *models.Client,
 	msg models.IncomingMessage, token string) error {
 
 	hub := h.container.GetHub()
-	
+
+	// Searching for a random stranger replaces waiting in a private channel
+	hub.ConnectService.Leave(client.UserId)
+
 	// Try to find a match
-	pair, err := hub.MatchingService.FindMatch(client)
+	pair, err := hub.MatchingService.FindMatch(ctx, client)
+	if errors.Is(err, services.ErrMatchingPaused) {
+		// Maintenance isn't the client's fault, so it stays connected
+		wsrouter.Fail(ctx, 503, err.Error())
+		return nil
+	}
 	if err != nil {
-		ctx.JSON(400, gin.H{"error": err.Error()})
+		wsrouter.Fail(ctx, 400, err.Error())
 		return err
 	}
 
 	// If no match yet (added to queue), notify user they're searching
 	if pair == nil {
 		searchingMsg := models.NewSystemMessage(string(models.Searching), client.UserId)
-		msgBytes, _ := json.Marshal(searchingMsg)
-		client.Conn.WriteMessage(websocket.TextMessage, msgBytes)
+		client.Conn.Send(searchingMsg)
 		return nil
 	}
 
@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"context"
+	"realTimeService/handlers/wsrouter"
+	"realTimeService/interfaces"
+	"realTimeService/models"
+	"runtime/debug"
+)
+
+// HelloHandler handles the handshake a client opens the connection with
+type HelloHandler struct {
+	container interfaces.Container
+}
+
+// NewHelloHandler creates a new HelloHandler
+func NewHelloHandler(container interfaces.Container) *HelloHandler {
+	return &HelloHandler{
+		container: container,
+	}
+}
+
+// Handle negotiates the protocol version and capabilities and replies with welcome
+func (h *HelloHandler) Handle(ctx context.Context, client *models.Client,
+	msg models.IncomingMessage, token string) error {
+
+	if msg.Version < models.MinProtocolVersion {
+		wsrouter.Fail(ctx, 400, "protocol version is required")
+		return client.Conn.Send(models.NewErrorMessage(models.Hello, "protocol version is required"))
+	}
+	if !client.Session.Negotiate(msg.Version, msg.Capabilities) {
+		wsrouter.Fail(ctx, 400, "hello must be the first message")
+		return nil
+	}
+
+	hub := h.container.GetHub()
+	welcome := &models.WelcomeMessage{
+		Type:          string(models.Welcome),
+		Version:       client.Session.Version(),
+		ServerVersion: serverVersion(),
+		Session: models.WelcomeSession{
+			UserId:      client.UserId.String(),
+			NodeId:      hub.NodeId,
+			ResumeToken: hub.SessionService.ResumeToken(client.UserId),
+		},
+		Limits: models.WelcomeLimits{
+			MessageHistorySize:    hub.MessageService.HistorySize(),
+			EditWindowSeconds:     int(hub.MessageService.EditWindow().Seconds()),
+			TranscriptMaxMessages: hub.TranscriptService.MaxMessages(),
+		},
+		Features:     []string{"replies", "edits", "reactions", "transcripts", "ratings", "stayInTouch"},
+		Capabilities: client.Session.Capabilities(),
+	}
+	return hub.SendToClient(client, welcome)
+}
+
+// serverVersion returns the module version the server was built from
+func serverVersion() string {
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" {
+		return info.Main.Version
+	}
+	return "(devel)"
+}
@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"context"
+	"realTimeService/handlers/wsrouter"
+	"realTimeService/interfaces"
+	"realTimeService/models"
+
+	"github.com/google/uuid"
+)
+
+// JoinChannelHandler handles users rejoining a private channel by code
+type JoinChannelHandler struct {
+	container interfaces.Container
+}
+
+// NewJoinChannelHandler creates a new JoinChannelHandler
+func NewJoinChannelHandler(container interfaces.Container) *JoinChannelHandler {
+	return &JoinChannelHandler{
+		container: container,
+	}
+}
+
+// Handle processes the join channel request
+func (h *JoinChannelHandler) Handle(ctx context.Context, client *models.Client,
+	msg models.IncomingMessage, token string) error {
+
+	if msg.Code == "" {
+		wsrouter.Fail(ctx, 400, "channel code is required")
+		return nil
+	}
+
+	hub := h.container.GetHub()
+
+	if pair, err := hub.MatchingService.GetPair(client.UserId); err == nil && pair.IsActive() {
+		wsrouter.Fail(ctx, 400, "leave your current chat first")
+		return nil
+	}
+
+	// Joining a channel replaces searching for a random stranger
+	hub.MatchingService.RemoveFromQueue(client.UserId)
+
+	partner, err := hub.ConnectService.Join(msg.Code, client)
+	if err != nil {
+		wsrouter.Fail(ctx, 400, err.Error())
+		return nil
+	}
+
+	// The other member isn't there yet
+	if partner == nil {
+		return hub.SendToClient(client, models.NewConnectMessage(models.ChannelWaiting, uuid.Nil, ""))
+	}
+
+	pair, err := hub.MatchingService.CreatePair(client, partner)
+	if err != nil {
+		wsrouter.Fail(ctx, 400, err.Error())
+		return nil
+	}
+	return hub.NotifyStrangerJoined(pair)
+}
@@ -1,12 +1,13 @@
 package handlers
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
+	"realTimeService/events"
+	"realTimeService/handlers/wsrouter"
 	"realTimeService/interfaces"
 	"realTimeService/models"
-
-	"github.com/gin-gonic/gin"
-	"github.com/gorilla/websocket"
+	"realTimeService/services"
 )
 
 // NextStrangerHandler handles users skipping to the next stranger
@@ -22,11 +23,14 @@ func NewNextStrangerHandler(container interfaces.Container) *NextStrangerHandler
 }
 
 // Handle processes the next stranger request
-func (h *NextStrangerHandler) Handle(ctx *gin.Context, client *models.Client,
+func (h *NextStrangerHandler) Handle(ctx context.Context, client *models.Client,
 	msg models.IncomingMessage, token string) error {
 
 	hub := h.container.GetHub()
 
+	// Moving on withdraws a proposal to stay in touch and waiting in a private channel
+	hub.ConnectService.Leave(client.UserId)
+
 	// Get current pair
 	currentPair, err := hub.MatchingService.GetPair(client.UserId)
 	if err == nil && currentPair != nil {
@@ -37,21 +41,25 @@ func (h *NextStrangerHandler) Handle(ctx *gin.Context, client *models.Client,
 		}
 
 		// End current pair
-		hub.MatchingService.EndPair(currentPair.ID)
+		hub.EndPair(currentPair, events.ReasonNext)
 	}
 
 	// Try to find new match
-	newPair, err := hub.MatchingService.FindMatch(client)
+	newPair, err := hub.MatchingService.FindMatch(ctx, client)
+	if errors.Is(err, services.ErrMatchingPaused) {
+		// Maintenance isn't the client's fault, so it stays connected
+		wsrouter.Fail(ctx, 503, err.Error())
+		return nil
+	}
 	if err != nil {
-		ctx.JSON(400, gin.H{"error": err.Error()})
+		wsrouter.Fail(ctx, 400, err.Error())
 		return err
 	}
 
 	// If no match yet, notify searching
 	if newPair == nil {
 		searchingMsg := models.NewSystemMessage(string(models.Searching), client.UserId)
-		msgBytes, _ := json.Marshal(searchingMsg)
-		client.Conn.WriteMessage(websocket.TextMessage, msgBytes)
+		client.Conn.Send(searchingMsg)
 		return nil
 	}
 
@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"realTimeService/handlers/wsrouter"
+	"realTimeService/interfaces"
+	"realTimeService/models"
+	"realTimeService/services"
+)
+
+// RateStrangerHandler handles users rating their former partner after a chat ended
+type RateStrangerHandler struct {
+	container interfaces.Container
+}
+
+// NewRateStrangerHandler creates a new RateStrangerHandler
+func NewRateStrangerHandler(container interfaces.Container) *RateStrangerHandler {
+	return &RateStrangerHandler{
+		container: container,
+	}
+}
+
+// Handle processes the rate stranger request
+func (h *RateStrangerHandler) Handle(ctx context.Context, client *models.Client,
+	msg models.IncomingMessage, token string) error {
+
+	if msg.Rating != "up" && msg.Rating != "down" {
+		wsrouter.Fail(ctx, 400, "rating must be up or down")
+		return nil
+	}
+
+	if len(msg.Tags) > services.MaxRatingTags {
+		wsrouter.Fail(ctx, 400, fmt.Sprintf("a rating can carry at most %d tags", services.MaxRatingTags))
+		return nil
+	}
+	// Complaints go with a thumbs down and praise with a thumbs up
+	for _, tag := range msg.Tags {
+		weight, ok := services.RatingTagWeights[tag]
+		if !ok {
+			wsrouter.Fail(ctx, 400, fmt.Sprintf("unknown rating tag %q", tag))
+			return nil
+		}
+		if (weight < 0) == (msg.Rating == "up") {
+			wsrouter.Fail(ctx, 400, fmt.Sprintf("tag %q doesn't go with a thumbs %s", tag, msg.Rating))
+			return nil
+		}
+	}
+
+	hub := h.container.GetHub()
+
+	// The pair ID identifies which ended chat is being rated
+	err := hub.ReputationService.Rate(client.UserId, msg.PairId, msg.Rating == "up", msg.Tags)
+	if err != nil {
+		wsrouter.Fail(ctx, 400, err.Error())
+		return nil
+	}
+
+	return hub.SendToClient(client, models.NewSystemMessage(string(models.RatingReceived), msg.PairId))
+}
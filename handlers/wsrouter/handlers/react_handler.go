@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"context"
+	"realTimeService/handlers/wsrouter"
+	"realTimeService/interfaces"
+	"realTimeService/logging"
+	"realTimeService/models"
+)
+
+// ReactHandler handles users reacting to messages
+type ReactHandler struct {
+	container interfaces.Container
+}
+
+// NewReactHandler creates a new ReactHandler
+func NewReactHandler(container interfaces.Container) *ReactHandler {
+	return &ReactHandler{
+		container: container,
+	}
+}
+
+// Handle processes the react request
+func (h *ReactHandler) Handle(ctx context.Context, client *models.Client,
+	msg models.IncomingMessage, token string) error {
+
+	hub := h.container.GetHub()
+
+	pair, err := hub.MatchingService.GetPair(client.UserId)
+	if err != nil || !pair.IsActive() {
+		wsrouter.Fail(ctx, 400, "you are not in an active chat")
+		return nil
+	}
+
+	// Validates the reaction and keeps one reaction per user per message
+	reactions, err := hub.MessageService.React(pair.ID, msg.MessageId, client.UserId, msg.Reaction)
+	if err != nil {
+		wsrouter.Fail(ctx, 400, err.Error())
+		return nil
+	}
+
+	// Each user gets the aggregated counts plus their own reaction. Failing to
+	// reach the partner is no reason to drop the reacting user's connection.
+	partner := pair.GetPartner(client.UserId)
+	update := models.NewReactionsMessage(pair.ID, msg.MessageId, reactions, partner.UserId)
+	if err := hub.SendToClient(partner, update); err != nil {
+		client.Log.Warn("Error notifying partner of reaction", logging.Pair(pair.ID), logging.Err(err))
+	}
+	return hub.SendToClient(client, models.NewReactionsMessage(pair.ID, msg.MessageId, reactions, client.UserId))
+}
@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"context"
+	"realTimeService/handlers/wsrouter"
+	"realTimeService/interfaces"
+	"realTimeService/models"
+	"realTimeService/services"
+
+	"github.com/google/uuid"
+)
+
+// ReportStrangerHandler handles users reporting the stranger to the operators,
+// during the chat or after it ended
+type ReportStrangerHandler struct {
+	container interfaces.Container
+}
+
+// NewReportStrangerHandler creates a new ReportStrangerHandler
+func NewReportStrangerHandler(container interfaces.Container) *ReportStrangerHandler {
+	return &ReportStrangerHandler{
+		container: container,
+	}
+}
+
+// Handle processes the report stranger request
+func (h *ReportStrangerHandler) Handle(ctx context.Context, client *models.Client,
+	msg models.IncomingMessage, token string) error {
+
+	hub := h.container.GetHub()
+
+	// The current chat, or the ended one named by the pair ID while it may still be rated
+	report := &models.Report{
+		PairId:     msg.PairId,
+		ReporterId: client.UserId,
+		Reason:     msg.Reason,
+		Details:    msg.Text,
+	}
+	if pair, err := hub.MatchingService.GetPair(client.UserId); err == nil && pair.IsActive() &&
+		(msg.PairId == uuid.Nil || msg.PairId == pair.ID) {
+		report.PairId = pair.ID
+		report.ReportedId = pair.GetPartner(client.UserId).UserId
+		report.Snippet = models.NewReportSnippet(
+			hub.MessageService.Recent(pair.ID, services.ReportSnippetSize), client.UserId)
+	} else if partnerId, ok := hub.ReputationService.FormerPartner(client.UserId, msg.PairId); ok {
+		report.ReportedId = partnerId
+		report.Snippet = models.NewReportSnippet(hub.ReportService.Snippet(msg.PairId), client.UserId)
+	} else {
+		wsrouter.Fail(ctx, 400, "no chat to report")
+		return nil
+	}
+	report.ReportedIP = hub.ClientAddress(report.ReportedId)
+
+	if err := hub.FileReport(report); err != nil {
+		wsrouter.Fail(ctx, 400, err.Error())
+		return nil
+	}
+
+	return hub.SendToClient(client, models.NewSystemMessage(string(models.ReportReceived), report.PairId))
+}
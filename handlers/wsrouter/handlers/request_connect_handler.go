@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"context"
+	"realTimeService/handlers/wsrouter"
+	"realTimeService/interfaces"
+	"realTimeService/logging"
+	"realTimeService/models"
+)
+
+// RequestConnectHandler handles users proposing to stay in touch with the stranger
+type RequestConnectHandler struct {
+	container interfaces.Container
+}
+
+// NewRequestConnectHandler creates a new RequestConnectHandler
+func NewRequestConnectHandler(container interfaces.Container) *RequestConnectHandler {
+	return &RequestConnectHandler{
+		container: container,
+	}
+}
+
+// Handle processes the request connect request
+func (h *RequestConnectHandler) Handle(ctx context.Context, client *models.Client,
+	msg models.IncomingMessage, token string) error {
+
+	hub := h.container.GetHub()
+
+	pair, err := hub.MatchingService.GetPair(client.UserId)
+	if err != nil || !pair.IsActive() {
+		wsrouter.Fail(ctx, 400, "you are not in an active chat")
+		return nil
+	}
+
+	channel, err := hub.ConnectService.Request(pair, client.UserId)
+	if err != nil {
+		wsrouter.Fail(ctx, 400, err.Error())
+		return nil
+	}
+
+	// Both proposed it, which counts as mutual acceptance. Failing to reach the
+	// partner is no reason to drop the requester's connection.
+	if channel != nil {
+		established := models.NewConnectMessage(models.ConnectEstablished, pair.ID, channel.Code)
+		if err := hub.SendEventToPair(pair.ID, established, client.UserId); err != nil {
+			client.Log.Warn("Error telling partner the channel was created", logging.Pair(pair.ID), logging.Err(err))
+		}
+		return hub.SendToClient(client, established)
+	}
+
+	// Nothing is revealed yet, the stranger only learns about the proposal
+	requested := models.NewConnectMessage(models.ConnectRequested, pair.ID, "")
+	if err := hub.SendEventToPair(pair.ID, requested, client.UserId); err != nil {
+		client.Log.Warn("Error telling partner about the proposal", logging.Pair(pair.ID), logging.Err(err))
+	}
+	return hub.SendToClient(client, models.NewConnectMessage(models.ConnectPending, pair.ID, ""))
+}
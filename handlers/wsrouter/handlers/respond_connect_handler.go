@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"context"
+	"realTimeService/handlers/wsrouter"
+	"realTimeService/interfaces"
+	"realTimeService/logging"
+	"realTimeService/models"
+)
+
+// RespondConnectHandler handles users accepting or declining to stay in touch
+type RespondConnectHandler struct {
+	container interfaces.Container
+}
+
+// NewRespondConnectHandler creates a new RespondConnectHandler
+func NewRespondConnectHandler(container interfaces.Container) *RespondConnectHandler {
+	return &RespondConnectHandler{
+		container: container,
+	}
+}
+
+// Handle processes the respond connect request
+func (h *RespondConnectHandler) Handle(ctx context.Context, client *models.Client,
+	msg models.IncomingMessage, token string) error {
+
+	hub := h.container.GetHub()
+
+	pair, err := hub.MatchingService.GetPair(client.UserId)
+	if err != nil || !pair.IsActive() {
+		wsrouter.Fail(ctx, 400, "you are not in an active chat")
+		return nil
+	}
+
+	channel, err := hub.ConnectService.Respond(pair, client.UserId, msg.Accept)
+	if err != nil {
+		wsrouter.Fail(ctx, 400, err.Error())
+		return nil
+	}
+
+	// Declining only tells the proposer, no code is ever created
+	if channel == nil {
+		declined := models.NewConnectMessage(models.ConnectDeclined, pair.ID, "")
+		if err := hub.SendEventToPair(pair.ID, declined, client.UserId); err != nil {
+			client.Log.Warn("Error telling partner the proposal was declined", logging.Pair(pair.ID), logging.Err(err))
+		}
+		return nil
+	}
+
+	// Failing to reach the partner is no reason to drop the responder's connection
+	established := models.NewConnectMessage(models.ConnectEstablished, pair.ID, channel.Code)
+	if err := hub.SendEventToPair(pair.ID, established, client.UserId); err != nil {
+		client.Log.Warn("Error telling partner the channel was created", logging.Pair(pair.ID), logging.Err(err))
+	}
+	return hub.SendToClient(client, established)
+}
@@ -1,10 +1,12 @@
 package handlers
 
 import (
+	"context"
+	"realTimeService/handlers/wsrouter"
 	"realTimeService/interfaces"
 	"realTimeService/models"
 
-	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 )
 
 // SendHandler implements MessageHandler interface
@@ -20,34 +22,51 @@ func NewSendHandler(container interfaces.Container) *SendHandler {
 }
 
 // Handle processes the incoming message to send a message to stranger
-func (h *SendHandler) Handle(ctx *gin.Context, client *models.Client,
+func (h *SendHandler) Handle(ctx context.Context, client *models.Client,
 	msg models.IncomingMessage, token string) error {
-	
+
 	// Validate the message
 	if msg.Text == "" {
-		ctx.JSON(400, gin.H{"error": "message text is required"})
+		wsrouter.Fail(ctx, 400, "message text is required")
 		return nil
 	}
 
 	// Get the user's current pair
 	pair, err := h.container.GetHub().MatchingService.GetPair(client.UserId)
 	if err != nil {
-		ctx.JSON(400, gin.H{"error": "you are not in an active chat"})
+		wsrouter.Fail(ctx, 400, "you are not in an active chat")
 		return nil
 	}
 
-	if !pair.Active {
-		ctx.JSON(400, gin.H{"error": "chat is not active"})
+	if !pair.IsActive() {
+		wsrouter.Fail(ctx, 400, "chat is not active")
 		return nil
 	}
 
+	hub := h.container.GetHub()
+
+	// Replies must reference a recent message of the same chat
+	if msg.ReplyTo != uuid.Nil {
+		if _, err := hub.MessageService.Get(pair.ID, msg.ReplyTo); err != nil {
+			wsrouter.Fail(ctx, 400, "replied message not found")
+			return nil
+		}
+	}
+
 	// Create and send the message to partner
 	outMsg := models.NewMessage(msg.Text, client.UserId, pair.ID)
-	err = h.container.GetHub().SendMessageToPair(pair.ID, outMsg, client.UserId)
+	outMsg.ReplyTo = msg.ReplyTo
+	hub.MessageService.Register(outMsg)
+
+	err = hub.SendMessageToPair(ctx, pair.ID, outMsg, client.UserId)
 	if err != nil {
-		ctx.JSON(500, gin.H{"error": "failed to send message"})
+		wsrouter.Fail(ctx, 500, "failed to send message")
 		return err
 	}
+	hub.TranscriptService.Record(pair.ID, outMsg)
 
-	return nil
-}
\ No newline at end of file
+	// Tell the sender which ID the server assigned
+	ack := outMsg.WithType(models.MessageAck)
+	ack.ClientId = msg.ClientId
+	return hub.SendToClient(client, ack)
+}
@@ -1,10 +1,10 @@
 package handlers
 
 import (
+	"context"
+	"realTimeService/events"
 	"realTimeService/interfaces"
 	"realTimeService/models"
-
-	"github.com/gin-gonic/gin"
 )
 
 // StopChatHandler handles users stopping their chat
@@ -20,7 +20,7 @@ func NewStopChatHandler(container interfaces.Container) *StopChatHandler {
 }
 
 // Handle processes the stop chat request
-func (h *StopChatHandler) Handle(ctx *gin.Context, client *models.Client,
+func (h *StopChatHandler) Handle(ctx context.Context, client *models.Client,
 	msg models.IncomingMessage, token string) error {
 
 	hub := h.container.GetHub()
@@ -35,11 +35,12 @@ func (h *StopChatHandler) Handle(ctx *gin.Context, client *models.Client,
 		}
 
 		// End current pair
-		hub.MatchingService.EndPair(currentPair.ID)
+		hub.EndPair(currentPair, events.ReasonStop)
 	}
 
-	// Remove from waiting queue if there
+	// Remove from waiting queue or private channel if there
 	hub.MatchingService.RemoveFromQueue(client.UserId)
+	hub.ConnectService.Leave(client.UserId)
 
 	return nil
 }
@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"context"
+	"realTimeService/handlers/wsrouter"
+	"realTimeService/interfaces"
+	"realTimeService/logging"
+	"realTimeService/models"
+)
+
+// TranscriptOptInHandler handles users opting in or out of keeping a chat transcript
+type TranscriptOptInHandler struct {
+	container interfaces.Container
+}
+
+// NewTranscriptOptInHandler creates a new TranscriptOptInHandler
+func NewTranscriptOptInHandler(container interfaces.Container) *TranscriptOptInHandler {
+	return &TranscriptOptInHandler{
+		container: container,
+	}
+}
+
+// Handle processes the transcript opt-in request
+func (h *TranscriptOptInHandler) Handle(ctx context.Context, client *models.Client,
+	msg models.IncomingMessage, token string) error {
+
+	hub := h.container.GetHub()
+
+	// Transcripts only exist for the current chat
+	pair, err := hub.MatchingService.GetPair(client.UserId)
+	if err != nil {
+		wsrouter.Fail(ctx, 400, "you are not in an active chat")
+		return nil
+	}
+
+	_, err = hub.TranscriptService.SetOptIn(pair, client.UserId, msg.Enabled)
+	if err != nil {
+		wsrouter.Fail(ctx, 400, err.Error())
+		return nil
+	}
+
+	// Both users see the opt-in state of each other. Failing to reach the
+	// partner is no reason to drop the user's connection.
+	if err := hub.NotifyTranscriptStatus(pair); err != nil {
+		client.Log.Warn("Error sending transcript status", logging.Pair(pair.ID), logging.Err(err))
+	}
+	return nil
+}
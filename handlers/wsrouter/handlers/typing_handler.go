@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"context"
+	"realTimeService/handlers/wsrouter"
+	"realTimeService/interfaces"
+	"realTimeService/models"
+)
+
+// TypingHandler relays typing indicators to the stranger
+type TypingHandler struct {
+	container interfaces.Container
+}
+
+// NewTypingHandler creates a new TypingHandler
+func NewTypingHandler(container interfaces.Container) *TypingHandler {
+	return &TypingHandler{
+		container: container,
+	}
+}
+
+// Handle tells the partner whether the user is typing. Partners that didn't
+// negotiate typing indicators don't get them.
+func (h *TypingHandler) Handle(ctx context.Context, client *models.Client,
+	msg models.IncomingMessage, token string) error {
+
+	hub := h.container.GetHub()
+
+	pair, err := hub.MatchingService.GetPair(client.UserId)
+	if err != nil || !pair.IsActive() {
+		wsrouter.Fail(ctx, 400, "you are not in an active chat")
+		return nil
+	}
+
+	event := &models.TypingMessage{
+		Type:   string(models.Typing),
+		PairId: pair.ID.String(),
+		Typing: msg.Enabled,
+	}
+	if err := hub.SendEventToPair(pair.ID, event, client.UserId); err != nil {
+		wsrouter.Fail(ctx, 500, "failed to send typing indicator")
+	}
+	return nil
+}
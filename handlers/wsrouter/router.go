@@ -1,23 +1,122 @@
 package wsrouter
 
 import (
+	"context"
+	"fmt"
+	"realTimeService/logging"
 	"realTimeService/models"
+	"realTimeService/tracing"
 
-	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // MessageHandler is an interface that defines a method for handling incoming messages.
-// It takes a gin.Context, a client model, an incoming message, and a token as parameters.
+// It takes a context, a client model, an incoming message, and a token as parameters.
 // The method returns an error if the handling fails.
 type MessageHandler interface {
-	Handle(ctx *gin.Context, client *models.Client,
+	Handle(ctx context.Context, client *models.Client,
 		msg models.IncomingMessage, token string) error
 }
 
+// Result is how a message was answered. Transports whose messages arrive as
+// HTTP requests, such as SSE, turn it into the response status.
+type Result struct {
+	Status int // 0 unless the message was rejected
+	Error  string
+}
+
+// resultKey is the context key of the Result a message's handling is recorded in
+type resultKey struct{}
+
+// WithResult returns a context that records how the message handled with it was answered
+func WithResult(ctx context.Context) (context.Context, *Result) {
+	result := &Result{}
+	return context.WithValue(ctx, resultKey{}, result), result
+}
+
+// request is the message being handled, which Fail tells the client about
+type request struct {
+	client  *models.Client
+	msgType models.MessageType
+	sender  Sender
+}
+
+// requestKey is the context key of the request being handled
+type requestKey struct{}
+
+// Fail rejects the message being handled with the HTTP-style status and reason.
+// The reason is recorded in the Result of the context, and a client that
+// completed the handshake gets an error event naming the rejected message.
+func Fail(ctx context.Context, status int, reason string) {
+	if result, ok := ctx.Value(resultKey{}).(*Result); ok {
+		result.Status, result.Error = status, reason
+	}
+	req, ok := ctx.Value(requestKey{}).(*request)
+	if !ok {
+		return
+	}
+	// Clients of other nodes were greeted before their messages were forwarded
+	if session := req.client.Session; session != nil && !session.Greeted() {
+		return
+	}
+	if err := req.send(models.NewErrorMessage(req.msgType, reason)); err != nil {
+		req.client.Log.Warn("Error sending rejection", logging.Err(err))
+	}
+}
+
+// send delivers an event to the client of the request
+func (req *request) send(v any) error {
+	if req.sender != nil {
+		return req.sender.SendToClient(req.client, v)
+	}
+	if req.client.Conn == nil {
+		return nil
+	}
+	return req.client.Conn.Send(v)
+}
+
+// Forwarder hands pair-scoped messages over to the node that owns the sender's pair.
+// Forward returns false if the message should be handled locally. The trace
+// context of ctx goes along with the message.
+type Forwarder interface {
+	Forward(ctx context.Context, client *models.Client, msg models.IncomingMessage) (bool, error)
+}
+
+// Sender delivers events to clients, including those connected to other nodes
+type Sender interface {
+	SendToClient(client *models.Client, v any) error
+}
+
+// requirement is what a session must have negotiated to send a message
+type requirement struct {
+	since      int               // First protocol version with the message
+	capability models.Capability // Capability the message belongs to, if any
+}
+
+// requirements lists the messages added after protocol version 1. The features
+// behind most of them are always on and announced in welcome, so only typing
+// needs a capability.
+var requirements = map[models.MessageType]requirement{
+	models.Hello:           {since: 2},
+	models.Typing:          {since: 2, capability: models.CapabilityTyping},
+	models.TranscriptOptIn: {since: 2},
+	models.EditMessage:     {since: 2},
+	models.DeleteMessage:   {since: 2},
+	models.React:           {since: 2},
+	models.RateStranger:    {since: 2},
+	models.RequestConnect:  {since: 2},
+	models.RespondConnect:  {since: 2},
+	models.JoinChannel:     {since: 2},
+	models.ReportStranger:  {since: 2},
+}
+
 // Router is a struct that holds a map of message types to their corresponding handlers.
 // It provides methods to register handlers and to handle incoming messages based on their type.
 type Router struct {
-	handlers map[models.MessageType]MessageHandler
+	handlers  map[models.MessageType]MessageHandler
+	forwarder Forwarder
+	sender    Sender
 }
 
 // NewRouter creates a new Router instance with an initialized handlers map.
@@ -35,16 +134,87 @@ func (r *Router) RegisterHandler(msgType models.MessageType, handler MessageHand
 	r.handlers[msgType] = handler
 }
 
+// SetForwarder sets where pair-scoped messages are sent when the sender's pair
+// is owned by another node. Without a forwarder every message is handled locally.
+func (r *Router) SetForwarder(forwarder Forwarder) {
+	r.forwarder = forwarder
+}
+
+// SetSender sets how rejections reach clients. Without a sender they are only
+// sent to clients connected to this node.
+func (r *Router) SetSender(sender Sender) {
+	r.sender = sender
+}
+
 // Handle processes an incoming message by routing it to the appropriate handler based on its type.
-// It takes a gin.Context, a client model, and an incoming message as parameters.
+// It takes a context, a client model, and an incoming message as parameters.
 // If the message type is not supported, it returns a 400 error response.
+// Messages the client's negotiated protocol version or capabilities don't cover are rejected.
+// Pair-scoped messages of a pair owned by another node are forwarded there.
 // If the handler exists, it calls the handler's Handle method to process the message.
-func (r *Router) Handle(ctx *gin.Context, client *models.Client,
+//
+// Each message is traced in a span that handlers find in the request context.
+// Messages of a connection start their own trace linked to the connection's,
+// and messages forwarded from another node continue the sender's trace.
+func (r *Router) Handle(parent context.Context, client *models.Client,
+	msg models.IncomingMessage, token string) (err error) {
+	options := []trace.SpanStartOption{
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(attribute.String("message.type", string(msg.Type)), tracing.Session(client.UserId)),
+	}
+	if connection := trace.SpanContextFromContext(parent); connection.IsValid() && !connection.IsRemote() {
+		options = append(options, trace.WithNewRoot(), trace.WithLinks(trace.Link{SpanContext: connection}))
+	}
+	ctx, span := tracing.Tracer().Start(parent, "wsrouter.Handle "+string(msg.Type), options...)
+	defer func() { tracing.End(span, err) }()
+
+	return r.route(ctx, client, msg, token)
+}
+
+// route hands a message to its handler, or to the node owning the sender's pair
+func (r *Router) route(ctx context.Context, client *models.Client,
 	msg models.IncomingMessage, token string) error {
+	ctx = context.WithValue(ctx, requestKey{}, &request{client: client, msgType: msg.Type, sender: r.sender})
 	handler, exists := r.handlers[msg.Type]
 	if !exists {
-		ctx.JSON(400, gin.H{"error": "unsupported message type"})
+		Fail(ctx, 400, "unsupported message type")
 		return nil
 	}
+	if reason := r.check(client, msg.Type); reason != "" {
+		Fail(ctx, 400, reason)
+		return nil
+	}
+	if r.forwarder != nil && msg.Type.PairScoped() {
+		if forwarded, err := r.forwarder.Forward(ctx, client, msg); forwarded {
+			return err
+		}
+	}
 	return handler.Handle(ctx, client, msg, token)
-}
\ No newline at end of file
+}
+
+// check returns why the client may not send a message of the type, empty if it may.
+// Messages of remote users were checked by their node already.
+func (r *Router) check(client *models.Client, msgType models.MessageType) string {
+	if client.Session == nil {
+		return ""
+	}
+	if msgType == models.Hello {
+		if client.Session.Started() {
+			return "hello must be the first message"
+		}
+		return ""
+	}
+	client.Session.Start()
+
+	req, ok := requirements[msgType]
+	if !ok {
+		return ""
+	}
+	if version := client.Session.Version(); version < req.since {
+		return fmt.Sprintf("%s requires protocol version %d, the session uses %d", msgType, req.since, version)
+	}
+	if req.capability != "" && !client.Session.Has(req.capability) {
+		return fmt.Sprintf("%s requires the %s capability", msgType, req.capability)
+	}
+	return ""
+}
@@ -0,0 +1,240 @@
+package hubs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"realTimeService/events"
+	"realTimeService/logging"
+	"realTimeService/models"
+	"realTimeService/tracing"
+	"time"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// clusterPublishTimeout bounds publishing a single event to another node
+const clusterPublishTimeout = 5 * time.Second
+
+// clusterEventType tells the receiving node what to do with an event
+type clusterEventType string
+
+const (
+	deliverEvent     clusterEventType = "deliver"     // Write the payload to a local user
+	pairCreatedEvent clusterEventType = "pairCreated" // A local waiting user was matched with a user of the sending node
+	pairEndedEvent   clusterEventType = "pairEnded"   // The sending node ended a pair shared with a local user
+	commandEvent     clusterEventType = "command"     // Run a message of a remote user on the pair this node owns
+	kickEvent        clusterEventType = "kick"        // Close the connection of a local user
+	kickAddressEvent clusterEventType = "kickAddress" // Close the connections of local users from an address
+	announceEvent    clusterEventType = "announce"    // Send an announcement to every local user
+)
+
+// clusterEvent is sent between nodes through the broker
+type clusterEvent struct {
+	Type      clusterEventType  `json:"type"`
+	From      string            `json:"from"`
+	UserId    uuid.UUID         `json:"userId"`             // User on the receiving node, or the sender of a command
+	PairId    uuid.UUID         `json:"pairId,omitzero"`    // Pair the event is about
+	PartnerId uuid.UUID         `json:"partnerId,omitzero"` // User on the sending node (pairCreated)
+	Payload   json.RawMessage   `json:"payload,omitempty"`  // Outgoing message (deliver) or incoming message (command)
+	Requires  models.Capability `json:"requires,omitempty"` // Capability the user needs to get the payload (deliver)
+	Text      string            `json:"text,omitempty"`     // Reason (kick, pairEnded) or announcement text (announce)
+	Address   string            `json:"address,omitempty"`  // IP address whose connections to close (kickAddress)
+	Trace     map[string]string `json:"trace,omitempty"`    // Trace context of the sender (deliver, command)
+}
+
+// CommandHandler runs a pair-scoped message that a remote user sent to their node,
+// with a context continuing the trace of the sender's node
+type CommandHandler func(ctx context.Context, client *models.Client, msg models.IncomingMessage)
+
+// nodeChannel returns the broker channel a node receives its events on
+func nodeChannel(nodeId string) string {
+	return "goroom:node:" + nodeId
+}
+
+// SetCommandHandler sets how messages forwarded from other nodes are handled
+func (h *MainHub) SetCommandHandler(handler CommandHandler) {
+	h.commandHandler = handler
+}
+
+// Start subscribes the hub to events sent to this node by other nodes
+func (h *MainHub) Start() error {
+	ctx, cancel := context.WithCancel(context.Background())
+	events, err := h.broker.Subscribe(ctx, nodeChannel(h.NodeId))
+	if err != nil {
+		cancel()
+		return fmt.Errorf("error subscribing to cluster events: %w", err)
+	}
+	h.stopCluster = cancel
+
+	go func() {
+		for {
+			select {
+			case payload, ok := <-events:
+				if !ok {
+					return
+				}
+				h.Do(func() { h.handleClusterEvent(payload) })
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	slog.Info("Listening for cluster events", logging.Node(h.NodeId))
+	return nil
+}
+
+// Forward hands a pair-scoped message over to the node owning the sender's pair.
+// Returns false if the message should be handled on this node.
+func (h *MainHub) Forward(ctx context.Context, client *models.Client, msg models.IncomingMessage) (bool, error) {
+	if client.IsRemote() {
+		return false, nil
+	}
+
+	pair, err := h.MatchingService.GetPair(client.UserId)
+	if err != nil || !pair.IsRemote() {
+		return false, nil
+	}
+
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return true, fmt.Errorf("error marshalling message: %w", err)
+	}
+	return true, h.publish(pair.NodeId, clusterEvent{
+		Type:    commandEvent,
+		UserId:  client.UserId,
+		PairId:  pair.ID,
+		Payload: payload,
+		Trace:   tracing.Inject(ctx),
+	})
+}
+
+// publish sends an event to another node
+func (h *MainHub) publish(nodeId string, event clusterEvent) error {
+	event.From = h.NodeId
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("error marshalling cluster event: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), clusterPublishTimeout)
+	defer cancel()
+	if err := h.broker.Publish(ctx, nodeChannel(nodeId), payload); err != nil {
+		return fmt.Errorf("error publishing %s to node %s: %w", event.Type, nodeId, err)
+	}
+	return nil
+}
+
+// handleClusterEvent applies an event received from another node
+func (h *MainHub) handleClusterEvent(payload []byte) {
+	var event clusterEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		slog.Warn("Invalid cluster event", logging.Err(err))
+		return
+	}
+
+	switch event.Type {
+	case deliverEvent:
+		h.mut.RLock()
+		client, ok := h.Clients[event.UserId]
+		h.mut.RUnlock()
+		if !ok {
+			return
+		}
+		_, span := tracing.Tracer().Start(tracing.Extract(event.Trace), "MainHub.deliver",
+			trace.WithSpanKind(trace.SpanKindConsumer),
+			trace.WithAttributes(tracing.Session(event.UserId), tracing.Node(event.From)))
+		if event.Requires != "" && !client.Session.Has(event.Requires) {
+			span.End()
+			return
+		}
+		err := client.Conn.Send(event.Payload)
+		if err != nil {
+			client.Log.Warn("Error sending event from another node", logging.Node(event.From), logging.Err(err))
+		}
+		tracing.End(span, err)
+
+	case pairCreatedEvent:
+		partner := models.NewRemoteClient(event.PartnerId, event.From)
+		// The user waits in the queue, or in a private channel the partner joined
+		client := h.ConnectService.Claim(event.UserId)
+		if client == nil {
+			client = h.MatchingService.Claim(event.UserId)
+		}
+		pair, err := h.MatchingService.AdoptPair(event.PairId, client, partner, event.From)
+		if err != nil {
+			// The user is gone, let the other node end the pair
+			slog.Info("Declining pair from another node", logging.Pair(event.PairId), logging.Node(event.From), logging.Err(err))
+			if err := h.publish(event.From, clusterEvent{
+				Type:   pairEndedEvent,
+				UserId: event.PartnerId,
+				PairId: event.PairId,
+				Text:   string(events.ReasonDisconnect),
+			}); err != nil {
+				slog.Error("Error declining pair", logging.Pair(event.PairId), logging.Err(err))
+			}
+			return
+		}
+		notification := models.NewSystemMessage(string(models.StrangerJoined), pair.ID)
+		if err := h.SendToClient(pair.GetPartner(event.PartnerId), notification); err != nil {
+			slog.Warn("Error notifying user of match", logging.Session(event.UserId), logging.Pair(pair.ID), logging.Err(err))
+		}
+
+	case pairEndedEvent:
+		pair, err := h.MatchingService.GetPairById(event.PairId)
+		if err != nil {
+			return // Already ended on this node too
+		}
+		h.NotifyStrangerLeft(event.UserId)
+		reason := events.EndReason(event.Text)
+		if reason == "" {
+			reason = events.ReasonUnknown
+		}
+		h.endPair(pair, reason, false)
+
+	case commandEvent:
+		var msg models.IncomingMessage
+		if err := json.Unmarshal(event.Payload, &msg); err != nil {
+			slog.Warn("Invalid command from another node", logging.Node(event.From), logging.Err(err))
+			return
+		}
+		if h.commandHandler != nil {
+			h.commandHandler(tracing.Extract(event.Trace), models.NewRemoteClient(event.UserId, event.From), msg)
+		}
+
+	case kickEvent:
+		h.kickLocal(event.UserId, event.Text)
+
+	case kickAddressEvent:
+		h.kickLocalAddress(event.Address, event.Text)
+
+	case announceEvent:
+		h.announceLocal(event.Text)
+
+	default:
+		slog.Warn("Unknown cluster event", "type", event.Type, logging.Node(event.From))
+	}
+}
+
+// handleNodeDown ends every pair with a user of a node that went down,
+// telling the partners here that the stranger left
+func (h *MainHub) handleNodeDown(nodeId string) {
+	pairs := h.MatchingService.GetNodePairs(nodeId)
+	for _, pair := range pairs {
+		for _, user := range pair.Users() {
+			if !user.IsRemote() {
+				h.NotifyStrangerLeft(user.UserId)
+			}
+		}
+		h.endPair(pair, events.ReasonNodeDown, false)
+	}
+	h.MatchingService.RemoveNodeFromQueue(nodeId)
+	if err := h.ConnectService.RemoveNode(nodeId); err != nil {
+		slog.Error("Error removing node from private channels", logging.Node(nodeId), logging.Err(err))
+	}
+
+	slog.Info("Ended pairs with users of a node that went down", logging.Node(nodeId), "pairs", len(pairs))
+}
@@ -0,0 +1,93 @@
+package hubs
+
+import "sync"
+
+// eventLoopBuffer is how many commands may wait for the loop before submitters block
+const eventLoopBuffer = 1024
+
+// command is a unit of work run on the event loop
+type command struct {
+	fn   func()
+	done chan any // receives the recovered panic, nil if fn returned normally
+}
+
+// EventLoop runs submitted commands one at a time on a single goroutine.
+// Everything a command does happens before the next command starts, so the
+// state the commands share changes in one deterministic order.
+type EventLoop struct {
+	commands chan command
+	stop     chan struct{}
+	stopped  chan struct{}
+	once     sync.Once
+}
+
+// NewEventLoop creates a new event loop, call Start to run it
+func NewEventLoop() *EventLoop {
+	return &EventLoop{
+		commands: make(chan command, eventLoopBuffer),
+		stop:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+}
+
+// Start runs the loop in the background
+func (l *EventLoop) Start() {
+	go func() {
+		defer close(l.stopped)
+		for {
+			select {
+			case cmd := <-l.commands:
+				cmd.done <- run(cmd.fn)
+			case <-l.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop terminates the loop once the running command returns.
+// Commands submitted afterwards run on the caller's goroutine.
+func (l *EventLoop) Stop() {
+	l.once.Do(func() {
+		close(l.stop)
+	})
+	<-l.stopped
+}
+
+// Do runs fn on the loop and waits for it to return. A panic in fn is
+// re-raised on the caller's goroutine. Do must not be called from a command.
+func (l *EventLoop) Do(fn func()) {
+	cmd := command{fn: fn, done: make(chan any, 1)}
+	select {
+	case l.commands <- cmd:
+	case <-l.stopped:
+		fn()
+		return
+	}
+
+	select {
+	case recovered := <-cmd.done:
+		if recovered != nil {
+			panic(recovered)
+		}
+	case <-l.stopped:
+		// The loop stopped before taking the command
+		select {
+		case recovered := <-cmd.done:
+			if recovered != nil {
+				panic(recovered)
+			}
+		default:
+			fn()
+		}
+	}
+}
+
+// run calls fn and returns what it panicked with, if anything
+func run(fn func()) (recovered any) {
+	defer func() {
+		recovered = recover()
+	}()
+	fn()
+	return nil
+}
@@ -0,0 +1,64 @@
+package hubs
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestEventLoopRunsCommandsOneAtATime(t *testing.T) {
+	loop := NewEventLoop()
+	loop.Start()
+	defer loop.Stop()
+
+	// Unsynchronized on purpose: the race detector fails the test if commands overlap
+	counter := 0
+	var wg sync.WaitGroup
+	for range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 100 {
+				loop.Do(func() { counter++ })
+			}
+		}()
+	}
+	wg.Wait()
+
+	if counter != 5000 {
+		t.Fatalf("counter = %d, want 5000", counter)
+	}
+}
+
+func TestEventLoopRaisesPanicsOnCaller(t *testing.T) {
+	loop := NewEventLoop()
+	loop.Start()
+	defer loop.Stop()
+
+	func() {
+		defer func() {
+			if recovered := recover(); recovered != "boom" {
+				t.Fatalf("recovered %v, want boom", recovered)
+			}
+		}()
+		loop.Do(func() { panic("boom") })
+	}()
+
+	// The loop survives the panic
+	ran := false
+	loop.Do(func() { ran = true })
+	if !ran {
+		t.Fatal("command after a panic did not run")
+	}
+}
+
+func TestEventLoopRunsOnCallerOnceStopped(t *testing.T) {
+	loop := NewEventLoop()
+	loop.Start()
+	loop.Stop()
+
+	ran := false
+	loop.Do(func() { ran = true })
+	if !ran {
+		t.Fatal("command after Stop did not run")
+	}
+}
@@ -1,45 +1,156 @@
 package hubs
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"log"
+	"log/slog"
+	"realTimeService/broker"
+	"realTimeService/events"
+	"realTimeService/logging"
 	"realTimeService/models"
 	"realTimeService/services"
+	"realTimeService/store"
+	"realTimeService/tracing"
+	"realTimeService/transport"
 	"sync"
+	"time"
 
 	"github.com/google/uuid"
-	"github.com/gorilla/websocket"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// MainHub tracks the connected clients and routes events between paired users.
+//
+// Lock ordering: mut only guards Clients. It is never held while calling a service,
+// the broker or a connection, and services never call back into the hub while
+// holding their own locks, so hub and matcher locks are never nested.
+//
+// With the event loop enabled, every entry point that changes clients, the queue
+// or pairs runs through Do on a single goroutine, so a check such as finding a
+// user's pair and the action taken on it cannot interleave with a disconnect.
 type MainHub struct {
-	Clients         map[uuid.UUID]*models.Client
-	MatchingService *services.MatchingService
-	mut             sync.RWMutex
+	Clients           map[uuid.UUID]*models.Client
+	MatchingService   *services.MatchingService
+	TranscriptService *services.TranscriptService
+	MessageService    *services.MessageService
+	ReputationService *services.ReputationService
+	ConnectService    *services.ConnectService
+	ClusterService    *services.ClusterService
+	BanService        *services.BanService
+	ReportService     *services.ReportService
+	AuditService      *services.AuditService
+	SessionService    *services.SessionService
+	// Events carries what happens on this node to subscribers such as webhooks
+	Events         *events.Bus
+	NodeId         string
+	broker         broker.Broker
+	commandHandler CommandHandler
+	stopCluster    context.CancelFunc
+	loop           *EventLoop // nil unless UseEventLoop was called
+	mut            sync.RWMutex
 }
 
-func NewMainHub() *MainHub {
-	return &MainHub{
-		Clients:         make(map[uuid.UUID]*models.Client),
-		MatchingService: services.NewMatchingService(),
-		mut:             sync.RWMutex{},
+// NewMainHub creates a hub for the given node, keeping bans, reports, reputation,
+// the audit trail and transcripts in st. With a shared queue, users wait in a
+// queue common to every node using the broker instead of one kept by this node.
+// Resume tokens are signed with sessionSecret, a random one if empty.
+func NewMainHub(b broker.Broker, st store.Store, nodeId string, sharedQueue bool, sessionSecret string) *MainHub {
+	reputation := services.NewReputationService(st,
+		services.DefaultReputationHalfLife, services.DefaultRatingWindow)
+
+	var queue services.WaitingQueue = services.NewLocalQueue(reputation)
+	if sharedQueue {
+		queue = services.NewSharedQueue(b, nodeId, reputation)
+	}
+
+	h := &MainHub{
+		Clients:           make(map[uuid.UUID]*models.Client),
+		MatchingService:   services.NewMatchingService(queue),
+		ReputationService: reputation,
+		TranscriptService: services.NewTranscriptService(st,
+			services.DefaultTranscriptMaxMessages, services.DefaultTranscriptRetention),
+		MessageService: services.NewMessageService(
+			services.DefaultMessageHistorySize, services.DefaultMessageEditWindow),
+		ConnectService: services.NewConnectService(st, b, nodeId, services.DefaultChannelTTL),
+		ClusterService: services.NewClusterService(b, nodeId,
+			services.DefaultHeartbeatInterval, services.DefaultNodeTimeout),
+		BanService:     services.NewBanService(st),
+		ReportService:  services.NewReportService(st),
+		AuditService:   services.NewAuditService(st),
+		SessionService: services.NewSessionService(sessionSecret),
+		Events:         events.NewBus(nodeId),
+		NodeId:         nodeId,
+		broker:         b,
+		mut:            sync.RWMutex{},
 	}
+	h.MatchingService.SetEvents(h.Events)
+	h.ClusterService.OnNodeDown(func(nodeId string) {
+		h.Do(func() { h.handleNodeDown(nodeId) })
+	})
+	return h
+}
+
+// UseEventLoop makes Do run state changes one at a time on a dedicated goroutine.
+// Events to clients are then queued per client, so a slow one can't hold up the loop.
+// Must be called before the hub is used.
+func (h *MainHub) UseEventLoop() {
+	h.loop = NewEventLoop()
+	h.loop.Start()
 }
+
+// Do runs fn on the event loop if it is enabled, otherwise right away on the
+// caller's goroutine. Calls must not be nested.
+func (h *MainHub) Do(fn func()) {
+	if h.loop == nil {
+		fn()
+		return
+	}
+	h.loop.Do(fn)
+}
+
+// AddClient registers a connected client. A client resuming a session takes the
+// place of its previous connection in the session's pair, queue entry and channel.
 func (h *MainHub) AddClient(client *models.Client) {
+	if h.loop != nil && client.Conn != nil {
+		client.Conn = transport.NewQueuedConnection(client.Conn)
+	}
 	h.mut.Lock()
-	defer h.mut.Unlock()
 	h.Clients[client.UserId] = client
-	log.Printf("Client %s added to hub", client.UserId)
+	h.mut.Unlock()
+	client.Log.Info("Client added to hub")
+	h.MatchingService.Rebind(client)
+	h.ConnectService.Rebind(client)
+	h.Events.Publish(events.ClientConnected{UserId: client.UserId, IP: hostOf(client.Conn.RemoteAddr())})
+
+	if err := h.ClusterService.RegisterSession(client.UserId); err != nil {
+		client.Log.Error("Error registering session", logging.Err(err))
+	}
 }
 
-// SendMessageToPair sends a message to the partner in a pair
-func (h *MainHub) SendMessageToPair(pairId uuid.UUID, message *models.Message, senderId uuid.UUID) error {
+// SendMessageToPair sends a message to the partner in a pair, traced as part of ctx.
+// A partner on another node continues the trace when it gets the message.
+func (h *MainHub) SendMessageToPair(ctx context.Context, pairId uuid.UUID, message *models.Message, senderId uuid.UUID) (err error) {
+	ctx, span := tracing.Tracer().Start(ctx, "MainHub.SendMessageToPair",
+		trace.WithAttributes(tracing.Pair(pairId), tracing.Session(senderId)))
+	defer func() { tracing.End(span, err) }()
+
+	return h.sendEventToPair(ctx, pairId, message, senderId)
+}
+
+// SendEventToPair sends any outgoing event to the partner of the sender in a pair
+func (h *MainHub) SendEventToPair(pairId uuid.UUID, event any, senderId uuid.UUID) error {
+	return h.sendEventToPair(context.Background(), pairId, event, senderId)
+}
+
+func (h *MainHub) sendEventToPair(ctx context.Context, pairId uuid.UUID, event any, senderId uuid.UUID) error {
 	pair, err := h.MatchingService.GetPairById(pairId)
 	if err != nil {
 		return fmt.Errorf("pair not found: %w", err)
 	}
 
-	if !pair.Active {
+	if !pair.IsActive() {
 		return fmt.Errorf("pair is not active")
 	}
 
@@ -49,39 +160,60 @@ func (h *MainHub) SendMessageToPair(pairId uuid.UUID, message *models.Message, s
 		return fmt.Errorf("partner not found")
 	}
 
-	messageBytes, err := json.Marshal(message)
-	if err != nil {
-		return fmt.Errorf("error marshalling message: %w", err)
-	}
-
-	err = partner.Conn.WriteMessage(websocket.TextMessage, messageBytes)
+	trace.SpanFromContext(ctx).SetAttributes(attribute.Bool("partner.remote", partner.IsRemote()))
+	err = h.sendToClient(ctx, partner, event)
 	if err != nil {
-		log.Printf("error sending message to client %s: %v", partner.UserId, err)
+		slog.Warn("Error sending event to client", logging.Session(partner.UserId), logging.Pair(pairId), logging.Err(err))
 		return err
 	}
 
-	log.Printf("Message sent from %s to %s in pair %s", senderId, partner.UserId, pairId)
+	slog.Debug("Event sent to partner", logging.Session(senderId), logging.Pair(pairId), "partner", partner.UserId.String())
+	return nil
+}
+
+// NotifyPair sends the same event to both users of a pair
+func (h *MainHub) NotifyPair(pair *models.ChatPair, event any) error {
+	users := pair.Users()
+	err1 := h.SendToClient(users[0], event)
+	err2 := h.SendToClient(users[1], event)
+
+	if err1 != nil || err2 != nil {
+		return fmt.Errorf("error notifying users: %v, %v", err1, err2)
+	}
 	return nil
 }
 
-// NotifyStrangerJoined notifies both users that they've been matched
+// NotifyStrangerJoined notifies both users that they've been matched.
+// A user on another node is notified by that node once it accepts the pair.
 func (h *MainHub) NotifyStrangerJoined(pair *models.ChatPair) error {
 	notification := models.NewSystemMessage(string(models.StrangerJoined), pair.ID)
-	
-	msg1, _ := json.Marshal(notification)
-	msg2, _ := json.Marshal(notification)
 
-	err1 := pair.User1.Conn.WriteMessage(websocket.TextMessage, msg1)
-	err2 := pair.User2.Conn.WriteMessage(websocket.TextMessage, msg2)
+	users := pair.Users()
+	err1 := h.notifyJoined(pair, users[0], notification)
+	err2 := h.notifyJoined(pair, users[1], notification)
 
 	if err1 != nil || err2 != nil {
 		return fmt.Errorf("error notifying users: %v, %v", err1, err2)
 	}
 
-	log.Printf("Both users notified of match in pair %s", pair.ID)
+	slog.Debug("Both users notified of match", logging.Pair(pair.ID))
 	return nil
 }
 
+// notifyJoined tells one user of a new pair that they've been matched, or asks
+// the node of a remote user to accept the pair
+func (h *MainHub) notifyJoined(pair *models.ChatPair, user *models.Client, notification *models.Message) error {
+	if !user.IsRemote() {
+		return h.SendToClient(user, notification)
+	}
+	return h.publish(user.NodeId, clusterEvent{
+		Type:      pairCreatedEvent,
+		UserId:    user.UserId,
+		PairId:    pair.ID,
+		PartnerId: pair.GetPartner(user.UserId).UserId,
+	})
+}
+
 // NotifyStrangerLeft notifies a user that their partner has left
 func (h *MainHub) NotifyStrangerLeft(userId uuid.UUID) error {
 	h.mut.RLock()
@@ -93,40 +225,182 @@ func (h *MainHub) NotifyStrangerLeft(userId uuid.UUID) error {
 	}
 
 	notification := models.NewSystemMessage(string(models.StrangerLeft), uuid.Nil)
-	messageBytes, _ := json.Marshal(notification)
+	if err := client.Conn.Send(notification); err != nil {
+		return fmt.Errorf("error notifying user: %w", err)
+	}
+
+	slog.Debug("User notified that stranger left", logging.Session(userId))
+	return nil
+}
+
+// NotifyTranscriptStatus sends the current transcript opt-in state to both users of a pair
+func (h *MainHub) NotifyTranscriptStatus(pair *models.ChatPair) error {
+	var errs []error
+	for _, user := range pair.Users() {
+		status := h.TranscriptService.Status(pair.ID, user.UserId)
+		if err := h.SendToClient(user, status); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("error notifying users: %v", errs)
+	}
+	return nil
+}
 
-	err := client.Conn.WriteMessage(websocket.TextMessage, messageBytes)
+// EndPair ends a pair for the given reason and finalizes everything attached to it.
+// If a transcript was kept, both users are told how to download it.
+// The node of a partner connected elsewhere is told the pair ended.
+func (h *MainHub) EndPair(pair *models.ChatPair, reason events.EndReason) error {
+	return h.endPair(pair, reason, true)
+}
+
+// endPair ends a pair, telling the partner's node only if notifyRemote is set
+func (h *MainHub) endPair(pair *models.ChatPair, reason events.EndReason, notifyRemote bool) error {
+	err := h.MatchingService.EndPair(pair.ID)
 	if err != nil {
-		return fmt.Errorf("error notifying user: %w", err)
+		return err
+	}
+	// The node owning the pair published its match, and publishes its end
+	if !pair.IsRemote() {
+		h.Events.Publish(events.PairEnded{
+			PairId:     pair.ID,
+			UserIds:    pair.UserIds(),
+			Reason:     reason,
+			DurationMs: time.Since(pair.CreatedAt).Milliseconds(),
+		})
+	}
+
+	if notifyRemote {
+		for _, user := range pair.Users() {
+			if !user.IsRemote() {
+				continue
+			}
+			if err := h.publish(user.NodeId, clusterEvent{
+				Type:   pairEndedEvent,
+				UserId: user.UserId,
+				PairId: pair.ID,
+				Text:   string(reason),
+			}); err != nil {
+				slog.Error("Error telling node that pair ended", logging.Node(user.NodeId), logging.Pair(pair.ID), logging.Err(err))
+			}
+		}
+	}
+
+	// Ended chats can still be reported for a while, with their last messages
+	h.ReportService.KeepSnippet(pair.ID, h.MessageService.Recent(pair.ID, services.ReportSnippetSize))
+	h.MessageService.ForgetPair(pair.ID)
+	h.ReputationService.RecordChatEnded(pair)
+	h.ConnectService.ForgetPair(pair.ID)
+	if transcript := h.TranscriptService.Finish(pair.ID); transcript != nil {
+		h.NotifyTranscriptStatus(pair)
+	}
+	return nil
+}
+
+// SendToClient sends a value over the client's connection,
+// routing it through the broker if the client is connected to another node.
+// Events needing a capability the client didn't negotiate are dropped.
+func (h *MainHub) SendToClient(client *models.Client, v any) error {
+	return h.sendToClient(context.Background(), client, v)
+}
+
+// sendToClient sends an event to a client, passing the trace context of ctx on
+// to the node of a remote client
+func (h *MainHub) sendToClient(ctx context.Context, client *models.Client, v any) error {
+	var required models.Capability
+	if event, ok := v.(models.CapabilityEvent); ok {
+		required = event.RequiredCapability()
+	}
+
+	if client.IsRemote() {
+		messageBytes, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Errorf("error marshalling message: %w", err)
+		}
+		return h.publish(client.NodeId, clusterEvent{
+			Type:     deliverEvent,
+			UserId:   client.UserId,
+			Payload:  messageBytes,
+			Requires: required,
+			Trace:    tracing.Inject(ctx),
+		})
+	}
+
+	if required != "" && !client.Session.Has(required) {
+		return nil
 	}
 
-	log.Printf("User %s notified that stranger left", userId)
+	if err := client.Conn.Send(v); err != nil {
+		return fmt.Errorf("error sending message to client %s: %w", client.UserId, err)
+	}
 	return nil
 }
 
-// RemoveClient removes a client from the hub and ends their pair if active
-func (h *MainHub) RemoveClient(userId uuid.UUID) {
+// Close stops the hub's background work
+func (h *MainHub) Close() {
+	if h.stopCluster != nil {
+		h.stopCluster()
+	}
+	h.ClusterService.Stop()
+	if h.loop != nil {
+		h.loop.Stop()
+	}
+	h.TranscriptService.Stop()
+	h.ReputationService.Stop()
+	h.ConnectService.Stop()
+	h.BanService.Stop()
+	h.ReportService.Stop()
+	h.Events.Close()
+}
+
+// RemoveClient removes a client from the hub and ends their pair if active.
+// A connection the session has since been resumed on replaces the client, and
+// removing the replaced client leaves the session, its pair and queue entry alone.
+func (h *MainHub) RemoveClient(client *models.Client) {
+	userId := client.UserId
 	h.mut.Lock()
-	defer h.mut.Unlock()
+	current := h.Clients[userId] == client
+	if current {
+		delete(h.Clients, userId)
+	}
+	h.mut.Unlock()
+	h.Events.Publish(events.ClientDisconnected{
+		UserId:     userId,
+		DurationMs: time.Since(client.ConnectedAt).Milliseconds(),
+	})
+	if !current {
+		client.Log.Info("Replaced connection closed")
+		return
+	}
+	logger := client.Log
+	logger.Info("Client removed from hub")
 
-	delete(h.Clients, userId)
-	log.Printf("Client %s removed from hub", userId)
+	if err := h.ClusterService.UnregisterSession(userId); err != nil {
+		logger.Error("Error unregistering session", logging.Err(err))
+	}
 
 	// Try to get their pair and notify partner
 	pair, err := h.MatchingService.GetPair(userId)
-	if err == nil && pair.Active {
+	if err == nil && pair.IsActive() {
 		// Notify partner
 		partner := pair.GetPartner(userId)
 		if partner != nil {
-			go h.NotifyStrangerLeft(partner.UserId)
+			// On the event loop the partner hears about it before any later event
+			if h.loop != nil {
+				h.NotifyStrangerLeft(partner.UserId)
+			} else {
+				go h.NotifyStrangerLeft(partner.UserId)
+			}
 		}
-		
+
 		// End the pair
-		h.MatchingService.EndPair(pair.ID)
+		h.EndPair(pair, events.ReasonDisconnect)
 	}
 
-	// Also remove from waiting queue if they're there
+	// Also remove from waiting queue or private channel if they're there
 	h.MatchingService.RemoveFromQueue(userId)
+	h.ConnectService.Leave(userId)
 }
 
 func (h *MainHub) GetClient(userId uuid.UUID) *models.Client {
@@ -136,6 +410,6 @@ func (h *MainHub) GetClient(userId uuid.UUID) *models.Client {
 	if !ok {
 		return nil
 	}
-	log.Printf("Client %s retrieved from hub", userId)
+	client.Log.Debug("Client retrieved from hub")
 	return client
 }
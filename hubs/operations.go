@@ -0,0 +1,214 @@
+package hubs
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"realTimeService/events"
+	"realTimeService/logging"
+	"realTimeService/models"
+	"realTimeService/services"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ErrClientNotFound is returned for a session that isn't connected to any node
+var ErrClientNotFound = errors.New("client not connected")
+
+// ListClients returns the clients connected to this node
+func (h *MainHub) ListClients() []*models.Client {
+	h.mut.RLock()
+	defer h.mut.RUnlock()
+
+	clients := make([]*models.Client, 0, len(h.Clients))
+	for _, client := range h.Clients {
+		clients = append(clients, client)
+	}
+	return clients
+}
+
+// ClientAddress returns the IP address of a client of this node, empty if it isn't connected here
+func (h *MainHub) ClientAddress(userId uuid.UUID) string {
+	h.mut.RLock()
+	client, ok := h.Clients[userId]
+	h.mut.RUnlock()
+	if !ok {
+		return ""
+	}
+	return hostOf(client.Conn.RemoteAddr())
+}
+
+// TerminatePair ends a pair on behalf of an operator, telling its users the stranger left
+func (h *MainHub) TerminatePair(pair *models.ChatPair) error {
+	for _, user := range pair.Users() {
+		if !user.IsRemote() {
+			h.NotifyStrangerLeft(user.UserId)
+		}
+	}
+	slog.Info("Pair terminated by an operator", logging.Pair(pair.ID))
+	return h.EndPair(pair, events.ReasonOperator)
+}
+
+// Kick closes a session's connection, passing the reason to the client,
+// on whichever node holds it
+func (h *MainHub) Kick(userId uuid.UUID, reason string) error {
+	if h.kickLocal(userId, reason) {
+		return nil
+	}
+
+	nodeId, err := h.ClusterService.SessionNode(userId)
+	if err != nil {
+		return err
+	}
+	if nodeId == "" || nodeId == h.NodeId {
+		return ErrClientNotFound
+	}
+	return h.publish(nodeId, clusterEvent{Type: kickEvent, UserId: userId, Text: reason})
+}
+
+// KickAddress closes the connections from an IP address on every node
+func (h *MainHub) KickAddress(ip, reason string) error {
+	h.kickLocalAddress(ip, reason)
+	return h.broadcast(clusterEvent{Type: kickAddressEvent, Address: ip, Text: reason})
+}
+
+// Ban bans a session, an IP address or both and disconnects them on every node.
+// A zero duration bans permanently.
+func (h *MainHub) Ban(userId uuid.UUID, ip, reason string, duration time.Duration) (*models.Ban, error) {
+	ban, err := h.BanService.Add(userId, ip, reason, duration)
+	if err != nil {
+		return nil, err
+	}
+	h.Events.Publish(events.BanApplied{
+		BanId:     ban.ID,
+		UserId:    ban.UserId,
+		IP:        ban.IP,
+		Reason:    ban.Reason,
+		ExpiresAt: ban.ExpiresAt,
+	})
+
+	kickReason := "banned"
+	if reason != "" {
+		kickReason += ": " + reason
+	}
+	if userId != uuid.Nil {
+		if err := h.Kick(userId, kickReason); err != nil && !errors.Is(err, ErrClientNotFound) {
+			return ban, err
+		}
+	}
+	if ip != "" {
+		return ban, h.KickAddress(ip, kickReason)
+	}
+	return ban, nil
+}
+
+// FileReport stores a user's report for the operators
+func (h *MainHub) FileReport(report *models.Report) error {
+	if err := h.ReportService.Add(report); err != nil {
+		return err
+	}
+	h.Events.Publish(events.ReportFiled{
+		ReportId:   report.ID,
+		PairId:     report.PairId,
+		ReporterId: report.ReporterId,
+		ReportedId: report.ReportedId,
+		Reason:     string(report.Reason),
+	})
+	return nil
+}
+
+// ResolveReport closes a report with an operator's note. With ban set, the reported
+// session and its address, if known, are banned for the duration first.
+func (h *MainHub) ResolveReport(reportId uuid.UUID, note string, ban bool, duration time.Duration) (*models.Report, error) {
+	report, err := h.ReportService.Get(reportId)
+	if err != nil {
+		return nil, err
+	}
+	if !report.Open() {
+		return nil, services.ErrReportResolved
+	}
+
+	var banId uuid.UUID
+	if ban {
+		issued, err := h.Ban(report.ReportedId, report.ReportedIP, report.Reason, duration)
+		if issued == nil {
+			return nil, err
+		}
+		banId = issued.ID
+		if err != nil {
+			slog.Error("Error disconnecting banned user", logging.Session(report.ReportedId), logging.Err(err))
+		}
+	}
+	return h.ReportService.Resolve(reportId, note, banId)
+}
+
+// Announce sends a system announcement to every client on every node
+func (h *MainHub) Announce(text string) error {
+	h.announceLocal(text)
+	return h.broadcast(clusterEvent{Type: announceEvent, Text: text})
+}
+
+// kickLocal closes the connection of a client of this node, false if it isn't connected here
+func (h *MainHub) kickLocal(userId uuid.UUID, reason string) bool {
+	h.mut.RLock()
+	client, ok := h.Clients[userId]
+	h.mut.RUnlock()
+	if !ok {
+		return false
+	}
+
+	// The transport handler removes the client once its connection is closed
+	client.Conn.Close(reason)
+	client.Log.Info("Client kicked", "reason", reason)
+	return true
+}
+
+// kickLocalAddress closes the connections of the clients of this node coming from an IP address
+func (h *MainHub) kickLocalAddress(ip, reason string) {
+	for _, client := range h.ListClients() {
+		if hostOf(client.Conn.RemoteAddr()) == ip {
+			client.Conn.Close(reason)
+			client.Log.Info("Client kicked", "reason", reason)
+		}
+	}
+}
+
+// announceLocal sends an announcement to the clients of this node
+func (h *MainHub) announceLocal(text string) {
+	announcement := models.NewSystemMessage(string(models.Announcement), uuid.Nil)
+	announcement.Text = text
+	for _, client := range h.ListClients() {
+		if err := h.SendToClient(client, announcement); err != nil {
+			client.Log.Warn("Error sending announcement", logging.Err(err))
+		}
+	}
+}
+
+// broadcast sends an event to every other node in the cluster
+func (h *MainHub) broadcast(event clusterEvent) error {
+	nodes, err := h.ClusterService.Nodes()
+	if err != nil {
+		return fmt.Errorf("error reading cluster membership: %w", err)
+	}
+
+	var errs []error
+	for nodeId := range nodes {
+		if nodeId == h.NodeId {
+			continue
+		}
+		if err := h.publish(nodeId, event); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// hostOf returns the host of a "host:port" address, or the address if it has no port
+func hostOf(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
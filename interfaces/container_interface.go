@@ -9,6 +9,7 @@ import (
 type Container interface {
 	GetHub() *hubs.MainHub
 	GetRouter() *wsrouter.Router
-	InitializeProviders(cfg *configuration.Config)
+	InitializeProviders(cfg *configuration.Config) error
+	ApplyConfig(cfg *configuration.Config)
 	Close() error
 }
@@ -0,0 +1,66 @@
+package logging
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/google/uuid"
+)
+
+// Field names shared by every record, so records of one session, pair or
+// request can be found whichever package logged them
+const (
+	SessionKey   = "session"
+	PairKey      = "pair"
+	IPKey        = "ip"
+	RequestIDKey = "requestId"
+	NodeKey      = "node"
+	ErrorKey     = "error"
+)
+
+// Session is the field of the session a record is about
+func Session(userId uuid.UUID) slog.Attr {
+	return slog.String(SessionKey, userId.String())
+}
+
+// Pair is the field of the pair a record is about
+func Pair(pairId uuid.UUID) slog.Attr {
+	return slog.String(PairKey, pairId.String())
+}
+
+// IP is the field of the client address a record is about
+func IP(addr string) slog.Attr {
+	return slog.String(IPKey, addr)
+}
+
+// RequestID is the field of the HTTP request a record was logged for
+func RequestID(id string) slog.Attr {
+	return slog.String(RequestIDKey, id)
+}
+
+// Node is the field of the cluster node a record is about
+func Node(nodeId string) slog.Attr {
+	return slog.String(NodeKey, nodeId)
+}
+
+// Err is the field of the error a record reports
+func Err(err error) slog.Attr {
+	return slog.Any(ErrorKey, err)
+}
+
+// Content is the field of chat content a user wrote. It only shows the size of
+// the content unless content logging is turned on, checked when the record is written.
+func Content(key, text string) slog.Attr {
+	return slog.Any(key, redacted(text))
+}
+
+// redacted is chat content that is hidden from the logs by default
+type redacted string
+
+// LogValue implements slog.LogValuer
+func (r redacted) LogValue() slog.Value {
+	if content.Load() {
+		return slog.StringValue(string(r))
+	}
+	return slog.StringValue(fmt.Sprintf("[redacted, %d bytes]", len(r)))
+}
@@ -0,0 +1,77 @@
+// Package logging sets up the structured logger of the server. Records carry the
+// session, pair, client address and request they belong to as fields, and chat
+// content is redacted unless content logging is turned on.
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync/atomic"
+)
+
+// Log formats
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+var (
+	// level is shared by every handler Setup installs, so reloads change it in place
+	level slog.LevelVar
+	// content lets chat content through to the logs when set
+	content atomic.Bool
+)
+
+// Setup installs the default logger writing records at level and above to w
+// in format, text or json, and sets whether chat content is logged
+func Setup(w io.Writer, format, lvl string, logContent bool) error {
+	if err := Configure(lvl, logContent); err != nil {
+		return err
+	}
+
+	options := &slog.HandlerOptions{Level: &level}
+	var handler slog.Handler
+	switch format {
+	case FormatText, "":
+		handler = slog.NewTextHandler(w, options)
+	case FormatJSON:
+		handler = slog.NewJSONHandler(w, options)
+	default:
+		return fmt.Errorf("unknown log format %q", format)
+	}
+	slog.SetDefault(slog.New(handler))
+	return nil
+}
+
+// Configure changes the level and content logging of the installed logger,
+// for settings reloaded while the server runs
+func Configure(lvl string, logContent bool) error {
+	parsed, err := ParseLevel(lvl)
+	if err != nil {
+		return err
+	}
+	level.Set(parsed)
+	content.Store(logContent)
+	return nil
+}
+
+// ParseLevel parses debug, info, warn or error, info if empty
+func ParseLevel(lvl string) (slog.Level, error) {
+	var parsed slog.Level
+	if lvl == "" {
+		return slog.LevelInfo, nil
+	}
+	if err := parsed.UnmarshalText([]byte(strings.ToLower(lvl))); err != nil {
+		return 0, fmt.Errorf("unknown log level %q", lvl)
+	}
+	return parsed, nil
+}
+
+// Fatal logs msg as an error and exits, for failures the server can't start or run with
+func Fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
@@ -1,27 +1,77 @@
 package main
 
 import (
-	"log"
+	"context"
+	"errors"
+	"expvar"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
 	"realTimeService/configuration"
 	"realTimeService/controllers"
 	"realTimeService/handlers"
 	"realTimeService/interfaces"
+	"realTimeService/logging"
 	"realTimeService/middlewares"
+	"realTimeService/models"
 	"realTimeService/providers"
+	"realTimeService/tracing"
+	"realTimeService/transport"
 
 	"github.com/gin-gonic/gin"
+	"github.com/quic-go/quic-go/http3"
+	"github.com/quic-go/webtransport-go"
 )
 
 func main() {
-	// Load configuration
-	cfg, err := configuration.LoadConfig("config.json")
-	if err != nil {
-		log.Fatalf("Failed to load configuration: %v", err)
+	// Load configuration: defaults, config file, environment, then flags
+	config, err := configuration.NewManager(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
 		return
 	}
+	if err != nil {
+		// Not logged, so that every problem found gets a line of its own
+		fmt.Fprintf(os.Stderr, "Failed to load configuration: %v\n", err)
+		os.Exit(1)
+	}
+	cfg := config.Current()
+
+	// Structured logging; the level and content logging follow reloads
+	if err := logging.Setup(os.Stderr, cfg.Logging.Format, cfg.Logging.Level, cfg.Logging.Content); err != nil {
+		logging.Fatal("Failed to set up logging", logging.Err(err))
+	}
+	config.OnReload(func(cfg *configuration.Config) {
+		if err := logging.Configure(cfg.Logging.Level, cfg.Logging.Content); err != nil {
+			slog.Error("Failed to apply logging settings", logging.Err(err))
+		}
+	})
+
+	// Tracing of the message path, flushed when the server stops
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Options{
+		Exporter:    cfg.Tracing.Exporter,
+		Endpoint:    cfg.Tracing.Endpoint,
+		Insecure:    cfg.Tracing.Insecure,
+		SampleRatio: cfg.Tracing.SampleRatio,
+	})
+	if err != nil {
+		logging.Fatal("Failed to set up tracing", logging.Err(err))
+	}
+	defer func() {
+		if err := shutdownTracing(context.Background()); err != nil {
+			slog.Error("Failed to flush traces", logging.Err(err))
+		}
+	}()
 
-	// Create Gin router
-	router := gin.Default()
+	// Create Gin router, logging each request with its ID
+	router := gin.New()
+	router.Use(middlewares.RequestLogMiddleware())
+	// Only these proxies may set the client address, which IP bans rely on.
+	// Without any, the peer address of the connection is used.
+	if err := router.SetTrustedProxies(cfg.Transports.TrustedProxies); err != nil {
+		logging.Fatal("Failed to set trusted proxies", logging.Err(err))
+	}
 
 	// Load HTML templates
 	router.LoadHTMLGlob("views/templates/*")
@@ -31,37 +81,162 @@ func main() {
 
 	// Initialize the DI container
 	var container interfaces.Container = providers.NewDependencyInjectionContainer()
-	container.InitializeProviders(cfg)
+	err = container.InitializeProviders(cfg)
+	if err != nil {
+		logging.Fatal("Failed to initialize dependency injection container", logging.Err(err))
+	}
 	defer func(container interfaces.Container) {
 		err := container.Close()
 		if err != nil {
-			log.Fatalf("Failed to close dependency injection container: %v", err)
-			return
+			logging.Fatal("Failed to close dependency injection container", logging.Err(err))
 		}
 	}(container)
 
+	// Settings that are safe to change at runtime follow the config file and SIGHUP
+	config.OnReload(container.ApplyConfig)
+	config.Watch(context.Background())
+
 	// Initialize controllers
 	homeController := controllers.NewHomeController()
-	chatController := controllers.NewChatController()
-	wsHandler := handlers.NewWsHandler(container)
+	chatController := controllers.NewChatController(cfg)
+	transcriptController := controllers.NewTranscriptController(container)
+	wsHandler := handlers.NewWsHandler(container, config)
+	sseHandler := handlers.NewSSEHandler(container)
+	adminController := controllers.NewAdminController(container)
+	moderationController := controllers.NewModerationController(container, config)
+
+	// Optional HTTP/3 listener serving the same routes, plus WebTransport
+	var h3Server *webtransport.Server
+	if cfg.Http3Port != "" {
+		h3Server = &webtransport.Server{
+			H3: http3.Server{Addr: cfg.Http3Port, Handler: router},
+			CheckOrigin: func(r *http.Request) bool {
+				return transport.OriginAllowed(r, config.Current().Transports.AllowedOrigins)
+			},
+		}
+	}
 
 	// Use middleware
 	router.Use(gin.Recovery())
+	if h3Server != nil {
+		router.Use(middlewares.AltSvcMiddleware(&h3Server.H3))
+	}
 
 	// HTTP routes
 	router.GET("/", homeController.Index)
 	router.GET("/chat", chatController.Index)
+	router.GET("/transcripts/:pairId", transcriptController.Download)
+	// Banned sessions and addresses are turned away before connecting
+	banMiddleware := middlewares.BanMiddleware(container.GetHub().BanService)
+	authMiddleware := middlewares.SimpleAuthMiddleware(container.GetHub().SessionService)
 
 	// WebSocket endpoint with simplified auth (no JWT required)
-	router.GET("/ws", middlewares.SimpleAuthMiddleware(cfg), wsHandler.Handle)
+	router.GET("/ws", authMiddleware, banMiddleware, wsHandler.Handle)
 
-	log.Printf("🚀 Starting anonymous chat server on %s", cfg.HttpPort)
-	log.Printf("📍 Home page: http://localhost%s", cfg.HttpPort)
-	log.Printf("💬 Chat page: http://localhost%s/chat", cfg.HttpPort)
+	// Fallback for networks that break WebSockets: events over SSE, messages over POST
+	if cfg.Transports.SSE {
+		router.GET("/sse", authMiddleware, banMiddleware, sseHandler.Stream)
+		router.POST("/sse/send", banMiddleware, sseHandler.Send)
+	}
+
+	if h3Server != nil {
+		// WebTransport sessions are opened with an extended CONNECT over HTTP/3
+		wtHandler := handlers.NewWebTransportHandler(container, h3Server)
+		router.Handle(http.MethodConnect, "/wt", authMiddleware, banMiddleware, wtHandler.Handle)
+
+		go func() {
+			slog.Info("Starting HTTP/3 listener", "addr", cfg.Http3Port)
+			if err := h3Server.ListenAndServeTLS(cfg.TLSCertFile, cfg.TLSKeyFile); err != nil {
+				logging.Fatal("Failed to start HTTP/3 server", logging.Err(err))
+			}
+		}()
+	}
+
+	if cfg.DebugAddr != "" {
+		// Metrics stay off the public router, on an address only operators can reach
+		go func() {
+			slog.Info("Starting debug listener", "addr", cfg.DebugAddr)
+			mux := http.NewServeMux()
+			mux.Handle("/debug/vars", expvar.Handler())
+			if err := http.ListenAndServe(cfg.DebugAddr, mux); err != nil {
+				logging.Fatal("Failed to start debug listener", logging.Err(err))
+			}
+		}()
+	}
+
+	// Admin API and moderation dashboard, on their own port when one is configured
+	// so they can stay off the public network
+	adminRouter := router
+	if cfg.AdminPort != "" {
+		adminRouter = gin.New()
+		if err := adminRouter.SetTrustedProxies(cfg.Transports.TrustedProxies); err != nil {
+			logging.Fatal("Failed to set trusted proxies", logging.Err(err))
+		}
+		adminRouter.Use(middlewares.RequestLogMiddleware(), gin.Recovery())
+		adminRouter.LoadHTMLGlob("views/templates/*")
+		adminRouter.Static("/static", "./views/static")
+	}
+	moderatorAuth := middlewares.ModeratorAuthMiddleware(config, controllers.ModerationSignInPath)
+	moderator := middlewares.RequireRole(models.RoleModerator)
+	adminRole := middlewares.RequireRole(models.RoleAdmin)
 
-	err = router.Run(cfg.HttpPort)
+	admin := adminRouter.Group("/admin", moderatorAuth)
+	{
+		admin.GET("/stats", adminController.Stats)
+		admin.GET("/clients", adminController.Clients)
+		admin.POST("/clients/:userId/kick", moderator, adminController.Kick)
+		admin.GET("/pairs", adminController.Pairs)
+		admin.DELETE("/pairs/:pairId", moderator, adminController.EndPair)
+		admin.GET("/queue", adminController.Queue)
+		admin.PUT("/matching", adminRole, adminController.SetMatching)
+		admin.GET("/bans", adminController.Bans)
+		admin.POST("/bans", moderator, adminController.AddBan)
+		admin.DELETE("/bans/:banId", moderator, adminController.RemoveBan)
+		admin.POST("/announcements", adminRole, adminController.Announce)
+		admin.GET("/reports", adminController.Reports)
+		admin.POST("/reports/:reportId/resolve", moderator, adminController.ResolveReport)
+		admin.GET("/audit", adminController.Audit)
+	}
+
+	adminRouter.GET(controllers.ModerationSignInPath, moderationController.SignInPage)
+	adminRouter.POST(controllers.ModerationSignInPath, moderationController.SignIn)
+	adminRouter.POST("/mod/logout", moderationController.SignOut)
+	mod := adminRouter.Group("/mod", moderatorAuth)
+	{
+		mod.GET("", moderationController.Dashboard)
+		mod.GET("/events", moderationController.Events)
+		mod.POST("/reports/:reportId/resolve", moderator, moderationController.ResolveReport)
+		mod.POST("/bans", moderator, moderationController.AddBan)
+		mod.POST("/bans/:banId/remove", moderator, moderationController.RemoveBan)
+		mod.POST("/announcements", adminRole, moderationController.Announce)
+		mod.POST("/matching", adminRole, moderationController.SetMatching)
+	}
+	if cfg.AdminPort != "" {
+		go func() {
+			slog.Info("Starting admin API", "addr", cfg.AdminPort)
+			adminServer := &http.Server{
+				Addr:              cfg.AdminPort,
+				Handler:           adminRouter,
+				ReadHeaderTimeout: cfg.Timeouts.ReadHeader.Std(),
+				IdleTimeout:       cfg.Timeouts.Idle.Std(),
+			}
+			if err := adminServer.ListenAndServe(); err != nil {
+				logging.Fatal("Failed to start admin server", logging.Err(err))
+			}
+		}()
+	}
+
+	slog.Info("Starting anonymous chat server", "addr", cfg.HttpPort,
+		"home", "http://localhost"+cfg.HttpPort, "chat", "http://localhost"+cfg.HttpPort+"/chat")
+
+	server := &http.Server{
+		Addr:              cfg.HttpPort,
+		Handler:           router,
+		ReadHeaderTimeout: cfg.Timeouts.ReadHeader.Std(),
+		IdleTimeout:       cfg.Timeouts.Idle.Std(),
+	}
+	err = server.ListenAndServe()
 	if err != nil {
-		log.Fatalf("Failed to start server: %v", err)
-		return
+		logging.Fatal("Failed to start server", logging.Err(err))
 	}
 }
@@ -0,0 +1,15 @@
+package middlewares
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/quic-go/quic-go/http3"
+)
+
+// AltSvcMiddleware advertises the HTTP/3 listener to clients, so browsers can switch over to it
+func AltSvcMiddleware(server *http3.Server) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Fails until the listener is up, the header is simply left out then
+		server.SetQUICHeaders(c.Writer.Header())
+		c.Next()
+	}
+}
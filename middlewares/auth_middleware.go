@@ -1,16 +1,35 @@
 package middlewares
 
 import (
+	"net/http"
+
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
-	"realTimeService/configuration"
+	"realTimeService/services"
 )
 
+// ResumeTokenHeader carries the token resuming a session, from the welcome reply
+const ResumeTokenHeader = "X-Resume-Token"
+
 // SimpleAuthMiddleware - simplified anonymous session middleware (no JWT required)
-func SimpleAuthMiddleware(cfg *configuration.Config) gin.HandlerFunc {
+func SimpleAuthMiddleware(sessions *services.SessionService) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// Generate anonymous user ID from cookie or create new one
-		sessionId := c.GetHeader("X-Session-ID")
+		// Resume the session of a resume token, or create a new one
+		resumeToken := c.GetHeader(ResumeTokenHeader)
+		if resumeToken == "" {
+			// Browsers can't set headers on WebSockets and event streams, they resume a session by query
+			resumeToken = c.Query("resume")
+		}
+
+		var sessionId string
+		if resumeToken != "" {
+			userId, ok := sessions.Resume(resumeToken)
+			if !ok {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid resume token"})
+				return
+			}
+			sessionId = userId.String()
+		}
 		
 		if sessionId == "" {
 			// Create new anonymous session
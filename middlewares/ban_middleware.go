@@ -0,0 +1,28 @@
+package middlewares
+
+import (
+	"net/http"
+	"realTimeService/logging"
+	"realTimeService/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// BanMiddleware refuses connections from banned sessions and IP addresses.
+// It runs after SimpleAuthMiddleware, which sets the session.
+func BanMiddleware(bans *services.BanService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userId, _ := uuid.Parse(c.GetString("user_sub"))
+		ban, err := bans.Find(userId, c.ClientIP())
+		if err != nil {
+			// Rather let everyone in than nobody while the broker is unreachable
+			logging.FromContext(c.Request.Context()).Error("Error checking bans", logging.Err(err))
+		}
+		if ban != nil {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "banned", "reason": ban.Reason})
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,62 @@
+package middlewares
+
+import (
+	"net/http"
+	"realTimeService/configuration"
+	"realTimeService/models"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// ModeratorKey is the context key of the signed in *models.Moderator
+	ModeratorKey = "moderator"
+	// ModeratorCookie carries the token of a moderator signed in to the dashboard
+	ModeratorCookie = "goroom_moderator"
+)
+
+// ModeratorAuthMiddleware lets requests carrying the admin token or a moderator token
+// through, as a bearer token or the dashboard cookie. Operator endpoints don't exist
+// while no token is configured. Browsers are sent to the sign in page.
+func ModeratorAuthMiddleware(config *configuration.Manager, signInPath string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Read on every request, so reloaded tokens apply right away
+		auth := config.Current().Auth
+		if auth.AdminToken == "" && len(auth.Moderators) == 0 {
+			c.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+
+		token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if !ok {
+			token, _ = c.Cookie(ModeratorCookie)
+		}
+		account, ok := auth.Moderator(token)
+		if !ok {
+			if c.Request.Method == http.MethodGet && strings.Contains(c.GetHeader("Accept"), "text/html") {
+				c.Redirect(http.StatusSeeOther, signInPath)
+				c.Abort()
+				return
+			}
+			c.Header("WWW-Authenticate", `Bearer realm="admin"`)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid admin token"})
+			return
+		}
+		c.Set(ModeratorKey, &models.Moderator{Name: account.Name, Role: models.Role(account.Role)})
+		c.Next()
+	}
+}
+
+// RequireRole lets moderators through whose role includes the required one.
+// It runs after ModeratorAuthMiddleware.
+func RequireRole(required models.Role) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		moderator := c.MustGet(ModeratorKey).(*models.Moderator)
+		if !moderator.Role.Allows(required) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "requires the " + string(required) + " role"})
+			return
+		}
+		c.Next()
+	}
+}
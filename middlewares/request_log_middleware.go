@@ -0,0 +1,67 @@
+package middlewares
+
+import (
+	"log/slog"
+	"realTimeService/logging"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	// RequestIDHeader carries the ID of a request, taken from a proxy in front
+	// of the server when it sets one and sent back in the response
+	RequestIDHeader = "X-Request-ID"
+	// RequestIDKey is the gin context key of the request ID
+	RequestIDKey = "request_id"
+
+	// maxRequestIDLength bounds IDs taken from the request
+	maxRequestIDLength = 64
+)
+
+// RequestLogMiddleware gives each request an ID and a logger carrying it and the
+// client address in the request context, and logs the request once served.
+// Only the path is logged, since query strings may carry tokens.
+func RequestLogMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestId := c.GetHeader(RequestIDHeader)
+		if !validRequestID(requestId) {
+			requestId = uuid.NewString()
+		}
+		c.Set(RequestIDKey, requestId)
+		c.Header(RequestIDHeader, requestId)
+
+		logger := slog.Default().With(logging.RequestID(requestId), logging.IP(c.ClientIP()))
+		c.Request = c.Request.WithContext(logging.WithLogger(c.Request.Context(), logger))
+
+		start := time.Now()
+		c.Next()
+
+		level := slog.LevelInfo
+		switch status := c.Writer.Status(); {
+		case status >= 500:
+			level = slog.LevelError
+		case status >= 400:
+			level = slog.LevelWarn
+		}
+		logger.Log(c.Request.Context(), level, "Request served",
+			"method", c.Request.Method,
+			"path", c.Request.URL.Path,
+			"status", c.Writer.Status(),
+			"duration", time.Since(start))
+	}
+}
+
+// validRequestID reports whether id is safe to log and echo back
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, r := range id {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' || r == '.') {
+			return false
+		}
+	}
+	return true
+}
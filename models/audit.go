@@ -0,0 +1,31 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// AuditAction names something an operator did
+type AuditAction string
+
+const (
+	AuditSignIn        AuditAction = "signIn"        // Signed in to the dashboard
+	AuditKick          AuditAction = "kick"          // Disconnected a session
+	AuditEndPair       AuditAction = "endPair"       // Ended a pair
+	AuditAddBan        AuditAction = "addBan"        // Banned a session or an address
+	AuditRemoveBan     AuditAction = "removeBan"     // Lifted a ban
+	AuditResolveReport AuditAction = "resolveReport" // Resolved a user report
+	AuditAnnounce      AuditAction = "announce"      // Sent an announcement
+	AuditSetMatching   AuditAction = "setMatching"   // Turned matching on or off
+)
+
+// AuditEntry records an action an operator took
+type AuditEntry struct {
+	ID        uuid.UUID   `json:"id"`
+	Actor     string      `json:"actor"` // Name of the moderator
+	Action    AuditAction `json:"action"`
+	Target    string      `json:"target,omitempty"` // What was acted on, such as a ban ID
+	Details   string      `json:"details,omitempty"`
+	CreatedAt time.Time   `json:"createdAt"`
+}
@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Ban keeps a session, an IP address or both from connecting
+type Ban struct {
+	ID        uuid.UUID  `json:"id"`
+	UserId    uuid.UUID  `json:"userId,omitzero"` // Banned session, zero for IP-only bans
+	IP        string     `json:"ip,omitempty"`    // Banned address, empty for session-only bans
+	Reason    string     `json:"reason,omitempty"`
+	CreatedAt time.Time  `json:"createdAt"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"` // nil for permanent bans
+}
+
+// Expired reports whether the ban no longer applies at the given time
+func (b *Ban) Expired(now time.Time) bool {
+	return b.ExpiresAt != nil && !now.Before(*b.ExpiresAt)
+}
+
+// Matches reports whether the ban applies to the session or the address
+func (b *Ban) Matches(userId uuid.UUID, ip string) bool {
+	return (b.UserId != uuid.Nil && b.UserId == userId) || (b.IP != "" && b.IP == ip)
+}
@@ -1,17 +1,23 @@
 package models
 
 import (
-	"github.com/google/uuid"
+	"sync"
 	"time"
+
+	"github.com/google/uuid"
 )
 
-// ChatPair represents a matched pair of users chatting anonymously
+// ChatPair represents a matched pair of users chatting anonymously.
+// A user's client is replaced when their session resumes on a new connection,
+// so once the pair is shared its users are read with Users or GetPartner.
 type ChatPair struct {
 	ID        uuid.UUID
 	User1     *Client
 	User2     *Client
 	CreatedAt time.Time
-	Active    bool
+	NodeId    string // Node that created the pair and holds its state, empty if it is this node
+	active    bool
+	mu        sync.RWMutex
 }
 
 // NewChatPair creates a new chat pair between two clients
@@ -21,24 +27,70 @@ func NewChatPair(user1, user2 *Client) *ChatPair {
 		User1:     user1,
 		User2:     user2,
 		CreatedAt: time.Now(),
-		Active:    true,
+		active:    true,
 	}
 }
 
 // GetPartner returns the partner of the given user in the pair
 func (cp *ChatPair) GetPartner(userId uuid.UUID) *Client {
+	cp.mu.RLock()
+	defer cp.mu.RUnlock()
 	if cp.User1.UserId == userId {
 		return cp.User2
 	}
 	return cp.User1
 }
 
+// Users returns the clients of both users
+func (cp *ChatPair) Users() [2]*Client {
+	cp.mu.RLock()
+	defer cp.mu.RUnlock()
+	return [2]*Client{cp.User1, cp.User2}
+}
+
+// UserIds returns the sessions of both users
+func (cp *ChatPair) UserIds() [2]uuid.UUID {
+	users := cp.Users()
+	return [2]uuid.UUID{users[0].UserId, users[1].UserId}
+}
+
 // HasUser checks if the given user is part of this pair
 func (cp *ChatPair) HasUser(userId uuid.UUID) bool {
-	return cp.User1.UserId == userId || cp.User2.UserId == userId
+	ids := cp.UserIds()
+	return ids[0] == userId || ids[1] == userId
+}
+
+// Rebind replaces the client of the user whose session the given client resumed.
+// Returns false if the user isn't in the pair.
+func (cp *ChatPair) Rebind(client *Client) bool {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	switch client.UserId {
+	case cp.User1.UserId:
+		cp.User1 = client
+	case cp.User2.UserId:
+		cp.User2 = client
+	default:
+		return false
+	}
+	return true
+}
+
+// IsRemote reports whether the pair is owned by another node
+func (cp *ChatPair) IsRemote() bool {
+	return cp.NodeId != ""
+}
+
+// IsActive reports whether the pair hasn't been closed yet
+func (cp *ChatPair) IsActive() bool {
+	cp.mu.RLock()
+	defer cp.mu.RUnlock()
+	return cp.active
 }
 
 // Close marks the pair as inactive
 func (cp *ChatPair) Close() {
-	cp.Active = false
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	cp.active = false
 }
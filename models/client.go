@@ -1,20 +1,46 @@
 package models
 
 import (
+	"log/slog"
+	"realTimeService/logging"
+	"time"
+
 	"github.com/google/uuid"
-	"github.com/gorilla/websocket"
 )
 
 type Client struct {
-	UserId uuid.UUID
-	Chat   *Chat
-	Conn   *websocket.Conn
+	UserId      uuid.UUID
+	Chat        *Chat
+	Conn        Connection // nil for clients connected to another node
+	NodeId      string     // Node holding the connection, empty for clients connected to this node
+	Session     *Session   // Negotiated protocol, nil for clients connected to another node
+	ConnectedAt time.Time  // Zero for clients connected to another node
+	// Log writes records about the client with its session and, once its transport
+	// handler sets it, the address and request it connected with
+	Log *slog.Logger
 }
 
-func NewClient(userId uuid.UUID, chat *Chat, conn *websocket.Conn) *Client {
+func NewClient(userId uuid.UUID, chat *Chat, conn Connection) *Client {
+	return &Client{
+		UserId:      userId,
+		Chat:        chat,
+		Conn:        conn,
+		Session:     NewSession(),
+		ConnectedAt: time.Now(),
+		Log:         slog.Default().With(logging.Session(userId)),
+	}
+}
+
+// NewRemoteClient creates a stand-in for a client connected to another node
+func NewRemoteClient(userId uuid.UUID, nodeId string) *Client {
 	return &Client{
 		UserId: userId,
-		Chat:   chat,
-		Conn:   conn,
+		NodeId: nodeId,
+		Log:    slog.Default().With(logging.Session(userId), logging.Node(nodeId)),
 	}
 }
+
+// IsRemote reports whether the client is connected to another node
+func (c *Client) IsRemote() bool {
+	return c.NodeId != ""
+}
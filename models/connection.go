@@ -0,0 +1,24 @@
+package models
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrConnectionClosed is returned when sending on a connection that was closed
+var ErrConnectionClosed = errors.New("connection closed")
+
+// Connection is the transport a client is connected through. The hub and the
+// handlers only talk to clients through it, so any transport able to carry
+// JSON events can be plugged in.
+type Connection interface {
+	// Send encodes an outgoing event and writes it to the client. A
+	// json.RawMessage is written as is. Safe for concurrent use.
+	Send(v any) error
+	// Close ends the connection, telling the client why if the transport can
+	Close(reason string) error
+	// RemoteAddr returns the address of the client
+	RemoteAddr() string
+	// Context is done once the connection is closed
+	Context() context.Context
+}
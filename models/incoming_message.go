@@ -11,15 +11,64 @@ const (
 	NextStranger    MessageType = "nextStranger"    // Skip to next stranger
 	StopChat        MessageType = "stopChat"        // Stop chatting
 	Typing          MessageType = "typing"          // User is typing notification
-	
+	TranscriptOptIn MessageType = "transcriptOptIn" // Opt in/out of keeping a transcript
+	EditMessage     MessageType = "editMessage"     // Edit a message you sent
+	DeleteMessage   MessageType = "deleteMessage"   // Delete a message you sent
+	React           MessageType = "react"           // React to a message
+	RateStranger    MessageType = "rateStranger"    // Rate the stranger after a chat ended
+	RequestConnect  MessageType = "requestConnect"  // Propose staying in touch
+	RespondConnect  MessageType = "respondConnect"  // Accept or decline staying in touch
+	JoinChannel     MessageType = "joinChannel"     // Rejoin a private channel by code
+	ReportStranger  MessageType = "reportStranger"  // Report the stranger to the operators
+	Hello           MessageType = "hello"           // Handshake, must be the first message
+
 	// System notifications (outgoing)
-	StrangerJoined  MessageType = "strangerJoined"  // Stranger connected
-	StrangerLeft    MessageType = "strangerLeft"    // Stranger disconnected
-	Searching       MessageType = "searching"       // Looking for stranger
+	StrangerJoined     MessageType = "strangerJoined"     // Stranger connected
+	StrangerLeft       MessageType = "strangerLeft"       // Stranger disconnected
+	Searching          MessageType = "searching"          // Looking for stranger
+	TranscriptStatus   MessageType = "transcriptStatus"   // Transcript opt-in state changed
+	MessageAck         MessageType = "messageAck"         // Your message was delivered, carries its ID
+	MessageEdited      MessageType = "messageEdited"      // A message was edited
+	MessageDeleted     MessageType = "messageDeleted"     // A message was deleted
+	Reactions          MessageType = "reactions"          // Reactions to a message changed
+	RatingReceived     MessageType = "ratingReceived"     // Your rating was recorded
+	ConnectPending     MessageType = "connectPending"     // Your proposal was sent to the stranger
+	ConnectRequested   MessageType = "connectRequested"   // Stranger proposes staying in touch
+	ConnectDeclined    MessageType = "connectDeclined"    // Stranger declined staying in touch
+	ConnectEstablished MessageType = "connectEstablished" // Both agreed, carries the channel code
+	ChannelWaiting     MessageType = "channelWaiting"     // Waiting in a private channel for the other member
+	Welcome            MessageType = "welcome"            // Handshake reply with the negotiated session
+	Error              MessageType = "error"              // A message was rejected
+	Announcement       MessageType = "announcement"       // System announcement from the operators
+	ReportReceived     MessageType = "reportReceived"     // Your report was filed
 )
 
+// PairScoped reports whether the message acts on the sender's current pair.
+// Such messages are handled by the node that owns the pair.
+func (t MessageType) PairScoped() bool {
+	switch t {
+	case SendMessage, Typing, TranscriptOptIn, EditMessage, DeleteMessage, React, RequestConnect, RespondConnect:
+		return true
+	default:
+		return false
+	}
+}
+
 type IncomingMessage struct {
-	Type   MessageType `json:"type"`
-	PairId uuid.UUID   `json:"pairId,omitempty"` // Optional: current pair ID
-	Text   string      `json:"text,omitempty"`   // Optional: message text
+	Type      MessageType `json:"type"`
+	PairId    uuid.UUID   `json:"pairId,omitempty"`   // Optional: current pair ID
+	Text      string      `json:"text,omitempty"`     // Optional: message text
+	Enabled   bool        `json:"enabled,omitempty"`  // Optional: toggle value (transcriptOptIn, typing)
+	MessageId uuid.UUID   `json:"messageId,omitzero"` // Optional: target message (edit, delete)
+	ReplyTo   uuid.UUID   `json:"replyTo,omitzero"`   // Optional: message being replied to
+	ClientId  string      `json:"clientId,omitempty"` // Optional: client-side ID echoed in the ack
+	Reaction  string      `json:"reaction,omitempty"` // Optional: emoji reaction, empty removes it (react)
+	Rating    string      `json:"rating,omitempty"`   // Optional: "up" or "down" (rateStranger)
+	Accept    bool        `json:"accept,omitempty"`   // Optional: answer to a proposal (respondConnect)
+	Code      string      `json:"code,omitempty"`     // Optional: private channel code (joinChannel)
+	Tags      []string    `json:"tags,omitempty"`     // Optional: rating tags like "spam" or "rude"
+	Reason    string      `json:"reason,omitempty"`   // Optional: why the stranger is reported (reportStranger)
+
+	Version      int          `json:"version,omitempty"`      // Optional: protocol version the client speaks (hello)
+	Capabilities []Capability `json:"capabilities,omitempty"` // Optional: features the client supports (hello)
 }
@@ -1,22 +1,28 @@
 package models
 
 import (
-	"github.com/google/uuid"
 	"time"
+
+	"github.com/google/uuid"
 )
 
 // Message represents a real-time chat message (no DB storage)
 type Message struct {
-	Type      string    `json:"type"`      // "message", "strangerJoined", "strangerLeft", etc
-	Text      string    `json:"text"`
-	UserId    uuid.UUID `json:"userId"`
-	PairId    uuid.UUID `json:"pairId"`
-	Timestamp time.Time `json:"timestamp"`
+	ID        uuid.UUID  `json:"id,omitzero"` // Server-assigned, only set for chat messages
+	Type      string     `json:"type"`        // "message", "strangerJoined", "strangerLeft", etc
+	Text      string     `json:"text"`
+	UserId    uuid.UUID  `json:"userId"`
+	PairId    uuid.UUID  `json:"pairId"`
+	ReplyTo   uuid.UUID  `json:"replyTo,omitzero"`   // Message this one replies to
+	ClientId  string     `json:"clientId,omitempty"` // Echoed back to the sender in acks
+	EditedAt  *time.Time `json:"editedAt,omitempty"`
+	Timestamp time.Time  `json:"timestamp"`
 }
 
 // NewMessage creates a new message
 func NewMessage(text string, userId, pairId uuid.UUID) *Message {
 	return &Message{
+		ID:        uuid.New(),
 		Type:      "message",
 		Text:      text,
 		UserId:    userId,
@@ -33,3 +39,11 @@ func NewSystemMessage(msgType string, pairId uuid.UUID) *Message {
 		Timestamp: time.Now(),
 	}
 }
+
+// WithType returns a copy of the message carrying a different type,
+// used for acks and edit/delete notifications about the same message
+func (m *Message) WithType(msgType MessageType) *Message {
+	copied := *m
+	copied.Type = string(msgType)
+	return &copied
+}
@@ -0,0 +1,27 @@
+package models
+
+import "slices"
+
+// Role is what a moderator may do, each role allowing everything the previous ones do
+type Role string
+
+const (
+	RoleViewer    Role = "viewer"    // Sees the dashboard
+	RoleModerator Role = "moderator" // Resolves reports and manages bans
+	RoleAdmin     Role = "admin"     // Sends announcements and toggles matching
+)
+
+// Roles lists the roles from least to most privileged
+var Roles = []Role{RoleViewer, RoleModerator, RoleAdmin}
+
+// Allows reports whether the role includes the required one
+func (r Role) Allows(required Role) bool {
+	rank := slices.Index(Roles, r)
+	return rank >= 0 && rank >= slices.Index(Roles, required)
+}
+
+// Moderator is an operator signed in to the moderation dashboard or calling the admin API
+type Moderator struct {
+	Name string `json:"name"`
+	Role Role   `json:"role"`
+}
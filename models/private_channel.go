@@ -0,0 +1,50 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// PrivateChannel is a reusable channel two former strangers agreed to keep.
+// Only their two sessions can rejoin it, the code alone is not enough.
+type PrivateChannel struct {
+	Code       string       `json:"code"`
+	Members    [2]uuid.UUID `json:"members"` // sessions of the two users who agreed to stay in touch
+	CreatedAt  time.Time    `json:"createdAt"`
+	LastUsedAt time.Time    `json:"lastUsedAt"`
+}
+
+// NewPrivateChannel creates a new private channel with the given code for the two users
+func NewPrivateChannel(code string, user1, user2 uuid.UUID) *PrivateChannel {
+	now := time.Now()
+	return &PrivateChannel{
+		Code:       code,
+		Members:    [2]uuid.UUID{user1, user2},
+		CreatedAt:  now,
+		LastUsedAt: now,
+	}
+}
+
+// IsMember reports whether the user is one of the two who created the channel
+func (p *PrivateChannel) IsMember(userId uuid.UUID) bool {
+	return p.Members[0] == userId || p.Members[1] == userId
+}
+
+// ConnectMessage notifies users about the "stay in touch" flow
+type ConnectMessage struct {
+	Type      string    `json:"type"`
+	PairId    uuid.UUID `json:"pairId,omitzero"`
+	Code      string    `json:"code,omitempty"` // only sent once both users agreed
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// NewConnectMessage creates a connect flow notification
+func NewConnectMessage(msgType MessageType, pairId uuid.UUID, code string) *ConnectMessage {
+	return &ConnectMessage{
+		Type:      string(msgType),
+		PairId:    pairId,
+		Code:      code,
+		Timestamp: time.Now(),
+	}
+}
@@ -0,0 +1,169 @@
+package models
+
+import (
+	"slices"
+	"sync"
+)
+
+const (
+	// ProtocolVersion is the newest protocol version the server speaks
+	ProtocolVersion = 2
+	// MinProtocolVersion is the oldest protocol version the server still accepts.
+	// Version 1 clients don't send hello.
+	MinProtocolVersion = 1
+)
+
+// Capability is an optional feature that a client and the server agree on in the handshake
+type Capability string
+
+const (
+	CapabilityTyping      Capability = "typing"      // Typing indicators
+	CapabilityReceipts    Capability = "receipts"    // Read receipts
+	CapabilityAttachments Capability = "attachments" // File and image attachments
+	CapabilityVideo       Capability = "video"       // Video chat
+)
+
+// SupportedCapabilities lists the capabilities this server can enable
+var SupportedCapabilities = []Capability{CapabilityTyping}
+
+// Session holds what a client negotiated in the handshake. Until it sends
+// hello, a client speaks version 1 without any capabilities.
+type Session struct {
+	version      int
+	capabilities []Capability
+	greeted      bool // hello was received
+	started      bool // a message was received, hello can't be sent anymore
+	mu           sync.RWMutex
+}
+
+// NewSession creates the session of a client that hasn't said hello yet
+func NewSession() *Session {
+	return &Session{
+		version: MinProtocolVersion,
+		mu:      sync.RWMutex{},
+	}
+}
+
+// Negotiate records the handshake, settling on the highest version both sides speak
+// and the capabilities both support. Returns false if the handshake came too late.
+func (s *Session) Negotiate(clientVersion int, capabilities []Capability) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.started {
+		return false
+	}
+
+	s.version = min(clientVersion, ProtocolVersion)
+	s.capabilities = nil
+	for _, capability := range capabilities {
+		if slices.Contains(SupportedCapabilities, capability) && !slices.Contains(s.capabilities, capability) {
+			s.capabilities = append(s.capabilities, capability)
+		}
+	}
+	s.greeted = true
+	s.started = true
+	return true
+}
+
+// Start marks that the client sent its first message, closing the window for hello
+func (s *Session) Start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.started = true
+}
+
+// Version returns the negotiated protocol version
+func (s *Session) Version() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.version
+}
+
+// Started reports whether the client sent a message yet
+func (s *Session) Started() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.started
+}
+
+// Greeted reports whether the client completed the handshake
+func (s *Session) Greeted() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.greeted
+}
+
+// Capabilities returns the negotiated capabilities
+func (s *Session) Capabilities() []Capability {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]Capability{}, s.capabilities...)
+}
+
+// Has reports whether the capability was negotiated
+func (s *Session) Has(capability Capability) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return slices.Contains(s.capabilities, capability)
+}
+
+// CapabilityEvent is an outgoing event that only clients with a capability understand.
+// Clients without it don't get the event at all.
+type CapabilityEvent interface {
+	RequiredCapability() Capability
+}
+
+// WelcomeMessage answers hello with what the session can use
+type WelcomeMessage struct {
+	Type          string         `json:"type"`
+	Version       int            `json:"version"`       // Negotiated protocol version
+	ServerVersion string         `json:"serverVersion"` // Build of the server
+	Session       WelcomeSession `json:"session"`
+	Limits        WelcomeLimits  `json:"limits"`
+	Features      []string       `json:"features"`     // Features the server has enabled
+	Capabilities  []Capability   `json:"capabilities"` // Capabilities enabled for this session
+}
+
+// WelcomeSession identifies the session to the client
+type WelcomeSession struct {
+	UserId string `json:"userId"`
+	NodeId string `json:"nodeId,omitempty"`
+	// ResumeToken reconnects to the session. Unlike the session ID it is never
+	// shown to anyone else, so it must be kept secret.
+	ResumeToken string `json:"resumeToken"`
+}
+
+// WelcomeLimits are the limits the server enforces
+type WelcomeLimits struct {
+	MessageHistorySize    int `json:"messageHistorySize"`    // Recent messages that can be replied to, edited or deleted
+	EditWindowSeconds     int `json:"editWindowSeconds"`     // How long a message can be edited or deleted
+	TranscriptMaxMessages int `json:"transcriptMaxMessages"` // Messages a transcript keeps
+}
+
+// ErrorMessage tells a client that completed the handshake why a message was rejected
+type ErrorMessage struct {
+	Type        string      `json:"type"`
+	RequestType MessageType `json:"requestType,omitempty"` // Type of the rejected message
+	Error       string      `json:"error"`
+}
+
+// NewErrorMessage creates the rejection of a message
+func NewErrorMessage(requestType MessageType, err string) *ErrorMessage {
+	return &ErrorMessage{
+		Type:        string(Error),
+		RequestType: requestType,
+		Error:       err,
+	}
+}
+
+// TypingMessage tells a user whether their partner is typing
+type TypingMessage struct {
+	Type   string `json:"type"`
+	PairId string `json:"pairId"`
+	Typing bool   `json:"typing"`
+}
+
+// RequiredCapability limits typing indicators to clients that asked for them
+func (m *TypingMessage) RequiredCapability() Capability {
+	return CapabilityTyping
+}
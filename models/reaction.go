@@ -0,0 +1,34 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ReactionsMessage carries the aggregated reactions to a message
+type ReactionsMessage struct {
+	Type      string         `json:"type"`
+	PairId    uuid.UUID      `json:"pairId"`
+	MessageId uuid.UUID      `json:"messageId"`
+	Reactions map[string]int `json:"reactions"`       // reaction -> count
+	Yours     string         `json:"yours,omitempty"` // the recipient's own reaction
+	Timestamp time.Time      `json:"timestamp"`
+}
+
+// NewReactionsMessage aggregates per-user reactions for one recipient
+func NewReactionsMessage(pairId, messageId uuid.UUID, reactions map[uuid.UUID]string, recipient uuid.UUID) *ReactionsMessage {
+	counts := make(map[string]int)
+	for _, reaction := range reactions {
+		counts[reaction]++
+	}
+
+	return &ReactionsMessage{
+		Type:      string(Reactions),
+		PairId:    pairId,
+		MessageId: messageId,
+		Reactions: counts,
+		Yours:     reactions[recipient],
+		Timestamp: time.Now(),
+	}
+}
@@ -0,0 +1,52 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ReportReasons lists the reasons a user may report a stranger for
+var ReportReasons = []string{"spam", "harassment", "inappropriate", "underage", "other"}
+
+// Report is a user's complaint about a stranger, waiting for an operator to resolve it
+type Report struct {
+	ID         uuid.UUID  `json:"id"`
+	PairId     uuid.UUID  `json:"pairId"`
+	ReporterId uuid.UUID  `json:"reporterId"`
+	ReportedId uuid.UUID  `json:"reportedId"`
+	ReportedIP string     `json:"reportedIp,omitempty"` // Empty if the stranger wasn't connected to the reporter's node
+	Reason     string     `json:"reason"`
+	Details    string     `json:"details,omitempty"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	ResolvedAt *time.Time `json:"resolvedAt,omitempty"` // nil while the report is open
+	Resolution string     `json:"resolution,omitempty"` // Operator's note on how it was resolved
+	BanId      uuid.UUID  `json:"banId,omitzero"`       // Ban issued when resolving, if any
+	// Snippet holds the last messages of the chat, empty if its history was gone or held by another node
+	Snippet []ReportLine `json:"snippet,omitempty"`
+}
+
+// ReportLine is a message of a reported chat
+type ReportLine struct {
+	Reported bool      `json:"reported"` // Sent by the reported user rather than the reporter
+	Text     string    `json:"text"`
+	SentAt   time.Time `json:"sentAt"`
+}
+
+// NewReportSnippet converts the last messages of a chat from the reporter's point of view
+func NewReportSnippet(messages []*Message, reporterId uuid.UUID) []ReportLine {
+	lines := make([]ReportLine, 0, len(messages))
+	for _, message := range messages {
+		lines = append(lines, ReportLine{
+			Reported: message.UserId != reporterId,
+			Text:     message.Text,
+			SentAt:   message.Timestamp,
+		})
+	}
+	return lines
+}
+
+// Open reports whether no operator has resolved the report yet
+func (r *Report) Open() bool {
+	return r.ResolvedAt == nil
+}
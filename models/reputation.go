@@ -0,0 +1,15 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Reputation is a user's score from the ratings of former partners as of UpdatedAt.
+// It decays towards 0, which is neutral.
+type Reputation struct {
+	UserId    uuid.UUID `json:"userId"`
+	Score     float64   `json:"score"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
@@ -0,0 +1,68 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Transcript is an opt-in, bounded log of the messages exchanged in a pair.
+// Messages are only recorded while both users have opted in.
+type Transcript struct {
+	PairId    uuid.UUID
+	Users     [2]uuid.UUID
+	OptedIn   map[uuid.UUID]bool
+	Tokens    map[uuid.UUID]string // per-user download tokens
+	Messages  []*Message
+	CreatedAt time.Time
+	EndedAt   time.Time // zero while the chat is still running
+}
+
+// NewTranscript creates an empty transcript for the given pair
+func NewTranscript(pair *ChatPair) *Transcript {
+	return &Transcript{
+		PairId:    pair.ID,
+		Users:     pair.UserIds(),
+		OptedIn:   make(map[uuid.UUID]bool),
+		Tokens:    make(map[uuid.UUID]string),
+		Messages:  make([]*Message, 0),
+		CreatedAt: time.Now(),
+	}
+}
+
+// HasUser checks if the given user took part in the transcribed chat
+func (t *Transcript) HasUser(userId uuid.UUID) bool {
+	return t.Users[0] == userId || t.Users[1] == userId
+}
+
+// Partner returns the other participant of the transcribed chat
+func (t *Transcript) Partner(userId uuid.UUID) uuid.UUID {
+	if t.Users[0] == userId {
+		return t.Users[1]
+	}
+	return t.Users[0]
+}
+
+// Recording reports whether both users have opted in
+func (t *Transcript) Recording() bool {
+	return t.OptedIn[t.Users[0]] && t.OptedIn[t.Users[1]]
+}
+
+// Ended reports whether the chat this transcript belongs to is over
+func (t *Transcript) Ended() bool {
+	return !t.EndedAt.IsZero()
+}
+
+// TranscriptStatusMessage tells a user the opt-in state of the current transcript
+// and, once the chat has ended, how to download it
+type TranscriptStatusMessage struct {
+	Type            string     `json:"type"`
+	PairId          uuid.UUID  `json:"pairId"`
+	YouOptedIn      bool       `json:"youOptedIn"`
+	StrangerOptedIn bool       `json:"strangerOptedIn"`
+	Recording       bool       `json:"recording"`
+	Ended           bool       `json:"ended"`
+	Token           string     `json:"token,omitempty"`
+	ExpiresAt       *time.Time `json:"expiresAt,omitempty"`
+	Timestamp       time.Time  `json:"timestamp"`
+}
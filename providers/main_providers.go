@@ -1,20 +1,43 @@
 package providers
 
 import (
-	"log"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"realTimeService/broker"
 	"realTimeService/configuration"
+	"realTimeService/events"
 	"realTimeService/handlers/wsrouter"
 	"realTimeService/handlers/wsrouter/handlers"
 	"realTimeService/hubs"
+	"realTimeService/logging"
 	"realTimeService/models"
+	"realTimeService/store"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
 )
 
+// brokerPingTimeout bounds checking that the broker is reachable at startup
+const brokerPingTimeout = 5 * time.Second
+
 // DependencyInjectionContainer DI Container
 type DependencyInjectionContainer struct {
 	Hub *hubs.MainHub
 
+	// Broker connecting this node to the others
+	Broker broker.Broker
+
+	// Store keeping bans, reports, reputation, the audit trail and transcripts
+	Store store.Store
+
 	// Router for WebSocket handling
 	Router *wsrouter.Router
+
+	// config is the configuration last applied to the services
+	config *configuration.Config
 }
 
 // NewDependencyInjectionContainer Create a new DI container
@@ -23,17 +46,158 @@ func NewDependencyInjectionContainer() *DependencyInjectionContainer {
 }
 
 // InitializeProviders Initialize the singleton variables
-func (d *DependencyInjectionContainer) InitializeProviders(cfg *configuration.Config) {
-	d.Hub = hubs.NewMainHub()
+func (d *DependencyInjectionContainer) InitializeProviders(cfg *configuration.Config) error {
+	b, err := newBroker(cfg)
+	if err != nil {
+		return err
+	}
+	d.Broker = b
+
+	st, err := newStore(cfg, b)
+	if err != nil {
+		return err
+	}
+	d.Store = st
+
+	nodeId := cfg.NodeId
+	if nodeId == "" {
+		nodeId = uuid.NewString()
+	}
+
+	d.Hub = hubs.NewMainHub(d.Broker, d.Store, nodeId, cfg.Broker != "memory", cfg.Auth.SessionSecret)
+	if cfg.EventLoop {
+		d.Hub.UseEventLoop()
+	}
+	d.ApplyConfig(cfg)
+	if err := d.subscribeEvents(cfg); err != nil {
+		return err
+	}
 	d.Router = wsrouter.NewRouter()
 
 	// Register WebSocket message handlers
+	d.Router.RegisterHandler(models.Hello, handlers.NewHelloHandler(d))
 	d.Router.RegisterHandler(models.FindMatch, handlers.NewFindMatchHandler(d))
 	d.Router.RegisterHandler(models.SendMessage, handlers.NewSendHandler(d))
+	d.Router.RegisterHandler(models.Typing, handlers.NewTypingHandler(d))
 	d.Router.RegisterHandler(models.NextStranger, handlers.NewNextStrangerHandler(d))
 	d.Router.RegisterHandler(models.StopChat, handlers.NewStopChatHandler(d))
+	d.Router.RegisterHandler(models.TranscriptOptIn, handlers.NewTranscriptOptInHandler(d))
+	d.Router.RegisterHandler(models.EditMessage, handlers.NewEditMessageHandler(d))
+	d.Router.RegisterHandler(models.DeleteMessage, handlers.NewDeleteMessageHandler(d))
+	d.Router.RegisterHandler(models.React, handlers.NewReactHandler(d))
+	d.Router.RegisterHandler(models.RateStranger, handlers.NewRateStrangerHandler(d))
+	d.Router.RegisterHandler(models.RequestConnect, handlers.NewRequestConnectHandler(d))
+	d.Router.RegisterHandler(models.RespondConnect, handlers.NewRespondConnectHandler(d))
+	d.Router.RegisterHandler(models.JoinChannel, handlers.NewJoinChannelHandler(d))
+	d.Router.RegisterHandler(models.ReportStranger, handlers.NewReportStrangerHandler(d))
+
+	// Messages of pairs owned by other nodes are handled there
+	d.Router.SetForwarder(d.Hub)
+	d.Router.SetSender(d.Hub)
+	d.Hub.SetCommandHandler(d.handleForwardedCommand)
+
+	// Start background work
+	d.Hub.TranscriptService.Start()
+	d.Hub.ReputationService.Start()
+	d.Hub.ConnectService.Start()
+	d.Hub.BanService.Start()
+	d.Hub.ReportService.Start()
+	if err := d.Hub.Start(); err != nil {
+		return err
+	}
+	d.Hub.ClusterService.Start()
+
+	slog.Info("DependencyInjectionContainer initialized with Hub and MatchingService",
+		logging.Node(nodeId), "broker", cfg.Broker, "store", cfg.Store.Driver)
+	return nil
+}
 
-	log.Println("DependencyInjectionContainer initialized with Hub and MatchingService")
+// ApplyConfig applies the settings that can change while the server runs to the services
+func (d *DependencyInjectionContainer) ApplyConfig(cfg *configuration.Config) {
+	d.Hub.MessageService.SetLimits(cfg.Limits.MessageHistorySize, cfg.Limits.EditWindow.Std())
+	d.Hub.TranscriptService.SetLimits(cfg.Limits.TranscriptMaxMessages, cfg.Limits.TranscriptRetention.Std())
+	d.Hub.ConnectService.SetTTL(cfg.Limits.ChannelTTL.Std())
+	d.Hub.ReputationService.SetTimings(cfg.Moderation.ReputationHalfLife.Std(), cfg.Moderation.RatingWindow.Std())
+	d.Hub.AuditService.SetSize(cfg.Moderation.AuditSize)
+	// Operators can toggle matching at runtime, which a reload only overrides
+	// when the configured value itself changed
+	if d.config == nil || d.config.Matching.Enabled != cfg.Matching.Enabled {
+		d.Hub.MatchingService.SetEnabled(cfg.Matching.Enabled)
+	}
+	d.config = cfg
+}
+
+// subscribeEvents hands the hub's events to the audit file and the webhooks configured
+func (d *DependencyInjectionContainer) subscribeEvents(cfg *configuration.Config) error {
+	if cfg.Events.AuditFile != "" {
+		auditFile, err := events.OpenAuditFile(cfg.Events.AuditFile)
+		if err != nil {
+			return err
+		}
+		d.Hub.Events.Subscribe("audit file", events.DefaultBuffer, auditFile)
+	}
+
+	types := make([]events.Type, 0, len(cfg.Events.WebhookEvents))
+	for _, eventType := range cfg.Events.WebhookEvents {
+		if !slices.Contains(events.Types, events.Type(eventType)) {
+			return fmt.Errorf("events.webhookEvents: unknown event type %q", eventType)
+		}
+		types = append(types, events.Type(eventType))
+	}
+	for _, url := range cfg.Events.Webhooks {
+		webhook := events.NewWebhook(url, cfg.Events.WebhookSecret, types)
+		d.Hub.Events.Subscribe("webhook "+url, events.DefaultBuffer, webhook)
+	}
+	return nil
+}
+
+// newBroker creates the broker selected in the configuration
+func newBroker(cfg *configuration.Config) (broker.Broker, error) {
+	switch cfg.Broker {
+	case "memory":
+		return broker.NewMemoryBroker(), nil
+	case "redis":
+		if cfg.RedisAddr == "" {
+			return nil, fmt.Errorf("redis broker requires redisAddr")
+		}
+		redisBroker := broker.NewRedisBroker(cfg.RedisAddr, cfg.RedisPassword)
+
+		ctx, cancel := context.WithTimeout(context.Background(), brokerPingTimeout)
+		defer cancel()
+		if err := redisBroker.Ping(ctx); err != nil {
+			redisBroker.Close()
+			return nil, err
+		}
+		return redisBroker, nil
+	default:
+		return nil, fmt.Errorf("unknown broker %q", cfg.Broker)
+	}
+}
+
+// newStore creates the store selected in the configuration
+func newStore(cfg *configuration.Config, b broker.Broker) (store.Store, error) {
+	switch cfg.Store.Driver {
+	case store.DriverBroker:
+		return store.NewBrokerStore(b), nil
+	case store.DriverMemory:
+		return store.NewMemoryStore(), nil
+	case store.DriverSQLite:
+		if cfg.Broker != "memory" {
+			slog.Warn("The SQLite store isn't shared with other nodes, bans and reports apply to this node only")
+		}
+		return store.OpenSQLiteStore(cfg.Store.Path)
+	default:
+		return nil, fmt.Errorf("unknown store %q", cfg.Store.Driver)
+	}
+}
+
+// handleForwardedCommand routes a message that a user connected to another node
+// sent about a pair owned by this node. Replies reach the user through the broker,
+// so the handlers only get the trace context of the sender's node.
+func (d *DependencyInjectionContainer) handleForwardedCommand(traceCtx context.Context, client *models.Client, msg models.IncomingMessage) {
+	if err := d.Router.Handle(traceCtx, client, msg, ""); err != nil {
+		client.Log.Warn("Error handling message forwarded from another node", "type", msg.Type, logging.Err(err))
+	}
 }
 
 func (d *DependencyInjectionContainer) GetHub() *hubs.MainHub {
@@ -45,6 +209,16 @@ func (d *DependencyInjectionContainer) GetRouter() *wsrouter.Router {
 }
 
 func (d *DependencyInjectionContainer) Close() error {
-	log.Println("Closing DependencyInjectionContainer")
-	return nil
+	slog.Info("Closing DependencyInjectionContainer")
+	if d.Hub != nil {
+		d.Hub.Close()
+	}
+	var errs []error
+	if d.Store != nil {
+		errs = append(errs, d.Store.Close())
+	}
+	if d.Broker != nil {
+		errs = append(errs, d.Broker.Close())
+	}
+	return errors.Join(errs...)
 }
@@ -0,0 +1,476 @@
+package providers_test
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"realTimeService/configuration"
+	"realTimeService/handlers"
+	"realTimeService/handlers/wsrouter"
+	"realTimeService/models"
+	"realTimeService/providers"
+	"realTimeService/store"
+	"realTimeService/transport"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+)
+
+// testClient is a client of the container's hub connected through memory
+type testClient struct {
+	*models.Client
+	conn *transport.MemoryConnection
+}
+
+// newContainer wires up a single node keeping everything in memory
+func newContainer(t *testing.T) *providers.DependencyInjectionContainer {
+	t.Helper()
+	return newContainerWith(t, func(*configuration.Config) {})
+}
+
+// newContainerWith wires up a single node like newContainer, with changes to its configuration
+func newContainerWith(t *testing.T, configure func(cfg *configuration.Config)) *providers.DependencyInjectionContainer {
+	t.Helper()
+	logger := slog.Default()
+	slog.SetDefault(slog.New(slog.DiscardHandler))
+	t.Cleanup(func() { slog.SetDefault(logger) })
+
+	cfg := configuration.Default()
+	cfg.Broker = "memory"
+	cfg.Store.Driver = store.DriverMemory
+	configure(cfg)
+	d := providers.NewDependencyInjectionContainer()
+	if err := d.InitializeProviders(cfg); err != nil {
+		t.Fatalf("InitializeProviders: %v", err)
+	}
+	t.Cleanup(func() { d.Close() })
+	return d
+}
+
+// connect adds a client to the hub and completes the handshake
+func connect(t *testing.T, d *providers.DependencyInjectionContainer) *testClient {
+	t.Helper()
+	conn := transport.NewMemoryConnection("127.0.0.1:1234")
+	client := &testClient{Client: models.NewClient(uuid.New(), nil, conn), conn: conn}
+	conn.SetSession(client.Session)
+	d.GetHub().AddClient(client.Client)
+	t.Cleanup(func() { d.GetHub().RemoveClient(client.Client) })
+
+	send(t, d, client, models.IncomingMessage{Type: models.Hello, Version: 2})
+	client.waitFor(t, "welcome")
+	return client
+}
+
+// send routes a message of the client and fails the test if the router returns an error
+func send(t *testing.T, d *providers.DependencyInjectionContainer, client *testClient, msg models.IncomingMessage) {
+	t.Helper()
+	if err := d.GetRouter().Handle(context.Background(), client.Client, msg, ""); err != nil {
+		t.Fatalf("Handle %s: %v", msg.Type, err)
+	}
+}
+
+// events returns the events of the type sent to the client so far
+func (c *testClient) events(t *testing.T, eventType string) []map[string]any {
+	t.Helper()
+	var matching []map[string]any
+	for _, payload := range c.conn.Sent() {
+		var event map[string]any
+		if err := json.Unmarshal(payload, &event); err != nil {
+			t.Fatalf("invalid event %s: %v", payload, err)
+		}
+		if event["type"] == eventType {
+			matching = append(matching, event)
+		}
+	}
+	return matching
+}
+
+// waitFor returns the first event of the type sent to the client, waiting for it to arrive
+func (c *testClient) waitFor(t *testing.T, eventType string) map[string]any {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		for _, payload := range c.conn.Sent() {
+			var event map[string]any
+			if err := json.Unmarshal(payload, &event); err != nil {
+				t.Fatalf("invalid event %s: %v", payload, err)
+			}
+			if event["type"] == eventType {
+				return event
+			}
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("no %s event, got %d events", eventType, len(c.conn.Sent()))
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// pairUp matches two new clients with each other
+func pairUp(t *testing.T, d *providers.DependencyInjectionContainer) (*testClient, *testClient) {
+	t.Helper()
+	first, second := connect(t, d), connect(t, d)
+	send(t, d, first, models.IncomingMessage{Type: models.FindMatch})
+	first.waitFor(t, "searching")
+	send(t, d, second, models.IncomingMessage{Type: models.FindMatch})
+	first.waitFor(t, "strangerJoined")
+	second.waitFor(t, "strangerJoined")
+	return first, second
+}
+
+func TestRouterRelaysMessages(t *testing.T) {
+	d := newContainer(t)
+	first, second := pairUp(t, d)
+
+	send(t, d, first, models.IncomingMessage{Type: models.SendMessage, Text: "hi", ClientId: "c1"})
+	if message := second.waitFor(t, "message"); message["text"] != "hi" {
+		t.Fatalf("partner got %v, want the text sent", message)
+	}
+	if ack := first.waitFor(t, "messageAck"); ack["clientId"] != "c1" {
+		t.Fatalf("sender got %v, want an ack of c1", ack)
+	}
+}
+
+func TestRouterRejectsMessages(t *testing.T) {
+	d := newContainer(t)
+	client := connect(t, d)
+
+	ctx, result := wsrouter.WithResult(context.Background())
+	if err := d.GetRouter().Handle(ctx, client.Client, models.IncomingMessage{Type: "bogus"}, ""); err != nil {
+		t.Fatalf("Handle: %v", err)
+	}
+	if result.Status != 400 {
+		t.Fatalf("status %d, want 400", result.Status)
+	}
+	if event := client.waitFor(t, "error"); event["requestType"] != "bogus" {
+		t.Fatalf("got %v, want an error about the bogus message", event)
+	}
+
+	// Messages that need a chat are refused outside of one
+	ctx, result = wsrouter.WithResult(context.Background())
+	msg := models.IncomingMessage{Type: models.SendMessage, Text: "hi"}
+	if err := d.GetRouter().Handle(ctx, client.Client, msg, ""); err != nil {
+		t.Fatalf("Handle: %v", err)
+	}
+	if result.Status != 400 {
+		t.Fatalf("status %d, want 400", result.Status)
+	}
+	if errors := client.events(t, "error"); len(errors) != 2 || errors[1]["requestType"] != "sendMessage" {
+		t.Fatalf("got errors %v, want one about sendMessage", errors)
+	}
+}
+
+func TestRouterRejectsNewMessagesFromVersion1(t *testing.T) {
+	d := newContainer(t)
+	conn := transport.NewMemoryConnection("127.0.0.1:1234")
+	legacy := models.NewClient(uuid.New(), nil, conn)
+	conn.SetSession(legacy.Session)
+	d.GetHub().AddClient(legacy)
+	defer d.GetHub().RemoveClient(legacy)
+
+	for _, msgType := range []models.MessageType{models.EditMessage, models.React, models.RequestConnect, models.ReportStranger} {
+		ctx, result := wsrouter.WithResult(context.Background())
+		if err := d.GetRouter().Handle(ctx, legacy, models.IncomingMessage{Type: msgType}, ""); err != nil {
+			t.Fatalf("Handle %s: %v", msgType, err)
+		}
+		if result.Status != 400 {
+			t.Errorf("%s from a version 1 client got status %d, want 400", msgType, result.Status)
+		}
+	}
+}
+
+func TestRouterRejectsTagsAgainstRating(t *testing.T) {
+	d := newContainer(t)
+	first, second := pairUp(t, d)
+	pair, err := d.GetHub().MatchingService.GetPair(first.UserId)
+	if err != nil {
+		t.Fatalf("GetPair: %v", err)
+	}
+	send(t, d, first, models.IncomingMessage{Type: models.StopChat})
+
+	for _, msg := range []models.IncomingMessage{
+		{Type: models.RateStranger, PairId: pair.ID, Rating: "up", Tags: []string{"spam"}},
+		{Type: models.RateStranger, PairId: pair.ID, Rating: "down", Tags: []string{"friendly"}},
+		{Type: models.RateStranger, PairId: pair.ID, Rating: "down", Tags: []string{"spam", "spam", "spam", "spam"}},
+	} {
+		ctx, result := wsrouter.WithResult(context.Background())
+		if err := d.GetRouter().Handle(ctx, first.Client, msg, ""); err != nil {
+			t.Fatalf("Handle: %v", err)
+		}
+		if result.Status != 400 {
+			t.Fatalf("rating %s with %v got status %d, want 400", msg.Rating, msg.Tags, result.Status)
+		}
+	}
+
+	send(t, d, first, models.IncomingMessage{Type: models.RateStranger, PairId: pair.ID, Rating: "down", Tags: []string{"spam"}})
+	first.waitFor(t, "ratingReceived")
+	if score := d.GetHub().ReputationService.Score(second.UserId); score >= 0 {
+		t.Fatalf("score = %v after a thumbs down, want it negative", score)
+	}
+}
+
+func TestRouterKeepsRequesterWhenPartnerUnreachable(t *testing.T) {
+	d := newContainer(t)
+	first, second := pairUp(t, d)
+	second.conn.Close("gone")
+
+	// send fails the test if the handler returns an error, which would drop the connection
+	send(t, d, first, models.IncomingMessage{Type: models.RequestConnect})
+	first.waitFor(t, "connectPending")
+	send(t, d, first, models.IncomingMessage{Type: models.TranscriptOptIn, Enabled: true})
+	first.waitFor(t, "transcriptStatus")
+}
+
+func TestHubTellsPartnerAboutDisconnect(t *testing.T) {
+	d := newContainer(t)
+	first, second := pairUp(t, d)
+
+	d.GetHub().RemoveClient(first.Client)
+	second.waitFor(t, "strangerLeft")
+	if _, err := d.GetHub().MatchingService.GetPair(second.UserId); err == nil {
+		t.Fatal("pair still active after a disconnect")
+	}
+}
+
+func TestHubKeepsResumedSession(t *testing.T) {
+	d := newContainer(t)
+	first, second := pairUp(t, d)
+
+	// The session reconnects before its old connection is noticed to be gone
+	first.conn.Close("gone")
+	conn := transport.NewMemoryConnection("127.0.0.1:1234")
+	resumed := &testClient{Client: models.NewClient(first.UserId, nil, conn), conn: conn}
+	conn.SetSession(resumed.Session)
+	d.GetHub().AddClient(resumed.Client)
+	d.GetHub().RemoveClient(first.Client)
+	send(t, d, resumed, models.IncomingMessage{Type: models.Hello, Version: 2})
+
+	if d.GetHub().GetClient(first.UserId) != resumed.Client {
+		t.Fatal("closing the replaced connection removed the resumed one")
+	}
+	if _, err := d.GetHub().MatchingService.GetPair(second.UserId); err != nil {
+		t.Fatalf("closing the replaced connection ended the pair: %v", err)
+	}
+
+	// The chat goes on over the resumed connection both ways
+	send(t, d, second, models.IncomingMessage{Type: models.SendMessage, Text: "still there?"})
+	if message := resumed.waitFor(t, "message"); message["text"] != "still there?" {
+		t.Fatalf("resumed connection got %v, want the partner's message", message)
+	}
+	send(t, d, resumed, models.IncomingMessage{Type: models.SendMessage, Text: "yes"})
+	if message := second.waitFor(t, "message"); message["text"] != "yes" {
+		t.Fatalf("partner got %v, want the resumed user's message", message)
+	}
+
+	d.GetHub().RemoveClient(resumed.Client)
+	second.waitFor(t, "strangerLeft")
+}
+
+func TestHubKeepsResumedQueueEntry(t *testing.T) {
+	d := newContainer(t)
+	waiting := connect(t, d)
+	send(t, d, waiting, models.IncomingMessage{Type: models.FindMatch})
+	waiting.waitFor(t, "searching")
+
+	waiting.conn.Close("gone")
+	conn := transport.NewMemoryConnection("127.0.0.1:1234")
+	resumed := &testClient{Client: models.NewClient(waiting.UserId, nil, conn), conn: conn}
+	conn.SetSession(resumed.Session)
+	d.GetHub().AddClient(resumed.Client)
+	d.GetHub().RemoveClient(waiting.Client)
+	t.Cleanup(func() { d.GetHub().RemoveClient(resumed.Client) })
+
+	stranger := connect(t, d)
+	send(t, d, stranger, models.IncomingMessage{Type: models.FindMatch})
+	resumed.waitFor(t, "strangerJoined")
+}
+
+func TestEventLoopTellsPartnerInOrder(t *testing.T) {
+	d := newContainerWith(t, func(cfg *configuration.Config) { cfg.EventLoop = true })
+	first, second := pairUp(t, d)
+
+	hub := d.GetHub()
+	hub.Do(func() { hub.RemoveClient(first.Client) })
+	send(t, d, second, models.IncomingMessage{Type: models.FindMatch})
+	second.waitFor(t, "searching")
+
+	// strangerLeft was queued by the disconnect, before anything that followed it
+	var types []string
+	for _, raw := range second.conn.Sent() {
+		var event map[string]any
+		if err := json.Unmarshal(raw, &event); err != nil {
+			t.Fatalf("invalid event: %v", err)
+		}
+		types = append(types, event["type"].(string))
+	}
+	left := slices.Index(types, "strangerLeft")
+	if left < 0 || !slices.Contains(types[left+1:], "searching") {
+		t.Fatalf("events %v, want strangerLeft before searching", types)
+	}
+}
+
+// stalledConnection is a connection of a client that stopped reading, whose
+// sends wait until it is released
+type stalledConnection struct {
+	*transport.MemoryConnection
+	release chan struct{}
+}
+
+func (c *stalledConnection) Send(v any) error {
+	<-c.release
+	return c.MemoryConnection.Send(v)
+}
+
+func TestEventLoopDoesNotWaitForStalledClients(t *testing.T) {
+	d := newContainerWith(t, func(cfg *configuration.Config) { cfg.EventLoop = true })
+	conn := &stalledConnection{MemoryConnection: transport.NewMemoryConnection("127.0.0.1:1234"), release: make(chan struct{})}
+	release := sync.OnceFunc(func() { close(conn.release) })
+	t.Cleanup(release) // Runs before the container closes, which waits for the loop
+	client := models.NewClient(uuid.New(), nil, conn)
+	conn.SetSession(client.Session)
+	hub := d.GetHub()
+	hub.Do(func() { hub.AddClient(client) })
+
+	// Far more events than the client's queue holds, none of them waiting for it
+	var errs int
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for range 1000 {
+			hub.Do(func() {
+				if err := hub.SendToClient(client, models.NewSystemMessage("searching", uuid.Nil)); err != nil {
+					errs++
+				}
+			})
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("event loop waited for a stalled client")
+	}
+	if errs == 0 {
+		t.Fatal("no send failed although the client's queue overflowed")
+	}
+
+	// The client is dropped, as it missed events
+	release()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if closed, reason := conn.Closed(); closed {
+			if reason != "too slow" {
+				t.Fatalf("closed with reason %q, want too slow", reason)
+			}
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("stalled client was not disconnected")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestHubKickClosesConnection(t *testing.T) {
+	d := newContainer(t)
+	client := connect(t, d)
+
+	if err := d.GetHub().Kick(client.UserId, "kicked"); err != nil {
+		t.Fatalf("Kick: %v", err)
+	}
+	if closed, reason := client.conn.Closed(); !closed || reason != "kicked" {
+		t.Fatalf("connection closed=%v reason=%q, want closed with the kick reason", closed, reason)
+	}
+}
+
+func TestPrivateChannelOnlyAdmitsItsMembers(t *testing.T) {
+	d := newContainer(t)
+	first, second := pairUp(t, d)
+
+	send(t, d, first, models.IncomingMessage{Type: models.RequestConnect})
+	send(t, d, second, models.IncomingMessage{Type: models.RequestConnect})
+	code, _ := first.waitFor(t, "connectEstablished")["code"].(string)
+	if code == "" {
+		t.Fatal("no channel code")
+	}
+
+	ctx, result := wsrouter.WithResult(context.Background())
+	stranger := connect(t, d)
+	if err := d.GetRouter().Handle(ctx, stranger.Client, models.IncomingMessage{Type: models.JoinChannel, Code: code}, ""); err != nil {
+		t.Fatalf("Handle: %v", err)
+	}
+	if result.Status != 400 {
+		t.Fatalf("status %d, want a stranger holding the code to be refused", result.Status)
+	}
+
+	send(t, d, first, models.IncomingMessage{Type: models.StopChat})
+	send(t, d, first, models.IncomingMessage{Type: models.JoinChannel, Code: code})
+	first.waitFor(t, "channelWaiting")
+}
+
+func TestFramesCarryNegotiatedVersion(t *testing.T) {
+	d := newContainer(t)
+	greeted := connect(t, d)
+	if welcome := greeted.waitFor(t, "welcome"); welcome["v"] != float64(2) {
+		t.Fatalf("welcome has v=%v, want 2", welcome["v"])
+	}
+
+	// Version 1 clients skip hello and don't know the field
+	conn := transport.NewMemoryConnection("127.0.0.1:1234")
+	legacy := &testClient{Client: models.NewClient(uuid.New(), nil, conn), conn: conn}
+	conn.SetSession(legacy.Session)
+	d.GetHub().AddClient(legacy.Client)
+	defer d.GetHub().RemoveClient(legacy.Client)
+	send(t, d, legacy, models.IncomingMessage{Type: models.FindMatch})
+	if searching := legacy.waitFor(t, "searching"); searching["v"] != nil {
+		t.Fatalf("version 1 client got v=%v", searching["v"])
+	}
+}
+
+func TestWebSocketRejectsUndecodableFrames(t *testing.T) {
+	d := newContainer(t)
+	config, err := configuration.NewManager(nil)
+	if err != nil {
+		t.Fatalf("NewManager: %v", err)
+	}
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/ws", func(ctx *gin.Context) { ctx.Set("user_sub", uuid.NewString()) },
+		handlers.NewWsHandler(d, config).Handle)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	ws, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/ws", nil)
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	defer ws.Close()
+
+	// The connection stays open after a rejected frame, so the second one is answered too
+	for frame, want := range map[string]string{
+		`{"v":3,"type":"hello","version":3}`: "unsupported protocol version",
+		`{"type":`:                           "invalid message",
+	} {
+		if err := ws.WriteMessage(websocket.TextMessage, []byte(frame)); err != nil {
+			t.Fatalf("WriteMessage: %v", err)
+		}
+		ws.SetReadDeadline(time.Now().Add(2 * time.Second))
+		var event map[string]any
+		for event["type"] != "error" {
+			event = nil
+			if err := ws.ReadJSON(&event); err != nil {
+				t.Fatalf("%s: no error event: %v", frame, err)
+			}
+		}
+		if event["error"] != want || event["requestType"] != nil {
+			t.Errorf("%s: error event = %v, want %q without a request type", frame, event, want)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"realTimeService/models"
+	"realTimeService/store"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// auditTimeout bounds a single audit trail operation
+const auditTimeout = 5 * time.Second
+
+// AuditService keeps the trail of actions operators took.
+// Entries live in the store, so it covers every node sharing it.
+type AuditService struct {
+	store store.Store
+	size  int // 0 keeps every entry
+	mu    sync.Mutex
+}
+
+// NewAuditService creates an audit trail in the store keeping every entry
+func NewAuditService(st store.Store) *AuditService {
+	return &AuditService{
+		store: st,
+		mu:    sync.Mutex{},
+	}
+}
+
+// SetSize changes how many of the latest entries the audit trail keeps, every one if 0
+func (s *AuditService) SetSize(size int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.size = size
+}
+
+// Record adds an entry to the audit trail, dropping the oldest ones beyond its size if it has one
+func (s *AuditService) Record(actor string, action models.AuditAction, target, details string) error {
+	entry := &models.AuditEntry{
+		ID:        uuid.New(),
+		Actor:     actor,
+		Action:    action,
+		Target:    target,
+		Details:   details,
+		CreatedAt: time.Now(),
+	}
+	slog.Info("Audit", "actor", actor, "action", action, "target", target, "details", details)
+
+	s.mu.Lock()
+	size := s.size
+	s.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), auditTimeout)
+	defer cancel()
+	if err := s.store.AddAuditEntry(ctx, entry, size); err != nil {
+		return fmt.Errorf("error recording audit entry: %w", err)
+	}
+	return nil
+}
+
+// List returns up to limit of the latest entries, newest first
+func (s *AuditService) List(limit int) ([]*models.AuditEntry, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), auditTimeout)
+	defer cancel()
+	return s.store.AuditEntries(ctx, limit)
+}
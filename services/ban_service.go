@@ -0,0 +1,146 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"realTimeService/logging"
+	"realTimeService/models"
+	"realTimeService/store"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// banTimeout bounds a single ban table operation
+	banTimeout = 5 * time.Second
+	// banCleanupInterval is how often expired bans are removed
+	banCleanupInterval = time.Minute
+)
+
+// BanService keeps banned sessions and IP addresses from connecting.
+// Bans live in the store, so they apply on every node sharing it.
+type BanService struct {
+	store store.Store
+	stop  chan struct{}
+}
+
+// NewBanService creates a ban service keeping its bans in the store
+func NewBanService(st store.Store) *BanService {
+	return &BanService{
+		store: st,
+		stop:  make(chan struct{}),
+	}
+}
+
+// Start runs the background removal of expired bans
+func (s *BanService) Start() {
+	go func() {
+		ticker := time.NewTicker(banCleanupInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				s.purgeExpired(time.Now())
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop terminates the background cleanup
+func (s *BanService) Stop() {
+	close(s.stop)
+}
+
+// Add bans a session, an IP address or both. A zero duration bans permanently.
+func (s *BanService) Add(userId uuid.UUID, ip, reason string, duration time.Duration) (*models.Ban, error) {
+	if userId == uuid.Nil && ip == "" {
+		return nil, fmt.Errorf("a ban needs a session or an IP address")
+	}
+	if duration < 0 {
+		return nil, fmt.Errorf("ban duration must not be negative")
+	}
+
+	ban := &models.Ban{
+		ID:        uuid.New(),
+		UserId:    userId,
+		IP:        ip,
+		Reason:    reason,
+		CreatedAt: time.Now(),
+	}
+	if duration > 0 {
+		expiresAt := ban.CreatedAt.Add(duration)
+		ban.ExpiresAt = &expiresAt
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), banTimeout)
+	defer cancel()
+	if err := s.store.AddBan(ctx, ban); err != nil {
+		return nil, fmt.Errorf("error storing ban: %w", err)
+	}
+
+	slog.Info("Ban added", "ban", ban.ID.String(), logging.Session(userId), logging.IP(ip), "reason", reason)
+	return ban, nil
+}
+
+// Remove lifts a ban
+func (s *BanService) Remove(banId uuid.UUID) error {
+	ctx, cancel := context.WithTimeout(context.Background(), banTimeout)
+	defer cancel()
+
+	err := s.store.DeleteBan(ctx, banId)
+	if errors.Is(err, store.ErrNotFound) {
+		return fmt.Errorf("ban not found")
+	}
+	if err != nil {
+		return err
+	}
+	slog.Info("Ban removed", "ban", banId.String())
+	return nil
+}
+
+// List returns the bans in effect, oldest first
+func (s *BanService) List() ([]*models.Ban, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), banTimeout)
+	defer cancel()
+
+	stored, err := s.store.Bans(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	bans := make([]*models.Ban, 0, len(stored))
+	for _, ban := range stored {
+		if !ban.Expired(now) {
+			bans = append(bans, ban)
+		}
+	}
+	return bans, nil
+}
+
+// Find returns the ban applying to the session or the address, nil if there is none
+func (s *BanService) Find(userId uuid.UUID, ip string) (*models.Ban, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), banTimeout)
+	defer cancel()
+
+	ban, err := s.store.FindBan(ctx, userId, ip)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, nil
+	}
+	return ban, err
+}
+
+// purgeExpired removes bans whose duration has passed
+func (s *BanService) purgeExpired(now time.Time) {
+	ctx, cancel := context.WithTimeout(context.Background(), banTimeout)
+	defer cancel()
+
+	if err := s.store.DeleteExpiredBans(ctx, now); err != nil {
+		slog.Error("Error removing expired bans", logging.Err(err))
+	}
+}
@@ -0,0 +1,222 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"realTimeService/broker"
+	"realTimeService/logging"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// DefaultHeartbeatInterval is how often a node refreshes its membership entry
+	DefaultHeartbeatInterval = 3 * time.Second
+	// DefaultNodeTimeout is how long a node may miss heartbeats before it is considered dead
+	DefaultNodeTimeout = 15 * time.Second
+	// clusterNodesKey is the hash of nodeId -> last heartbeat in Unix milliseconds
+	clusterNodesKey = "goroom:nodes"
+	// clusterSessionsKey is the hash of userId -> nodeId holding the session's connection
+	clusterSessionsKey = "goroom:sessions"
+	// clusterTimeout bounds a single membership table operation
+	clusterTimeout = 5 * time.Second
+)
+
+// ClusterService keeps this node's entry in the shared membership table alive,
+// records which node holds each session and detects nodes that went away
+type ClusterService struct {
+	broker            broker.Broker
+	nodeId            string
+	known             map[string]bool // other nodes seen alive, only used by the heartbeat
+	joined            bool
+	onNodeDown        func(nodeId string)
+	heartbeatInterval time.Duration
+	nodeTimeout       time.Duration
+	stop              chan struct{}
+}
+
+// NewClusterService creates a new cluster membership service for the node
+func NewClusterService(b broker.Broker, nodeId string, heartbeatInterval, nodeTimeout time.Duration) *ClusterService {
+	return &ClusterService{
+		broker:            b,
+		nodeId:            nodeId,
+		known:             make(map[string]bool),
+		heartbeatInterval: heartbeatInterval,
+		nodeTimeout:       nodeTimeout,
+		stop:              make(chan struct{}),
+	}
+}
+
+// OnNodeDown sets what to do when another node stops sending heartbeats or leaves the table
+func (c *ClusterService) OnNodeDown(handler func(nodeId string)) {
+	c.onNodeDown = handler
+}
+
+// Start registers the node and runs the heartbeat in the background
+func (c *ClusterService) Start() {
+	c.heartbeat(time.Now())
+
+	go func() {
+		ticker := time.NewTicker(c.heartbeatInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				c.heartbeat(time.Now())
+			case <-c.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop terminates the heartbeat and removes the node from the table,
+// so other nodes end their pairs with its users right away
+func (c *ClusterService) Stop() {
+	close(c.stop)
+
+	ctx, cancel := context.WithTimeout(context.Background(), clusterTimeout)
+	defer cancel()
+	if err := c.broker.DeleteField(ctx, clusterNodesKey, c.nodeId); err != nil {
+		slog.Error("Error leaving cluster", logging.Err(err))
+	}
+}
+
+// RegisterSession records that the user's connection is held by this node
+func (c *ClusterService) RegisterSession(userId uuid.UUID) error {
+	ctx, cancel := context.WithTimeout(context.Background(), clusterTimeout)
+	defer cancel()
+	return c.broker.SetField(ctx, clusterSessionsKey, userId.String(), c.nodeId)
+}
+
+// UnregisterSession forgets the user's session unless another node has taken it over since
+func (c *ClusterService) UnregisterSession(userId uuid.UUID) error {
+	nodeId, err := c.SessionNode(userId)
+	if err != nil || nodeId != c.nodeId {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), clusterTimeout)
+	defer cancel()
+	return c.broker.DeleteField(ctx, clusterSessionsKey, userId.String())
+}
+
+// SessionNode returns the node holding the user's connection, empty if the session is unknown
+func (c *ClusterService) SessionNode(userId uuid.UUID) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), clusterTimeout)
+	defer cancel()
+
+	nodeId, _, err := c.broker.Field(ctx, clusterSessionsKey, userId.String())
+	return nodeId, err
+}
+
+// Nodes returns the nodes in the membership table with their last heartbeat
+func (c *ClusterService) Nodes() (map[string]time.Time, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), clusterTimeout)
+	defer cancel()
+
+	entries, err := c.broker.Fields(ctx, clusterNodesKey)
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := make(map[string]time.Time, len(entries))
+	for nodeId, value := range entries {
+		millis, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			continue
+		}
+		nodes[nodeId] = time.UnixMilli(millis)
+	}
+	return nodes, nil
+}
+
+// heartbeat refreshes this node's entry and handles nodes that went away since the last one
+func (c *ClusterService) heartbeat(now time.Time) {
+	nodes, err := c.Nodes()
+	if err != nil {
+		slog.Error("Error reading cluster membership", logging.Err(err))
+		return
+	}
+
+	// Another node reaped us after missed heartbeats and ended its pairs with our users
+	if _, registered := nodes[c.nodeId]; !registered && c.joined {
+		slog.Warn("Node was missing from the membership table, rejoining", logging.Node(c.nodeId))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), clusterTimeout)
+	defer cancel()
+	err = c.broker.SetField(ctx, clusterNodesKey, c.nodeId, strconv.FormatInt(now.UnixMilli(), 10))
+	if err != nil {
+		slog.Error("Error sending heartbeat", logging.Err(err))
+		return
+	}
+	c.joined = true
+
+	for _, nodeId := range c.detectDown(nodes, now) {
+		slog.Warn("Node is down, cleaning up its sessions and pairs", logging.Node(nodeId))
+		if err := c.reap(nodeId); err != nil {
+			slog.Error("Error cleaning up node", logging.Node(nodeId), logging.Err(err))
+		}
+		if c.onNodeDown != nil {
+			c.onNodeDown(nodeId)
+		}
+	}
+}
+
+// detectDown returns the nodes that timed out or disappeared from the table since the last heartbeat
+func (c *ClusterService) detectDown(nodes map[string]time.Time, now time.Time) []string {
+	var down []string
+	for nodeId, lastSeen := range nodes {
+		if nodeId == c.nodeId {
+			continue
+		}
+		if now.Sub(lastSeen) > c.nodeTimeout {
+			down = append(down, nodeId)
+			delete(c.known, nodeId)
+			continue
+		}
+		c.known[nodeId] = true
+	}
+
+	// A node removed by another node's cleanup or by leaving gracefully is down as well
+	for nodeId := range c.known {
+		if _, ok := nodes[nodeId]; !ok {
+			down = append(down, nodeId)
+			delete(c.known, nodeId)
+		}
+	}
+	return down
+}
+
+// reap removes a dead node and its sessions from the shared tables.
+// Every surviving node may do this, the removals are idempotent.
+func (c *ClusterService) reap(nodeId string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), clusterTimeout)
+	defer cancel()
+
+	if err := c.broker.DeleteField(ctx, clusterNodesKey, nodeId); err != nil {
+		return err
+	}
+
+	sessions, err := c.broker.Fields(ctx, clusterSessionsKey)
+	if err != nil {
+		return err
+	}
+	removed := 0
+	for userId, owner := range sessions {
+		if owner != nodeId {
+			continue
+		}
+		if err := c.broker.DeleteField(ctx, clusterSessionsKey, userId); err != nil {
+			return fmt.Errorf("error removing session %s: %w", userId, err)
+		}
+		removed++
+	}
+
+	slog.Info("Removed node from the membership table", logging.Node(nodeId), "sessions", removed)
+	return nil
+}
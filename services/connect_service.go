@@ -0,0 +1,394 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"log/slog"
+	"realTimeService/broker"
+	"realTimeService/logging"
+	"realTimeService/models"
+	"realTimeService/store"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// DefaultChannelTTL is how long an unused private channel is kept
+	DefaultChannelTTL = 7 * 24 * time.Hour
+	// channelCleanupInterval is how often expired channels are removed
+	channelCleanupInterval = 10 * time.Minute
+	// channelCodeAlphabet leaves out characters that are easy to confuse
+	channelCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+	// channelCodeLength is the number of random characters in a code
+	channelCodeLength = 10
+	// channelWaitingKey is the broker hash of code -> "nodeId|userId" of the member waiting in the channel
+	channelWaitingKey = "goroom:channels:waiting"
+	// channelLockPrefix prefixes the broker lock serializing joins of a channel
+	channelLockPrefix = "goroom:lock:channel:"
+	// channelTimeout bounds a single channel operation including waiting for the lock
+	channelTimeout = 5 * time.Second
+)
+
+// channelWaiter is a user of this node waiting in a private channel
+type channelWaiter struct {
+	code   string
+	client *models.Client
+}
+
+// ConnectService handles strangers agreeing to stay in touch through private channels.
+// Channels are kept in the store, so they survive restarts and can be joined through
+// any node sharing it. Who waits in a channel is kept in the broker.
+type ConnectService struct {
+	store   store.Store
+	broker  broker.Broker
+	nodeId  string
+	pending map[uuid.UUID]uuid.UUID     // pairId -> userId who proposed connecting
+	waiting map[uuid.UUID]channelWaiter // userId -> channel a user of this node waits in
+	ttl     time.Duration
+	stop    chan struct{}
+	mu      sync.Mutex
+}
+
+// NewConnectService creates a new connect service keeping channels in st
+func NewConnectService(st store.Store, b broker.Broker, nodeId string, ttl time.Duration) *ConnectService {
+	return &ConnectService{
+		store:   st,
+		broker:  b,
+		nodeId:  nodeId,
+		pending: make(map[uuid.UUID]uuid.UUID),
+		waiting: make(map[uuid.UUID]channelWaiter),
+		ttl:     ttl,
+		stop:    make(chan struct{}),
+		mu:      sync.Mutex{},
+	}
+}
+
+// SetTTL changes how long an unused private channel is kept
+func (c *ConnectService) SetTTL(ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ttl = ttl
+}
+
+// Start runs the background cleanup of expired channels
+func (c *ConnectService) Start() {
+	go func() {
+		ticker := time.NewTicker(channelCleanupInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				c.purgeExpired(time.Now())
+			case <-c.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop terminates the background cleanup
+func (c *ConnectService) Stop() {
+	close(c.stop)
+}
+
+// Request proposes staying in touch. If the partner already proposed it,
+// this counts as acceptance and the new channel is returned.
+func (c *ConnectService) Request(pair *models.ChatPair, userId uuid.UUID) (*models.PrivateChannel, error) {
+	c.mu.Lock()
+	requester, exists := c.pending[pair.ID]
+	if !exists {
+		c.pending[pair.ID] = userId
+		c.mu.Unlock()
+		return nil, nil
+	}
+	if requester == userId {
+		c.mu.Unlock()
+		return nil, fmt.Errorf("already requested")
+	}
+	// Taking the proposal makes sure only one answer creates a channel
+	delete(c.pending, pair.ID)
+	c.mu.Unlock()
+	return c.establish(pair, requester)
+}
+
+// Respond answers the partner's proposal. Accepting returns the new channel.
+func (c *ConnectService) Respond(pair *models.ChatPair, userId uuid.UUID, accept bool) (*models.PrivateChannel, error) {
+	c.mu.Lock()
+	requester, exists := c.pending[pair.ID]
+	if !exists || requester == userId {
+		c.mu.Unlock()
+		return nil, fmt.Errorf("no request to respond to")
+	}
+	delete(c.pending, pair.ID)
+	c.mu.Unlock()
+
+	if !accept {
+		return nil, nil
+	}
+	return c.establish(pair, requester)
+}
+
+// Requester returns who proposed connecting in the given pair
+func (c *ConnectService) Requester(pairId uuid.UUID) (uuid.UUID, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	requester, exists := c.pending[pairId]
+	return requester, exists
+}
+
+// Join enters a private channel by code. If the other member is already
+// waiting they are returned so both can be paired, as a remote client if they
+// wait on another node; otherwise the client waits. Only the two members can
+// join, anyone else is told the channel doesn't exist.
+func (c *ConnectService) Join(code string, client *models.Client) (*models.Client, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), channelTimeout)
+	defer cancel()
+
+	code = normalizeChannelCode(code)
+	channel, err := c.store.Channel(ctx, code)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, fmt.Errorf("channel not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading channel: %w", err)
+	}
+	c.mu.Lock()
+	ttl := c.ttl
+	c.mu.Unlock()
+	if time.Since(channel.LastUsedAt) > ttl || !channel.IsMember(client.UserId) {
+		return nil, fmt.Errorf("channel not found")
+	}
+
+	if err := c.leave(ctx, client.UserId); err != nil {
+		return nil, err
+	}
+
+	unlock, err := c.broker.Lock(ctx, channelLockPrefix+code, channelTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("error locking channel: %w", err)
+	}
+	defer unlock()
+
+	channel.LastUsedAt = time.Now()
+	if err := c.store.SaveChannel(ctx, channel); err != nil {
+		return nil, fmt.Errorf("error saving channel: %w", err)
+	}
+
+	partner, err := c.takeWaiting(ctx, code, client.UserId)
+	if err != nil {
+		return nil, err
+	}
+	if partner == nil {
+		c.mu.Lock()
+		c.waiting[client.UserId] = channelWaiter{code: code, client: client}
+		c.mu.Unlock()
+		if err := c.broker.SetField(ctx, channelWaitingKey, code, c.nodeId+"|"+client.UserId.String()); err != nil {
+			c.mu.Lock()
+			delete(c.waiting, client.UserId)
+			c.mu.Unlock()
+			return nil, fmt.Errorf("error waiting in channel: %w", err)
+		}
+		return nil, nil
+	}
+
+	// The code is a secret of the members, so it stays out of the logs
+	slog.Info("Private channel rejoined", logging.Session(client.UserId), "partner", partner.UserId.String())
+	return partner, nil
+}
+
+// takeWaiting takes the other member out of the channel if they wait in it, nil if
+// nobody does. The caller must hold the channel lock.
+func (c *ConnectService) takeWaiting(ctx context.Context, code string, userId uuid.UUID) (*models.Client, error) {
+	entry, ok, err := c.broker.Field(ctx, channelWaitingKey, code)
+	if err != nil {
+		return nil, fmt.Errorf("error reading channel: %w", err)
+	}
+	if !ok {
+		return nil, nil
+	}
+	if err := c.broker.DeleteField(ctx, channelWaitingKey, code); err != nil {
+		return nil, fmt.Errorf("error leaving channel: %w", err)
+	}
+
+	nodeId, id, _ := strings.Cut(entry, "|")
+	waitingId, err := uuid.Parse(id)
+	if err != nil || waitingId == userId {
+		return nil, nil
+	}
+	if nodeId != c.nodeId {
+		return models.NewRemoteClient(waitingId, nodeId), nil
+	}
+
+	// A user of this node who left in the meantime doesn't count
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	waiter, ok := c.waiting[waitingId]
+	if !ok || waiter.code != code {
+		return nil, nil
+	}
+	delete(c.waiting, waitingId)
+	return waiter.client, nil
+}
+
+// Claim takes a user of this node out of the channel they wait in, for a pair
+// another node created when the other member joined. Nil if they aren't waiting.
+func (c *ConnectService) Claim(userId uuid.UUID) *models.Client {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	waiter, ok := c.waiting[userId]
+	if !ok {
+		return nil
+	}
+	delete(c.waiting, userId)
+	return waiter.client
+}
+
+// Leave stops the user from waiting in a private channel and withdraws the
+// proposals they made
+func (c *ConnectService) Leave(userId uuid.UUID) {
+	ctx, cancel := context.WithTimeout(context.Background(), channelTimeout)
+	defer cancel()
+	if err := c.leave(ctx, userId); err != nil {
+		slog.Error("Error leaving private channel", logging.Session(userId), logging.Err(err))
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for pairId, requester := range c.pending {
+		if requester == userId {
+			delete(c.pending, pairId)
+		}
+	}
+}
+
+// leave removes a user of this node from the channel they wait in
+func (c *ConnectService) leave(ctx context.Context, userId uuid.UUID) error {
+	c.mu.Lock()
+	waiter, ok := c.waiting[userId]
+	delete(c.waiting, userId)
+	c.mu.Unlock()
+	if !ok {
+		return nil
+	}
+
+	unlock, err := c.broker.Lock(ctx, channelLockPrefix+waiter.code, channelTimeout)
+	if err != nil {
+		return fmt.Errorf("error locking channel: %w", err)
+	}
+	defer unlock()
+
+	entry, ok, err := c.broker.Field(ctx, channelWaitingKey, waiter.code)
+	if err != nil || !ok || entry != c.nodeId+"|"+userId.String() {
+		return err
+	}
+	return c.broker.DeleteField(ctx, channelWaitingKey, waiter.code)
+}
+
+// RemoveNode drops the users of a node that went down from the channels they wait in
+func (c *ConnectService) RemoveNode(nodeId string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), channelTimeout)
+	defer cancel()
+
+	entries, err := c.broker.Fields(ctx, channelWaitingKey)
+	if err != nil {
+		return fmt.Errorf("error reading channels: %w", err)
+	}
+	for code, entry := range entries {
+		if !strings.HasPrefix(entry, nodeId+"|") {
+			continue
+		}
+		if err := c.broker.DeleteField(ctx, channelWaitingKey, code); err != nil {
+			return fmt.Errorf("error leaving channel: %w", err)
+		}
+	}
+	return nil
+}
+
+// Rebind puts the client a session resumed on in place of its previous one
+// in the channel the user waits in
+func (c *ConnectService) Rebind(client *models.Client) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if waiter, ok := c.waiting[client.UserId]; ok {
+		waiter.client = client
+		c.waiting[client.UserId] = waiter
+	}
+}
+
+// ForgetPair drops an unanswered proposal of an ended pair
+func (c *ConnectService) ForgetPair(pairId uuid.UUID) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.pending, pairId)
+}
+
+// establish creates and stores the channel for a mutually accepted proposal.
+// If that fails the proposal of the requester stands.
+func (c *ConnectService) establish(pair *models.ChatPair, requester uuid.UUID) (*models.PrivateChannel, error) {
+	channel, err := c.create(pair)
+	if err != nil {
+		c.mu.Lock()
+		c.pending[pair.ID] = requester
+		c.mu.Unlock()
+		return nil, err
+	}
+	slog.Info("Private channel created", logging.Pair(pair.ID))
+	return channel, nil
+}
+
+// create stores a new channel for the users of the pair
+func (c *ConnectService) create(pair *models.ChatPair) (*models.PrivateChannel, error) {
+	code, err := newChannelCode()
+	if err != nil {
+		return nil, err
+	}
+
+	ids := pair.UserIds()
+	channel := models.NewPrivateChannel(code, ids[0], ids[1])
+	ctx, cancel := context.WithTimeout(context.Background(), channelTimeout)
+	defer cancel()
+	if err := c.store.SaveChannel(ctx, channel); err != nil {
+		return nil, fmt.Errorf("error saving channel: %w", err)
+	}
+	return channel, nil
+}
+
+// purgeExpired removes channels nobody used within the TTL
+func (c *ConnectService) purgeExpired(now time.Time) {
+	c.mu.Lock()
+	ttl := c.ttl
+	c.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), channelTimeout)
+	defer cancel()
+	if err := c.store.DeleteChannels(ctx, now.Add(-ttl)); err != nil {
+		slog.Error("Error deleting expired channels", logging.Err(err))
+	}
+}
+
+// newChannelCode generates a random code formatted as XXXXX-XXXXX
+func newChannelCode() (string, error) {
+	buf := make([]byte, channelCodeLength)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("error generating channel code: %w", err)
+	}
+
+	var sb strings.Builder
+	for i, b := range buf {
+		if i == channelCodeLength/2 {
+			sb.WriteByte('-')
+		}
+		sb.WriteByte(channelCodeAlphabet[int(b)%len(channelCodeAlphabet)])
+	}
+	return sb.String(), nil
+}
+
+// normalizeChannelCode accepts codes typed in lower case or with surrounding spaces
+func normalizeChannelCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
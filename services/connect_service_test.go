@@ -0,0 +1,69 @@
+package services
+
+import (
+	"realTimeService/broker"
+	"realTimeService/models"
+	"realTimeService/store"
+	"testing"
+)
+
+// newChannel has the users of a new pair agree to stay in touch through node
+func newChannel(t *testing.T, node *ConnectService, user1, user2 *models.Client) *models.PrivateChannel {
+	t.Helper()
+	pair := models.NewChatPair(user1, user2)
+	if _, err := node.Request(pair, user1.UserId); err != nil {
+		t.Fatalf("Request: %v", err)
+	}
+	channel, err := node.Request(pair, user2.UserId)
+	if err != nil || channel == nil {
+		t.Fatalf("Request = %v, %v, want the new channel", channel, err)
+	}
+	return channel
+}
+
+func TestConnectServiceJoinsChannelsAcrossNodes(t *testing.T) {
+	st, b := store.NewMemoryStore(), broker.NewMemoryBroker()
+	node1 := NewConnectService(st, b, "node-1", DefaultChannelTTL)
+	node2 := NewConnectService(st, b, "node-2", DefaultChannelTTL)
+	user1, user2 := newBenchClient(), newBenchClient()
+	channel := newChannel(t, node1, user1, user2)
+
+	if partner, err := node1.Join(channel.Code, user1); err != nil || partner != nil {
+		t.Fatalf("Join = %v, %v, want to wait", partner, err)
+	}
+	partner, err := node2.Join(channel.Code, user2)
+	if err != nil || partner == nil || partner.UserId != user1.UserId || partner.NodeId != "node-1" {
+		t.Fatalf("Join = %+v, %v, want the member waiting on node-1", partner, err)
+	}
+	if claimed := node1.Claim(user1.UserId); claimed != user1 {
+		t.Fatalf("Claim = %v, want the waiting member", claimed)
+	}
+}
+
+func TestConnectServiceKeepsChannelsAcrossRestarts(t *testing.T) {
+	st, b := store.NewMemoryStore(), broker.NewMemoryBroker()
+	user1, user2 := newBenchClient(), newBenchClient()
+	channel := newChannel(t, NewConnectService(st, b, "node-1", DefaultChannelTTL), user1, user2)
+
+	restarted := NewConnectService(st, broker.NewMemoryBroker(), "node-1", DefaultChannelTTL)
+	if _, err := restarted.Join(channel.Code, user1); err != nil {
+		t.Fatalf("Join after a restart: %v", err)
+	}
+	if partner, err := restarted.Join(channel.Code, user2); err != nil || partner != user1 {
+		t.Fatalf("Join = %v, %v, want the waiting member", partner, err)
+	}
+}
+
+func TestConnectServiceLeaveWithdrawsProposal(t *testing.T) {
+	node := NewConnectService(store.NewMemoryStore(), broker.NewMemoryBroker(), "node-1", DefaultChannelTTL)
+	user1, user2 := newBenchClient(), newBenchClient()
+	pair := models.NewChatPair(user1, user2)
+	if _, err := node.Request(pair, user1.UserId); err != nil {
+		t.Fatalf("Request: %v", err)
+	}
+
+	node.Leave(user1.UserId)
+	if _, pending := node.Requester(pair.ID); pending {
+		t.Fatal("proposal still pending after the proposer left")
+	}
+}
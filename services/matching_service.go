@@ -1,97 +1,209 @@
 package services
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"realTimeService/events"
+	"realTimeService/logging"
 	"realTimeService/models"
-	"sync"
+	"realTimeService/tracing"
+	"sync/atomic"
 
 	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
-// MatchingService handles pairing users for anonymous chats
+// ReputationSource provides the scores the matcher uses to pair users of similar reputation
+type ReputationSource interface {
+	Score(userId uuid.UUID) float64
+}
+
+// MatchingService handles pairing users for anonymous chats.
+//
+// The waiting queue and the pair index lock independently and the service never
+// holds a lock of one while calling into the other. Callers such as the hub must
+// not hold their own locks while calling the service, so the service is always
+// the innermost lock holder.
 type MatchingService struct {
-	waitingQueue []*models.Client
-	activePairs  map[uuid.UUID]*models.ChatPair
-	userToPair   map[uuid.UUID]uuid.UUID // userId -> pairId mapping
-	mu           sync.RWMutex
+	queue  WaitingQueue
+	pairs  *pairIndex
+	paused atomic.Bool // set while matching is turned off for maintenance
+	events *events.Bus // nil unless SetEvents was called
 }
 
+// ErrMatchingPaused is returned by FindMatch while matching is turned off
+var ErrMatchingPaused = errors.New("matching is paused for maintenance")
+
 // NewMatchingService creates a new matching service
-func NewMatchingService() *MatchingService {
+func NewMatchingService(queue WaitingQueue) *MatchingService {
 	return &MatchingService{
-		waitingQueue: make([]*models.Client, 0),
-		activePairs:  make(map[uuid.UUID]*models.ChatPair),
-		userToPair:   make(map[uuid.UUID]uuid.UUID),
-		mu:           sync.RWMutex{},
+		queue: queue,
+		pairs: newPairIndex(),
 	}
 }
 
-// FindMatch tries to find a partner for the given client
+// SetEnabled turns matching on or off. Existing pairs and waiting users are unaffected.
+func (m *MatchingService) SetEnabled(enabled bool) {
+	m.paused.Store(!enabled)
+}
+
+// SetEvents sets the bus that users queueing and getting matched are published on.
+// Must be called before the service is used.
+func (m *MatchingService) SetEvents(bus *events.Bus) {
+	m.events = bus
+}
+
+// Enabled reports whether new matches can be made
+func (m *MatchingService) Enabled() bool {
+	return !m.paused.Load()
+}
+
+// FindMatch tries to find a partner for the given client, traced as part of ctx
 // Returns the created pair if match found, nil if added to queue
-func (m *MatchingService) FindMatch(client *models.Client) (*models.ChatPair, error) {
-	m.mu.Lock()
-	defer m.mu.Unlock()
+func (m *MatchingService) FindMatch(ctx context.Context, client *models.Client) (pair *models.ChatPair, err error) {
+	_, span := tracing.Tracer().Start(ctx, "MatchingService.FindMatch",
+		trace.WithAttributes(tracing.Session(client.UserId)))
+	defer func() {
+		span.SetAttributes(attribute.Bool("matched", pair != nil))
+		if pair != nil {
+			span.SetAttributes(tracing.Pair(pair.ID))
+		}
+		tracing.End(span, err)
+	}()
+
+	return m.findMatch(client)
+}
+
+func (m *MatchingService) findMatch(client *models.Client) (*models.ChatPair, error) {
+	if m.paused.Load() {
+		return nil, ErrMatchingPaused
+	}
 
 	// Check if user is already in a pair
-	if pairId, exists := m.userToPair[client.UserId]; exists {
-		if pair, ok := m.activePairs[pairId]; ok && pair.Active {
-			return nil, fmt.Errorf("user already in active chat")
-		}
+	if m.hasActivePair(client.UserId) {
+		return nil, fmt.Errorf("user already in active chat")
 	}
 
-	// If no one is waiting, add to queue
-	if len(m.waitingQueue) == 0 {
-		m.waitingQueue = append(m.waitingQueue, client)
-		log.Printf("User %s added to waiting queue", client.UserId)
+	// Take a partner from the queue, or wait in it
+	stranger, err := m.queue.Match(client)
+	if err != nil {
+		return nil, err
+	}
+	if stranger == nil {
+		m.events.Publish(events.Queued{UserId: client.UserId})
 		return nil, nil // nil means waiting for match
 	}
 
-	// Take first person from queue
-	stranger := m.waitingQueue[0]
-	m.waitingQueue = m.waitingQueue[1:]
+	// Create pair
+	pair := models.NewChatPair(client, stranger)
+	if !m.pairs.add(pair) {
+		// The stranger left the queue for this match, so they wait on unless
+		// they were paired in the meantime
+		if !m.hasActivePair(stranger.UserId) {
+			if err := m.queue.Requeue(stranger); err != nil {
+				slog.Error("Error putting stranger back in queue", logging.Session(stranger.UserId), logging.Err(err))
+			}
+		}
+		return nil, fmt.Errorf("user already in active chat")
+	}
 
-	// Don't match with yourself
-	if stranger.UserId == client.UserId {
-		m.waitingQueue = append(m.waitingQueue, client)
-		return nil, nil
+	slog.Info("Matched users", logging.Pair(pair.ID), logging.Session(client.UserId), "partner", stranger.UserId.String())
+	m.events.Publish(events.Matched{PairId: pair.ID, UserIds: [2]uuid.UUID{client.UserId, stranger.UserId}})
+	return pair, nil
+}
+
+// CreatePair pairs two specific users directly, bypassing the waiting queue,
+// such as the members of a private channel
+func (m *MatchingService) CreatePair(user1, user2 *models.Client) (*models.ChatPair, error) {
+	pair := models.NewChatPair(user1, user2)
+	if !m.pairs.add(pair) {
+		return nil, fmt.Errorf("user already in active chat")
 	}
 
-	// Create pair
-	pair := models.NewChatPair(client, stranger)
-	m.activePairs[pair.ID] = pair
-	m.userToPair[client.UserId] = pair.ID
-	m.userToPair[stranger.UserId] = pair.ID
+	for _, user := range []*models.Client{user1, user2} {
+		if err := m.queue.Remove(user.UserId); err != nil {
+			slog.Error("Error removing user from waiting queue", logging.Session(user.UserId), logging.Err(err))
+		}
+	}
 
-	log.Printf("Matched users %s and %s in pair %s", client.UserId, stranger.UserId, pair.ID)
+	slog.Info("Paired users directly", logging.Pair(pair.ID), logging.Session(user1.UserId), "partner", user2.UserId.String())
+	m.events.Publish(events.Matched{
+		PairId:         pair.ID,
+		UserIds:        [2]uuid.UUID{user1.UserId, user2.UserId},
+		PrivateChannel: true,
+	})
 	return pair, nil
 }
 
+// Claim takes a user waiting on this node out of the queue, nil if they aren't waiting
+func (m *MatchingService) Claim(userId uuid.UUID) *models.Client {
+	return m.queue.Claim(userId)
+}
+
+// AdoptPair registers a pair that another node created for a user of this node,
+// who was claimed from the queue or a private channel. Fails if the user stopped
+// waiting in the meantime, which leaves client nil.
+func (m *MatchingService) AdoptPair(pairId uuid.UUID, client *models.Client, partner *models.Client, nodeId string) (*models.ChatPair, error) {
+	if client == nil {
+		return nil, fmt.Errorf("user is no longer waiting")
+	}
+	userId := client.UserId
+
+	pair := models.NewChatPair(partner, client)
+	pair.ID = pairId
+	pair.NodeId = nodeId
+	if !m.pairs.add(pair) {
+		return nil, fmt.Errorf("user already in active chat")
+	}
+
+	slog.Info("User joined pair owned by another node", logging.Session(userId), logging.Pair(pairId), logging.Node(nodeId))
+	return pair, nil
+}
+
+// Rebind puts the client a session resumed on in place of its previous one,
+// in the user's pair or queue entry
+func (m *MatchingService) Rebind(client *models.Client) {
+	if pair, err := m.GetPair(client.UserId); err == nil {
+		pair.Rebind(client)
+	}
+	m.queue.Rebind(client)
+}
+
 // RemoveFromQueue removes a client from the waiting queue
 func (m *MatchingService) RemoveFromQueue(userId uuid.UUID) {
-	m.mu.Lock()
-	defer m.mu.Unlock()
-
-	for i, client := range m.waitingQueue {
-		if client.UserId == userId {
-			m.waitingQueue = append(m.waitingQueue[:i], m.waitingQueue[i+1:]...)
-			log.Printf("User %s removed from waiting queue", userId)
-			return
-		}
+	if err := m.queue.Remove(userId); err != nil {
+		slog.Error("Error removing user from waiting queue", logging.Session(userId), logging.Err(err))
 	}
 }
 
+// RemoveNodeFromQueue drops the queue entries of users waiting on a node that went down
+func (m *MatchingService) RemoveNodeFromQueue(nodeId string) {
+	if err := m.queue.RemoveNode(nodeId); err != nil {
+		slog.Error("Error removing users of a node from waiting queue", logging.Node(nodeId), logging.Err(err))
+	}
+}
+
+// hasActivePair reports whether the user is in an active pair
+func (m *MatchingService) hasActivePair(userId uuid.UUID) bool {
+	pairId, exists := m.pairs.userPairId(userId)
+	if !exists {
+		return false
+	}
+	_, ok := m.pairs.get(pairId)
+	return ok
+}
+
 // GetPair returns the active pair for the given user
 func (m *MatchingService) GetPair(userId uuid.UUID) (*models.ChatPair, error) {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
-
-	pairId, exists := m.userToPair[userId]
+	pairId, exists := m.pairs.userPairId(userId)
 	if !exists {
 		return nil, fmt.Errorf("user not in any pair")
 	}
 
-	pair, ok := m.activePairs[pairId]
+	pair, ok := m.pairs.get(pairId)
 	if !ok {
 		return nil, fmt.Errorf("pair not found")
 	}
@@ -101,10 +213,7 @@ func (m *MatchingService) GetPair(userId uuid.UUID) (*models.ChatPair, error) {
 
 // GetPairById returns a pair by its ID
 func (m *MatchingService) GetPairById(pairId uuid.UUID) (*models.ChatPair, error) {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
-
-	pair, ok := m.activePairs[pairId]
+	pair, ok := m.pairs.get(pairId)
 	if !ok {
 		return nil, fmt.Errorf("pair not found")
 	}
@@ -114,57 +223,63 @@ func (m *MatchingService) GetPairById(pairId uuid.UUID) (*models.ChatPair, error
 
 // EndPair closes a pair and removes both users from mapping
 func (m *MatchingService) EndPair(pairId uuid.UUID) error {
-	m.mu.Lock()
-	defer m.mu.Unlock()
-
-	pair, ok := m.activePairs[pairId]
-	if !ok {
+	pair := m.pairs.remove(pairId)
+	if pair == nil {
 		return fmt.Errorf("pair not found")
 	}
-
 	pair.Close()
-	delete(m.userToPair, pair.User1.UserId)
-	delete(m.userToPair, pair.User2.UserId)
-	delete(m.activePairs, pairId)
 
-	log.Printf("Pair %s ended", pairId)
+	slog.Info("Pair ended", logging.Pair(pairId))
 	return nil
 }
 
 // EndUserPair ends the pair that the user is currently in
 func (m *MatchingService) EndUserPair(userId uuid.UUID) error {
-	m.mu.Lock()
-	defer m.mu.Unlock()
-
-	pairId, exists := m.userToPair[userId]
+	pairId, exists := m.pairs.userPairId(userId)
 	if !exists {
 		return fmt.Errorf("user not in any pair")
 	}
 
-	pair, ok := m.activePairs[pairId]
-	if !ok {
+	pair := m.pairs.remove(pairId)
+	if pair == nil {
 		return fmt.Errorf("pair not found")
 	}
-
 	pair.Close()
-	delete(m.userToPair, pair.User1.UserId)
-	delete(m.userToPair, pair.User2.UserId)
-	delete(m.activePairs, pairId)
 
-	log.Printf("Pair %s ended by user %s", pairId, userId)
+	slog.Info("Pair ended by user", logging.Pair(pairId), logging.Session(userId))
 	return nil
 }
 
-// GetQueueSize returns the number of users waiting for a match
+// GetNodePairs returns the active pairs with a user connected to the given node
+func (m *MatchingService) GetNodePairs(nodeId string) []*models.ChatPair {
+	return m.pairs.filter(func(pair *models.ChatPair) bool {
+		users := pair.Users()
+		return users[0].NodeId == nodeId || users[1].NodeId == nodeId
+	})
+}
+
+// GetPairs returns the active pairs known to this node
+func (m *MatchingService) GetPairs() []*models.ChatPair {
+	return m.pairs.filter(func(pair *models.ChatPair) bool { return true })
+}
+
+// GetWaitingUsers returns the users waiting for a match on this node
+func (m *MatchingService) GetWaitingUsers() []uuid.UUID {
+	return m.queue.Waiting()
+}
+
+// QueueShared reports whether users wait in a queue shared by every node
+func (m *MatchingService) QueueShared() bool {
+	_, shared := m.queue.(*SharedQueue)
+	return shared
+}
+
+// GetQueueSize returns the number of users waiting for a match on this node
 func (m *MatchingService) GetQueueSize() int {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
-	return len(m.waitingQueue)
+	return m.queue.Len()
 }
 
 // GetActivePairsCount returns the number of active pairs
 func (m *MatchingService) GetActivePairsCount() int {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
-	return len(m.activePairs)
+	return m.pairs.count()
 }
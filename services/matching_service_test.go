@@ -0,0 +1,169 @@
+package services
+
+import (
+	"context"
+	"flag"
+	"log/slog"
+	"math/rand/v2"
+	"realTimeService/broker"
+	"realTimeService/models"
+	"realTimeService/store"
+	"runtime"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// benchClients is about how many clients use the matching service at once:
+//
+//	go test ./services -run '^$' -bench . -clients 50000
+var benchClients = flag.Int("clients", 20000, "number of concurrent clients in benchmarks")
+
+// benchQueues creates the waiting queues every benchmark runs against
+var benchQueues = []struct {
+	name     string
+	newQueue func(reputation ReputationSource) WaitingQueue
+}{
+	{"local", func(reputation ReputationSource) WaitingQueue { return NewLocalQueue(reputation) }},
+	{"shared", func(reputation ReputationSource) WaitingQueue {
+		return NewSharedQueue(broker.NewMemoryBroker(), "bench", reputation)
+	}},
+}
+
+// benchmarkQueues runs the body once per waiting queue with a fresh matching service
+func benchmarkQueues(b *testing.B, body func(b *testing.B, matcher *MatchingService, clients int)) {
+	// The services log every match, which would dominate the results
+	logger := slog.Default()
+	slog.SetDefault(slog.New(slog.DiscardHandler))
+	b.Cleanup(func() { slog.SetDefault(logger) })
+
+	for _, queue := range benchQueues {
+		b.Run(queue.name, func(b *testing.B) {
+			reputation := NewReputationService(store.NewMemoryStore(),
+				DefaultReputationHalfLife, DefaultRatingWindow)
+			b.ReportAllocs()
+			body(b, NewMatchingService(queue.newQueue(reputation)), *benchClients)
+		})
+	}
+}
+
+// runParallel runs the body from about the given number of goroutines at once
+func runParallel(b *testing.B, clients int, body func(pb *testing.PB)) {
+	b.SetParallelism(max(1, clients/runtime.GOMAXPROCS(0)))
+	b.ResetTimer()
+	b.RunParallel(body)
+}
+
+// newBenchClient creates a client without a connection
+func newBenchClient() *models.Client {
+	return models.NewClient(uuid.New(), nil, nil)
+}
+
+// pairUp creates half as many pairs as there are clients
+func pairUp(b *testing.B, matcher *MatchingService, clients int) []*models.ChatPair {
+	pairs := make([]*models.ChatPair, 0, clients/2)
+	for range max(1, clients/2) {
+		pair, err := matcher.CreatePair(newBenchClient(), newBenchClient())
+		if err != nil {
+			b.Fatal(err)
+		}
+		pairs = append(pairs, pair)
+	}
+	return pairs
+}
+
+// BenchmarkFindMatchAndEnd has clients search for a stranger and end the chat once matched
+func BenchmarkFindMatchAndEnd(b *testing.B) {
+	benchmarkQueues(b, func(b *testing.B, matcher *MatchingService, clients int) {
+		runParallel(b, clients, func(pb *testing.PB) {
+			for pb.Next() {
+				pair, err := matcher.FindMatch(context.Background(), newBenchClient())
+				if err != nil {
+					b.Error(err)
+					return
+				}
+				if pair != nil {
+					matcher.EndPair(pair.ID)
+				}
+			}
+		})
+	})
+}
+
+// BenchmarkSearchAndCancel has clients start searching and give up right away
+func BenchmarkSearchAndCancel(b *testing.B) {
+	benchmarkQueues(b, func(b *testing.B, matcher *MatchingService, clients int) {
+		runParallel(b, clients, func(pb *testing.PB) {
+			for pb.Next() {
+				client := newBenchClient()
+				pair, err := matcher.FindMatch(context.Background(), client)
+				if err != nil {
+					b.Error(err)
+					return
+				}
+				if pair != nil {
+					matcher.EndPair(pair.ID)
+					continue
+				}
+				matcher.RemoveFromQueue(client.UserId)
+			}
+		})
+	})
+}
+
+// BenchmarkGetPair looks up the pairs of random users, as every chat message does
+func BenchmarkGetPair(b *testing.B) {
+	benchmarkQueues(b, func(b *testing.B, matcher *MatchingService, clients int) {
+		pairs := pairUp(b, matcher, clients)
+		runParallel(b, clients, func(pb *testing.PB) {
+			for pb.Next() {
+				pair := pairs[rand.IntN(len(pairs))]
+				if _, err := matcher.GetPair(pair.User1.UserId); err != nil {
+					b.Error(err)
+					return
+				}
+			}
+		})
+	})
+}
+
+// BenchmarkGetPairById looks up random pairs by ID
+func BenchmarkGetPairById(b *testing.B) {
+	benchmarkQueues(b, func(b *testing.B, matcher *MatchingService, clients int) {
+		pairs := pairUp(b, matcher, clients)
+		runParallel(b, clients, func(pb *testing.PB) {
+			for pb.Next() {
+				if _, err := matcher.GetPairById(pairs[rand.IntN(len(pairs))].ID); err != nil {
+					b.Error(err)
+					return
+				}
+			}
+		})
+	})
+}
+
+// BenchmarkChatSession mixes the calls of a whole chat: matching, a few messages and leaving.
+// One op is one call to the service.
+func BenchmarkChatSession(b *testing.B) {
+	const messagesPerChat = 8
+
+	benchmarkQueues(b, func(b *testing.B, matcher *MatchingService, clients int) {
+		runParallel(b, clients, func(pb *testing.PB) {
+			client := newBenchClient()
+			for pb.Next() {
+				pair, err := matcher.GetPair(client.UserId)
+				if err != nil {
+					// Not chatting yet, look for someone. Another client may match
+					// this one in the meantime, which FindMatch reports as an error.
+					matcher.FindMatch(context.Background(), client)
+					continue
+				}
+
+				if rand.IntN(messagesPerChat) == 0 {
+					matcher.EndPair(pair.ID)
+				}
+			}
+			matcher.RemoveFromQueue(client.UserId)
+		})
+	})
+}
@@ -0,0 +1,234 @@
+package services
+
+import (
+	"fmt"
+	"maps"
+	"realTimeService/models"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// DefaultMessageHistorySize is how many recent messages per pair can be replied to, edited or deleted
+	DefaultMessageHistorySize = 200
+	// DefaultMessageEditWindow is how long after sending a message its sender may edit or delete it
+	DefaultMessageEditWindow = 5 * time.Minute
+)
+
+// AllowedReactions lists the emoji users may react to messages with
+var AllowedReactions = []string{"👍", "❤️", "😂", "😮", "😢", "😡"}
+
+// pairHistory holds the recent messages of one pair in sending order
+type pairHistory struct {
+	messages  map[uuid.UUID]*models.Message
+	reactions map[uuid.UUID]map[uuid.UUID]string // messageId -> userId -> reaction
+	order     []uuid.UUID
+}
+
+// MessageService keeps a bounded history of recent messages per pair
+// so they can be referenced by ID
+type MessageService struct {
+	histories   map[uuid.UUID]*pairHistory // pairId -> history
+	historySize int
+	editWindow  time.Duration
+	mu          sync.RWMutex
+}
+
+// NewMessageService creates a new message service
+func NewMessageService(historySize int, editWindow time.Duration) *MessageService {
+	return &MessageService{
+		histories:   make(map[uuid.UUID]*pairHistory),
+		historySize: historySize,
+		editWindow:  editWindow,
+		mu:          sync.RWMutex{},
+	}
+}
+
+// SetLimits changes the history size and edit window. A smaller history is
+// trimmed as messages are sent.
+func (s *MessageService) SetLimits(historySize int, editWindow time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.historySize = historySize
+	s.editWindow = editWindow
+}
+
+// HistorySize returns how many recent messages per pair are kept
+func (s *MessageService) HistorySize() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.historySize
+}
+
+// EditWindow returns how long after sending a message it may be changed
+func (s *MessageService) EditWindow() time.Duration {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.editWindow
+}
+
+// Register stores a copy of a sent message in its pair's history
+func (s *MessageService) Register(message *models.Message) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	history, ok := s.histories[message.PairId]
+	if !ok {
+		history = &pairHistory{
+			messages:  make(map[uuid.UUID]*models.Message),
+			reactions: make(map[uuid.UUID]map[uuid.UUID]string),
+		}
+		s.histories[message.PairId] = history
+	}
+
+	stored := *message
+	stored.ClientId = ""
+	history.messages[message.ID] = &stored
+	history.order = append(history.order, message.ID)
+
+	// Drop the oldest messages once the history is full
+	for len(history.order) > s.historySize {
+		delete(history.messages, history.order[0])
+		delete(history.reactions, history.order[0])
+		history.order = history.order[1:]
+	}
+}
+
+// Get returns a copy of a message from the pair's history
+func (s *MessageService) Get(pairId, messageId uuid.UUID) (*models.Message, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	message, err := s.find(pairId, messageId)
+	if err != nil {
+		return nil, err
+	}
+	copied := *message
+	return &copied, nil
+}
+
+// Edit changes the text of a message. Only its sender may edit it, within the edit window.
+func (s *MessageService) Edit(pairId, messageId, userId uuid.UUID, text string) (*models.Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	message, err := s.findOwn(pairId, messageId, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	editedAt := time.Now()
+	message.Text = text
+	message.EditedAt = &editedAt
+
+	copied := *message
+	return &copied, nil
+}
+
+// Delete removes a message from the history. Only its sender may delete it, within the edit window.
+func (s *MessageService) Delete(pairId, messageId, userId uuid.UUID) (*models.Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	message, err := s.findOwn(pairId, messageId, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	history := s.histories[pairId]
+	delete(history.messages, messageId)
+	delete(history.reactions, messageId)
+	for i, id := range history.order {
+		if id == messageId {
+			history.order = append(history.order[:i], history.order[i+1:]...)
+			break
+		}
+	}
+	return message, nil
+}
+
+// React sets the user's reaction to a message, replacing any previous one.
+// An empty reaction removes it. Returns every user's reaction to the message.
+func (s *MessageService) React(pairId, messageId, userId uuid.UUID, reaction string) (map[uuid.UUID]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if reaction != "" && !slices.Contains(AllowedReactions, reaction) {
+		return nil, fmt.Errorf("reaction not allowed")
+	}
+	if _, err := s.find(pairId, messageId); err != nil {
+		return nil, err
+	}
+
+	history := s.histories[pairId]
+	reactions, ok := history.reactions[messageId]
+	if !ok {
+		reactions = make(map[uuid.UUID]string)
+		history.reactions[messageId] = reactions
+	}
+
+	// One reaction per user per message
+	if reaction == "" {
+		delete(reactions, userId)
+	} else {
+		reactions[userId] = reaction
+	}
+
+	return maps.Clone(reactions), nil
+}
+
+// Recent returns copies of the last messages of the pair, oldest first
+func (s *MessageService) Recent(pairId uuid.UUID, count int) []*models.Message {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	history, ok := s.histories[pairId]
+	if !ok {
+		return nil
+	}
+	order := history.order[max(0, len(history.order)-count):]
+	messages := make([]*models.Message, 0, len(order))
+	for _, messageId := range order {
+		copied := *history.messages[messageId]
+		messages = append(messages, &copied)
+	}
+	return messages
+}
+
+// ForgetPair drops the history of an ended pair
+func (s *MessageService) ForgetPair(pairId uuid.UUID) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.histories, pairId)
+}
+
+// find looks up a message, the caller must hold the lock
+func (s *MessageService) find(pairId, messageId uuid.UUID) (*models.Message, error) {
+	history, ok := s.histories[pairId]
+	if !ok {
+		return nil, fmt.Errorf("message not found")
+	}
+	message, ok := history.messages[messageId]
+	if !ok {
+		return nil, fmt.Errorf("message not found")
+	}
+	return message, nil
+}
+
+// findOwn looks up a message the user may still change, the caller must hold the lock
+func (s *MessageService) findOwn(pairId, messageId, userId uuid.UUID) (*models.Message, error) {
+	message, err := s.find(pairId, messageId)
+	if err != nil {
+		return nil, err
+	}
+	if message.UserId != userId {
+		return nil, fmt.Errorf("only the sender can change this message")
+	}
+	if time.Since(message.Timestamp) > s.editWindow {
+		return nil, fmt.Errorf("message can no longer be changed")
+	}
+	return message, nil
+}
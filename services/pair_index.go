@@ -0,0 +1,156 @@
+package services
+
+import (
+	"encoding/binary"
+	"realTimeService/models"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// pairShardCount is the number of independently locked shards, a power of two
+const pairShardCount = 64
+
+// pairShard holds the pairs and user entries whose IDs hash to it
+type pairShard struct {
+	pairs map[uuid.UUID]*models.ChatPair // pairId -> pair
+	users map[uuid.UUID]uuid.UUID        // userId -> pairId
+	mu    sync.RWMutex
+}
+
+// pairIndex maps pair and user IDs to active pairs. A pair is stored in the
+// shard of its ID and each of its users in the shard of the user's ID, so
+// lookups of unrelated pairs never contend. At most one shard lock is held
+// at a time, which rules out lock ordering problems between shards.
+//
+// A pair is added before its user entries and removed before them, so a user
+// entry whose pair is gone belongs to a pair that is being ended.
+type pairIndex struct {
+	shards [pairShardCount]pairShard
+}
+
+// newPairIndex creates an empty pair index
+func newPairIndex() *pairIndex {
+	index := &pairIndex{}
+	for i := range index.shards {
+		index.shards[i].pairs = make(map[uuid.UUID]*models.ChatPair)
+		index.shards[i].users = make(map[uuid.UUID]uuid.UUID)
+	}
+	return index
+}
+
+// shard returns the shard an ID hashes to
+func (ix *pairIndex) shard(id uuid.UUID) *pairShard {
+	return &ix.shards[binary.BigEndian.Uint32(id[12:])&(pairShardCount-1)]
+}
+
+// add registers a pair unless one of its users is already in an active pair
+func (ix *pairIndex) add(pair *models.ChatPair) bool {
+	shard := ix.shard(pair.ID)
+	shard.mu.Lock()
+	shard.pairs[pair.ID] = pair
+	shard.mu.Unlock()
+
+	for _, userId := range pair.UserIds() {
+		if !ix.claimUser(userId, pair.ID) {
+			ix.remove(pair.ID)
+			return false
+		}
+	}
+	return true
+}
+
+// claimUser points the user at the pair unless they are in another active pair
+func (ix *pairIndex) claimUser(userId, pairId uuid.UUID) bool {
+	for {
+		shard := ix.shard(userId)
+		shard.mu.Lock()
+		current, exists := shard.users[userId]
+		if !exists {
+			shard.users[userId] = pairId
+			shard.mu.Unlock()
+			return true
+		}
+		shard.mu.Unlock()
+
+		if _, active := ix.get(current); active {
+			return false
+		}
+		// The previous pair was removed but its user entries not yet
+		ix.releaseUser(userId, current)
+	}
+}
+
+// releaseUser removes the user's entry if it still points at the pair
+func (ix *pairIndex) releaseUser(userId, pairId uuid.UUID) {
+	shard := ix.shard(userId)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	if shard.users[userId] == pairId {
+		delete(shard.users, userId)
+	}
+}
+
+// remove unregisters a pair and returns it, nil if it wasn't registered.
+// Only one of several concurrent removals of the same pair gets it.
+func (ix *pairIndex) remove(pairId uuid.UUID) *models.ChatPair {
+	shard := ix.shard(pairId)
+	shard.mu.Lock()
+	pair, ok := shard.pairs[pairId]
+	delete(shard.pairs, pairId)
+	shard.mu.Unlock()
+	if !ok {
+		return nil
+	}
+
+	for _, userId := range pair.UserIds() {
+		ix.releaseUser(userId, pairId)
+	}
+	return pair
+}
+
+// get returns the pair with the given ID
+func (ix *pairIndex) get(pairId uuid.UUID) (*models.ChatPair, bool) {
+	shard := ix.shard(pairId)
+	shard.mu.RLock()
+	defer shard.mu.RUnlock()
+	pair, ok := shard.pairs[pairId]
+	return pair, ok
+}
+
+// userPairId returns the ID of the pair the user is in
+func (ix *pairIndex) userPairId(userId uuid.UUID) (uuid.UUID, bool) {
+	shard := ix.shard(userId)
+	shard.mu.RLock()
+	defer shard.mu.RUnlock()
+	pairId, ok := shard.users[userId]
+	return pairId, ok
+}
+
+// filter returns the pairs matching the predicate
+func (ix *pairIndex) filter(match func(pair *models.ChatPair) bool) []*models.ChatPair {
+	var pairs []*models.ChatPair
+	for i := range ix.shards {
+		shard := &ix.shards[i]
+		shard.mu.RLock()
+		for _, pair := range shard.pairs {
+			if match(pair) {
+				pairs = append(pairs, pair)
+			}
+		}
+		shard.mu.RUnlock()
+	}
+	return pairs
+}
+
+// count returns the number of registered pairs
+func (ix *pairIndex) count() int {
+	total := 0
+	for i := range ix.shards {
+		shard := &ix.shards[i]
+		shard.mu.RLock()
+		total += len(shard.pairs)
+		shard.mu.RUnlock()
+	}
+	return total
+}
@@ -0,0 +1,132 @@
+package services
+
+import (
+	"math/rand/v2"
+	"realTimeService/models"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestPairIndexKeepsUsersInOnePair(t *testing.T) {
+	index := newPairIndex()
+	users := make([]*models.Client, 16)
+	for i := range users {
+		users[i] = newBenchClient()
+	}
+
+	// busy is set while the user is in a pair the index accepted
+	busy := make([]atomic.Bool, len(users))
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 500 {
+				i, j := rand.IntN(len(users)), rand.IntN(len(users)-1)
+				if j >= i {
+					j++
+				}
+				pair := models.NewChatPair(users[i], users[j])
+				if !index.add(pair) {
+					continue
+				}
+				if !busy[i].CompareAndSwap(false, true) || !busy[j].CompareAndSwap(false, true) {
+					t.Error("user added to a second active pair")
+					return
+				}
+				if got, ok := index.userPairId(users[i].UserId); !ok || got != pair.ID {
+					t.Error("user entry does not point at their pair")
+				}
+				busy[i].Store(false)
+				busy[j].Store(false)
+				if index.remove(pair.ID) == nil {
+					t.Error("added pair could not be removed")
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if count := index.count(); count != 0 {
+		t.Fatalf("count = %d after removing every pair, want 0", count)
+	}
+	for _, user := range users {
+		if _, ok := index.userPairId(user.UserId); ok {
+			t.Fatalf("user %s still has an entry after their pairs were removed", user.UserId)
+		}
+	}
+}
+
+func TestPairIndexRemovesPairOnce(t *testing.T) {
+	index := newPairIndex()
+	pair := models.NewChatPair(newBenchClient(), newBenchClient())
+	if !index.add(pair) {
+		t.Fatal("pair of new users was not added")
+	}
+
+	var removed atomic.Int32
+	var wg sync.WaitGroup
+	for range 16 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if index.remove(pair.ID) != nil {
+				removed.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := removed.Load(); got != 1 {
+		t.Fatalf("pair removed %d times, want once", got)
+	}
+}
+
+func TestPairIndexReplacesEntriesOfEndingPair(t *testing.T) {
+	index := newPairIndex()
+	user1, user2 := newBenchClient(), newBenchClient()
+	ending := models.NewChatPair(user1, user2)
+	if !index.add(ending) {
+		t.Fatal("pair of new users was not added")
+	}
+
+	// Removed from its shard, but the user entries not yet released
+	shard := index.shard(ending.ID)
+	shard.mu.Lock()
+	delete(shard.pairs, ending.ID)
+	shard.mu.Unlock()
+
+	next := models.NewChatPair(user1, newBenchClient())
+	if !index.add(next) {
+		t.Fatal("user of an ending pair could not join a new one")
+	}
+	if got, _ := index.userPairId(user1.UserId); got != next.ID {
+		t.Fatalf("user entry points at %s, want the new pair %s", got, next.ID)
+	}
+	if got, _ := index.userPairId(user2.UserId); got != ending.ID {
+		t.Fatalf("entry of the other user changed to %s", got)
+	}
+}
+
+func TestPairIndexRefusesUsersOfActivePair(t *testing.T) {
+	index := newPairIndex()
+	user1, user2 := newBenchClient(), newBenchClient()
+	active := models.NewChatPair(user1, user2)
+	if !index.add(active) {
+		t.Fatal("pair of new users was not added")
+	}
+
+	third := newBenchClient()
+	if index.add(models.NewChatPair(third, user2)) {
+		t.Fatal("user of an active pair was added to another")
+	}
+
+	// The refused pair leaves nothing behind
+	if count := index.count(); count != 1 {
+		t.Fatalf("count = %d, want 1", count)
+	}
+	if _, ok := index.userPairId(third.UserId); ok {
+		t.Fatal("user of the refused pair kept an entry")
+	}
+}
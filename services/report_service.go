@@ -0,0 +1,208 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"realTimeService/logging"
+	"realTimeService/models"
+	"realTimeService/store"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// reportTimeout bounds a single report table operation
+	reportTimeout = 5 * time.Second
+	// reportCleanupInterval is how often old resolved reports and snippets are removed
+	reportCleanupInterval = time.Minute
+	// DefaultReportRetention is how long resolved reports are kept
+	DefaultReportRetention = 30 * 24 * time.Hour
+	// MaxReportDetailsLength bounds the free text a reporter may add
+	MaxReportDetailsLength = 500
+	// ReportSnippetSize is how many of the last messages of a chat a report carries
+	ReportSnippetSize = 10
+	// snippetRetention is how long the last messages of an ended chat are kept for a report,
+	// as long as the chat may be rated
+	snippetRetention = DefaultRatingWindow
+)
+
+// endedChat holds the last messages of an ended chat
+type endedChat struct {
+	messages []*models.Message
+	endedAt  time.Time
+}
+
+var (
+	// ErrReportNotFound is returned for a report that doesn't exist or was purged
+	ErrReportNotFound = errors.New("report not found")
+	// ErrReportResolved is returned when resolving a report a second time
+	ErrReportResolved = errors.New("report already resolved")
+)
+
+// ReportService collects users' reports of strangers for operators to review.
+// Reports live in the store, so every node sharing it sees them.
+// The last messages of recently ended chats stay on this node.
+type ReportService struct {
+	store      store.Store
+	endedChats map[uuid.UUID]*endedChat // pairId -> last messages
+	stop       chan struct{}
+	mu         sync.Mutex
+}
+
+// NewReportService creates a report service keeping its reports in the store
+func NewReportService(st store.Store) *ReportService {
+	return &ReportService{
+		store:      st,
+		endedChats: make(map[uuid.UUID]*endedChat),
+		stop:       make(chan struct{}),
+		mu:         sync.Mutex{},
+	}
+}
+
+// Start runs the background removal of old resolved reports and snippets
+func (s *ReportService) Start() {
+	go func() {
+		ticker := time.NewTicker(reportCleanupInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				s.purgeResolved(time.Now())
+				s.purgeSnippets(time.Now())
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop terminates the background cleanup
+func (s *ReportService) Stop() {
+	close(s.stop)
+}
+
+// KeepSnippet holds the last messages of an ended chat, so it can still be reported with them
+func (s *ReportService) KeepSnippet(pairId uuid.UUID, messages []*models.Message) {
+	if len(messages) == 0 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.endedChats[pairId] = &endedChat{messages: messages, endedAt: time.Now()}
+}
+
+// Snippet returns the last messages of a recently ended chat
+func (s *ReportService) Snippet(pairId uuid.UUID) []*models.Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if chat, ok := s.endedChats[pairId]; ok {
+		return chat.messages
+	}
+	return nil
+}
+
+// Add files a report of a stranger. A user may report each chat once.
+func (s *ReportService) Add(report *models.Report) error {
+	if !slices.Contains(models.ReportReasons, report.Reason) {
+		return fmt.Errorf("unknown report reason %q", report.Reason)
+	}
+	if len(report.Details) > MaxReportDetailsLength {
+		return fmt.Errorf("report details exceed %d bytes", MaxReportDetailsLength)
+	}
+
+	reports, err := s.List(false)
+	if err != nil {
+		return err
+	}
+	for _, existing := range reports {
+		if existing.ReporterId == report.ReporterId && existing.PairId == report.PairId {
+			return fmt.Errorf("chat already reported")
+		}
+	}
+
+	report.ID = uuid.New()
+	report.CreatedAt = time.Now()
+	if err := s.save(report); err != nil {
+		return err
+	}
+	slog.Info("User reported", "report", report.ID.String(), logging.Session(report.ReporterId),
+		"reported", report.ReportedId.String(), logging.Pair(report.PairId), "reason", report.Reason)
+	return nil
+}
+
+// Get returns a report
+func (s *ReportService) Get(reportId uuid.UUID) (*models.Report, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), reportTimeout)
+	defer cancel()
+
+	report, err := s.store.Report(ctx, reportId)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, ErrReportNotFound
+	}
+	return report, err
+}
+
+// Resolve closes a report with the operator's note and the ban issued for it, if any
+func (s *ReportService) Resolve(reportId uuid.UUID, resolution string, banId uuid.UUID) (*models.Report, error) {
+	report, err := s.Get(reportId)
+	if err != nil {
+		return nil, err
+	}
+	if !report.Open() {
+		return nil, ErrReportResolved
+	}
+
+	now := time.Now()
+	report.ResolvedAt = &now
+	report.Resolution = resolution
+	report.BanId = banId
+	if err := s.save(report); err != nil {
+		return nil, err
+	}
+	slog.Info("Report resolved", "report", reportId.String())
+	return report, nil
+}
+
+// List returns the reports, oldest first, only the open ones if openOnly is set
+func (s *ReportService) List(openOnly bool) ([]*models.Report, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), reportTimeout)
+	defer cancel()
+
+	return s.store.Reports(ctx, openOnly)
+}
+
+// save stores a report
+func (s *ReportService) save(report *models.Report) error {
+	ctx, cancel := context.WithTimeout(context.Background(), reportTimeout)
+	defer cancel()
+	if err := s.store.SaveReport(ctx, report); err != nil {
+		return fmt.Errorf("error storing report: %w", err)
+	}
+	return nil
+}
+
+// purgeSnippets drops the messages of chats that can no longer be reported
+func (s *ReportService) purgeSnippets(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for pairId, chat := range s.endedChats {
+		if now.Sub(chat.endedAt) > snippetRetention {
+			delete(s.endedChats, pairId)
+		}
+	}
+}
+
+// purgeResolved removes reports resolved longer than the retention ago
+func (s *ReportService) purgeResolved(now time.Time) {
+	ctx, cancel := context.WithTimeout(context.Background(), reportTimeout)
+	defer cancel()
+
+	if err := s.store.DeleteResolvedReports(ctx, now.Add(-DefaultReportRetention)); err != nil {
+		slog.Error("Error removing resolved reports", logging.Err(err))
+	}
+}
@@ -0,0 +1,286 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"realTimeService/logging"
+	"realTimeService/models"
+	"realTimeService/store"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// DefaultReputationHalfLife is how long it takes for a rating's effect to halve
+	DefaultReputationHalfLife = 30 * time.Minute
+	// DefaultRatingWindow is how long after a chat ends its participants may rate each other
+	DefaultRatingWindow = 10 * time.Minute
+	// reputationCleanupInterval is how often expired tickets and faded scores are dropped
+	reputationCleanupInterval = time.Minute
+	// reputationTimeout bounds a single reputation store operation
+	reputationTimeout = 5 * time.Second
+	// fadedScore is the magnitude below which a score is treated as neutral and forgotten
+	fadedScore = 0.01
+	// MaxRatingTags is how many tags a single rating may carry
+	MaxRatingTags = 3
+	// maxRatingDelta bounds how far a single rating moves a score either way
+	maxRatingDelta = 3
+)
+
+// RatingTagWeights lists the tags a rating may carry and how much each adds to the score.
+// Tags with a negative weight go with a thumbs down, the others with a thumbs up.
+var RatingTagWeights = map[string]float64{
+	"spam":          -1,
+	"rude":          -1,
+	"inappropriate": -2,
+	"bot":           -1,
+	"friendly":      0.5,
+	"funny":         0.5,
+}
+
+// ratingTicket allows one rating of a former partner
+type ratingTicket struct {
+	partnerId uuid.UUID
+	endedAt   time.Time
+}
+
+// ratingKey identifies a ticket by who rates and which chat they rate
+type ratingKey struct {
+	raterId uuid.UUID
+	pairId  uuid.UUID
+}
+
+// ReputationService aggregates end-of-chat ratings into per-session reputation scores.
+// Scores are saved to the store and loaded when the service starts; matching reads
+// them from memory. Rating tickets of recently ended chats stay on this node.
+type ReputationService struct {
+	store        store.Store
+	scores       map[uuid.UUID]*models.Reputation
+	tickets      map[ratingKey]*ratingTicket
+	halfLife     time.Duration
+	ratingWindow time.Duration
+	stop         chan struct{}
+	mu           sync.RWMutex
+	// saving serializes reading and writing stored scores, so that matching,
+	// which only needs mu, doesn't wait for the store
+	saving sync.Mutex
+}
+
+// NewReputationService creates a reputation service saving its scores in the store
+func NewReputationService(st store.Store, halfLife, ratingWindow time.Duration) *ReputationService {
+	return &ReputationService{
+		store:        st,
+		scores:       make(map[uuid.UUID]*models.Reputation),
+		tickets:      make(map[ratingKey]*ratingTicket),
+		halfLife:     halfLife,
+		ratingWindow: ratingWindow,
+		stop:         make(chan struct{}),
+		mu:           sync.RWMutex{},
+	}
+}
+
+// SetTimings changes the reputation half-life and the rating window
+func (r *ReputationService) SetTimings(halfLife, ratingWindow time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.halfLife = halfLife
+	r.ratingWindow = ratingWindow
+}
+
+// Start loads the stored scores and runs the background cleanup of expired tickets and faded scores
+func (r *ReputationService) Start() {
+	r.load()
+	go func() {
+		ticker := time.NewTicker(reputationCleanupInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				r.cleanup(time.Now())
+			case <-r.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop terminates the background cleanup
+func (r *ReputationService) Stop() {
+	close(r.stop)
+}
+
+// RecordChatEnded lets both users of an ended pair rate each other once
+func (r *ReputationService) RecordChatEnded(pair *models.ChatPair) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	ids := pair.UserIds()
+	r.tickets[ratingKey{ids[0], pair.ID}] = &ratingTicket{partnerId: ids[1], endedAt: now}
+	r.tickets[ratingKey{ids[1], pair.ID}] = &ratingTicket{partnerId: ids[0], endedAt: now}
+}
+
+// Rate applies a thumbs up/down with optional tags to the rater's former partner in the given pair
+func (r *ReputationService) Rate(raterId, pairId uuid.UUID, positive bool, tags []string) error {
+	delta := -1.0
+	if positive {
+		delta = 1
+	}
+	// Repeating a tag doesn't add its weight again
+	seen := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		weight, ok := RatingTagWeights[tag]
+		if !ok {
+			return fmt.Errorf("unknown rating tag %q", tag)
+		}
+		if !seen[tag] {
+			seen[tag] = true
+			delta += weight
+		}
+	}
+	delta = max(-maxRatingDelta, min(maxRatingDelta, delta))
+
+	r.saving.Lock()
+	defer r.saving.Unlock()
+
+	key := ratingKey{raterId, pairId}
+	now := time.Now()
+	ticket, err := r.ticket(key, now)
+	if err != nil {
+		return err
+	}
+
+	// The stored score includes ratings applied by other nodes sharing the store
+	ctx, cancel := context.WithTimeout(context.Background(), reputationTimeout)
+	defer cancel()
+	current, err := r.store.Reputation(ctx, ticket.partnerId)
+	if errors.Is(err, store.ErrNotFound) {
+		current, err = &models.Reputation{UserId: ticket.partnerId, UpdatedAt: now}, nil
+	}
+	if err != nil {
+		return fmt.Errorf("error reading reputation: %w", err)
+	}
+	r.mu.RLock()
+	current.Score = r.decayed(current, now) + delta
+	r.mu.RUnlock()
+	current.UpdatedAt = now
+	if err := r.store.SaveReputation(ctx, current); err != nil {
+		return fmt.Errorf("error saving reputation: %w", err)
+	}
+
+	r.mu.Lock()
+	r.scores[ticket.partnerId] = current
+	delete(r.tickets, key)
+	r.mu.Unlock()
+
+	slog.Info("User rated partner", logging.Session(raterId), logging.Pair(pairId), "delta", delta)
+	return nil
+}
+
+// ticket returns the rating ticket of the key if it is still valid, dropping it once expired
+func (r *ReputationService) ticket(key ratingKey, now time.Time) (*ratingTicket, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ticket, ok := r.tickets[key]
+	if !ok {
+		return nil, fmt.Errorf("no chat to rate")
+	}
+	if now.Sub(ticket.endedAt) > r.ratingWindow {
+		delete(r.tickets, key)
+		return nil, fmt.Errorf("rating window has passed")
+	}
+	return ticket, nil
+}
+
+// FormerPartner returns the partner the rater may still rate for an ended pair
+func (r *ReputationService) FormerPartner(raterId, pairId uuid.UUID) (uuid.UUID, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	ticket, ok := r.tickets[ratingKey{raterId, pairId}]
+	if !ok || time.Since(ticket.endedAt) > r.ratingWindow {
+		return uuid.Nil, false
+	}
+	return ticket.partnerId, true
+}
+
+// Score returns the user's current reputation, 0 being neutral
+func (r *ReputationService) Score(userId uuid.UUID) float64 {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	current, ok := r.scores[userId]
+	if !ok {
+		return 0
+	}
+	return r.decayed(current, time.Now())
+}
+
+// decayed returns the score as of now, halving every half-life
+func (r *ReputationService) decayed(rep *models.Reputation, now time.Time) float64 {
+	elapsed := now.Sub(rep.UpdatedAt)
+	return rep.Score * math.Pow(0.5, float64(elapsed)/float64(r.halfLife))
+}
+
+// load reads the stored scores into memory
+func (r *ReputationService) load() {
+	ctx, cancel := context.WithTimeout(context.Background(), reputationTimeout)
+	defer cancel()
+	reputations, err := r.store.Reputations(ctx)
+	if err != nil {
+		slog.Error("Error loading reputation scores", logging.Err(err))
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, rep := range reputations {
+		r.scores[rep.UserId] = rep
+	}
+	slog.Info("Reputation scores loaded", "count", len(reputations))
+}
+
+// cleanup drops expired rating tickets and scores that have decayed to neutral
+func (r *ReputationService) cleanup(now time.Time) {
+	r.saving.Lock()
+	defer r.saving.Unlock()
+
+	r.mu.Lock()
+	for key, ticket := range r.tickets {
+		if now.Sub(ticket.endedAt) > r.ratingWindow {
+			delete(r.tickets, key)
+		}
+	}
+	var faded []uuid.UUID
+	for userId, rep := range r.scores {
+		if math.Abs(r.decayed(rep, now)) < fadedScore {
+			faded = append(faded, userId)
+		}
+	}
+	r.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), reputationTimeout)
+	defer cancel()
+	for _, userId := range faded {
+		// Another node sharing the store may have rated the user since
+		stored, err := r.store.Reputation(ctx, userId)
+		r.mu.Lock()
+		if err == nil && math.Abs(r.decayed(stored, now)) >= fadedScore {
+			r.scores[userId] = stored
+			r.mu.Unlock()
+			continue
+		}
+		delete(r.scores, userId)
+		r.mu.Unlock()
+
+		if err := r.store.DeleteReputation(ctx, userId); err != nil {
+			slog.Error("Error removing faded reputation", logging.Session(userId), logging.Err(err))
+		}
+	}
+}
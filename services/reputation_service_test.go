@@ -0,0 +1,39 @@
+package services
+
+import (
+	"realTimeService/models"
+	"realTimeService/store"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestReputationCountsRepeatedTagsOnce(t *testing.T) {
+	reputation := NewReputationService(store.NewMemoryStore(), time.Hour, time.Hour)
+	rater, rated := newBenchClient(), newBenchClient()
+	pair := models.NewChatPair(rater, rated)
+	reputation.RecordChatEnded(pair)
+
+	tags := slices.Repeat([]string{"inappropriate"}, 1000)
+	if err := reputation.Rate(rater.UserId, pair.ID, false, tags); err != nil {
+		t.Fatalf("Rate: %v", err)
+	}
+	// A thumbs down plus one inappropriate tag
+	if score := reputation.Score(rated.UserId); score > -2.9 || score < -3 {
+		t.Fatalf("score = %v, want about -3", score)
+	}
+}
+
+func TestReputationBoundsSingleRating(t *testing.T) {
+	reputation := NewReputationService(store.NewMemoryStore(), time.Hour, time.Hour)
+	rater, rated := newBenchClient(), newBenchClient()
+	pair := models.NewChatPair(rater, rated)
+	reputation.RecordChatEnded(pair)
+
+	if err := reputation.Rate(rater.UserId, pair.ID, false, []string{"spam", "rude", "inappropriate", "bot"}); err != nil {
+		t.Fatalf("Rate: %v", err)
+	}
+	if score := reputation.Score(rated.UserId); score < -maxRatingDelta {
+		t.Fatalf("score = %v, want at least %v", score, -maxRatingDelta)
+	}
+}
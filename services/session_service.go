@@ -0,0 +1,58 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// SessionService issues the resume tokens a client reconnects to its session with.
+// The session ID can't serve this purpose since partners see it. Tokens are signed
+// rather than stored, so every node sharing the secret accepts them.
+type SessionService struct {
+	key []byte
+}
+
+// NewSessionService creates a session service signing tokens with the secret.
+// Without a secret a random one is used, and tokens only work on this node until it restarts.
+func NewSessionService(secret string) *SessionService {
+	key := []byte(secret)
+	if secret == "" {
+		key = make([]byte, 32)
+		rand.Read(key)
+	}
+	return &SessionService{key: key}
+}
+
+// ResumeToken returns the token that resumes the session
+func (s *SessionService) ResumeToken(userId uuid.UUID) string {
+	return userId.String() + "." + base64.RawURLEncoding.EncodeToString(s.sign(userId))
+}
+
+// Resume returns the session a resume token was issued for, false if the token is invalid
+func (s *SessionService) Resume(token string) (uuid.UUID, bool) {
+	id, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return uuid.Nil, false
+	}
+	userId, err := uuid.Parse(id)
+	if err != nil {
+		return uuid.Nil, false
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(mac, s.sign(userId)) {
+		return uuid.Nil, false
+	}
+	return userId, true
+}
+
+// sign returns the signature of a session ID
+func (s *SessionService) sign(userId uuid.UUID) []byte {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write(userId[:])
+	return mac.Sum(nil)
+}
@@ -0,0 +1,37 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestSessionServiceResumesOwnTokens(t *testing.T) {
+	sessions := NewSessionService("secret")
+	userId := uuid.New()
+
+	token := sessions.ResumeToken(userId)
+	if resumed, ok := sessions.Resume(token); !ok || resumed != userId {
+		t.Fatalf("Resume(%q) = %v, %v, want the session it was issued for", token, resumed, ok)
+	}
+	// Another node with the same secret accepts it too
+	if resumed, ok := NewSessionService("secret").Resume(token); !ok || resumed != userId {
+		t.Fatalf("Resume on a node sharing the secret = %v, %v", resumed, ok)
+	}
+}
+
+func TestSessionServiceRefusesForgedTokens(t *testing.T) {
+	sessions := NewSessionService("secret")
+	userId := uuid.New()
+
+	for name, token := range map[string]string{
+		"session id":   userId.String(),
+		"other secret": NewSessionService("other").ResumeToken(userId),
+		"other id":     uuid.NewString() + sessions.ResumeToken(userId)[36:],
+		"empty":        "",
+	} {
+		if _, ok := sessions.Resume(token); ok {
+			t.Errorf("%s: token %q accepted", name, token)
+		}
+	}
+}
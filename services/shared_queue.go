@@ -0,0 +1,336 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"maps"
+	"math"
+	"realTimeService/broker"
+	"realTimeService/logging"
+	"realTimeService/models"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// sharedQueueKey is the broker queue holding "nodeId|userId|score" entries of waiting users
+	sharedQueueKey = "goroom:queue"
+	// sharedQueueLock serializes matching across nodes
+	sharedQueueLock = "goroom:lock:queue"
+	// sharedQueueTimeout bounds a single queue operation including waiting for the lock
+	sharedQueueTimeout = 5 * time.Second
+)
+
+// SharedQueue is a waiting queue shared by every node through a broker,
+// so users connected to different nodes can be matched with each other.
+// Like LocalQueue it pairs users of similar reputation. Each entry carries the
+// user's score when they queued, as other nodes can't look it up.
+type SharedQueue struct {
+	broker     broker.Broker
+	nodeId     string
+	waiting    map[uuid.UUID]sharedWaiter // users waiting on this node
+	taken      map[uuid.UUID]takenEntry   // entries of users of other nodes recently taken by Match
+	reputation ReputationSource
+	mu         sync.Mutex
+}
+
+// sharedWaiter is a user waiting on this node with their entry in the shared queue
+type sharedWaiter struct {
+	client *models.Client
+	entry  string
+}
+
+// takenEntry is the entry of a user of another node that Match took out of the queue
+type takenEntry struct {
+	member  string
+	takenAt time.Time
+}
+
+// queueEntry is a parsed entry of the shared queue
+type queueEntry struct {
+	member string
+	nodeId string
+	userId uuid.UUID
+	score  float64
+}
+
+// NewSharedQueue creates a waiting queue shared through the broker
+func NewSharedQueue(b broker.Broker, nodeId string, reputation ReputationSource) *SharedQueue {
+	return &SharedQueue{
+		broker:     b,
+		nodeId:     nodeId,
+		waiting:    make(map[uuid.UUID]sharedWaiter),
+		taken:      make(map[uuid.UUID]takenEntry),
+		reputation: reputation,
+		mu:         sync.Mutex{},
+	}
+}
+
+// Match takes the user of any node whose reputation is closest to the client's,
+// or queues the client. Only the longest waiting users are considered and ties go
+// to whoever has waited longest. Users waiting on other nodes are returned as remote clients.
+func (q *SharedQueue) Match(client *models.Client) (*models.Client, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), sharedQueueTimeout)
+	defer cancel()
+
+	unlock, err := q.broker.Lock(ctx, sharedQueueLock, sharedQueueTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("error locking waiting queue: %w", err)
+	}
+	defer unlock()
+
+	// A repeated request replaces the earlier queue entry
+	if err := q.remove(ctx, client.UserId); err != nil {
+		return nil, err
+	}
+
+	score := q.reputation.Score(client.UserId)
+	for {
+		candidate, found, err := q.closestCandidate(ctx, client.UserId, score)
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			break
+		}
+		if err := q.broker.Remove(ctx, sharedQueueKey, candidate.member); err != nil {
+			return nil, fmt.Errorf("error leaving waiting queue: %w", err)
+		}
+		if candidate.nodeId != q.nodeId {
+			q.keepTaken(candidate)
+			return models.NewRemoteClient(candidate.userId, candidate.nodeId), nil
+		}
+
+		// Entries of users who left this node in the meantime are skipped
+		q.mu.Lock()
+		stranger, waiting := q.waiting[candidate.userId]
+		delete(q.waiting, candidate.userId)
+		q.mu.Unlock()
+		if waiting {
+			return stranger.client, nil
+		}
+	}
+
+	// If no one is waiting, add to queue
+	entry := q.entry(client.UserId, score)
+	q.mu.Lock()
+	q.waiting[client.UserId] = sharedWaiter{client: client, entry: entry}
+	q.mu.Unlock()
+	if err := q.broker.Push(ctx, sharedQueueKey, entry); err != nil {
+		q.mu.Lock()
+		delete(q.waiting, client.UserId)
+		q.mu.Unlock()
+		return nil, fmt.Errorf("error joining waiting queue: %w", err)
+	}
+
+	client.Log.Debug("User added to shared waiting queue")
+	return nil, nil
+}
+
+// closestCandidate returns the entry among the longest waiting users whose score is
+// closest to the given one, found is false if nobody else waits. Malformed entries are
+// dropped on the way. The caller must hold the queue lock.
+func (q *SharedQueue) closestCandidate(ctx context.Context, userId uuid.UUID, score float64) (queueEntry, bool, error) {
+	for {
+		members, err := q.broker.Head(ctx, sharedQueueKey, matchCandidates)
+		if err != nil {
+			return queueEntry{}, false, fmt.Errorf("error reading waiting queue: %w", err)
+		}
+
+		var best queueEntry
+		found, dropped := false, false
+		bestDistance := math.Inf(1)
+		for _, member := range members {
+			candidate, err := parseQueueEntry(member)
+			if err != nil {
+				slog.Warn("Dropping malformed waiting queue entry", "entry", member, logging.Err(err))
+				if err := q.broker.Remove(ctx, sharedQueueKey, member); err != nil {
+					return queueEntry{}, false, fmt.Errorf("error cleaning waiting queue: %w", err)
+				}
+				dropped = true
+				continue
+			}
+			if candidate.userId == userId {
+				continue
+			}
+			if distance := math.Abs(candidate.score - score); distance < bestDistance {
+				best, bestDistance, found = candidate, distance, true
+			}
+		}
+
+		// Dropped entries made room for others, which are compared too
+		if found || !dropped {
+			return best, found, nil
+		}
+	}
+}
+
+// keepTaken remembers the entry of a user of another node taken out of the queue,
+// so Requeue can put it back unchanged. Entries are only kept for as long as a
+// queue operation may take.
+func (q *SharedQueue) keepTaken(candidate queueEntry) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	now := time.Now()
+	for userId, taken := range q.taken {
+		if now.Sub(taken.takenAt) > sharedQueueTimeout {
+			delete(q.taken, userId)
+		}
+	}
+	q.taken[candidate.userId] = takenEntry{member: candidate.member, takenAt: now}
+}
+
+// Requeue puts the user back in the queue. A user of another node gets back the
+// entry Match took, which is only kept for a short while.
+func (q *SharedQueue) Requeue(client *models.Client) error {
+	ctx, cancel := context.WithTimeout(context.Background(), sharedQueueTimeout)
+	defer cancel()
+
+	var member string
+	q.mu.Lock()
+	if client.IsRemote() {
+		taken, ok := q.taken[client.UserId]
+		if !ok {
+			q.mu.Unlock()
+			return fmt.Errorf("entry of user %s is no longer known", client.UserId)
+		}
+		delete(q.taken, client.UserId)
+		member = taken.member
+	} else {
+		member = q.entry(client.UserId, q.reputation.Score(client.UserId))
+		q.waiting[client.UserId] = sharedWaiter{client: client, entry: member}
+	}
+	q.mu.Unlock()
+
+	if err := q.broker.Push(ctx, sharedQueueKey, member); err != nil {
+		if !client.IsRemote() {
+			q.mu.Lock()
+			delete(q.waiting, client.UserId)
+			q.mu.Unlock()
+		}
+		return fmt.Errorf("error joining waiting queue: %w", err)
+	}
+	return nil
+}
+
+// Rebind replaces the client of a user waiting on this node, keeping their entry
+func (q *SharedQueue) Rebind(client *models.Client) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if waiter, waiting := q.waiting[client.UserId]; waiting {
+		waiter.client = client
+		q.waiting[client.UserId] = waiter
+	}
+}
+
+// Claim takes a user waiting on this node out of the queue
+func (q *SharedQueue) Claim(userId uuid.UUID) *models.Client {
+	q.mu.Lock()
+	waiter, waiting := q.waiting[userId]
+	delete(q.waiting, userId)
+	q.mu.Unlock()
+	if !waiting {
+		return nil
+	}
+
+	// The entry is usually gone already, taken by the node that matched the user
+	ctx, cancel := context.WithTimeout(context.Background(), sharedQueueTimeout)
+	defer cancel()
+	if err := q.broker.Remove(ctx, sharedQueueKey, waiter.entry); err != nil {
+		slog.Error("Error removing claimed user from waiting queue", logging.Session(userId), logging.Err(err))
+	}
+	return waiter.client
+}
+
+// Remove takes the user out of the queue if they are waiting
+func (q *SharedQueue) Remove(userId uuid.UUID) error {
+	ctx, cancel := context.WithTimeout(context.Background(), sharedQueueTimeout)
+	defer cancel()
+	return q.remove(ctx, userId)
+}
+
+// RemoveNode drops the entries of users waiting on a node that went down,
+// so nobody gets matched with them
+func (q *SharedQueue) RemoveNode(nodeId string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), sharedQueueTimeout)
+	defer cancel()
+
+	members, err := q.broker.Members(ctx, sharedQueueKey)
+	if err != nil {
+		return fmt.Errorf("error reading waiting queue: %w", err)
+	}
+	for _, member := range members {
+		entry, err := parseQueueEntry(member)
+		if err != nil || entry.nodeId != nodeId {
+			continue
+		}
+		if err := q.broker.Remove(ctx, sharedQueueKey, member); err != nil {
+			return fmt.Errorf("error leaving waiting queue: %w", err)
+		}
+	}
+	return nil
+}
+
+// Len returns the number of users waiting on this node
+func (q *SharedQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.waiting)
+}
+
+// Waiting returns the users waiting on this node
+func (q *SharedQueue) Waiting() []uuid.UUID {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return slices.Collect(maps.Keys(q.waiting))
+}
+
+// remove drops the user's local and shared entries
+func (q *SharedQueue) remove(ctx context.Context, userId uuid.UUID) error {
+	q.mu.Lock()
+	waiter, waiting := q.waiting[userId]
+	delete(q.waiting, userId)
+	q.mu.Unlock()
+	if !waiting {
+		return nil
+	}
+
+	if err := q.broker.Remove(ctx, sharedQueueKey, waiter.entry); err != nil {
+		return fmt.Errorf("error leaving waiting queue: %w", err)
+	}
+	slog.Debug("User removed from shared waiting queue", logging.Session(userId))
+	return nil
+}
+
+// entry formats the queue entry of a user waiting on this node
+func (q *SharedQueue) entry(userId uuid.UUID, score float64) string {
+	return q.nodeId + "|" + userId.String() + "|" + strconv.FormatFloat(score, 'g', -1, 64)
+}
+
+// parseQueueEntry splits a queue entry into node, user and score
+func parseQueueEntry(member string) (queueEntry, error) {
+	scoreSeparator := strings.LastIndex(member, "|")
+	if scoreSeparator < 0 {
+		return queueEntry{}, fmt.Errorf("missing user")
+	}
+	score, err := strconv.ParseFloat(member[scoreSeparator+1:], 64)
+	if err != nil {
+		return queueEntry{}, fmt.Errorf("invalid score: %w", err)
+	}
+
+	userSeparator := strings.LastIndex(member[:scoreSeparator], "|")
+	if userSeparator < 0 {
+		return queueEntry{}, fmt.Errorf("missing node")
+	}
+	userId, err := uuid.Parse(member[userSeparator+1 : scoreSeparator])
+	if err != nil {
+		return queueEntry{}, err
+	}
+	return queueEntry{member: member, nodeId: member[:userSeparator], userId: userId, score: score}, nil
+}
@@ -0,0 +1,311 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"realTimeService/logging"
+	"realTimeService/models"
+	"realTimeService/store"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// DefaultTranscriptMaxMessages is how many messages a transcript keeps before dropping the oldest
+	DefaultTranscriptMaxMessages = 500
+	// DefaultTranscriptRetention is how long a transcript stays downloadable after the chat ends
+	DefaultTranscriptRetention = 15 * time.Minute
+	// transcriptPurgeInterval is how often expired transcripts are removed
+	transcriptPurgeInterval = time.Minute
+	// transcriptTimeout bounds a single transcript store operation
+	transcriptTimeout = 5 * time.Second
+)
+
+// TranscriptService keeps opt-in transcripts of chat pairs. Transcripts of running
+// chats are kept in memory and saved to the store when the chat ends, to be
+// downloaded until their retention has passed.
+type TranscriptService struct {
+	store       store.Store
+	transcripts map[uuid.UUID]*models.Transcript // pairId -> transcript of a running chat
+	maxMessages int
+	retention   time.Duration
+	stop        chan struct{}
+	mu          sync.RWMutex
+}
+
+// NewTranscriptService creates a transcript service saving ended transcripts in the store
+func NewTranscriptService(st store.Store, maxMessages int, retention time.Duration) *TranscriptService {
+	return &TranscriptService{
+		store:       st,
+		transcripts: make(map[uuid.UUID]*models.Transcript),
+		maxMessages: maxMessages,
+		retention:   retention,
+		stop:        make(chan struct{}),
+		mu:          sync.RWMutex{},
+	}
+}
+
+// SetLimits changes how many messages a transcript keeps and how long it is retained
+func (t *TranscriptService) SetLimits(maxMessages int, retention time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.maxMessages = maxMessages
+	t.retention = retention
+}
+
+// MaxMessages returns how many messages a transcript keeps
+func (t *TranscriptService) MaxMessages() int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.maxMessages
+}
+
+// Start runs the background purge of expired transcripts
+func (t *TranscriptService) Start() {
+	go func() {
+		ticker := time.NewTicker(transcriptPurgeInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				t.purgeExpired(time.Now())
+			case <-t.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop terminates the background purge
+func (t *TranscriptService) Stop() {
+	close(t.stop)
+}
+
+// SetOptIn records whether a user wants the current chat to be transcribed.
+// Opting out discards everything recorded so far.
+func (t *TranscriptService) SetOptIn(pair *models.ChatPair, userId uuid.UUID, enabled bool) (*models.Transcript, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if !pair.HasUser(userId) {
+		return nil, fmt.Errorf("user not in pair")
+	}
+
+	transcript, ok := t.transcripts[pair.ID]
+	if !ok {
+		transcript = models.NewTranscript(pair)
+		t.transcripts[pair.ID] = transcript
+	}
+	if transcript.Ended() {
+		return nil, fmt.Errorf("chat already ended")
+	}
+
+	transcript.OptedIn[userId] = enabled
+	if !enabled {
+		transcript.Messages = transcript.Messages[:0]
+	}
+	if _, ok := transcript.Tokens[userId]; !ok {
+		token, err := newTranscriptToken()
+		if err != nil {
+			return nil, err
+		}
+		transcript.Tokens[userId] = token
+	}
+
+	slog.Info("User set transcript opt-in", logging.Session(userId), logging.Pair(pair.ID), "enabled", enabled)
+	return transcript, nil
+}
+
+// Record appends a message to the pair's transcript if both users opted in
+func (t *TranscriptService) Record(pairId uuid.UUID, message *models.Message) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	transcript, ok := t.transcripts[pairId]
+	if !ok || !transcript.Recording() || transcript.Ended() {
+		return
+	}
+
+	stored := *message
+	stored.ClientId = ""
+	transcript.Messages = append(transcript.Messages, &stored)
+	if over := len(transcript.Messages) - t.maxMessages; over > 0 {
+		transcript.Messages = transcript.Messages[over:]
+	}
+}
+
+// Update replaces a recorded message after it was edited
+func (t *TranscriptService) Update(pairId uuid.UUID, message *models.Message) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	transcript, ok := t.transcripts[pairId]
+	if !ok || transcript.Ended() {
+		return
+	}
+	for i, recorded := range transcript.Messages {
+		if recorded.ID == message.ID {
+			stored := *message
+			transcript.Messages[i] = &stored
+			return
+		}
+	}
+}
+
+// Remove drops a deleted message from the pair's transcript
+func (t *TranscriptService) Remove(pairId, messageId uuid.UUID) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	transcript, ok := t.transcripts[pairId]
+	if !ok || transcript.Ended() {
+		return
+	}
+	for i, recorded := range transcript.Messages {
+		if recorded.ID == messageId {
+			transcript.Messages = append(transcript.Messages[:i], transcript.Messages[i+1:]...)
+			return
+		}
+	}
+}
+
+// Finish marks the pair's transcript as ended and saves it to the store. Transcripts
+// that were never recorded by both users, or couldn't be saved, are discarded and nil
+// is returned.
+func (t *TranscriptService) Finish(pairId uuid.UUID) *models.Transcript {
+	t.mu.Lock()
+	transcript, ok := t.transcripts[pairId]
+	delete(t.transcripts, pairId)
+	t.mu.Unlock()
+
+	if !ok || !transcript.Recording() || len(transcript.Messages) == 0 {
+		return nil
+	}
+
+	transcript.EndedAt = time.Now()
+	ctx, cancel := context.WithTimeout(context.Background(), transcriptTimeout)
+	defer cancel()
+	if err := t.store.SaveTranscript(ctx, transcript); err != nil {
+		slog.Error("Error saving transcript", logging.Pair(pairId), logging.Err(err))
+		return nil
+	}
+	slog.Info("Transcript kept", logging.Pair(pairId), "until", t.ExpiresAt(transcript).Format(time.RFC3339))
+	return transcript
+}
+
+// Get returns the transcript of an ended chat if the token belongs to one of its participants.
+// Transcripts of running chats can't be downloaded.
+func (t *TranscriptService) Get(pairId uuid.UUID, token string) (*models.Transcript, uuid.UUID, error) {
+	transcript, err := t.find(pairId)
+	if err != nil {
+		return nil, uuid.Nil, err
+	}
+	if transcript == nil || !transcript.Recording() || !transcript.Ended() {
+		return nil, uuid.Nil, fmt.Errorf("transcript not found")
+	}
+
+	for userId, userToken := range transcript.Tokens {
+		if subtle.ConstantTimeCompare([]byte(userToken), []byte(token)) == 1 {
+			return transcript, userId, nil
+		}
+	}
+	return nil, uuid.Nil, fmt.Errorf("invalid transcript token")
+}
+
+// find returns a snapshot of the transcript of a running chat, or else the saved
+// transcript of an ended one if it is still retained. It is nil if there is neither.
+func (t *TranscriptService) find(pairId uuid.UUID) (*models.Transcript, error) {
+	t.mu.RLock()
+	if transcript, ok := t.transcripts[pairId]; ok {
+		snapshot := *transcript
+		snapshot.OptedIn = maps.Clone(transcript.OptedIn)
+		snapshot.Tokens = maps.Clone(transcript.Tokens)
+		snapshot.Messages = append([]*models.Message(nil), transcript.Messages...)
+		t.mu.RUnlock()
+		return &snapshot, nil
+	}
+	retention := t.retention
+	t.mu.RUnlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), transcriptTimeout)
+	defer cancel()
+	transcript, err := t.store.Transcript(ctx, pairId)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading transcript: %w", err)
+	}
+	if time.Now().After(transcript.EndedAt.Add(retention)) {
+		return nil, nil
+	}
+	return transcript, nil
+}
+
+// Status builds the transcript status notification for one of the participants
+func (t *TranscriptService) Status(pairId, userId uuid.UUID) *models.TranscriptStatusMessage {
+	status := &models.TranscriptStatusMessage{
+		Type:      string(models.TranscriptStatus),
+		PairId:    pairId,
+		Timestamp: time.Now(),
+	}
+
+	transcript, err := t.find(pairId)
+	if err != nil {
+		slog.Error("Error reading transcript status", logging.Pair(pairId), logging.Err(err))
+		return status
+	}
+	if transcript == nil || !transcript.HasUser(userId) {
+		return status
+	}
+
+	status.YouOptedIn = transcript.OptedIn[userId]
+	status.StrangerOptedIn = transcript.OptedIn[transcript.Partner(userId)]
+	status.Recording = transcript.Recording()
+	status.Ended = transcript.Ended()
+	if status.Recording {
+		status.Token = transcript.Tokens[userId]
+	}
+	if status.Ended {
+		expiresAt := t.ExpiresAt(transcript)
+		status.ExpiresAt = &expiresAt
+	}
+	return status
+}
+
+// ExpiresAt returns when an ended transcript will be purged
+func (t *TranscriptService) ExpiresAt(transcript *models.Transcript) time.Time {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return transcript.EndedAt.Add(t.retention)
+}
+
+// purgeExpired removes ended transcripts whose retention has elapsed
+func (t *TranscriptService) purgeExpired(now time.Time) {
+	t.mu.RLock()
+	retention := t.retention
+	t.mu.RUnlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), transcriptTimeout)
+	defer cancel()
+	if err := t.store.DeleteTranscripts(ctx, now.Add(-retention)); err != nil {
+		slog.Error("Error purging transcripts", logging.Err(err))
+	}
+}
+
+// newTranscriptToken generates a random download token
+func newTranscriptToken() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("error generating transcript token: %w", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
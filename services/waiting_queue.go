@@ -0,0 +1,178 @@
+package services
+
+import (
+	"container/list"
+	"math"
+	"realTimeService/models"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// WaitingQueue holds the users waiting for a random stranger
+type WaitingQueue interface {
+	// Match takes the best waiting partner for the client out of the queue.
+	// If nobody suitable is waiting, the client is queued and nil is returned.
+	Match(client *models.Client) (*models.Client, error)
+
+	// Requeue puts back a user that Match just returned, when they couldn't be paired after all
+	Requeue(client *models.Client) error
+
+	// Rebind replaces the client of a user waiting on this node with the one their session resumed on
+	Rebind(client *models.Client)
+
+	// Claim takes a user waiting on this node out of the queue, nil if they aren't waiting
+	Claim(userId uuid.UUID) *models.Client
+
+	// Remove takes the user out of the queue if they are waiting
+	Remove(userId uuid.UUID) error
+
+	// RemoveNode drops the entries of users waiting on a node that went down
+	RemoveNode(nodeId string) error
+
+	// Len returns the number of users waiting on this node
+	Len() int
+
+	// Waiting returns the users waiting on this node
+	Waiting() []uuid.UUID
+}
+
+// matchCandidates is how many of the longest waiting users are compared by reputation,
+// which keeps matching constant-time however long the queue gets
+const matchCandidates = 32
+
+// LocalQueue is a waiting queue for a single node that pairs users of similar reputation.
+// Users are kept in waiting order with an index by user ID, so any user can be removed in O(1).
+type LocalQueue struct {
+	waiting    *list.List                  // *models.Client, longest waiting first
+	index      map[uuid.UUID]*list.Element // userId -> element in waiting
+	reputation ReputationSource
+	mu         sync.Mutex
+}
+
+// NewLocalQueue creates a new in-process waiting queue
+func NewLocalQueue(reputation ReputationSource) *LocalQueue {
+	return &LocalQueue{
+		waiting:    list.New(),
+		index:      make(map[uuid.UUID]*list.Element),
+		reputation: reputation,
+		mu:         sync.Mutex{},
+	}
+}
+
+// Match takes the waiting user with the closest reputation, or queues the client
+func (q *LocalQueue) Match(client *models.Client) (*models.Client, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	// A repeated request replaces the earlier queue entry
+	q.remove(client.UserId)
+
+	// If no one is waiting, add to queue
+	if q.waiting.Len() == 0 {
+		q.index[client.UserId] = q.waiting.PushBack(client)
+		client.Log.Debug("User added to waiting queue")
+		return nil, nil
+	}
+
+	stranger := q.closestCandidate(client)
+	q.unlink(q.index[stranger.UserId])
+	return stranger, nil
+}
+
+// Requeue puts the user back at the head of the queue, where they waited before being taken
+func (q *LocalQueue) Requeue(client *models.Client) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if _, waiting := q.index[client.UserId]; !waiting {
+		q.index[client.UserId] = q.waiting.PushFront(client)
+	}
+	return nil
+}
+
+// Rebind replaces the client of a waiting user, keeping their place in the queue
+func (q *LocalQueue) Rebind(client *models.Client) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if element, waiting := q.index[client.UserId]; waiting {
+		element.Value = client
+	}
+}
+
+// Claim takes a waiting user out of the queue
+func (q *LocalQueue) Claim(userId uuid.UUID) *models.Client {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.remove(userId)
+}
+
+// Remove takes the user out of the queue if they are waiting
+func (q *LocalQueue) Remove(userId uuid.UUID) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.remove(userId)
+	return nil
+}
+
+// RemoveNode does nothing, a local queue only holds users of this node
+func (q *LocalQueue) RemoveNode(nodeId string) error {
+	return nil
+}
+
+// Len returns the number of waiting users
+func (q *LocalQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.waiting.Len()
+}
+
+// Waiting returns the waiting users, longest waiting first
+func (q *LocalQueue) Waiting() []uuid.UUID {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	users := make([]uuid.UUID, 0, q.waiting.Len())
+	for element := q.waiting.Front(); element != nil; element = element.Next() {
+		users = append(users, element.Value.(*models.Client).UserId)
+	}
+	return users
+}
+
+// closestCandidate returns the waiting user whose reputation is closest to the client's,
+// so users with bad ratings end up matched with each other. Only the longest waiting
+// users are considered and ties go to whoever has waited longest. The queue must not
+// be empty and the caller must hold the lock.
+func (q *LocalQueue) closestCandidate(client *models.Client) *models.Client {
+	score := q.reputation.Score(client.UserId)
+
+	var best *models.Client
+	bestDistance := math.Inf(1)
+	element := q.waiting.Front()
+	for i := 0; i < matchCandidates && element != nil; i++ {
+		candidate := element.Value.(*models.Client)
+		distance := math.Abs(q.reputation.Score(candidate.UserId) - score)
+		if distance < bestDistance {
+			best, bestDistance = candidate, distance
+		}
+		element = element.Next()
+	}
+	return best
+}
+
+// remove takes a user out of the queue and returns them, the caller must hold the lock
+func (q *LocalQueue) remove(userId uuid.UUID) *models.Client {
+	element, ok := q.index[userId]
+	if !ok {
+		return nil
+	}
+	client := q.unlink(element)
+	client.Log.Debug("User removed from waiting queue")
+	return client
+}
+
+// unlink drops an element from the queue and its index, the caller must hold the lock
+func (q *LocalQueue) unlink(element *list.Element) *models.Client {
+	client := q.waiting.Remove(element).(*models.Client)
+	delete(q.index, client.UserId)
+	return client
+}
@@ -0,0 +1,226 @@
+package services
+
+import (
+	"context"
+	"realTimeService/broker"
+	"realTimeService/models"
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// scores is a reputation source with fixed scores, zero for anyone not listed
+type scores map[uuid.UUID]float64
+
+// Score returns the user's fixed score
+func (s scores) Score(userId uuid.UUID) float64 {
+	return s[userId]
+}
+
+// testQueues creates the waiting queues every test runs against
+var testQueues = []struct {
+	name     string
+	newQueue func(reputation ReputationSource) WaitingQueue
+}{
+	{"local", func(reputation ReputationSource) WaitingQueue { return NewLocalQueue(reputation) }},
+	{"shared", func(reputation ReputationSource) WaitingQueue {
+		return NewSharedQueue(broker.NewMemoryBroker(), "test", reputation)
+	}},
+}
+
+// enqueue appends waiting users to the queue without matching them with each other
+func enqueue(t *testing.T, queue WaitingQueue, clients ...*models.Client) {
+	t.Helper()
+	switch q := queue.(type) {
+	case *LocalQueue:
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		for _, client := range clients {
+			q.index[client.UserId] = q.waiting.PushBack(client)
+		}
+	case *SharedQueue:
+		for _, client := range clients {
+			entry := q.entry(client.UserId, q.reputation.Score(client.UserId))
+			q.mu.Lock()
+			q.waiting[client.UserId] = sharedWaiter{client: client, entry: entry}
+			q.mu.Unlock()
+			if err := q.broker.Push(context.Background(), sharedQueueKey, entry); err != nil {
+				t.Fatal(err)
+			}
+		}
+	default:
+		t.Fatalf("unknown queue %T", queue)
+	}
+}
+
+// mustMatch matches a new client and returns the stranger it got
+func mustMatch(t *testing.T, queue WaitingQueue) *models.Client {
+	t.Helper()
+	stranger, err := queue.Match(newBenchClient())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stranger == nil {
+		t.Fatal("client was queued, want a match")
+	}
+	return stranger
+}
+
+func TestQueueRemovesUserFromMiddle(t *testing.T) {
+	for _, tc := range testQueues {
+		t.Run(tc.name, func(t *testing.T) {
+			queue := tc.newQueue(scores{})
+			first, middle, last := newBenchClient(), newBenchClient(), newBenchClient()
+			enqueue(t, queue, first, middle, last)
+
+			if err := queue.Remove(middle.UserId); err != nil {
+				t.Fatal(err)
+			}
+			if got := queue.Len(); got != 2 {
+				t.Fatalf("Len = %d, want 2", got)
+			}
+
+			// The others keep their places
+			if got := mustMatch(t, queue); got.UserId != first.UserId {
+				t.Fatalf("matched %s, want the first user", got.UserId)
+			}
+			if got := mustMatch(t, queue); got.UserId != last.UserId {
+				t.Fatalf("matched %s, want the last user", got.UserId)
+			}
+			if got := queue.Len(); got != 0 {
+				t.Fatalf("Len = %d, want 0", got)
+			}
+		})
+	}
+}
+
+func TestQueueComparesLongestWaitingOnly(t *testing.T) {
+	for _, tc := range testQueues {
+		t.Run(tc.name, func(t *testing.T) {
+			waiting := make([]*models.Client, matchCandidates+1)
+			for i := range waiting {
+				waiting[i] = newBenchClient()
+			}
+			client := newBenchClient()
+			reputation := scores{client.UserId: 1}
+
+			// The last candidate is closer than the first, the user behind it is closest
+			reputation[waiting[matchCandidates-1].UserId] = 0.5
+			reputation[waiting[matchCandidates].UserId] = 1
+			queue := tc.newQueue(reputation)
+			enqueue(t, queue, waiting...)
+
+			stranger, err := queue.Match(client)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stranger == nil || stranger.UserId != waiting[matchCandidates-1].UserId {
+				t.Fatalf("matched %v, want the closest of the first %d users", stranger, matchCandidates)
+			}
+		})
+	}
+}
+
+func TestQueueRequeuesStranger(t *testing.T) {
+	for _, tc := range testQueues {
+		t.Run(tc.name, func(t *testing.T) {
+			queue := tc.newQueue(scores{})
+			first, second := newBenchClient(), newBenchClient()
+			enqueue(t, queue, first, second)
+
+			stranger := mustMatch(t, queue)
+			if err := queue.Requeue(stranger); err != nil {
+				t.Fatal(err)
+			}
+			if got := queue.Len(); got != 2 {
+				t.Fatalf("Len = %d, want 2", got)
+			}
+
+			// The shared queue can only append, so the order isn't checked
+			matched := map[uuid.UUID]bool{mustMatch(t, queue).UserId: true, mustMatch(t, queue).UserId: true}
+			if !matched[first.UserId] || !matched[second.UserId] {
+				t.Fatal("requeued user was not matched again")
+			}
+		})
+	}
+}
+
+func TestSharedQueueRequeuesUserOfOtherNode(t *testing.T) {
+	b := broker.NewMemoryBroker()
+	other := NewSharedQueue(b, "other", scores{})
+	queue := NewSharedQueue(b, "test", scores{})
+	remote := newBenchClient()
+	enqueue(t, other, remote)
+
+	stranger := mustMatch(t, queue)
+	if !stranger.IsRemote() || stranger.UserId != remote.UserId {
+		t.Fatalf("matched %v, want the user of the other node", stranger)
+	}
+	if err := queue.Requeue(stranger); err != nil {
+		t.Fatal(err)
+	}
+
+	// The other node still finds its entry, so it can be claimed and removed
+	if got := mustMatch(t, queue); got.UserId != remote.UserId {
+		t.Fatalf("matched %s, want the requeued user", got.UserId)
+	}
+	if err := queue.Requeue(models.NewRemoteClient(uuid.New(), "other")); err == nil {
+		t.Fatal("requeued a user the queue never took")
+	}
+}
+
+func TestQueueMatchesEachUserOnce(t *testing.T) {
+	for _, tc := range testQueues {
+		t.Run(tc.name, func(t *testing.T) {
+			queue := tc.newQueue(scores{})
+			clients := make([]*models.Client, 400)
+			for i := range clients {
+				clients[i] = newBenchClient()
+			}
+
+			var mu sync.Mutex
+			matched := make(map[uuid.UUID]int)
+			var wg sync.WaitGroup
+			for i, client := range clients {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					stranger, err := queue.Match(client)
+					if err != nil {
+						t.Error(err)
+						return
+					}
+					// Every fourth client gives up again
+					if stranger == nil && i%4 == 0 {
+						if err := queue.Remove(client.UserId); err != nil {
+							t.Error(err)
+						}
+					}
+					if stranger == nil {
+						return
+					}
+					mu.Lock()
+					matched[client.UserId]++
+					matched[stranger.UserId]++
+					mu.Unlock()
+				}()
+			}
+			wg.Wait()
+
+			for userId, times := range matched {
+				if times != 1 {
+					t.Fatalf("user %s matched %d times", userId, times)
+				}
+			}
+			for _, userId := range queue.Waiting() {
+				if matched[userId] != 0 {
+					t.Fatalf("matched user %s is still waiting", userId)
+				}
+			}
+			if len(matched)+queue.Len() > len(clients) {
+				t.Fatalf("%d matched and %d waiting out of %d clients", len(matched), queue.Len(), len(clients))
+			}
+		})
+	}
+}
@@ -0,0 +1,370 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"realTimeService/broker"
+	"realTimeService/logging"
+	"realTimeService/models"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// bansKey is the hash of banId -> ban as JSON
+	bansKey = "goroom:bans"
+	// banIndexKey prefixes the hashes of banId -> ban as JSON of each banned
+	// session ("user:<userId>") and address ("ip:<ip>"), to find bans without a scan
+	banIndexKey = "goroom:bans:"
+	// reportsKey is the hash of reportId -> report as JSON
+	reportsKey = "goroom:reports"
+	// reputationKey is the hash of userId -> reputation as JSON
+	reputationKey = "goroom:reputation"
+	// auditKey is the queue of audit entries as JSON, oldest first
+	auditKey = "goroom:audit"
+	// transcriptsKey is the hash of pairId -> transcript as JSON
+	transcriptsKey = "goroom:transcripts"
+	// channelsKey is the hash of code -> private channel as JSON
+	channelsKey = "goroom:channels"
+	// auditLock serializes appending to and trimming the audit trail across nodes
+	auditLock = "goroom:lock:audit"
+	// auditLockTimeout bounds appending an audit entry including waiting for the lock
+	auditLockTimeout = 5 * time.Second
+)
+
+// BrokerStore keeps records as JSON in the hashes and queues of the broker,
+// so with a shared broker every node sees them. With the memory broker they
+// are lost on restart.
+type BrokerStore struct {
+	broker broker.Broker
+}
+
+// NewBrokerStore creates a store keeping its records in the broker
+func NewBrokerStore(b broker.Broker) *BrokerStore {
+	return &BrokerStore{broker: b}
+}
+
+// AddBan stores a new ban. The ban is stored before its indexes and deleted after
+// them, so an index entry left by a failure always has a ban that deletes it.
+func (s *BrokerStore) AddBan(ctx context.Context, ban *models.Ban) error {
+	if err := s.set(ctx, bansKey, ban.ID, ban); err != nil {
+		return err
+	}
+	for _, index := range banIndexes(ban.UserId, ban.IP) {
+		if err := s.set(ctx, index, ban.ID, ban); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteBan removes a ban, returning ErrNotFound if it doesn't exist
+func (s *BrokerStore) DeleteBan(ctx context.Context, banId uuid.UUID) error {
+	data, ok, err := s.broker.Field(ctx, bansKey, banId.String())
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrNotFound
+	}
+	return s.deleteBan(ctx, banId.String(), data)
+}
+
+// Bans returns every stored ban, including expired ones not yet deleted
+func (s *BrokerStore) Bans(ctx context.Context) ([]*models.Ban, error) {
+	bans, err := all[models.Ban](ctx, s.broker, bansKey)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(bans, func(i, j int) bool { return bans[i].CreatedAt.Before(bans[j].CreatedAt) })
+	return bans, nil
+}
+
+// FindBan returns the oldest ban in effect for the session or the address, or ErrNotFound
+func (s *BrokerStore) FindBan(ctx context.Context, userId uuid.UUID, ip string) (*models.Ban, error) {
+	var found *models.Ban
+	now := time.Now()
+	for _, index := range banIndexes(userId, ip) {
+		bans, err := all[models.Ban](ctx, s.broker, index)
+		if err != nil {
+			return nil, err
+		}
+		for _, ban := range bans {
+			if !ban.Expired(now) && (found == nil || ban.CreatedAt.Before(found.CreatedAt)) {
+				found = ban
+			}
+		}
+	}
+	if found == nil {
+		return nil, ErrNotFound
+	}
+	return found, nil
+}
+
+// DeleteExpiredBans removes the bans that expired by now
+func (s *BrokerStore) DeleteExpiredBans(ctx context.Context, now time.Time) error {
+	entries, err := s.broker.Fields(ctx, bansKey)
+	if err != nil {
+		return err
+	}
+	for id, data := range entries {
+		var ban models.Ban
+		if err := json.Unmarshal([]byte(data), &ban); err == nil && !ban.Expired(now) {
+			continue
+		}
+		if err := s.deleteBan(ctx, id, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteBan removes a ban stored as data from the bans and their indexes
+func (s *BrokerStore) deleteBan(ctx context.Context, id, data string) error {
+	var ban models.Ban
+	if err := json.Unmarshal([]byte(data), &ban); err == nil {
+		for _, index := range banIndexes(ban.UserId, ban.IP) {
+			if err := s.broker.DeleteField(ctx, index, id); err != nil {
+				return err
+			}
+		}
+	}
+	return s.broker.DeleteField(ctx, bansKey, id)
+}
+
+// banIndexes returns the hashes indexing the bans of a session and an address
+func banIndexes(userId uuid.UUID, ip string) []string {
+	var indexes []string
+	if userId != uuid.Nil {
+		indexes = append(indexes, banIndexKey+"user:"+userId.String())
+	}
+	if ip != "" {
+		indexes = append(indexes, banIndexKey+"ip:"+ip)
+	}
+	return indexes
+}
+
+// SaveReport stores a new report or replaces an existing one
+func (s *BrokerStore) SaveReport(ctx context.Context, report *models.Report) error {
+	return s.set(ctx, reportsKey, report.ID, report)
+}
+
+// Report returns a report, or ErrNotFound
+func (s *BrokerStore) Report(ctx context.Context, reportId uuid.UUID) (*models.Report, error) {
+	return one[models.Report](ctx, s.broker, reportsKey, reportId)
+}
+
+// Reports returns the reports, only the open ones if openOnly is set
+func (s *BrokerStore) Reports(ctx context.Context, openOnly bool) ([]*models.Report, error) {
+	reports, err := all[models.Report](ctx, s.broker, reportsKey)
+	if err != nil {
+		return nil, err
+	}
+	if openOnly {
+		reports = slices.DeleteFunc(reports, func(report *models.Report) bool { return !report.Open() })
+	}
+	sort.Slice(reports, func(i, j int) bool { return reports[i].CreatedAt.Before(reports[j].CreatedAt) })
+	return reports, nil
+}
+
+// DeleteResolvedReports removes the reports resolved before the given time
+func (s *BrokerStore) DeleteResolvedReports(ctx context.Context, before time.Time) error {
+	return deleteWhere(ctx, s.broker, reportsKey, func(report *models.Report) bool {
+		return !report.Open() && report.ResolvedAt.Before(before)
+	})
+}
+
+// SaveReputation stores a user's score as of its update time
+func (s *BrokerStore) SaveReputation(ctx context.Context, reputation *models.Reputation) error {
+	return s.set(ctx, reputationKey, reputation.UserId, reputation)
+}
+
+// Reputation returns a user's stored score, or ErrNotFound
+func (s *BrokerStore) Reputation(ctx context.Context, userId uuid.UUID) (*models.Reputation, error) {
+	return one[models.Reputation](ctx, s.broker, reputationKey, userId)
+}
+
+// Reputations returns every stored score
+func (s *BrokerStore) Reputations(ctx context.Context) ([]*models.Reputation, error) {
+	return all[models.Reputation](ctx, s.broker, reputationKey)
+}
+
+// DeleteReputation forgets a user's score
+func (s *BrokerStore) DeleteReputation(ctx context.Context, userId uuid.UUID) error {
+	return s.broker.DeleteField(ctx, reputationKey, userId.String())
+}
+
+// AddAuditEntry appends an entry to the audit trail, dropping the oldest beyond keep.
+// A keep of 0 keeps every entry.
+func (s *BrokerStore) AddAuditEntry(ctx context.Context, entry *models.AuditEntry, keep int) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if keep <= 0 {
+		return s.broker.Push(ctx, auditKey, string(data))
+	}
+
+	// Without the lock concurrent appends could each trim the others' entries
+	unlock, err := s.broker.Lock(ctx, auditLock, auditLockTimeout)
+	if err != nil {
+		return fmt.Errorf("error locking audit trail: %w", err)
+	}
+	defer unlock()
+
+	if err := s.broker.Push(ctx, auditKey, string(data)); err != nil {
+		return err
+	}
+
+	members, err := s.broker.Members(ctx, auditKey)
+	if err != nil {
+		return err
+	}
+	for range len(members) - keep {
+		if _, _, err := s.broker.Pop(ctx, auditKey); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AuditEntries returns up to limit of the latest entries, newest first
+func (s *BrokerStore) AuditEntries(ctx context.Context, limit int) ([]*models.AuditEntry, error) {
+	members, err := s.broker.Members(ctx, auditKey)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]*models.AuditEntry, 0, min(limit, len(members)))
+	for _, data := range slices.Backward(members) {
+		if len(entries) == limit {
+			break
+		}
+		var entry models.AuditEntry
+		if err := json.Unmarshal([]byte(data), &entry); err != nil {
+			slog.Warn("Invalid audit entry", logging.Err(err))
+			continue
+		}
+		entries = append(entries, &entry)
+	}
+	return entries, nil
+}
+
+// SaveTranscript stores the transcript of an ended chat
+func (s *BrokerStore) SaveTranscript(ctx context.Context, transcript *models.Transcript) error {
+	return s.set(ctx, transcriptsKey, transcript.PairId, transcript)
+}
+
+// Transcript returns the transcript of a pair, or ErrNotFound
+func (s *BrokerStore) Transcript(ctx context.Context, pairId uuid.UUID) (*models.Transcript, error) {
+	return one[models.Transcript](ctx, s.broker, transcriptsKey, pairId)
+}
+
+// DeleteTranscripts removes the transcripts of chats that ended before the given time
+func (s *BrokerStore) DeleteTranscripts(ctx context.Context, endedBefore time.Time) error {
+	return deleteWhere(ctx, s.broker, transcriptsKey, func(transcript *models.Transcript) bool {
+		return transcript.EndedAt.Before(endedBefore)
+	})
+}
+
+// SaveChannel stores a new private channel or replaces an existing one
+func (s *BrokerStore) SaveChannel(ctx context.Context, channel *models.PrivateChannel) error {
+	data, err := json.Marshal(channel)
+	if err != nil {
+		return err
+	}
+	return s.broker.SetField(ctx, channelsKey, channel.Code, string(data))
+}
+
+// Channel returns the private channel with the code, or ErrNotFound
+func (s *BrokerStore) Channel(ctx context.Context, code string) (*models.PrivateChannel, error) {
+	data, ok, err := s.broker.Field(ctx, channelsKey, code)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrNotFound
+	}
+	var channel models.PrivateChannel
+	if err := json.Unmarshal([]byte(data), &channel); err != nil {
+		return nil, fmt.Errorf("invalid channel in %s: %w", channelsKey, err)
+	}
+	return &channel, nil
+}
+
+// DeleteChannels removes the private channels last used before the given time
+func (s *BrokerStore) DeleteChannels(ctx context.Context, unusedBefore time.Time) error {
+	return deleteWhere(ctx, s.broker, channelsKey, func(channel *models.PrivateChannel) bool {
+		return channel.LastUsedAt.Before(unusedBefore)
+	})
+}
+
+// Close does nothing, the broker is closed by its owner
+func (s *BrokerStore) Close() error {
+	return nil
+}
+
+// set stores a record as JSON in a hash field named by its ID
+func (s *BrokerStore) set(ctx context.Context, hash string, id uuid.UUID, record any) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return s.broker.SetField(ctx, hash, id.String(), string(data))
+}
+
+// one decodes the record stored in a hash field, returning ErrNotFound if it isn't set
+func one[T any](ctx context.Context, b broker.Broker, hash string, id uuid.UUID) (*T, error) {
+	data, ok, err := b.Field(ctx, hash, id.String())
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrNotFound
+	}
+	var record T
+	if err := json.Unmarshal([]byte(data), &record); err != nil {
+		return nil, fmt.Errorf("invalid record %s in %s: %w", id, hash, err)
+	}
+	return &record, nil
+}
+
+// all decodes every record of a hash, skipping invalid ones
+func all[T any](ctx context.Context, b broker.Broker, hash string) ([]*T, error) {
+	entries, err := b.Fields(ctx, hash)
+	if err != nil {
+		return nil, err
+	}
+	records := make([]*T, 0, len(entries))
+	for id, data := range entries {
+		var record T
+		if err := json.Unmarshal([]byte(data), &record); err != nil {
+			slog.Warn("Invalid record", "hash", hash, "id", id, logging.Err(err))
+			continue
+		}
+		records = append(records, &record)
+	}
+	return records, nil
+}
+
+// deleteWhere removes the records of a hash matching the predicate, and invalid ones
+func deleteWhere[T any](ctx context.Context, b broker.Broker, hash string, match func(*T) bool) error {
+	entries, err := b.Fields(ctx, hash)
+	if err != nil {
+		return err
+	}
+	for id, data := range entries {
+		var record T
+		if err := json.Unmarshal([]byte(data), &record); err != nil || match(&record) {
+			if err := b.DeleteField(ctx, hash, id); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,305 @@
+package store
+
+import (
+	"context"
+	"maps"
+	"realTimeService/models"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// MemoryStore keeps everything in this process, for tests and throwaway instances.
+// Records are copied in and out, so callers may change what they get.
+type MemoryStore struct {
+	bans        map[uuid.UUID]*models.Ban
+	reports     map[uuid.UUID]*models.Report
+	reputations map[uuid.UUID]*models.Reputation
+	audit       []*models.AuditEntry // oldest first
+	transcripts map[uuid.UUID]*models.Transcript
+	channels    map[string]*models.PrivateChannel
+	mu          sync.RWMutex
+}
+
+// NewMemoryStore creates an empty in-process store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		bans:        make(map[uuid.UUID]*models.Ban),
+		reports:     make(map[uuid.UUID]*models.Report),
+		reputations: make(map[uuid.UUID]*models.Reputation),
+		audit:       make([]*models.AuditEntry, 0),
+		transcripts: make(map[uuid.UUID]*models.Transcript),
+		channels:    make(map[string]*models.PrivateChannel),
+		mu:          sync.RWMutex{},
+	}
+}
+
+// AddBan stores a new ban
+func (s *MemoryStore) AddBan(ctx context.Context, ban *models.Ban) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.bans[ban.ID] = cloneBan(ban)
+	return nil
+}
+
+// DeleteBan removes a ban, returning ErrNotFound if it doesn't exist
+func (s *MemoryStore) DeleteBan(ctx context.Context, banId uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.bans[banId]; !ok {
+		return ErrNotFound
+	}
+	delete(s.bans, banId)
+	return nil
+}
+
+// Bans returns every stored ban, including expired ones not yet deleted
+func (s *MemoryStore) Bans(ctx context.Context) ([]*models.Ban, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	bans := make([]*models.Ban, 0, len(s.bans))
+	for _, ban := range s.bans {
+		bans = append(bans, cloneBan(ban))
+	}
+	sort.Slice(bans, func(i, j int) bool { return bans[i].CreatedAt.Before(bans[j].CreatedAt) })
+	return bans, nil
+}
+
+// FindBan returns the oldest ban in effect for the session or the address, or ErrNotFound
+func (s *MemoryStore) FindBan(ctx context.Context, userId uuid.UUID, ip string) (*models.Ban, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var found *models.Ban
+	now := time.Now()
+	for _, ban := range s.bans {
+		if ban.Matches(userId, ip) && !ban.Expired(now) && (found == nil || ban.CreatedAt.Before(found.CreatedAt)) {
+			found = ban
+		}
+	}
+	if found == nil {
+		return nil, ErrNotFound
+	}
+	return cloneBan(found), nil
+}
+
+// DeleteExpiredBans removes the bans that expired by now
+func (s *MemoryStore) DeleteExpiredBans(ctx context.Context, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	maps.DeleteFunc(s.bans, func(_ uuid.UUID, ban *models.Ban) bool { return ban.Expired(now) })
+	return nil
+}
+
+// SaveReport stores a new report or replaces an existing one
+func (s *MemoryStore) SaveReport(ctx context.Context, report *models.Report) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reports[report.ID] = cloneReport(report)
+	return nil
+}
+
+// Report returns a report, or ErrNotFound
+func (s *MemoryStore) Report(ctx context.Context, reportId uuid.UUID) (*models.Report, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	report, ok := s.reports[reportId]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return cloneReport(report), nil
+}
+
+// Reports returns the reports, only the open ones if openOnly is set
+func (s *MemoryStore) Reports(ctx context.Context, openOnly bool) ([]*models.Report, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	reports := make([]*models.Report, 0, len(s.reports))
+	for _, report := range s.reports {
+		if !openOnly || report.Open() {
+			reports = append(reports, cloneReport(report))
+		}
+	}
+	sort.Slice(reports, func(i, j int) bool { return reports[i].CreatedAt.Before(reports[j].CreatedAt) })
+	return reports, nil
+}
+
+// DeleteResolvedReports removes the reports resolved before the given time
+func (s *MemoryStore) DeleteResolvedReports(ctx context.Context, before time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	maps.DeleteFunc(s.reports, func(_ uuid.UUID, report *models.Report) bool {
+		return !report.Open() && report.ResolvedAt.Before(before)
+	})
+	return nil
+}
+
+// SaveReputation stores a user's score as of its update time
+func (s *MemoryStore) SaveReputation(ctx context.Context, reputation *models.Reputation) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored := *reputation
+	s.reputations[reputation.UserId] = &stored
+	return nil
+}
+
+// Reputation returns a user's stored score, or ErrNotFound
+func (s *MemoryStore) Reputation(ctx context.Context, userId uuid.UUID) (*models.Reputation, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	reputation, ok := s.reputations[userId]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	stored := *reputation
+	return &stored, nil
+}
+
+// Reputations returns every stored score
+func (s *MemoryStore) Reputations(ctx context.Context) ([]*models.Reputation, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	reputations := make([]*models.Reputation, 0, len(s.reputations))
+	for _, reputation := range s.reputations {
+		stored := *reputation
+		reputations = append(reputations, &stored)
+	}
+	return reputations, nil
+}
+
+// DeleteReputation forgets a user's score
+func (s *MemoryStore) DeleteReputation(ctx context.Context, userId uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.reputations, userId)
+	return nil
+}
+
+// AddAuditEntry appends an entry to the audit trail, dropping the oldest beyond keep.
+// A keep of 0 keeps every entry.
+func (s *MemoryStore) AddAuditEntry(ctx context.Context, entry *models.AuditEntry, keep int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored := *entry
+	s.audit = append(s.audit, &stored)
+	if over := len(s.audit) - keep; keep > 0 && over > 0 {
+		s.audit = slices.Delete(s.audit, 0, over)
+	}
+	return nil
+}
+
+// AuditEntries returns up to limit of the latest entries, newest first
+func (s *MemoryStore) AuditEntries(ctx context.Context, limit int) ([]*models.AuditEntry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	entries := make([]*models.AuditEntry, 0, min(limit, len(s.audit)))
+	for _, entry := range slices.Backward(s.audit) {
+		if len(entries) == limit {
+			break
+		}
+		stored := *entry
+		entries = append(entries, &stored)
+	}
+	return entries, nil
+}
+
+// SaveTranscript stores the transcript of an ended chat
+func (s *MemoryStore) SaveTranscript(ctx context.Context, transcript *models.Transcript) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.transcripts[transcript.PairId] = cloneTranscript(transcript)
+	return nil
+}
+
+// Transcript returns the transcript of a pair, or ErrNotFound
+func (s *MemoryStore) Transcript(ctx context.Context, pairId uuid.UUID) (*models.Transcript, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	transcript, ok := s.transcripts[pairId]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return cloneTranscript(transcript), nil
+}
+
+// DeleteTranscripts removes the transcripts of chats that ended before the given time
+func (s *MemoryStore) DeleteTranscripts(ctx context.Context, endedBefore time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	maps.DeleteFunc(s.transcripts, func(_ uuid.UUID, transcript *models.Transcript) bool {
+		return transcript.EndedAt.Before(endedBefore)
+	})
+	return nil
+}
+
+// SaveChannel stores a new private channel or replaces an existing one
+func (s *MemoryStore) SaveChannel(ctx context.Context, channel *models.PrivateChannel) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored := *channel
+	s.channels[channel.Code] = &stored
+	return nil
+}
+
+// Channel returns the private channel with the code, or ErrNotFound
+func (s *MemoryStore) Channel(ctx context.Context, code string) (*models.PrivateChannel, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	channel, ok := s.channels[code]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	stored := *channel
+	return &stored, nil
+}
+
+// DeleteChannels removes the private channels last used before the given time
+func (s *MemoryStore) DeleteChannels(ctx context.Context, unusedBefore time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	maps.DeleteFunc(s.channels, func(_ string, channel *models.PrivateChannel) bool {
+		return channel.LastUsedAt.Before(unusedBefore)
+	})
+	return nil
+}
+
+// Close does nothing, the records go away with the store
+func (s *MemoryStore) Close() error {
+	return nil
+}
+
+// cloneBan copies a ban so the copy shares nothing with the original
+func cloneBan(ban *models.Ban) *models.Ban {
+	copied := *ban
+	if ban.ExpiresAt != nil {
+		expiresAt := *ban.ExpiresAt
+		copied.ExpiresAt = &expiresAt
+	}
+	return &copied
+}
+
+// cloneReport copies a report so the copy shares nothing with the original
+func cloneReport(report *models.Report) *models.Report {
+	copied := *report
+	if report.ResolvedAt != nil {
+		resolvedAt := *report.ResolvedAt
+		copied.ResolvedAt = &resolvedAt
+	}
+	copied.Snippet = slices.Clone(report.Snippet)
+	return &copied
+}
+
+// cloneTranscript copies a transcript so the copy shares nothing with the original
+func cloneTranscript(transcript *models.Transcript) *models.Transcript {
+	copied := *transcript
+	copied.OptedIn = maps.Clone(transcript.OptedIn)
+	copied.Tokens = maps.Clone(transcript.Tokens)
+	copied.Messages = make([]*models.Message, 0, len(transcript.Messages))
+	for _, message := range transcript.Messages {
+		stored := *message
+		copied.Messages = append(copied.Messages, &stored)
+	}
+	return &copied
+}
@@ -0,0 +1,112 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// migrationFiles holds the schema changes of the SQLite store, named
+// <version>_<description>.sql and applied in order of their version
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// migration is a schema change read from migrationFiles
+type migration struct {
+	version int
+	name    string
+	sql     string
+}
+
+// migrations returns every migration, oldest first
+func migrations() ([]migration, error) {
+	entries, err := fs.ReadDir(migrationFiles, "migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	var list []migration
+	for _, entry := range entries {
+		prefix, _, ok := strings.Cut(entry.Name(), "_")
+		version, err := strconv.Atoi(prefix)
+		if !ok || err != nil || version <= 0 {
+			return nil, fmt.Errorf("migration %s must be named <version>_<description>.sql", entry.Name())
+		}
+		data, err := migrationFiles.ReadFile(path.Join("migrations", entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		if len(list) > 0 && list[len(list)-1].version == version {
+			return nil, fmt.Errorf("migrations %s and %s share version %d", list[len(list)-1].name, entry.Name(), version)
+		}
+		list = append(list, migration{version: version, name: entry.Name(), sql: string(data)})
+	}
+	// ReadDir sorts by name, which orders versions only when they have as many digits
+	for i := 1; i < len(list); i++ {
+		if list[i].version < list[i-1].version {
+			return nil, fmt.Errorf("migration %s is out of order, pad versions to the same width", list[i].name)
+		}
+	}
+	return list, nil
+}
+
+// migrate brings the database schema up to date, applying each missing migration
+// in a transaction of its own. A database migrated by a newer server is refused.
+func migrate(ctx context.Context, db *sql.DB) error {
+	if _, err := db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    INTEGER PRIMARY KEY,
+		applied_at INTEGER NOT NULL
+	)`); err != nil {
+		return fmt.Errorf("error creating migrations table: %w", err)
+	}
+
+	var current int
+	if err := db.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&current); err != nil {
+		return fmt.Errorf("error reading schema version: %w", err)
+	}
+
+	list, err := migrations()
+	if err != nil {
+		return err
+	}
+	if latest := list[len(list)-1].version; current > latest {
+		return fmt.Errorf("database schema version %d is newer than this server's %d", current, latest)
+	}
+
+	for _, m := range list {
+		if m.version <= current {
+			continue
+		}
+		if err := apply(ctx, db, m); err != nil {
+			return fmt.Errorf("error applying migration %s: %w", m.name, err)
+		}
+		slog.Info("Store migration applied", "migration", m.name)
+	}
+	return nil
+}
+
+// apply runs a migration and records it, or neither if it fails
+func apply(ctx context.Context, db *sql.DB, m migration) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, m.sql); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `INSERT INTO schema_migrations (version, applied_at) VALUES (?, ?)`,
+		m.version, time.Now().UnixNano()); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
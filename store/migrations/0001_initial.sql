@@ -0,0 +1,59 @@
+-- Times are Unix nanoseconds, IDs are UUID strings and optional IDs are NULL when unset
+
+CREATE TABLE bans (
+    id         TEXT PRIMARY KEY,
+    user_id    TEXT,
+    ip         TEXT NOT NULL DEFAULT '',
+    reason     TEXT NOT NULL DEFAULT '',
+    created_at INTEGER NOT NULL,
+    expires_at INTEGER
+);
+
+CREATE INDEX bans_expires_at ON bans (expires_at);
+
+CREATE TABLE reports (
+    id          TEXT PRIMARY KEY,
+    pair_id     TEXT NOT NULL,
+    reporter_id TEXT NOT NULL,
+    reported_id TEXT NOT NULL,
+    reported_ip TEXT NOT NULL DEFAULT '',
+    reason      TEXT NOT NULL,
+    details     TEXT NOT NULL DEFAULT '',
+    created_at  INTEGER NOT NULL,
+    resolved_at INTEGER,
+    resolution  TEXT NOT NULL DEFAULT '',
+    ban_id      TEXT,
+    snippet     TEXT NOT NULL DEFAULT '[]' -- JSON array of report lines
+);
+
+CREATE INDEX reports_created_at ON reports (created_at);
+CREATE INDEX reports_resolved_at ON reports (resolved_at);
+
+CREATE TABLE reputations (
+    user_id    TEXT PRIMARY KEY,
+    score      REAL NOT NULL,
+    updated_at INTEGER NOT NULL
+);
+
+CREATE TABLE audit_entries (
+    seq        INTEGER PRIMARY KEY AUTOINCREMENT, -- Order of recording
+    id         TEXT NOT NULL UNIQUE,
+    actor      TEXT NOT NULL,
+    action     TEXT NOT NULL,
+    target     TEXT NOT NULL DEFAULT '',
+    details    TEXT NOT NULL DEFAULT '',
+    created_at INTEGER NOT NULL
+);
+
+CREATE TABLE transcripts (
+    pair_id     TEXT PRIMARY KEY,
+    user1_id    TEXT NOT NULL,
+    user2_id    TEXT NOT NULL,
+    user1_token TEXT NOT NULL,
+    user2_token TEXT NOT NULL,
+    created_at  INTEGER NOT NULL,
+    ended_at    INTEGER NOT NULL,
+    messages    TEXT NOT NULL -- JSON array of messages
+);
+
+CREATE INDEX transcripts_ended_at ON transcripts (ended_at);
@@ -0,0 +1,4 @@
+-- Bans are looked up by session and address on every connection
+
+CREATE INDEX bans_user_id ON bans (user_id);
+CREATE INDEX bans_ip ON bans (ip);
@@ -0,0 +1,11 @@
+-- Private channels of users who agreed to stay in touch, looked up by code
+
+CREATE TABLE channels (
+    code         TEXT PRIMARY KEY,
+    user1_id     TEXT NOT NULL,
+    user2_id     TEXT NOT NULL,
+    created_at   INTEGER NOT NULL,
+    last_used_at INTEGER NOT NULL
+);
+
+CREATE INDEX channels_last_used_at ON channels (last_used_at);
@@ -0,0 +1,458 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"realTimeService/models"
+	"time"
+
+	"github.com/google/uuid"
+	_ "modernc.org/sqlite"
+)
+
+// migrateTimeout bounds bringing the schema up to date when opening the database
+const migrateTimeout = time.Minute
+
+// SQLiteStore keeps records in an SQLite database file, so they survive restarts.
+// It suits a single node: other nodes can't share the file.
+type SQLiteStore struct {
+	db *sql.DB
+}
+
+// OpenSQLiteStore opens the database at path, creating it readable by this user
+// only if it doesn't exist, and applies the migrations it is missing
+func OpenSQLiteStore(path string) (*SQLiteStore, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("error opening store: %w", err)
+	}
+	file.Close()
+
+	// Writers wait for each other rather than failing, and readers don't block the writer
+	pragmas := url.Values{"_pragma": {"busy_timeout(5000)", "journal_mode(WAL)", "synchronous(NORMAL)"}}
+	db, err := sql.Open("sqlite", "file:"+path+"?"+pragmas.Encode())
+	if err != nil {
+		return nil, fmt.Errorf("error opening store: %w", err)
+	}
+	// SQLite allows one writer at a time; a single connection avoids busy errors
+	db.SetMaxOpenConns(1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), migrateTimeout)
+	defer cancel()
+	if err := migrate(ctx, db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &SQLiteStore{db: db}, nil
+}
+
+// AddBan stores a new ban
+func (s *SQLiteStore) AddBan(ctx context.Context, ban *models.Ban) error {
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO bans (id, user_id, ip, reason, created_at, expires_at) VALUES (?, ?, ?, ?, ?, ?)`,
+		ban.ID.String(), nullID(ban.UserId), ban.IP, ban.Reason, ban.CreatedAt.UnixNano(), nullTime(ban.ExpiresAt))
+	return err
+}
+
+// DeleteBan removes a ban, returning ErrNotFound if it doesn't exist
+func (s *SQLiteStore) DeleteBan(ctx context.Context, banId uuid.UUID) error {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM bans WHERE id = ?`, banId.String())
+	if err != nil {
+		return err
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Bans returns every stored ban, including expired ones not yet deleted
+func (s *SQLiteStore) Bans(ctx context.Context) ([]*models.Ban, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT id, user_id, ip, reason, created_at, expires_at FROM bans ORDER BY created_at`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	bans := make([]*models.Ban, 0)
+	for rows.Next() {
+		var (
+			ban       models.Ban
+			id        string
+			userId    sql.NullString
+			createdAt int64
+			expiresAt sql.NullInt64
+		)
+		if err := rows.Scan(&id, &userId, &ban.IP, &ban.Reason, &createdAt, &expiresAt); err != nil {
+			return nil, err
+		}
+		ban.ID = parseID(id)
+		ban.UserId = parseID(userId.String)
+		ban.CreatedAt = time.Unix(0, createdAt)
+		ban.ExpiresAt = timeOf(expiresAt)
+		bans = append(bans, &ban)
+	}
+	return bans, rows.Err()
+}
+
+// FindBan returns the oldest ban in effect for the session or the address, or ErrNotFound
+func (s *SQLiteStore) FindBan(ctx context.Context, userId uuid.UUID, ip string) (*models.Ban, error) {
+	var (
+		ban       models.Ban
+		id        string
+		banned    sql.NullString
+		createdAt int64
+		expiresAt sql.NullInt64
+	)
+	// NULL parameters match nothing, so an empty address doesn't match session-only bans
+	err := s.db.QueryRowContext(ctx,
+		`SELECT id, user_id, ip, reason, created_at, expires_at FROM bans
+		WHERE (user_id = ? OR ip = ?) AND (expires_at IS NULL OR expires_at > ?)
+		ORDER BY created_at LIMIT 1`,
+		nullID(userId), sql.NullString{String: ip, Valid: ip != ""}, time.Now().UnixNano(),
+	).Scan(&id, &banned, &ban.IP, &ban.Reason, &createdAt, &expiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	ban.ID = parseID(id)
+	ban.UserId = parseID(banned.String)
+	ban.CreatedAt = time.Unix(0, createdAt)
+	ban.ExpiresAt = timeOf(expiresAt)
+	return &ban, nil
+}
+
+// DeleteExpiredBans removes the bans that expired by now
+func (s *SQLiteStore) DeleteExpiredBans(ctx context.Context, now time.Time) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM bans WHERE expires_at <= ?`, now.UnixNano())
+	return err
+}
+
+// SaveReport stores a new report or replaces an existing one
+func (s *SQLiteStore) SaveReport(ctx context.Context, report *models.Report) error {
+	snippet, err := json.Marshal(report.Snippet)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx,
+		`INSERT OR REPLACE INTO reports (id, pair_id, reporter_id, reported_id, reported_ip, reason, details,
+			created_at, resolved_at, resolution, ban_id, snippet)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		report.ID.String(), report.PairId.String(), report.ReporterId.String(), report.ReportedId.String(),
+		report.ReportedIP, report.Reason, report.Details, report.CreatedAt.UnixNano(),
+		nullTime(report.ResolvedAt), report.Resolution, nullID(report.BanId), string(snippet))
+	return err
+}
+
+// Report returns a report, or ErrNotFound
+func (s *SQLiteStore) Report(ctx context.Context, reportId uuid.UUID) (*models.Report, error) {
+	reports, err := s.queryReports(ctx, `WHERE id = ?`, reportId.String())
+	if err != nil {
+		return nil, err
+	}
+	if len(reports) == 0 {
+		return nil, ErrNotFound
+	}
+	return reports[0], nil
+}
+
+// Reports returns the reports, only the open ones if openOnly is set
+func (s *SQLiteStore) Reports(ctx context.Context, openOnly bool) ([]*models.Report, error) {
+	if openOnly {
+		return s.queryReports(ctx, `WHERE resolved_at IS NULL ORDER BY created_at`)
+	}
+	return s.queryReports(ctx, `ORDER BY created_at`)
+}
+
+// DeleteResolvedReports removes the reports resolved before the given time
+func (s *SQLiteStore) DeleteResolvedReports(ctx context.Context, before time.Time) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM reports WHERE resolved_at < ?`, before.UnixNano())
+	return err
+}
+
+// queryReports returns the reports selected by the clause following FROM
+func (s *SQLiteStore) queryReports(ctx context.Context, clause string, args ...any) ([]*models.Report, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT id, pair_id, reporter_id, reported_id, reported_ip, reason, details,
+			created_at, resolved_at, resolution, ban_id, snippet
+		FROM reports `+clause, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reports := make([]*models.Report, 0)
+	for rows.Next() {
+		var (
+			report                             models.Report
+			id, pairId, reporterId, reportedId string
+			createdAt                          int64
+			resolvedAt                         sql.NullInt64
+			banId                              sql.NullString
+			snippet                            string
+		)
+		if err := rows.Scan(&id, &pairId, &reporterId, &reportedId, &report.ReportedIP, &report.Reason,
+			&report.Details, &createdAt, &resolvedAt, &report.Resolution, &banId, &snippet); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(snippet), &report.Snippet); err != nil {
+			return nil, fmt.Errorf("invalid snippet of report %s: %w", id, err)
+		}
+		report.ID = parseID(id)
+		report.PairId = parseID(pairId)
+		report.ReporterId = parseID(reporterId)
+		report.ReportedId = parseID(reportedId)
+		report.CreatedAt = time.Unix(0, createdAt)
+		report.ResolvedAt = timeOf(resolvedAt)
+		report.BanId = parseID(banId.String)
+		reports = append(reports, &report)
+	}
+	return reports, rows.Err()
+}
+
+// SaveReputation stores a user's score as of its update time
+func (s *SQLiteStore) SaveReputation(ctx context.Context, reputation *models.Reputation) error {
+	_, err := s.db.ExecContext(ctx,
+		`INSERT OR REPLACE INTO reputations (user_id, score, updated_at) VALUES (?, ?, ?)`,
+		reputation.UserId.String(), reputation.Score, reputation.UpdatedAt.UnixNano())
+	return err
+}
+
+// Reputation returns a user's stored score, or ErrNotFound
+func (s *SQLiteStore) Reputation(ctx context.Context, userId uuid.UUID) (*models.Reputation, error) {
+	reputation := models.Reputation{UserId: userId}
+	var updatedAt int64
+	err := s.db.QueryRowContext(ctx, `SELECT score, updated_at FROM reputations WHERE user_id = ?`,
+		userId.String()).Scan(&reputation.Score, &updatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	reputation.UpdatedAt = time.Unix(0, updatedAt)
+	return &reputation, nil
+}
+
+// Reputations returns every stored score
+func (s *SQLiteStore) Reputations(ctx context.Context) ([]*models.Reputation, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT user_id, score, updated_at FROM reputations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reputations := make([]*models.Reputation, 0)
+	for rows.Next() {
+		var (
+			reputation models.Reputation
+			userId     string
+			updatedAt  int64
+		)
+		if err := rows.Scan(&userId, &reputation.Score, &updatedAt); err != nil {
+			return nil, err
+		}
+		reputation.UserId = parseID(userId)
+		reputation.UpdatedAt = time.Unix(0, updatedAt)
+		reputations = append(reputations, &reputation)
+	}
+	return reputations, rows.Err()
+}
+
+// DeleteReputation forgets a user's score
+func (s *SQLiteStore) DeleteReputation(ctx context.Context, userId uuid.UUID) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM reputations WHERE user_id = ?`, userId.String())
+	return err
+}
+
+// AddAuditEntry appends an entry to the audit trail, dropping the oldest beyond keep.
+// A keep of 0 keeps every entry.
+func (s *SQLiteStore) AddAuditEntry(ctx context.Context, entry *models.AuditEntry, keep int) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO audit_entries (id, actor, action, target, details, created_at) VALUES (?, ?, ?, ?, ?, ?)`,
+		entry.ID.String(), entry.Actor, string(entry.Action), entry.Target, entry.Details,
+		entry.CreatedAt.UnixNano()); err != nil {
+		return err
+	}
+	if keep > 0 {
+		if _, err := tx.ExecContext(ctx,
+			`DELETE FROM audit_entries WHERE seq <= (SELECT MAX(seq) FROM audit_entries) - ?`, keep); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// AuditEntries returns up to limit of the latest entries, newest first
+func (s *SQLiteStore) AuditEntries(ctx context.Context, limit int) ([]*models.AuditEntry, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT id, actor, action, target, details, created_at FROM audit_entries ORDER BY seq DESC LIMIT ?`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := make([]*models.AuditEntry, 0)
+	for rows.Next() {
+		var (
+			entry     models.AuditEntry
+			id        string
+			createdAt int64
+		)
+		if err := rows.Scan(&id, &entry.Actor, &entry.Action, &entry.Target, &entry.Details, &createdAt); err != nil {
+			return nil, err
+		}
+		entry.ID = parseID(id)
+		entry.CreatedAt = time.Unix(0, createdAt)
+		entries = append(entries, &entry)
+	}
+	return entries, rows.Err()
+}
+
+// SaveTranscript stores the transcript of an ended chat
+func (s *SQLiteStore) SaveTranscript(ctx context.Context, transcript *models.Transcript) error {
+	messages, err := json.Marshal(transcript.Messages)
+	if err != nil {
+		return err
+	}
+	user1, user2 := transcript.Users[0], transcript.Users[1]
+	_, err = s.db.ExecContext(ctx,
+		`INSERT OR REPLACE INTO transcripts (pair_id, user1_id, user2_id, user1_token, user2_token,
+			created_at, ended_at, messages)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		transcript.PairId.String(), user1.String(), user2.String(), transcript.Tokens[user1],
+		transcript.Tokens[user2], transcript.CreatedAt.UnixNano(), transcript.EndedAt.UnixNano(), string(messages))
+	return err
+}
+
+// Transcript returns the transcript of a pair, or ErrNotFound.
+// Stored transcripts were recorded with both users opted in.
+func (s *SQLiteStore) Transcript(ctx context.Context, pairId uuid.UUID) (*models.Transcript, error) {
+	var (
+		user1, user2, token1, token2 string
+		createdAt, endedAt           int64
+		messages                     string
+	)
+	err := s.db.QueryRowContext(ctx,
+		`SELECT user1_id, user2_id, user1_token, user2_token, created_at, ended_at, messages
+		FROM transcripts WHERE pair_id = ?`, pairId.String()).
+		Scan(&user1, &user2, &token1, &token2, &createdAt, &endedAt, &messages)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	transcript := &models.Transcript{
+		PairId:    pairId,
+		Users:     [2]uuid.UUID{parseID(user1), parseID(user2)},
+		CreatedAt: time.Unix(0, createdAt),
+		EndedAt:   time.Unix(0, endedAt),
+	}
+	transcript.OptedIn = map[uuid.UUID]bool{transcript.Users[0]: true, transcript.Users[1]: true}
+	transcript.Tokens = map[uuid.UUID]string{transcript.Users[0]: token1, transcript.Users[1]: token2}
+	if err := json.Unmarshal([]byte(messages), &transcript.Messages); err != nil {
+		return nil, fmt.Errorf("invalid messages of transcript %s: %w", pairId, err)
+	}
+	return transcript, nil
+}
+
+// DeleteTranscripts removes the transcripts of chats that ended before the given time
+func (s *SQLiteStore) DeleteTranscripts(ctx context.Context, endedBefore time.Time) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM transcripts WHERE ended_at < ?`, endedBefore.UnixNano())
+	return err
+}
+
+// SaveChannel stores a new private channel or replaces an existing one
+func (s *SQLiteStore) SaveChannel(ctx context.Context, channel *models.PrivateChannel) error {
+	_, err := s.db.ExecContext(ctx,
+		`INSERT OR REPLACE INTO channels (code, user1_id, user2_id, created_at, last_used_at)
+		VALUES (?, ?, ?, ?, ?)`,
+		channel.Code, channel.Members[0].String(), channel.Members[1].String(),
+		channel.CreatedAt.UnixNano(), channel.LastUsedAt.UnixNano())
+	return err
+}
+
+// Channel returns the private channel with the code, or ErrNotFound
+func (s *SQLiteStore) Channel(ctx context.Context, code string) (*models.PrivateChannel, error) {
+	var (
+		user1, user2          string
+		createdAt, lastUsedAt int64
+	)
+	err := s.db.QueryRowContext(ctx,
+		`SELECT user1_id, user2_id, created_at, last_used_at FROM channels WHERE code = ?`, code).
+		Scan(&user1, &user2, &createdAt, &lastUsedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &models.PrivateChannel{
+		Code:       code,
+		Members:    [2]uuid.UUID{parseID(user1), parseID(user2)},
+		CreatedAt:  time.Unix(0, createdAt),
+		LastUsedAt: time.Unix(0, lastUsedAt),
+	}, nil
+}
+
+// DeleteChannels removes the private channels last used before the given time
+func (s *SQLiteStore) DeleteChannels(ctx context.Context, unusedBefore time.Time) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM channels WHERE last_used_at < ?`, unusedBefore.UnixNano())
+	return err
+}
+
+// Close closes the database
+func (s *SQLiteStore) Close() error {
+	return s.db.Close()
+}
+
+// nullID stores an unset ID as NULL
+func nullID(id uuid.UUID) any {
+	if id == uuid.Nil {
+		return nil
+	}
+	return id.String()
+}
+
+// parseID reads a stored ID, uuid.Nil if it is empty or invalid
+func parseID(s string) uuid.UUID {
+	id, _ := uuid.Parse(s)
+	return id
+}
+
+// nullTime stores an unset time as NULL
+func nullTime(t *time.Time) any {
+	if t == nil {
+		return nil
+	}
+	return t.UnixNano()
+}
+
+// timeOf reads a nullable stored time
+func timeOf(n sql.NullInt64) *time.Time {
+	if !n.Valid {
+		return nil
+	}
+	t := time.Unix(0, n.Int64)
+	return &t
+}
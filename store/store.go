@@ -0,0 +1,96 @@
+// Package store keeps the data that must outlive a chat: bans, reports, reputation
+// scores, the moderators' audit trail, the transcripts users chose to keep and the
+// private channels of users who stayed in touch.
+// Live chat state, such as clients, pairs and the waiting queue, stays in memory.
+package store
+
+import (
+	"context"
+	"errors"
+	"realTimeService/models"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Drivers selecting a store implementation
+const (
+	DriverBroker = "broker" // In the broker, shared by every node using it
+	DriverMemory = "memory" // In this process, lost on restart
+	DriverSQLite = "sqlite" // In an SQLite database file, surviving restarts
+)
+
+// ErrNotFound is returned when the requested record doesn't exist
+var ErrNotFound = errors.New("not found")
+
+// Store persists bans, reports, reputation scores, audit entries, transcripts and private channels.
+// Lists are returned oldest first unless stated otherwise.
+type Store interface {
+	// AddBan stores a new ban
+	AddBan(ctx context.Context, ban *models.Ban) error
+
+	// DeleteBan removes a ban, returning ErrNotFound if it doesn't exist
+	DeleteBan(ctx context.Context, banId uuid.UUID) error
+
+	// Bans returns every stored ban, including expired ones not yet deleted
+	Bans(ctx context.Context) ([]*models.Ban, error)
+
+	// FindBan returns the oldest ban in effect for the session or the address,
+	// or ErrNotFound. It is looked up by session and address rather than scanned.
+	FindBan(ctx context.Context, userId uuid.UUID, ip string) (*models.Ban, error)
+
+	// DeleteExpiredBans removes the bans that expired by now
+	DeleteExpiredBans(ctx context.Context, now time.Time) error
+
+	// SaveReport stores a new report or replaces an existing one
+	SaveReport(ctx context.Context, report *models.Report) error
+
+	// Report returns a report, or ErrNotFound
+	Report(ctx context.Context, reportId uuid.UUID) (*models.Report, error)
+
+	// Reports returns the reports, only the open ones if openOnly is set
+	Reports(ctx context.Context, openOnly bool) ([]*models.Report, error)
+
+	// DeleteResolvedReports removes the reports resolved before the given time
+	DeleteResolvedReports(ctx context.Context, before time.Time) error
+
+	// SaveReputation stores a user's score as of its update time
+	SaveReputation(ctx context.Context, reputation *models.Reputation) error
+
+	// Reputation returns a user's stored score, or ErrNotFound
+	Reputation(ctx context.Context, userId uuid.UUID) (*models.Reputation, error)
+
+	// Reputations returns every stored score
+	Reputations(ctx context.Context) ([]*models.Reputation, error)
+
+	// DeleteReputation forgets a user's score
+	DeleteReputation(ctx context.Context, userId uuid.UUID) error
+
+	// AddAuditEntry appends an entry to the audit trail, dropping the oldest beyond keep.
+	// A keep of 0 keeps every entry.
+	AddAuditEntry(ctx context.Context, entry *models.AuditEntry, keep int) error
+
+	// AuditEntries returns up to limit of the latest entries, newest first
+	AuditEntries(ctx context.Context, limit int) ([]*models.AuditEntry, error)
+
+	// SaveTranscript stores the transcript of an ended chat
+	SaveTranscript(ctx context.Context, transcript *models.Transcript) error
+
+	// Transcript returns the transcript of a pair, or ErrNotFound
+	Transcript(ctx context.Context, pairId uuid.UUID) (*models.Transcript, error)
+
+	// SaveChannel stores a new private channel or replaces an existing one
+	SaveChannel(ctx context.Context, channel *models.PrivateChannel) error
+
+	// Channel returns the private channel with the code, or ErrNotFound
+	Channel(ctx context.Context, code string) (*models.PrivateChannel, error)
+
+	// DeleteChannels removes the private channels last used before the given time
+	DeleteChannels(ctx context.Context, unusedBefore time.Time) error
+
+	// DeleteTranscripts removes the transcripts of chats that ended before the given time
+	DeleteTranscripts(ctx context.Context, endedBefore time.Time) error
+
+	// Close releases the store's resources
+	Close() error
+}
@@ -0,0 +1,352 @@
+package store_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"realTimeService/broker"
+	"realTimeService/broker/redistest"
+	"realTimeService/models"
+	"realTimeService/store"
+
+	"github.com/google/uuid"
+)
+
+// drivers creates each store implementation, empty
+var drivers = []struct {
+	name     string
+	newStore func(t *testing.T) store.Store
+}{
+	{"memory", func(t *testing.T) store.Store { return store.NewMemoryStore() }},
+	{"sqlite", func(t *testing.T) store.Store {
+		st, err := store.OpenSQLiteStore(filepath.Join(t.TempDir(), "goroom.db"))
+		if err != nil {
+			t.Fatalf("OpenSQLiteStore: %v", err)
+		}
+		return st
+	}},
+	{"broker", func(t *testing.T) store.Store { return store.NewBrokerStore(broker.NewMemoryBroker()) }},
+	{"broker/redis", func(t *testing.T) store.Store {
+		server, err := redistest.NewServer()
+		if err != nil {
+			t.Fatalf("starting redistest server: %v", err)
+		}
+		b := broker.NewRedisBroker(server.Addr(), "")
+		t.Cleanup(func() {
+			b.Close()
+			server.Close()
+		})
+		return store.NewBrokerStore(b)
+	}},
+}
+
+// forEachDriver runs the test against every store implementation
+func forEachDriver(t *testing.T, test func(t *testing.T, st store.Store)) {
+	for _, driver := range drivers {
+		t.Run(driver.name, func(t *testing.T) {
+			st := driver.newStore(t)
+			t.Cleanup(func() { st.Close() })
+			test(t, st)
+		})
+	}
+}
+
+// at returns a time the given number of minutes from now, without the monotonic
+// reading that stores don't keep
+func at(minutes int) time.Time {
+	return time.Now().Round(0).Add(time.Duration(minutes) * time.Minute)
+}
+
+func TestStoreBans(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, st store.Store) {
+		ctx := context.Background()
+		expiredAt, expiresAt := at(-1), at(60)
+		session := &models.Ban{ID: uuid.New(), UserId: uuid.New(), Reason: "spam", CreatedAt: at(-30)}
+		address := &models.Ban{ID: uuid.New(), IP: "10.0.0.1", CreatedAt: at(-20), ExpiresAt: &expiresAt}
+		expired := &models.Ban{ID: uuid.New(), UserId: uuid.New(), IP: "10.0.0.2", CreatedAt: at(-10), ExpiresAt: &expiredAt}
+		for _, ban := range []*models.Ban{expired, session, address} {
+			if err := st.AddBan(ctx, ban); err != nil {
+				t.Fatalf("AddBan: %v", err)
+			}
+		}
+
+		bans, err := st.Bans(ctx)
+		if err != nil {
+			t.Fatalf("Bans: %v", err)
+		}
+		if len(bans) != 3 || bans[0].ID != session.ID || bans[1].ID != address.ID || bans[2].ID != expired.ID {
+			t.Fatalf("Bans = %v, want every ban oldest first", bans)
+		}
+
+		found, err := st.FindBan(ctx, session.UserId, "10.0.0.9")
+		if err != nil || found.ID != session.ID || found.Reason != "spam" || !found.CreatedAt.Equal(session.CreatedAt) {
+			t.Fatalf("FindBan by session = %+v, %v, want the session ban", found, err)
+		}
+		found, err = st.FindBan(ctx, uuid.New(), "10.0.0.1")
+		if err != nil || found.ID != address.ID || !found.ExpiresAt.Equal(expiresAt) {
+			t.Fatalf("FindBan by address = %+v, %v, want the address ban", found, err)
+		}
+		// An unknown address must not match the bans without one
+		if found, err := st.FindBan(ctx, uuid.New(), ""); !errors.Is(err, store.ErrNotFound) {
+			t.Fatalf("FindBan without an address = %+v, %v, want ErrNotFound", found, err)
+		}
+		if found, err := st.FindBan(ctx, expired.UserId, expired.IP); !errors.Is(err, store.ErrNotFound) {
+			t.Fatalf("FindBan of an expired ban = %+v, %v, want ErrNotFound", found, err)
+		}
+
+		if err := st.DeleteExpiredBans(ctx, time.Now()); err != nil {
+			t.Fatalf("DeleteExpiredBans: %v", err)
+		}
+		if err := st.DeleteBan(ctx, session.ID); err != nil {
+			t.Fatalf("DeleteBan: %v", err)
+		}
+		if err := st.DeleteBan(ctx, session.ID); !errors.Is(err, store.ErrNotFound) {
+			t.Fatalf("DeleteBan of a deleted ban = %v, want ErrNotFound", err)
+		}
+		if _, err := st.FindBan(ctx, session.UserId, ""); !errors.Is(err, store.ErrNotFound) {
+			t.Fatalf("FindBan of a deleted ban = %v, want ErrNotFound", err)
+		}
+		bans, err = st.Bans(ctx)
+		if err != nil || len(bans) != 1 || bans[0].ID != address.ID {
+			t.Fatalf("Bans = %v, %v, want only the address ban", bans, err)
+		}
+	})
+}
+
+func TestStoreReports(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, st store.Store) {
+		ctx := context.Background()
+		resolvedAt := at(-5)
+		open := &models.Report{
+			ID: uuid.New(), PairId: uuid.New(), ReporterId: uuid.New(), ReportedId: uuid.New(),
+			ReportedIP: "10.0.0.1", Reason: "spam", Details: "links", CreatedAt: at(-20),
+			Snippet: []models.ReportLine{{Reported: true, Text: "buy now", SentAt: at(-21)}},
+		}
+		resolved := &models.Report{
+			ID: uuid.New(), PairId: uuid.New(), ReporterId: uuid.New(), ReportedId: uuid.New(),
+			Reason: "other", CreatedAt: at(-10), ResolvedAt: &resolvedAt, Resolution: "dismissed",
+		}
+		for _, report := range []*models.Report{resolved, open} {
+			if err := st.SaveReport(ctx, report); err != nil {
+				t.Fatalf("SaveReport: %v", err)
+			}
+		}
+
+		got, err := st.Report(ctx, open.ID)
+		if err != nil {
+			t.Fatalf("Report: %v", err)
+		}
+		if got.ReportedIP != open.ReportedIP || got.Details != open.Details || !got.Open() ||
+			len(got.Snippet) != 1 || got.Snippet[0].Text != "buy now" || !got.Snippet[0].Reported {
+			t.Fatalf("Report = %+v, want %+v", got, open)
+		}
+		if _, err := st.Report(ctx, uuid.New()); !errors.Is(err, store.ErrNotFound) {
+			t.Fatalf("Report of an unknown ID = %v, want ErrNotFound", err)
+		}
+
+		reports, err := st.Reports(ctx, false)
+		if err != nil || len(reports) != 2 || reports[0].ID != open.ID {
+			t.Fatalf("Reports = %v, %v, want both oldest first", reports, err)
+		}
+		reports, err = st.Reports(ctx, true)
+		if err != nil || len(reports) != 1 || reports[0].ID != open.ID {
+			t.Fatalf("open Reports = %v, %v, want the open one", reports, err)
+		}
+
+		if err := st.DeleteResolvedReports(ctx, time.Now()); err != nil {
+			t.Fatalf("DeleteResolvedReports: %v", err)
+		}
+		if _, err := st.Report(ctx, resolved.ID); !errors.Is(err, store.ErrNotFound) {
+			t.Fatalf("Report of a deleted report = %v, want ErrNotFound", err)
+		}
+		if _, err := st.Report(ctx, open.ID); err != nil {
+			t.Fatalf("open report deleted: %v", err)
+		}
+	})
+}
+
+func TestStoreReputations(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, st store.Store) {
+		ctx := context.Background()
+		reputation := &models.Reputation{UserId: uuid.New(), Score: -1.5, UpdatedAt: at(0)}
+		if err := st.SaveReputation(ctx, reputation); err != nil {
+			t.Fatalf("SaveReputation: %v", err)
+		}
+		reputation.Score = 2
+		if err := st.SaveReputation(ctx, reputation); err != nil {
+			t.Fatalf("SaveReputation: %v", err)
+		}
+
+		got, err := st.Reputation(ctx, reputation.UserId)
+		if err != nil || got.Score != 2 || !got.UpdatedAt.Equal(reputation.UpdatedAt) {
+			t.Fatalf("Reputation = %+v, %v, want %+v", got, err, reputation)
+		}
+		all, err := st.Reputations(ctx)
+		if err != nil || len(all) != 1 {
+			t.Fatalf("Reputations = %v, %v, want one score", all, err)
+		}
+
+		if err := st.DeleteReputation(ctx, reputation.UserId); err != nil {
+			t.Fatalf("DeleteReputation: %v", err)
+		}
+		if _, err := st.Reputation(ctx, reputation.UserId); !errors.Is(err, store.ErrNotFound) {
+			t.Fatalf("Reputation after deleting = %v, want ErrNotFound", err)
+		}
+	})
+}
+
+func TestStoreAuditEntries(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, st store.Store) {
+		ctx := context.Background()
+		var added []*models.AuditEntry
+		for i := range 3 {
+			entry := &models.AuditEntry{
+				ID: uuid.New(), Actor: "admin", Action: models.AuditSignIn, Target: "target",
+				Details: "details", CreatedAt: at(i),
+			}
+			if err := st.AddAuditEntry(ctx, entry, 2); err != nil {
+				t.Fatalf("AddAuditEntry: %v", err)
+			}
+			added = append(added, entry)
+		}
+
+		entries, err := st.AuditEntries(ctx, 10)
+		if err != nil || len(entries) != 2 || entries[0].ID != added[2].ID || entries[1].ID != added[1].ID {
+			t.Fatalf("AuditEntries = %v, %v, want the 2 kept newest first", entries, err)
+		}
+		if entries[0].Actor != "admin" || entries[0].Action != models.AuditSignIn || !entries[0].CreatedAt.Equal(added[2].CreatedAt) {
+			t.Fatalf("AuditEntries[0] = %+v, want %+v", entries[0], added[2])
+		}
+		entries, err = st.AuditEntries(ctx, 1)
+		if err != nil || len(entries) != 1 || entries[0].ID != added[2].ID {
+			t.Fatalf("AuditEntries(1) = %v, %v, want the newest", entries, err)
+		}
+	})
+}
+
+func TestStoreKeepsAuditEntriesConcurrently(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, st store.Store) {
+		ctx := context.Background()
+		var wg sync.WaitGroup
+		for i := range 20 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				entry := &models.AuditEntry{ID: uuid.New(), Actor: "admin", Action: models.AuditSignIn, CreatedAt: at(i)}
+				if err := st.AddAuditEntry(ctx, entry, 5); err != nil {
+					t.Errorf("AddAuditEntry: %v", err)
+				}
+			}()
+		}
+		wg.Wait()
+
+		entries, err := st.AuditEntries(ctx, 50)
+		if err != nil || len(entries) != 5 {
+			t.Fatalf("AuditEntries = %d entries, %v, want the 5 kept", len(entries), err)
+		}
+	})
+}
+
+func TestStoreKeepsEveryAuditEntryWithoutLimit(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, st store.Store) {
+		ctx := context.Background()
+		for i := range 20 {
+			entry := &models.AuditEntry{ID: uuid.New(), Actor: "admin", Action: models.AuditSignIn, CreatedAt: at(i)}
+			if err := st.AddAuditEntry(ctx, entry, 0); err != nil {
+				t.Fatalf("AddAuditEntry: %v", err)
+			}
+		}
+
+		entries, err := st.AuditEntries(ctx, 50)
+		if err != nil || len(entries) != 20 {
+			t.Fatalf("AuditEntries = %d entries, %v, want all 20", len(entries), err)
+		}
+	})
+}
+
+func TestStoreTranscripts(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, st store.Store) {
+		ctx := context.Background()
+		user1, user2 := uuid.New(), uuid.New()
+		transcript := &models.Transcript{
+			PairId:    uuid.New(),
+			Users:     [2]uuid.UUID{user1, user2},
+			OptedIn:   map[uuid.UUID]bool{user1: true, user2: true},
+			Tokens:    map[uuid.UUID]string{user1: "token1", user2: "token2"},
+			Messages:  []*models.Message{{ID: uuid.New(), Type: "message", Text: "hi", UserId: user1, Timestamp: at(-10)}},
+			CreatedAt: at(-15),
+			EndedAt:   at(-5),
+		}
+		if err := st.SaveTranscript(ctx, transcript); err != nil {
+			t.Fatalf("SaveTranscript: %v", err)
+		}
+
+		got, err := st.Transcript(ctx, transcript.PairId)
+		if err != nil {
+			t.Fatalf("Transcript: %v", err)
+		}
+		if got.Users != transcript.Users || got.Tokens[user2] != "token2" || !got.EndedAt.Equal(transcript.EndedAt) ||
+			len(got.Messages) != 1 || got.Messages[0].Text != "hi" {
+			t.Fatalf("Transcript = %+v, want %+v", got, transcript)
+		}
+		if _, err := st.Transcript(ctx, uuid.New()); !errors.Is(err, store.ErrNotFound) {
+			t.Fatalf("Transcript of an unknown pair = %v, want ErrNotFound", err)
+		}
+
+		if err := st.DeleteTranscripts(ctx, at(-6)); err != nil {
+			t.Fatalf("DeleteTranscripts: %v", err)
+		}
+		if _, err := st.Transcript(ctx, transcript.PairId); err != nil {
+			t.Fatalf("transcript ended after the cutoff deleted: %v", err)
+		}
+		if err := st.DeleteTranscripts(ctx, time.Now()); err != nil {
+			t.Fatalf("DeleteTranscripts: %v", err)
+		}
+		if _, err := st.Transcript(ctx, transcript.PairId); !errors.Is(err, store.ErrNotFound) {
+			t.Fatalf("Transcript after deleting = %v, want ErrNotFound", err)
+		}
+	})
+}
+
+func TestStoreChannels(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, st store.Store) {
+		ctx := context.Background()
+		channel := &models.PrivateChannel{
+			Code: "ABCDE-FGHJK", Members: [2]uuid.UUID{uuid.New(), uuid.New()}, CreatedAt: at(-30), LastUsedAt: at(-10),
+		}
+		if err := st.SaveChannel(ctx, channel); err != nil {
+			t.Fatalf("SaveChannel: %v", err)
+		}
+
+		got, err := st.Channel(ctx, channel.Code)
+		if err != nil || got.Members != channel.Members || !got.CreatedAt.Equal(channel.CreatedAt) ||
+			!got.LastUsedAt.Equal(channel.LastUsedAt) {
+			t.Fatalf("Channel = %+v, %v, want %+v", got, err, channel)
+		}
+		if _, err := st.Channel(ctx, "LMNPQ-RSTUV"); !errors.Is(err, store.ErrNotFound) {
+			t.Fatalf("Channel of an unknown code = %v, want ErrNotFound", err)
+		}
+
+		// Using the channel keeps it
+		channel.LastUsedAt = at(-1)
+		if err := st.SaveChannel(ctx, channel); err != nil {
+			t.Fatalf("SaveChannel: %v", err)
+		}
+		if err := st.DeleteChannels(ctx, at(-5)); err != nil {
+			t.Fatalf("DeleteChannels: %v", err)
+		}
+		if _, err := st.Channel(ctx, channel.Code); err != nil {
+			t.Fatalf("channel used after the cutoff deleted: %v", err)
+		}
+		if err := st.DeleteChannels(ctx, time.Now()); err != nil {
+			t.Fatalf("DeleteChannels: %v", err)
+		}
+		if _, err := st.Channel(ctx, channel.Code); !errors.Is(err, store.ErrNotFound) {
+			t.Fatalf("Channel after deleting = %v, want ErrNotFound", err)
+		}
+	})
+}
@@ -0,0 +1,31 @@
+package tracing
+
+import (
+	"realTimeService/logging"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Span attributes use the field names of the logs, so spans and log records of
+// one session or pair can be matched
+
+// Session is the attribute of the session a span is about
+func Session(userId uuid.UUID) attribute.KeyValue {
+	return attribute.String(logging.SessionKey, userId.String())
+}
+
+// Pair is the attribute of the pair a span is about
+func Pair(pairId uuid.UUID) attribute.KeyValue {
+	return attribute.String(logging.PairKey, pairId.String())
+}
+
+// IP is the attribute of the client address a span is about
+func IP(addr string) attribute.KeyValue {
+	return attribute.String(logging.IPKey, addr)
+}
+
+// Node is the attribute of the cluster node a span is about
+func Node(nodeId string) attribute.KeyValue {
+	return attribute.String(logging.NodeKey, nodeId)
+}
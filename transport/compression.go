@@ -0,0 +1,92 @@
+package transport
+
+import (
+	"bufio"
+	"expvar"
+	"net"
+	"net/http"
+	"strings"
+	"sync/atomic"
+)
+
+// DefaultCompressionThreshold is the payload size below which deflate costs more than it saves
+const DefaultCompressionThreshold = 256
+
+// Compression configures permessage-deflate on WebSocket connections
+type Compression struct {
+	Enabled bool
+	// Level is a compress/flate level, flate.BestSpeed suiting small and frequent
+	// chat messages. 0 is flate.NoCompression, framing messages as deflate
+	// without compressing them.
+	Level int
+	// Threshold is the payload size in bytes from which messages are compressed,
+	// 0 for DefaultCompressionThreshold
+	Threshold int
+}
+
+// threshold returns the configured threshold or the default
+func (c Compression) threshold() int {
+	if c.Threshold == 0 {
+		return DefaultCompressionThreshold
+	}
+	return c.Threshold
+}
+
+// compressionMetrics are published under "websocket_compression" on /debug/vars.
+// Bytes saved compare the payloads of compressed messages to the frames written for them.
+var compressionMetrics = expvar.NewMap("websocket_compression")
+
+// recordSend counts a message sent with or without compression
+func recordSend(compressed bool, payloadBytes, wireBytes int64) {
+	if !compressed {
+		compressionMetrics.Add("messagesUncompressed", 1)
+		compressionMetrics.Add("uncompressedBytes", payloadBytes)
+		return
+	}
+	compressionMetrics.Add("messagesCompressed", 1)
+	compressionMetrics.Add("payloadBytes", payloadBytes)
+	compressionMetrics.Add("wireBytes", wireBytes)
+	compressionMetrics.Add("bytesSaved", payloadBytes-wireBytes)
+}
+
+// offersDeflate reports whether the client offered permessage-deflate in its handshake
+func offersDeflate(r *http.Request) bool {
+	for _, header := range r.Header.Values("Sec-WebSocket-Extensions") {
+		for _, extension := range strings.Split(header, ",") {
+			name, _, _ := strings.Cut(extension, ";")
+			if strings.EqualFold(strings.TrimSpace(name), "permessage-deflate") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// meteredResponseWriter hands the WebSocket upgrader a connection that counts
+// the bytes written to it, so the size of compressed frames can be measured
+type meteredResponseWriter struct {
+	http.ResponseWriter
+	conn *meteredConn
+}
+
+// Hijack takes over the connection, wrapping it in a meteredConn
+func (w *meteredResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := http.NewResponseController(w.ResponseWriter).Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+	w.conn = &meteredConn{Conn: conn}
+	return w.conn, rw, nil
+}
+
+// meteredConn is a net.Conn counting the bytes written to it
+type meteredConn struct {
+	net.Conn
+	written atomic.Int64
+}
+
+func (c *meteredConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	c.written.Add(int64(n))
+	return n, err
+}
@@ -0,0 +1,87 @@
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"realTimeService/codec"
+	"realTimeService/models"
+	"sync"
+)
+
+// MemoryConnection is an in-process models.Connection that records what is sent
+// to it, for driving the hub and handlers without real sockets
+type MemoryConnection struct {
+	sessionVersion // protocol version of the frames sent
+
+	addr        string
+	sent        []json.RawMessage
+	closed      bool
+	closeReason string
+	ctx         context.Context
+	cancel      context.CancelFunc
+	mu          sync.Mutex
+}
+
+// NewMemoryConnection creates an open in-memory connection reporting addr as its remote address
+func NewMemoryConnection(addr string) *MemoryConnection {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &MemoryConnection{
+		addr:   addr,
+		ctx:    ctx,
+		cancel: cancel,
+		mu:     sync.Mutex{},
+	}
+}
+
+// Send records the JSON encoding of an event
+func (c *MemoryConnection) Send(v any) error {
+	payload, err := codec.JSON.Encode(v, c.version())
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return models.ErrConnectionClosed
+	}
+	c.sent = append(c.sent, payload)
+	return nil
+}
+
+// Close marks the connection closed and records the reason
+func (c *MemoryConnection) Close(reason string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	c.closeReason = reason
+	c.cancel()
+	return nil
+}
+
+// RemoteAddr returns the address given at creation
+func (c *MemoryConnection) RemoteAddr() string {
+	return c.addr
+}
+
+// Context is done once the connection is closed
+func (c *MemoryConnection) Context() context.Context {
+	return c.ctx
+}
+
+// Sent returns the events sent so far, oldest first
+func (c *MemoryConnection) Sent() []json.RawMessage {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]json.RawMessage(nil), c.sent...)
+}
+
+// Closed reports whether the connection was closed and with which reason
+func (c *MemoryConnection) Closed() (bool, string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closed, c.closeReason
+}
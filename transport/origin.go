@@ -0,0 +1,22 @@
+package transport
+
+import (
+	"net/http"
+	"strings"
+)
+
+// OriginAllowed reports whether a browser page at the request's origin may open a
+// connection. Any origin is allowed if the list is empty or contains "*". Requests
+// without an Origin header don't come from a browser page and are allowed.
+func OriginAllowed(r *http.Request, allowed []string) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" || len(allowed) == 0 {
+		return true
+	}
+	for _, candidate := range allowed {
+		if candidate == "*" || strings.EqualFold(candidate, origin) {
+			return true
+		}
+	}
+	return false
+}
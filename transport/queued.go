@@ -0,0 +1,103 @@
+package transport
+
+import (
+	"encoding/json"
+	"fmt"
+	"realTimeService/models"
+	"sync"
+)
+
+// sendQueueSize is how many events may wait to be written to a queued connection
+const sendQueueSize = 256
+
+// QueuedConnection is a models.Connection whose events are queued and written by
+// a goroutine of its own, so a client slow to read never holds up the sender.
+// A client that lets the queue fill up is disconnected, as it would miss events.
+type QueuedConnection struct {
+	models.Connection
+
+	queue   chan json.RawMessage
+	closing chan struct{} // closed once Close was called or the queue overflowed
+	reason  string
+	drain   bool // write the queued events before closing
+	closed  bool
+	mu      sync.Mutex
+}
+
+// NewQueuedConnection queues the events sent to conn until it is closed
+func NewQueuedConnection(conn models.Connection) *QueuedConnection {
+	c := &QueuedConnection{
+		Connection: conn,
+		queue:      make(chan json.RawMessage, sendQueueSize),
+		closing:    make(chan struct{}),
+		mu:         sync.Mutex{},
+	}
+	go c.write()
+	return c
+}
+
+// Send queues an event without waiting for the client. The event is encoded
+// right away, so later changes to it aren't sent.
+func (c *QueuedConnection) Send(v any) error {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return models.ErrConnectionClosed
+	}
+	select {
+	case c.queue <- payload:
+		return nil
+	default:
+		c.shut("too slow", false)
+		return fmt.Errorf("send queue of %s is full", c.RemoteAddr())
+	}
+}
+
+// Close closes the connection once the events queued so far were written
+func (c *QueuedConnection) Close(reason string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.closed {
+		c.shut(reason, true)
+	}
+	return nil
+}
+
+// shut stops queueing events and tells the writer to close the connection.
+// Must be called with c.mu held.
+func (c *QueuedConnection) shut(reason string, drain bool) {
+	c.closed, c.reason, c.drain = true, reason, drain
+	close(c.closing)
+}
+
+// write sends the queued events in order until the connection closes. A failed
+// write closes the connection, as the client would miss the event.
+func (c *QueuedConnection) write() {
+	for {
+		select {
+		case payload := <-c.queue:
+			if err := c.Connection.Send(payload); err != nil {
+				c.Connection.Close("")
+				return
+			}
+		case <-c.closing:
+			c.mu.Lock()
+			reason, drain := c.reason, c.drain
+			c.mu.Unlock()
+			for drain && len(c.queue) > 0 {
+				if err := c.Connection.Send(<-c.queue); err != nil {
+					break
+				}
+			}
+			c.Connection.Close(reason)
+			return
+		case <-c.Connection.Context().Done():
+			return
+		}
+	}
+}
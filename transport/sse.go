@@ -0,0 +1,180 @@
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"realTimeService/codec"
+	"realTimeService/models"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// sseBuffer is how many events may wait to be written to a stream
+	sseBuffer = 256
+	// sseKeepAlive is how often an idle stream gets a comment, so proxies don't time it out
+	sseKeepAlive = 15 * time.Second
+	// MaxSSEMessage bounds the size of a message POSTed to a stream, like a WebTransport message
+	MaxSSEMessage = maxWebTransportMessage
+)
+
+// SSEConnection is a models.Connection that streams events to the client as
+// Server-Sent Events. The client sends its messages with separate HTTP
+// requests, so the connection only carries the outgoing direction.
+type SSEConnection struct {
+	sessionVersion // protocol version of the frames sent
+
+	remoteAddr  string
+	events      chan []byte
+	closeReason string
+	closed      bool
+	ctx         context.Context
+	cancel      context.CancelFunc
+	mu          sync.Mutex
+}
+
+// NewSSEConnection creates a stream for the client at remoteAddr. Its context is
+// derived from ctx. Events are buffered until Serve writes them.
+func NewSSEConnection(ctx context.Context, remoteAddr string) *SSEConnection {
+	ctx, cancel := context.WithCancel(ctx)
+	return &SSEConnection{
+		remoteAddr: remoteAddr,
+		events:     make(chan []byte, sseBuffer),
+		ctx:        ctx,
+		cancel:     cancel,
+		mu:         sync.Mutex{},
+	}
+}
+
+// Send queues an event for the stream, waiting up to writeWait if the client is slow to read
+func (c *SSEConnection) Send(v any) error {
+	payload, err := codec.JSON.Encode(v, c.version())
+	if err != nil {
+		return err
+	}
+
+	select {
+	case c.events <- payload:
+		return nil
+	case <-c.ctx.Done():
+		return models.ErrConnectionClosed
+	case <-time.After(writeWait):
+		return fmt.Errorf("event stream of %s is full", c.remoteAddr)
+	}
+}
+
+// Close ends the stream, sending a close event carrying the reason first
+func (c *SSEConnection) Close(reason string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.closed {
+		c.closed = true
+		c.closeReason = reason
+		c.cancel()
+	}
+	return nil
+}
+
+// RemoteAddr returns the address of the client
+func (c *SSEConnection) RemoteAddr() string {
+	return c.remoteAddr
+}
+
+// Context is done once the stream is closed
+func (c *SSEConnection) Context() context.Context {
+	return c.ctx
+}
+
+// Serve writes the stream to w until the connection is closed or a write fails.
+// The first event, named by openEvent, carries openData so the client learns how
+// to send its messages.
+func (c *SSEConnection) Serve(w http.ResponseWriter, openEvent string, openData any) error {
+	header := w.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	header.Set("Connection", "keep-alive")
+	header.Set("X-Accel-Buffering", "no") // Keep nginx from buffering the stream
+	w.WriteHeader(http.StatusOK)
+
+	flusher := http.NewResponseController(w)
+	write := func(event string, data []byte) error {
+		if err := writeSSEEvent(w, event, data); err != nil {
+			return err
+		}
+		return flusher.Flush()
+	}
+
+	openPayload, err := json.Marshal(openData)
+	if err != nil {
+		return err
+	}
+	if err := write(openEvent, openPayload); err != nil {
+		return err
+	}
+
+	keepAlive := time.NewTicker(sseKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case payload := <-c.events:
+			if err := write("", payload); err != nil {
+				c.Close("")
+				return err
+			}
+		case <-keepAlive.C:
+			if _, err := io.WriteString(w, ": keep-alive\n\n"); err != nil {
+				c.Close("")
+				return err
+			}
+			if err := flusher.Flush(); err != nil {
+				c.Close("")
+				return err
+			}
+		case <-c.ctx.Done():
+			c.mu.Lock()
+			closedByServer, reason := c.closed, c.closeReason
+			c.mu.Unlock()
+			if !closedByServer {
+				return nil // The client went away
+			}
+			c.flush(write)
+			reasonPayload, _ := json.Marshal(map[string]string{"reason": reason})
+			write("close", reasonPayload)
+			return nil
+		}
+	}
+}
+
+// flush writes the events queued before the stream was closed
+func (c *SSEConnection) flush(write func(event string, data []byte) error) {
+	for {
+		select {
+		case payload := <-c.events:
+			if err := write("", payload); err != nil {
+				return
+			}
+		default:
+			return
+		}
+	}
+}
+
+// writeSSEEvent writes one event in the text/event-stream format.
+// An empty name sends a default "message" event.
+func writeSSEEvent(w io.Writer, event string, data []byte) error {
+	var b strings.Builder
+	if event != "" {
+		b.WriteString("event: " + event + "\n")
+	}
+	// JSON has no raw newlines, but a data line must never contain one
+	for _, line := range strings.Split(string(data), "\n") {
+		b.WriteString("data: " + line + "\n")
+	}
+	b.WriteString("\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
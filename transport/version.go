@@ -0,0 +1,26 @@
+package transport
+
+import (
+	"realTimeService/models"
+	"sync/atomic"
+)
+
+// sessionVersion stamps the frames of a connection with the protocol version its
+// client negotiated, so version 1 clients never see a field they don't know
+type sessionVersion struct {
+	negotiated atomic.Pointer[models.Session]
+}
+
+// SetSession sets the session whose negotiated protocol version frames carry.
+// Until it is set and the client said hello, frames are version 1.
+func (s *sessionVersion) SetSession(session *models.Session) {
+	s.negotiated.Store(session)
+}
+
+// version returns the protocol version to encode the next frame for
+func (s *sessionVersion) version() int {
+	if session := s.negotiated.Load(); session != nil {
+		return session.Version()
+	}
+	return models.MinProtocolVersion
+}
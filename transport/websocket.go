@@ -0,0 +1,204 @@
+package transport
+
+import (
+	"context"
+	"net/http"
+	"realTimeService/codec"
+	"realTimeService/models"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// writeWait bounds a single write, so a client that stopped reading can't block senders forever
+const writeWait = 10 * time.Second
+
+// pongWait is how long the client may stay silent, pongs included, before its connection is considered dead
+const pongWait = 60 * time.Second
+
+// pingPeriod is how often the client is pinged, often enough for a pong to arrive within pongWait
+const pingPeriod = pongWait * 9 / 10
+
+// WebSocketConnection adapts a gorilla WebSocket connection to models.Connection.
+// Gorilla allows one concurrent writer, so writes are serialized.
+type WebSocketConnection struct {
+	sessionVersion // protocol version of the frames sent
+
+	conn  *websocket.Conn
+	codec codec.Codec
+	// metered counts the bytes written to the socket, nil if not upgraded by UpgradeWebSocket
+	metered *meteredConn
+	// compress is set when permessage-deflate was negotiated
+	compress   bool
+	threshold  int
+	remoteAddr string // empty to use the peer address of the socket
+	ctx        context.Context
+	cancel     context.CancelFunc
+	closed     bool
+	mu         sync.Mutex
+}
+
+// NewWebSocketConnection wraps an upgraded connection sending events with the
+// negotiated codec. Its context is derived from ctx.
+func NewWebSocketConnection(ctx context.Context, conn *websocket.Conn, c codec.Codec) *WebSocketConnection {
+	ctx, cancel := context.WithCancel(ctx)
+	return &WebSocketConnection{
+		conn:   conn,
+		codec:  c,
+		ctx:    ctx,
+		cancel: cancel,
+		mu:     sync.Mutex{},
+	}
+}
+
+// WebSocketOptions configure the connections created by UpgradeWebSocket
+type WebSocketOptions struct {
+	// RemoteAddr identifies the client, such as its address behind a proxy.
+	// The peer address of the socket is used if it is empty.
+	RemoteAddr     string
+	AllowedOrigins []string
+	Compression    Compression
+}
+
+// UpgradeWebSocket upgrades the request to a WebSocket connection if its origin is
+// allowed. The client picks the wire encoding through Sec-WebSocket-Protocol, JSON
+// if it asks for none, and gets permessage-deflate if it offers it and compression
+// is enabled.
+func UpgradeWebSocket(w http.ResponseWriter, r *http.Request, options WebSocketOptions) (*WebSocketConnection, error) {
+	compression := options.Compression
+	upgrader := websocket.Upgrader{
+		CheckOrigin:       func(r *http.Request) bool { return OriginAllowed(r, options.AllowedOrigins) },
+		Subprotocols:      codec.Names(),
+		EnableCompression: compression.Enabled,
+	}
+	metered := &meteredResponseWriter{ResponseWriter: w}
+	conn, err := upgrader.Upgrade(metered, r, nil)
+	if err != nil {
+		return nil, err
+	}
+	wireCodec, err := codec.ByName(conn.Subprotocol())
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	c := NewWebSocketConnection(r.Context(), conn, wireCodec)
+	c.metered = metered.conn
+	c.remoteAddr = options.RemoteAddr
+	c.compress = compression.Enabled && offersDeflate(r)
+	c.threshold = compression.threshold()
+	if c.compress {
+		if err := conn.SetCompressionLevel(compression.Level); err != nil {
+			c.Close("")
+			return nil, err
+		}
+	}
+	c.keepAlive()
+	return c, nil
+}
+
+// keepAlive pings the client until the connection is closed. Every message or
+// pong from the client extends the read deadline, so reads fail on a half-open
+// connection instead of blocking forever.
+func (c *WebSocketConnection) keepAlive() {
+	c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+
+	go func() {
+		ticker := time.NewTicker(pingPeriod)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				// Control frames may be written concurrently with Send
+				if err := c.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeWait)); err != nil {
+					return
+				}
+			case <-c.ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// ReadMessage returns the next message sent by the client. Only one goroutine may read.
+func (c *WebSocketConnection) ReadMessage() ([]byte, error) {
+	_, data, err := c.conn.ReadMessage()
+	if err == nil {
+		c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	}
+	return data, err
+}
+
+// Codec returns the wire encoding negotiated with the client
+func (c *WebSocketConnection) Codec() codec.Codec {
+	return c.codec
+}
+
+// Send writes an event encoded with the connection's codec
+func (c *WebSocketConnection) Send(v any) error {
+	payload, err := c.codec.Encode(v, c.version())
+	if err != nil {
+		return err
+	}
+	frameType := websocket.TextMessage
+	if c.codec.Binary() {
+		frameType = websocket.BinaryMessage
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return models.ErrConnectionClosed
+	}
+	c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+	if !c.compress {
+		return c.conn.WriteMessage(frameType, payload)
+	}
+
+	// Small payloads grow under deflate, so they go out as they are
+	compressed := len(payload) >= c.threshold
+	c.conn.EnableWriteCompression(compressed)
+	var before int64
+	if c.metered != nil {
+		before = c.metered.written.Load()
+	}
+	if err := c.conn.WriteMessage(frameType, payload); err != nil {
+		return err
+	}
+	if c.metered != nil {
+		recordSend(compressed, int64(len(payload)), c.metered.written.Load()-before)
+	}
+	return nil
+}
+
+// Close sends a close frame carrying the reason and closes the socket
+func (c *WebSocketConnection) Close(reason string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	c.cancel()
+
+	frame := websocket.FormatCloseMessage(websocket.CloseNormalClosure, reason)
+	c.conn.WriteControl(websocket.CloseMessage, frame, time.Now().Add(writeWait))
+	return c.conn.Close()
+}
+
+// RemoteAddr returns the address of the client
+func (c *WebSocketConnection) RemoteAddr() string {
+	if c.remoteAddr != "" {
+		return c.remoteAddr
+	}
+	return c.conn.RemoteAddr().String()
+}
+
+// Context is done once the connection is closed
+func (c *WebSocketConnection) Context() context.Context {
+	return c.ctx
+}
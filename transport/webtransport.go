@@ -0,0 +1,105 @@
+package transport
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"realTimeService/codec"
+	"realTimeService/models"
+	"sync"
+	"time"
+
+	"github.com/quic-go/webtransport-go"
+)
+
+// maxWebTransportMessage bounds the size of a single incoming message
+const maxWebTransportMessage = 64 * 1024
+
+// WebTransportConnection is a models.Connection over a WebTransport session.
+// The client opens one bidirectional stream and both sides write JSON messages
+// to it, one per line, with the same content as WebSocket text messages.
+type WebTransportConnection struct {
+	sessionVersion // protocol version of the frames sent
+
+	session    *webtransport.Session
+	stream     *webtransport.Stream
+	scanner    *bufio.Scanner
+	remoteAddr string // empty to use the peer address of the session
+	closed     bool
+	mu         sync.Mutex
+}
+
+// AcceptWebTransportConnection waits for the client to open the message stream of a session.
+// remoteAddr identifies the client, such as its address behind a proxy; the peer
+// address of the session is used if it is empty.
+func AcceptWebTransportConnection(ctx context.Context, session *webtransport.Session, remoteAddr string) (*WebTransportConnection, error) {
+	stream, err := session.AcceptStream(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	scanner := bufio.NewScanner(stream)
+	scanner.Buffer(make([]byte, 4096), maxWebTransportMessage)
+	return &WebTransportConnection{
+		session:    session,
+		stream:     stream,
+		scanner:    scanner,
+		remoteAddr: remoteAddr,
+		mu:         sync.Mutex{},
+	}, nil
+}
+
+// ReadMessage returns the next message sent by the client, skipping empty lines.
+// Only one goroutine may read.
+func (c *WebTransportConnection) ReadMessage() ([]byte, error) {
+	for c.scanner.Scan() {
+		if line := bytes.TrimSpace(c.scanner.Bytes()); len(line) > 0 {
+			return line, nil
+		}
+	}
+	if err := c.scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, models.ErrConnectionClosed
+}
+
+// Send writes an event as a line of JSON
+func (c *WebTransportConnection) Send(v any) error {
+	payload, err := codec.JSON.Encode(v, c.version())
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return models.ErrConnectionClosed
+	}
+	c.stream.SetWriteDeadline(time.Now().Add(writeWait))
+	_, err = c.stream.Write(append(payload, '\n'))
+	return err
+}
+
+// Close closes the session, passing the reason to the client
+func (c *WebTransportConnection) Close(reason string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	return c.session.CloseWithError(0, reason)
+}
+
+// RemoteAddr returns the address of the client
+func (c *WebTransportConnection) RemoteAddr() string {
+	if c.remoteAddr != "" {
+		return c.remoteAddr
+	}
+	return c.session.RemoteAddr().String()
+}
+
+// Context is done once the session is closed
+func (c *WebTransportConnection) Context() context.Context {
+	return c.session.Context()
+}
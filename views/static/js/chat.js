@@ -1,16 +1,50 @@
 // WebSocket Chat Client
-let ws = null;
+let ws = null; // WebSocket, WebTransportSocket over HTTP/3, or SseSocket when WebSockets are blocked
+let transport = 'websocket'; // webtransport, websocket, sse
 let currentState = 'disconnected'; // disconnected, searching, chatting
 let reconnectAttempts = 0;
+let currentPairId = null;
+let transcriptOptedIn = false;
+let replyingTo = null; // { id, text } of the message being replied to
+let clientMessageCounter = 0;
+const allowedReactions = ['👍', '❤️', '😂', '😮', '😢', '😡'];
+const ratingTags = ['friendly', 'funny', 'spam', 'rude', 'inappropriate', 'bot'];
+const reportReasons = ['spam', 'harassment', 'inappropriate', 'underage', 'other'];
 const maxReconnectAttempts = 5;
+const protocolVersion = 2;
+const clientCapabilities = ['typing'];
+const typingIdleMs = 3000; // Typing stops being reported after this long without input
+let session = null; // welcome reply of the server, null until the handshake completed
+let resumeToken = null; // token of the session to reconnect with, private channels only let their members back in
+let pendingChannel = null; // code to join once the resumed session completed the handshake
+let typingSent = false;
+let typingTimer = null;
 
 // Initialize on page load
 document.addEventListener('DOMContentLoaded', () => {
     setupEventListeners();
     setupEmojiPicker();
+    // Prefer WebTransport when the server runs HTTP/3 and the browser supports it
+    if (webTransportUrl()) {
+        transport = 'webtransport';
+    }
     connect();
 });
 
+// URL of the server's WebTransport endpoint, null if unavailable
+function webTransportUrl() {
+    const port = document.body.dataset.webtransportPort;
+    if (!port || typeof WebTransport === 'undefined' || window.location.protocol !== 'https:') {
+        return null;
+    }
+    return `https://${window.location.hostname}:${port}/wt${sessionQuery()}`;
+}
+
+// Query that resumes a session, browsers can't set the X-Resume-Token header on these connections
+function sessionQuery() {
+    return resumeToken ? `?resume=${encodeURIComponent(resumeToken)}` : '';
+}
+
 // Setup event listeners
 function setupEventListeners() {
     const input = document.getElementById('messageInput');
@@ -20,6 +54,7 @@ function setupEventListeners() {
                 sendMessage();
             }
         });
+        input.addEventListener('input', notifyTyping);
     }
     
     // Close emoji picker when clicking outside
@@ -73,22 +108,146 @@ function toggleEmojiPicker() {
     }
 }
 
-// Connect to WebSocket server
+// WebTransportSocket mimics the WebSocket API on top of a WebTransport session,
+// exchanging one JSON message per line over a single bidirectional stream
+class WebTransportSocket {
+    constructor(url) {
+        this.readyState = WebSocket.CONNECTING;
+        this.encoder = new TextEncoder();
+        this.transport = new WebTransport(url);
+        this.transport.closed.catch(() => {}).finally(() => this.close());
+        this.open().catch((error) => {
+            if (this.onerror) this.onerror(error);
+            this.close();
+        });
+    }
+
+    async open() {
+        await this.transport.ready;
+        const stream = await this.transport.createBidirectionalStream();
+        this.writer = stream.writable.getWriter();
+        this.readyState = WebSocket.OPEN;
+        if (this.onopen) this.onopen();
+
+        const reader = stream.readable.pipeThrough(new TextDecoderStream()).getReader();
+        let buffered = '';
+        for (;;) {
+            const { value, done } = await reader.read();
+            if (done) break;
+            buffered += value;
+            const lines = buffered.split('\n');
+            buffered = lines.pop();
+            for (const line of lines) {
+                if (line.trim() && this.onmessage) this.onmessage({ data: line });
+            }
+        }
+        this.close();
+    }
+
+    send(data) {
+        if (this.readyState !== WebSocket.OPEN) return;
+        this.writer.write(this.encoder.encode(data + '\n')).catch((error) => {
+            console.error('❌ Error sending message:', error);
+        });
+    }
+
+    close() {
+        if (this.readyState === WebSocket.CLOSED) return;
+        this.readyState = WebSocket.CLOSED;
+        try {
+            this.transport.close();
+        } catch (error) {
+            // Already closed
+        }
+        if (this.onclose) this.onclose();
+    }
+}
+
+// SseSocket mimics the WebSocket API on top of Server-Sent Events for receiving
+// and POST requests for sending, for networks where WebSockets don't get through
+class SseSocket {
+    constructor(url) {
+        this.url = url;
+        this.readyState = WebSocket.CONNECTING;
+        this.token = null;
+        this.pending = Promise.resolve(); // Keeps messages in the order they were sent
+        this.source = new EventSource(url);
+
+        this.source.addEventListener('session', (event) => {
+            this.token = JSON.parse(event.data).token;
+            this.readyState = WebSocket.OPEN;
+            if (this.onopen) this.onopen();
+        });
+        this.source.onmessage = (event) => {
+            if (this.onmessage) this.onmessage(event);
+        };
+        this.source.addEventListener('close', () => this.close());
+        this.source.onerror = (error) => {
+            // EventSource would reconnect with a new session, let connect() handle it instead
+            if (this.readyState === WebSocket.OPEN && this.onerror) this.onerror(error);
+            this.close();
+        };
+    }
+
+    send(data) {
+        if (this.readyState !== WebSocket.OPEN) return;
+        this.pending = this.pending.then(async () => {
+            try {
+                const response = await fetch(`${this.url}/send`, {
+                    method: 'POST',
+                    headers: { 'Content-Type': 'application/json', 'X-Stream-Token': this.token },
+                    body: data
+                });
+                if (response.status === 404) {
+                    this.close();
+                } else if (!response.ok) {
+                    console.error('❌ Message rejected:', await response.text());
+                }
+            } catch (error) {
+                console.error('❌ Error sending message:', error);
+            }
+        });
+    }
+
+    close() {
+        if (this.readyState === WebSocket.CLOSED) return;
+        this.readyState = WebSocket.CLOSED;
+        this.source.close();
+        if (this.onclose) this.onclose();
+    }
+}
+
+// Connect to the server over WebTransport or a WebSocket, falling back to the
+// next transport if one never got through
 function connect() {
-    const protocol = window.location.protocol === 'https:' ? 'wss:' : 'ws:';
-    const wsUrl = `${protocol}//${window.location.host}/ws`;
-    
-    console.log('Connecting to:', wsUrl);
-    ws = new WebSocket(wsUrl);
+    let opened = false;
+    if (transport === 'webtransport') {
+        const url = webTransportUrl();
+        console.log('Connecting to:', url);
+        ws = new WebTransportSocket(url);
+    } else if (transport === 'sse') {
+        const sseUrl = `${window.location.protocol}//${window.location.host}/sse${sessionQuery()}`;
+        console.log('Connecting to:', sseUrl);
+        ws = new SseSocket(sseUrl);
+    } else {
+        const protocol = window.location.protocol === 'https:' ? 'wss:' : 'ws:';
+        const wsUrl = `${protocol}//${window.location.host}/ws${sessionQuery()}`;
+        console.log('Connecting to:', wsUrl);
+        ws = new WebSocket(wsUrl);
+    }
     
     ws.onopen = () => {
-        console.log('✅ Connected to server');
+        opened = true;
+        console.log(`✅ Connected to server (${transport})`);
         updateStatus('connected', 'Connected');
         reconnectAttempts = 0;
+
+        // The handshake must be the first message
+        session = null;
+        ws.send(JSON.stringify({ type: 'hello', version: protocolVersion, capabilities: clientCapabilities }));
         
         // Enable start button
-        const startBtn = document.getElementById('startBtn');
-        if (startBtn) startBtn.disabled = false;
+        setButtonStates({ start: true });
     };
     
     ws.onmessage = (event) => {
@@ -102,11 +261,29 @@ function connect() {
     };
     
     ws.onerror = (error) => {
-        console.error('❌ WebSocket error:', error);
-        showSystemMessage('Connection error occurred');
+        console.error('❌ Connection error:', error);
+        if (opened) {
+            showSystemMessage('Connection error occurred');
+        }
     };
     
     ws.onclose = () => {
+        // UDP may be blocked, try a WebSocket instead
+        if (!opened && transport === 'webtransport') {
+            console.log('⚠️ WebTransport unavailable, falling back to WebSocket');
+            transport = 'websocket';
+            connect();
+            return;
+        }
+
+        // A WebSocket that never opened is likely blocked by a proxy, fall back right away
+        if (!opened && transport === 'websocket') {
+            console.log('⚠️ WebSocket unavailable, falling back to Server-Sent Events');
+            transport = 'sse';
+            connect();
+            return;
+        }
+
         console.log('🔌 Disconnected from server');
         updateStatus('disconnected', 'Disconnected');
         disableAllButtons();
@@ -139,6 +316,9 @@ function handleMessage(msg) {
         case 'strangerJoined':
             updateStatus('chatting', 'Chatting with stranger');
             currentState = 'chatting';
+            currentPairId = msg.pairId;
+            setTranscriptState(false, true);
+            setConnectEnabled(true);
             showSystemMessage('✨ Stranger connected! Say hi!');
             
             // Enable input and buttons
@@ -151,17 +331,95 @@ function handleMessage(msg) {
             break;
             
         case 'message':
-            addStrangerMessage(msg.text, msg.timestamp);
+            setStrangerTyping(false);
+            addStrangerMessage(msg);
+            break;
+
+        case 'welcome':
+            session = msg;
+            console.log(`🤝 Protocol v${msg.version}, capabilities:`, msg.capabilities);
+            if (pendingChannel) {
+                ws.send(JSON.stringify({ type: 'joinChannel', code: pendingChannel }));
+                pendingChannel = null;
+            }
+            break;
+
+        case 'error':
+            console.warn(`⚠️ ${msg.requestType} rejected:`, msg.error);
+            break;
+
+        case 'typing':
+            setStrangerTyping(msg.typing);
+            break;
+
+        case 'messageAck':
+            confirmYourMessage(msg);
+            break;
+
+        case 'messageEdited':
+            updateMessageText(msg.id, msg.text, true);
+            break;
+
+        case 'messageDeleted':
+            markMessageDeleted(msg.id);
+            break;
+
+        case 'reactions':
+            updateReactions(msg);
+            break;
+
+        case 'transcriptStatus':
+            handleTranscriptStatus(msg);
             break;
             
         case 'strangerLeft':
+            setStrangerTyping(false);
             updateStatus('connected', 'Stranger left');
             currentState = 'connected';
             showSystemMessage('👋 Stranger disconnected');
             
             // Disable input, enable start button
             disableChatInput();
+            setTranscriptState(false, false);
             setButtonStates({ start: true, next: false, stop: false });
+            endCurrentPair();
+            break;
+
+        case 'ratingReceived':
+            showSystemMessage('🙏 Thanks for your feedback!');
+            break;
+
+        case 'connectPending':
+            showSystemMessage('🤝 Asked stranger to stay in touch - waiting for an answer');
+            setConnectEnabled(false);
+            break;
+
+        case 'connectRequested':
+            showConnectPrompt();
+            break;
+
+        case 'connectDeclined':
+            showSystemMessage('🤝 Stranger declined to stay in touch');
+            break;
+
+        case 'connectEstablished':
+            setConnectEnabled(false);
+            showChannelCode(msg.code);
+            break;
+
+        case 'reportReceived':
+            showSystemMessage('🚩 Thanks, the moderators will review your report');
+            break;
+
+        case 'announcement':
+            showSystemMessage(`📢 ${msg.text}`);
+            break;
+
+        case 'channelWaiting':
+            updateStatus('searching', 'Waiting in private channel...');
+            currentState = 'searching';
+            showSystemMessage('🔑 Waiting for the other person to join with the same code...');
+            setButtonStates({ start: false, next: false, stop: true, join: false });
             break;
             
         default:
@@ -177,17 +435,69 @@ function sendMessage() {
     const text = input.value.trim();
     
     if (text && ws && ws.readyState === WebSocket.OPEN && currentState === 'chatting') {
-        ws.send(JSON.stringify({
+        const clientId = `c${++clientMessageCounter}`;
+        const payload = {
             type: 'sendMessage',
-            text: text
-        }));
+            text: text,
+            clientId: clientId
+        };
+        if (replyingTo) {
+            payload.replyTo = replyingTo.id;
+        }
+        ws.send(JSON.stringify(payload));
+        stopTyping();
         
-        addYourMessage(text);
+        addYourMessage(text, clientId, replyingTo ? replyingTo.id : null);
+        cancelReply();
         input.value = '';
         input.focus();
     }
 }
 
+// Edit one of your messages
+function editMessage(id) {
+    const current = findMessageElement(id);
+    if (!current || !ws || ws.readyState !== WebSocket.OPEN) return;
+
+    const oldText = current.querySelector('.message-text').textContent;
+    const text = prompt('Edit message', oldText);
+    if (text === null || text.trim() === '' || text.trim() === oldText) return;
+
+    ws.send(JSON.stringify({ type: 'editMessage', messageId: id, text: text.trim() }));
+}
+
+// Delete one of your messages
+function deleteMessage(id) {
+    if (!ws || ws.readyState !== WebSocket.OPEN) return;
+    if (!confirm('Delete this message for both of you?')) return;
+
+    ws.send(JSON.stringify({ type: 'deleteMessage', messageId: id }));
+}
+
+// Start replying to a message
+function replyToMessage(id) {
+    const element = findMessageElement(id);
+    if (!element) return;
+
+    replyingTo = { id: id, text: element.querySelector('.message-text').textContent };
+
+    const preview = document.getElementById('replyPreview');
+    if (preview) {
+        preview.querySelector('.reply-preview-text').textContent = replyingTo.text;
+        preview.style.display = 'flex';
+    }
+
+    const input = document.getElementById('messageInput');
+    if (input) input.focus();
+}
+
+// Stop replying
+function cancelReply() {
+    replyingTo = null;
+    const preview = document.getElementById('replyPreview');
+    if (preview) preview.style.display = 'none';
+}
+
 // Start chatting
 function startChat() {
     if (ws && ws.readyState === WebSocket.OPEN) {
@@ -217,6 +527,8 @@ function nextStranger() {
         }
         
         disableChatInput();
+        setTranscriptState(false, false);
+        endCurrentPair();
     }
 }
 
@@ -228,7 +540,273 @@ function stopChat() {
         
         currentState = 'connected';
         disableChatInput();
+        setTranscriptState(false, false);
         setButtonStates({ start: true, next: false, stop: false });
+        endCurrentPair();
+    }
+}
+
+// Forget the current pair and ask for feedback about it
+function endCurrentPair() {
+    const endedPairId = currentPairId;
+    currentPairId = null;
+    setConnectEnabled(false);
+    if (endedPairId) {
+        showRatingPrompt(endedPairId);
+    }
+}
+
+// Propose staying in touch with the current stranger
+function requestConnect() {
+    if (ws && ws.readyState === WebSocket.OPEN && currentState === 'chatting') {
+        ws.send(JSON.stringify({ type: 'requestConnect' }));
+    }
+}
+
+// Ask the user whether to accept the stranger's proposal
+function showConnectPrompt() {
+    const messagesDiv = document.getElementById('messages');
+    if (!messagesDiv) return;
+
+    const msgDiv = document.createElement('div');
+    msgDiv.className = 'system-message';
+
+    const bubble = document.createElement('div');
+    bubble.className = 'system-bubble';
+    bubble.appendChild(document.createTextNode('🤝 Stranger wants to stay in touch. '));
+
+    for (const [label, accept] of [['Accept', true], ['Decline', false]]) {
+        const btn = document.createElement('button');
+        btn.className = 'message-action-btn';
+        btn.textContent = label;
+        btn.addEventListener('click', () => {
+            if (ws && ws.readyState === WebSocket.OPEN) {
+                ws.send(JSON.stringify({ type: 'respondConnect', accept: accept }));
+            }
+            msgDiv.remove();
+        });
+        bubble.appendChild(btn);
+    }
+
+    msgDiv.appendChild(bubble);
+    messagesDiv.appendChild(msgDiv);
+    messagesDiv.scrollTop = messagesDiv.scrollHeight;
+}
+
+// Show and remember the code of a newly created private channel
+function showChannelCode(code) {
+    localStorage.setItem('goroomLastChannel', code);
+    // Only this session may rejoin the channel, so it is kept along with the code
+    if (session) {
+        localStorage.setItem('goroomLastChannelSession', session.session.userId);
+        localStorage.setItem('goroomLastChannelToken', session.session.resumeToken);
+    }
+    showSystemMessage(`🔑 You both agreed to stay in touch! Your private code: ${code} - use "Rejoin by Code" later to meet again`);
+}
+
+// Rejoin a private channel by code
+function joinChannel() {
+    if (!ws || ws.readyState !== WebSocket.OPEN) return;
+
+    const code = prompt('Enter your private channel code', localStorage.getItem('goroomLastChannel') || '');
+    if (!code || !code.trim()) return;
+
+    const messagesDiv = document.getElementById('messages');
+    if (messagesDiv) {
+        messagesDiv.innerHTML = '';
+    }
+
+    // The channel only lets in the session that created it, reconnect with it first
+    const owner = localStorage.getItem('goroomLastChannelSession');
+    const ownerToken = localStorage.getItem('goroomLastChannelToken');
+    if (code.trim() === localStorage.getItem('goroomLastChannel') && owner && ownerToken && session && owner !== session.session.userId) {
+        resumeToken = ownerToken;
+        pendingChannel = code.trim();
+        ws.onclose = null;
+        ws.close();
+        connect();
+        return;
+    }
+    ws.send(JSON.stringify({ type: 'joinChannel', code: code.trim() }));
+}
+
+function setConnectEnabled(enabled) {
+    const connectBtn = document.getElementById('connectBtn');
+    if (connectBtn) connectBtn.disabled = !enabled;
+}
+
+// Ask the user to rate the stranger of a chat that just ended
+function showRatingPrompt(pairId) {
+    const messagesDiv = document.getElementById('messages');
+    if (!messagesDiv) return;
+
+    const msgDiv = document.createElement('div');
+    msgDiv.className = 'system-message';
+
+    const bubble = document.createElement('div');
+    bubble.className = 'system-bubble rating-prompt';
+    bubble.appendChild(document.createTextNode('How was this chat? '));
+
+    const selectedTags = new Set();
+    const tagsDiv = document.createElement('div');
+    tagsDiv.className = 'rating-tags';
+    for (const tag of ratingTags) {
+        const chip = document.createElement('button');
+        chip.className = 'rating-tag';
+        chip.textContent = tag;
+        chip.addEventListener('click', () => {
+            if (selectedTags.has(tag)) {
+                selectedTags.delete(tag);
+            } else {
+                selectedTags.add(tag);
+            }
+            chip.classList.toggle('selected');
+        });
+        tagsDiv.appendChild(chip);
+    }
+
+    for (const [icon, rating] of [['👍', 'up'], ['👎', 'down']]) {
+        const btn = document.createElement('button');
+        btn.className = 'message-action-btn';
+        btn.textContent = icon;
+        btn.addEventListener('click', () => {
+            if (ws && ws.readyState === WebSocket.OPEN) {
+                ws.send(JSON.stringify({
+                    type: 'rateStranger',
+                    pairId: pairId,
+                    rating: rating,
+                    tags: Array.from(selectedTags)
+                }));
+            }
+            msgDiv.remove();
+        });
+        bubble.appendChild(btn);
+    }
+
+    bubble.appendChild(tagsDiv);
+
+    // Reporting goes to the moderators, separately from the rating
+    const reportDiv = document.createElement('div');
+    reportDiv.className = 'rating-tags';
+    const reasonSelect = document.createElement('select');
+    for (const reason of reportReasons) {
+        const option = document.createElement('option');
+        option.value = reason;
+        option.textContent = reason;
+        reasonSelect.appendChild(option);
+    }
+    const reportBtn = document.createElement('button');
+    reportBtn.className = 'rating-tag';
+    reportBtn.textContent = '🚩 Report';
+    reportBtn.addEventListener('click', () => {
+        if (ws && ws.readyState === WebSocket.OPEN) {
+            ws.send(JSON.stringify({ type: 'reportStranger', pairId: pairId, reason: reasonSelect.value }));
+        }
+        reportDiv.remove();
+    });
+    reportDiv.appendChild(reasonSelect);
+    reportDiv.appendChild(reportBtn);
+    bubble.appendChild(reportDiv);
+
+    msgDiv.appendChild(bubble);
+    messagesDiv.appendChild(msgDiv);
+    messagesDiv.scrollTop = messagesDiv.scrollHeight;
+}
+
+// Toggle transcript opt-in for the current chat
+function toggleTranscript() {
+    if (ws && ws.readyState === WebSocket.OPEN && currentState === 'chatting') {
+        ws.send(JSON.stringify({ type: 'transcriptOptIn', enabled: !transcriptOptedIn }));
+    }
+}
+
+// Handle transcript opt-in changes and download availability
+function handleTranscriptStatus(msg) {
+    if (msg.ended) {
+        if (msg.recording && msg.token) {
+            showTranscriptDownload(msg.pairId, msg.token, msg.expiresAt);
+        }
+        return;
+    }
+
+    if (msg.pairId !== currentPairId) return;
+
+    const wasOptedIn = transcriptOptedIn;
+    setTranscriptState(msg.youOptedIn, true);
+
+    if (msg.recording) {
+        showSystemMessage('📝 Transcript is being kept - you can download it after the chat ends');
+    } else if (msg.youOptedIn) {
+        showSystemMessage('📝 You asked to keep a transcript - waiting for stranger to agree');
+    } else if (msg.strangerOptedIn) {
+        showSystemMessage('📝 Stranger wants to keep a transcript - click 📝 to agree');
+    } else if (wasOptedIn) {
+        showSystemMessage('📝 Transcript disabled');
+    }
+}
+
+// Show download links for a finished transcript
+function showTranscriptDownload(pairId, token, expiresAt) {
+    const messagesDiv = document.getElementById('messages');
+    if (!messagesDiv) return;
+
+    const msgDiv = document.createElement('div');
+    msgDiv.className = 'system-message';
+
+    const bubble = document.createElement('div');
+    bubble.className = 'system-bubble';
+    const until = expiresAt ? ` (until ${new Date(expiresAt).toLocaleTimeString()})` : '';
+    bubble.textContent = `📝 Download transcript${until}: `;
+
+    for (const format of ['txt', 'json', 'html']) {
+        const link = document.createElement('a');
+        link.href = '#';
+        link.className = 'transcript-link';
+        link.textContent = format.toUpperCase();
+        link.addEventListener('click', (e) => {
+            e.preventDefault();
+            downloadTranscript(pairId, token, format);
+        });
+        bubble.appendChild(link);
+    }
+
+    msgDiv.appendChild(bubble);
+    messagesDiv.appendChild(msgDiv);
+    messagesDiv.scrollTop = messagesDiv.scrollHeight;
+}
+
+// Download a transcript, sending the token in a header so it stays out of URLs
+async function downloadTranscript(pairId, token, format) {
+    try {
+        const response = await fetch(`/transcripts/${pairId}?format=${format}`, {
+            headers: { 'X-Transcript-Token': token }
+        });
+        if (!response.ok) {
+            showSystemMessage('⚠️ Transcript is no longer available');
+            return;
+        }
+
+        const blob = await response.blob();
+        const url = URL.createObjectURL(blob);
+        const link = document.createElement('a');
+        link.href = url;
+        link.download = `chat-transcript.${format}`;
+        document.body.appendChild(link);
+        link.click();
+        link.remove();
+        URL.revokeObjectURL(url);
+    } catch (error) {
+        console.error('❌ Error downloading transcript:', error);
+        showSystemMessage('⚠️ Could not download transcript');
+    }
+}
+
+function setTranscriptState(optedIn, enabled) {
+    transcriptOptedIn = optedIn;
+    const transcriptBtn = document.getElementById('transcriptBtn');
+    if (transcriptBtn) {
+        transcriptBtn.disabled = !enabled;
+        transcriptBtn.classList.toggle('active', optedIn);
     }
 }
 
@@ -244,6 +822,45 @@ function clearChat() {
     }
 }
 
+// Report typing to the stranger, if the server enabled typing indicators
+function notifyTyping() {
+    if (!session || !session.capabilities.includes('typing') || currentState !== 'chatting') return;
+    if (!typingSent && ws && ws.readyState === WebSocket.OPEN) {
+        ws.send(JSON.stringify({ type: 'typing', enabled: true }));
+        typingSent = true;
+    }
+    clearTimeout(typingTimer);
+    typingTimer = setTimeout(stopTyping, typingIdleMs);
+}
+
+// Report that typing stopped, if it was reported before
+function stopTyping() {
+    clearTimeout(typingTimer);
+    if (typingSent && ws && ws.readyState === WebSocket.OPEN && currentState === 'chatting') {
+        ws.send(JSON.stringify({ type: 'typing', enabled: false }));
+    }
+    typingSent = false;
+}
+
+// Show or hide the stranger's typing indicator
+function setStrangerTyping(typing) {
+    const messagesDiv = document.getElementById('messages');
+    if (!messagesDiv) return;
+    let indicator = document.getElementById('typingIndicator');
+    if (!typing) {
+        if (indicator) indicator.remove();
+        return;
+    }
+    if (!indicator) {
+        indicator = document.createElement('div');
+        indicator.id = 'typingIndicator';
+        indicator.className = 'typing-indicator';
+        indicator.innerHTML = '<span class="typing-dot"></span><span class="typing-dot"></span><span class="typing-dot"></span>';
+    }
+    messagesDiv.appendChild(indicator); // Keep it below the newest message
+    messagesDiv.scrollTop = messagesDiv.scrollHeight;
+}
+
 // UI Helper Functions
 function updateStatus(state, text) {
     const statusBadge = document.getElementById('statusBadge');
@@ -264,9 +881,9 @@ function updateStatus(state, text) {
     }
 }
 
-function addMessage(className, text, timestamp) {
+function addMessage(className, text, timestamp, options = {}) {
     const messagesDiv = document.getElementById('messages');
-    if (!messagesDiv) return;
+    if (!messagesDiv) return null;
     
     // Remove welcome message if exists
     const welcome = messagesDiv.querySelector('.welcome-message');
@@ -276,9 +893,21 @@ function addMessage(className, text, timestamp) {
     
     const msgDiv = document.createElement('div');
     msgDiv.className = `message ${className}`;
+    if (options.id) msgDiv.dataset.id = options.id;
+    if (options.clientId) msgDiv.dataset.clientId = options.clientId;
     
     const bubble = document.createElement('div');
     bubble.className = 'message-bubble';
+
+    if (options.replyTo) {
+        const quote = document.createElement('div');
+        quote.className = 'message-reply';
+        const original = findMessageElement(options.replyTo);
+        quote.textContent = original
+            ? original.querySelector('.message-text').textContent
+            : 'Earlier message';
+        bubble.appendChild(quote);
+    }
     
     const textP = document.createElement('p');
     textP.className = 'message-text';
@@ -292,20 +921,150 @@ function addMessage(className, text, timestamp) {
         timeDiv.textContent = time.toLocaleTimeString();
         bubble.appendChild(timeDiv);
     }
+
+    const actions = document.createElement('div');
+    actions.className = 'message-actions';
+    bubble.appendChild(actions);
     
     msgDiv.appendChild(bubble);
     messagesDiv.appendChild(msgDiv);
+
+    if (options.id) {
+        addMessageActions(msgDiv, className === 'you');
+    }
     
     // Scroll to bottom
     messagesDiv.scrollTop = messagesDiv.scrollHeight;
+    return msgDiv;
+}
+
+// Add reply (and for your own messages edit/delete) buttons once a message has an ID
+function addMessageActions(msgDiv, own) {
+    const actions = msgDiv.querySelector('.message-actions');
+    if (!actions) return;
+    actions.innerHTML = '';
+
+    const id = msgDiv.dataset.id;
+    const buttons = [
+        ['↩️', 'Reply', () => replyToMessage(id)],
+        ['🙂', 'React', () => toggleReactionPicker(msgDiv)]
+    ];
+    if (own) {
+        buttons.push(['✏️', 'Edit', () => editMessage(id)]);
+        buttons.push(['🗑️', 'Delete', () => deleteMessage(id)]);
+    }
+
+    for (const [icon, title, handler] of buttons) {
+        const btn = document.createElement('button');
+        btn.className = 'message-action-btn';
+        btn.title = title;
+        btn.textContent = icon;
+        btn.addEventListener('click', handler);
+        actions.appendChild(btn);
+    }
+}
+
+// Show or hide the row of allowed reactions under a message
+function toggleReactionPicker(msgDiv) {
+    const existing = msgDiv.querySelector('.reaction-picker');
+    if (existing) {
+        existing.remove();
+        return;
+    }
+
+    const picker = document.createElement('div');
+    picker.className = 'reaction-picker';
+    for (const reaction of allowedReactions) {
+        const btn = document.createElement('button');
+        btn.className = 'message-action-btn';
+        btn.textContent = reaction;
+        btn.addEventListener('click', () => {
+            // Clicking your current reaction again removes it
+            const current = msgDiv.dataset.yourReaction || '';
+            sendReaction(msgDiv.dataset.id, current === reaction ? '' : reaction);
+            picker.remove();
+        });
+        picker.appendChild(btn);
+    }
+    msgDiv.querySelector('.message-bubble').appendChild(picker);
+}
+
+function sendReaction(id, reaction) {
+    if (ws && ws.readyState === WebSocket.OPEN && currentState === 'chatting') {
+        ws.send(JSON.stringify({ type: 'react', messageId: id, reaction: reaction }));
+    }
 }
 
-function addYourMessage(text) {
-    addMessage('you', text, new Date().toISOString());
+// Render the aggregated reactions of a message
+function updateReactions(msg) {
+    const msgDiv = findMessageElement(msg.messageId);
+    if (!msgDiv) return;
+
+    msgDiv.dataset.yourReaction = msg.yours || '';
+
+    let row = msgDiv.querySelector('.message-reactions');
+    if (!row) {
+        row = document.createElement('div');
+        row.className = 'message-reactions';
+        msgDiv.querySelector('.message-bubble').appendChild(row);
+    }
+    row.innerHTML = '';
+
+    for (const [reaction, count] of Object.entries(msg.reactions || {})) {
+        const chip = document.createElement('span');
+        chip.className = 'reaction-chip' + (reaction === msg.yours ? ' yours' : '');
+        chip.textContent = count > 1 ? `${reaction} ${count}` : reaction;
+        chip.addEventListener('click', () => {
+            sendReaction(msg.messageId, reaction === msgDiv.dataset.yourReaction ? '' : reaction);
+        });
+        row.appendChild(chip);
+    }
 }
 
-function addStrangerMessage(text, timestamp) {
-    addMessage('stranger', text, timestamp);
+function findMessageElement(id) {
+    if (!id) return null;
+    return document.querySelector(`.message[data-id="${id}"]`);
+}
+
+function addYourMessage(text, clientId, replyTo) {
+    addMessage('you', text, new Date().toISOString(), { clientId: clientId, replyTo: replyTo });
+}
+
+function addStrangerMessage(msg) {
+    addMessage('stranger', msg.text, msg.timestamp, { id: msg.id, replyTo: msg.replyTo });
+}
+
+// Attach the server-assigned ID to a message you sent
+function confirmYourMessage(msg) {
+    const msgDiv = document.querySelector(`.message[data-client-id="${msg.clientId}"]`);
+    if (!msgDiv) return;
+    msgDiv.dataset.id = msg.id;
+    addMessageActions(msgDiv, true);
+}
+
+function updateMessageText(id, text, edited) {
+    const msgDiv = findMessageElement(id);
+    if (!msgDiv) return;
+
+    msgDiv.querySelector('.message-text').textContent = text;
+    if (edited && !msgDiv.querySelector('.message-edited')) {
+        const editedSpan = document.createElement('span');
+        editedSpan.className = 'message-edited';
+        editedSpan.textContent = ' (edited)';
+        msgDiv.querySelector('.message-time')?.appendChild(editedSpan);
+    }
+}
+
+function markMessageDeleted(id) {
+    const msgDiv = findMessageElement(id);
+    if (!msgDiv) return;
+
+    msgDiv.classList.add('deleted');
+    msgDiv.querySelector('.message-text').textContent = 'Message deleted';
+    msgDiv.querySelector('.message-actions')?.remove();
+    msgDiv.querySelector('.message-reactions')?.remove();
+    msgDiv.querySelector('.reaction-picker')?.remove();
+    if (replyingTo && replyingTo.id === id) cancelReply();
 }
 
 function showSystemMessage(text) {
@@ -356,6 +1115,7 @@ function disableChatInput() {
         input.placeholder = 'Start a chat to send messages...';
         input.value = '';
     }
+    cancelReply();
     if (sendBtn) sendBtn.disabled = true;
     if (emojiBtn) emojiBtn.disabled = true;
     if (emojiContainer) emojiContainer.style.display = 'none';
@@ -364,10 +1124,16 @@ function disableChatInput() {
 function setButtonStates(states) {
     const buttons = {
         start: document.getElementById('startBtn'),
+        join: document.getElementById('joinBtn'),
         next: document.getElementById('nextBtn'),
         stop: document.getElementById('stopBtn')
     };
     
+    // Rejoining by code is possible whenever starting a chat is
+    if (states.join === undefined && states.start !== undefined) {
+        states = { ...states, join: states.start };
+    }
+
     for (const [key, enabled] of Object.entries(states)) {
         if (buttons[key]) {
             buttons[key].disabled = !enabled;
@@ -377,5 +1143,7 @@ function setButtonStates(states) {
 
 function disableAllButtons() {
     setButtonStates({ start: false, next: false, stop: false });
+    setConnectEnabled(false);
     disableChatInput();
+    setTranscriptState(false, false);
 }
@@ -0,0 +1,183 @@
+// Moderation dashboard: follows the state the server streams over SSE.
+// Rows of the report queue and ban list are kept by ID, so a form being
+// filled in isn't reset when others change.
+
+const canModerate = document.body.dataset.canModerate === 'true';
+
+// Create an element with a class and text
+function el(tag, className, text) {
+    const element = document.createElement(tag);
+    if (className) element.className = className;
+    if (text !== undefined) element.textContent = text;
+    return element;
+}
+
+// Create a form posting to the action, with the given inputs and submit button
+function postForm(action, fields, buttonText, buttonClass) {
+    const form = el('form', 'mod-form');
+    form.method = 'post';
+    form.action = action;
+    for (const field of fields) {
+        form.appendChild(field);
+    }
+    const button = el('button', `btn ${buttonClass}`, buttonText);
+    button.type = 'submit';
+    form.appendChild(button);
+    return form;
+}
+
+function textInput(name, placeholder, size) {
+    const input = el('input');
+    input.type = 'text';
+    input.name = name;
+    input.placeholder = placeholder;
+    if (size) input.size = size;
+    return input;
+}
+
+function reportRow(report) {
+    const tr = el('tr');
+    tr.dataset.id = report.id;
+    tr.appendChild(el('td', 'id', report.reported));
+    tr.appendChild(el('td', '', report.ip));
+    tr.appendChild(el('td', '', report.reason));
+    tr.appendChild(el('td', '', report.created));
+
+    const details = el('td', '', report.details);
+    if (report.snippet.length > 0) {
+        const snippet = el('details', 'mod-snippet');
+        snippet.appendChild(el('summary', '', `Last ${report.snippet.length} messages`));
+        for (const line of report.snippet) {
+            const div = el('div', 'line');
+            div.appendChild(el('span', line.author, line.author));
+            div.appendChild(document.createTextNode(` ${line.time}: ${line.text}`));
+            snippet.appendChild(div);
+        }
+        details.appendChild(snippet);
+    }
+    tr.appendChild(details);
+
+    if (canModerate) {
+        const ban = el('label');
+        const checkbox = el('input');
+        checkbox.type = 'checkbox';
+        checkbox.name = 'ban';
+        checkbox.value = 'true';
+        ban.appendChild(checkbox);
+        ban.appendChild(document.createTextNode(' ban'));
+
+        const cell = el('td');
+        cell.appendChild(postForm(`/mod/reports/${report.id}/resolve`,
+            [textInput('note', 'Note'), ban, textInput('duration', '24h', 5)], 'Resolve', 'btn-primary'));
+        tr.appendChild(cell);
+    }
+    return tr;
+}
+
+function banRow(ban) {
+    const tr = el('tr');
+    tr.dataset.id = ban.id;
+    tr.appendChild(el('td', 'id', ban.user));
+    tr.appendChild(el('td', '', ban.ip));
+    tr.appendChild(el('td', '', ban.reason));
+    tr.appendChild(el('td', '', ban.created));
+    tr.appendChild(el('td', '', ban.expires));
+    if (canModerate) {
+        const cell = el('td');
+        cell.appendChild(postForm(`/mod/bans/${ban.id}/remove`, [], 'Lift', 'btn-secondary'));
+        tr.appendChild(cell);
+    }
+    return tr;
+}
+
+function auditRow(entry) {
+    const tr = el('tr');
+    tr.appendChild(el('td', '', entry.time));
+    tr.appendChild(el('td', '', entry.actor));
+    tr.appendChild(el('td', '', entry.action));
+    tr.appendChild(el('td', 'id', entry.target));
+    tr.appendChild(el('td', '', entry.details));
+    return tr;
+}
+
+// Show an item per row, keeping the rows of items still present
+function syncRows(tbodyId, items, createRow, emptyText, columns) {
+    const tbody = document.getElementById(tbodyId);
+    if (!tbody) return;
+
+    const existing = new Map();
+    for (const tr of tbody.querySelectorAll('tr[data-id]')) {
+        existing.set(tr.dataset.id, tr);
+    }
+    const rows = items.map(item => existing.get(item.id) || createRow(item));
+    if (rows.length === 0) {
+        const tr = el('tr', 'empty-row');
+        const td = el('td', 'empty', emptyText);
+        td.colSpan = columns;
+        tr.appendChild(td);
+        rows.push(tr);
+    }
+    tbody.replaceChildren(...rows);
+}
+
+function updateCounters(stats) {
+    const values = {
+        clients: stats.clients,
+        pairs: stats.pairs,
+        waiting: stats.waiting,
+        openReports: stats.openReports,
+        bans: stats.bans,
+        matchingEnabled: stats.matchingEnabled ? 'on' : 'off',
+        nodes: stats.nodes.length
+    };
+    for (const [stat, value] of Object.entries(values)) {
+        const element = document.querySelector(`[data-stat="${stat}"]`);
+        if (element) element.textContent = value;
+    }
+
+    const matchingForm = document.getElementById('matchingForm');
+    if (matchingForm) {
+        matchingForm.querySelector('input[name="enabled"]').value = stats.matchingEnabled ? 'false' : 'true';
+        const button = matchingForm.querySelector('button');
+        button.textContent = stats.matchingEnabled ? 'Pause matching on this node' : 'Resume matching on this node';
+        button.className = stats.matchingEnabled ? 'btn btn-danger' : 'btn btn-primary';
+    }
+}
+
+function applyState(state) {
+    updateCounters(state.stats);
+    syncRows('reports', state.reports, reportRow, 'No open reports', 6);
+    syncRows('bans', state.bans, banRow, 'No bans', 6);
+
+    const audit = document.getElementById('audit');
+    if (audit) {
+        const rows = state.audit.map(auditRow);
+        if (rows.length === 0) {
+            const tr = el('tr', 'empty-row');
+            const td = el('td', 'empty', 'No actions yet');
+            td.colSpan = 5;
+            tr.appendChild(td);
+            rows.push(tr);
+        }
+        audit.replaceChildren(...rows);
+    }
+}
+
+function setFeedStatus(live) {
+    const status = document.getElementById('feedStatus');
+    if (!status) return;
+    status.textContent = live ? '● live' : '○ reconnecting...';
+    status.classList.toggle('live', live);
+}
+
+// EventSource reconnects by itself after errors
+const events = new EventSource('/mod/events');
+events.addEventListener('open', () => setFeedStatus(true));
+events.addEventListener('error', () => setFeedStatus(false));
+events.addEventListener('state', (event) => {
+    try {
+        applyState(JSON.parse(event.data));
+    } catch (error) {
+        console.error('❌ Error applying moderation state:', error);
+    }
+});